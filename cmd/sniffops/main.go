@@ -2,18 +2,40 @@ package main
 
 import (
 	"context"
+	"crypto/ed25519"
+	"encoding/json"
 	"fmt"
+	"net/url"
 	"os"
 	"os/signal"
+	"os/user"
+	"strings"
 	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/google/uuid"
+	"github.com/sniffops/sniffops/internal/k8s"
+	"github.com/sniffops/sniffops/internal/loop"
+	"github.com/sniffops/sniffops/internal/notify"
+	"github.com/sniffops/sniffops/internal/replay"
+	"github.com/sniffops/sniffops/internal/risk"
 	"github.com/sniffops/sniffops/internal/server"
+	"github.com/sniffops/sniffops/internal/tools"
+	"github.com/sniffops/sniffops/internal/trace"
 	"github.com/sniffops/sniffops/internal/web"
 )
 
 var (
 	version = "v0.1.0"
+
+	// traceDB is the trace database: a SQLite file path or a postgres:// DSN (empty = ~/.sniffops/traces.db)
+	traceDB string
+
+	// encryptionKey is the keyring file for trace payload encryption
+	// (empty = SNIFFOPS_ENCRYPTION_KEY or ~/.sniffops/encryption.key if present)
+	encryptionKey string
 )
 
 func main() {
@@ -24,30 +46,377 @@ func main() {
 		Version: version,
 	}
 
-	// serve 명령어 - MCP 서버 시작 (stdio)
+	rootCmd.PersistentFlags().StringVar(&traceDB, "db", os.Getenv("SNIFFOPS_DB"),
+		"Trace database: SQLite file path or postgres:// DSN (default: ~/.sniffops/traces.db; also SNIFFOPS_DB)")
+	rootCmd.PersistentFlags().StringVar(&encryptionKey, "encryption-key", "",
+		"Keyring file for encrypting trace output (default: $SNIFFOPS_ENCRYPTION_KEY or ~/.sniffops/encryption.key if present)")
+
+	// serve 명령어 - MCP 서버 시작 (stdio 또는 streamable HTTP)
+	var httpAddr string
+	var authTokens []string
+	var noAuth bool
+	var serveMetrics bool
+	var policyPath string
+	var enforce bool
+	var maxRisk string
+	var requireApproval bool
+	var approvalTimeout time.Duration
+	var serveRetentionPath string
+	var checkpointKey string
+	var checkpointEvery int
+	var otlpEndpoint string
+	var otlpHeaders []string
+	var notifyPath string
+	var pricingPath string
+	var budgetPath string
+	var loopsPath string
 	serveCmd := &cobra.Command{
 		Use:   "serve",
-		Short: "Start MCP server (stdio mode)",
-		Long:  "Start SniffOps MCP server. This command is called by Claude Code automatically.",
+		Short: "Start MCP server (stdio mode, or streamable HTTP with --http)",
+		Long:  "Start SniffOps MCP server. This command is called by Claude Code automatically. With --http, one instance serves many MCP clients over streamable HTTP.",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runServe()
+			if serveMetrics && httpAddr == "" {
+				return fmt.Errorf("--metrics requires --http (use sniffops web for /metrics with stdio)")
+			}
+			if token := os.Getenv("SNIFFOPS_AUTH_TOKEN"); token != "" {
+				authTokens = append(authTokens, token)
+			}
+			retention, err := trace.LoadRetentionPolicy(serveRetentionPath)
+			if err != nil {
+				return err
+			}
+			return runServe(httpAddr, &server.Config{
+				TraceDBPath:  traceDB, // 빈 문자열 = 기본 경로 (~/.sniffops/traces.db)
+				KeyringPath:  encryptionKey,
+				PolicyPath:   policyPath,
+				Enforce:      enforce,
+				MaxRiskLevel: maxRisk,
+
+				CheckpointKeyPath: checkpointKey,
+				CheckpointEvery:   checkpointEvery,
+
+				OTLPEndpoint: otlpEndpoint,
+				OTLPHeaders:  otlpHeaders,
+
+				NotifyPath: notifyPath,
+
+				PricingPath: pricingPath,
+				BudgetPath:  budgetPath,
+				LoopsPath:   loopsPath,
+
+				RequireApproval: requireApproval,
+				ApprovalTimeout: approvalTimeout,
+
+				Retention: retention,
+
+				AuthTokens: authTokens,
+				NoAuth:     noAuth,
+				Metrics:    serveMetrics,
+			})
 		},
 	}
 
+	serveCmd.Flags().StringVar(&httpAddr, "http", "", "Serve MCP over streamable HTTP on this address (e.g. :8080) instead of stdio")
+	serveCmd.Flags().StringArrayVar(&authTokens, "token", nil, "Bearer token accepted over HTTP, as TOKEN or NAME=TOKEN (repeatable; also SNIFFOPS_AUTH_TOKEN)")
+	serveCmd.Flags().BoolVar(&noAuth, "no-auth", false, "Allow HTTP clients without a bearer token (local testing only)")
+	serveCmd.Flags().BoolVar(&serveMetrics, "metrics", false, "With --http, also serve Prometheus metrics on /metrics (without authentication)")
+	serveCmd.Flags().StringVar(&policyPath, "policy", "", "Risk policy file (YAML or JSON, default: ~/.sniffops/policy.yaml if present)")
+	serveCmd.Flags().BoolVar(&enforce, "enforce", false, "Enforcement mode: block tool calls at or above the maximum risk level")
+	serveCmd.Flags().StringVar(&maxRisk, "max-risk", "", "Maximum allowed risk level in enforcement mode (low, medium, high, critical; implies --enforce)")
+	serveCmd.Flags().BoolVar(&requireApproval, "require-approval", false, "Ask a human before sniff_delete, sniff_exec and scale-to-zero")
+	serveCmd.Flags().DurationVar(&approvalTimeout, "approval-timeout", 5*time.Minute, "How long to wait for an approval before denying the call")
+	serveCmd.Flags().StringVar(&serveRetentionPath, "retention", "", "Trace retention policy file (default: ~/.sniffops/retention.yaml if present)")
+	serveCmd.Flags().StringVar(&checkpointKey, "checkpoint-key", "", "Key for signing hash chain checkpoints (default: ~/.sniffops/chain.key if present)")
+	serveCmd.Flags().IntVar(&checkpointEvery, "checkpoint-every", trace.DefaultCheckpointInterval, "Sign a hash chain checkpoint every N traces")
+	serveCmd.Flags().StringVar(&otlpEndpoint, "otlp-endpoint", defaultOTLPEndpoint(), "Also send traces as spans to this OTLP/HTTP collector, e.g. http://localhost:4318 (also OTEL_EXPORTER_OTLP_ENDPOINT)")
+	serveCmd.Flags().StringArrayVar(&otlpHeaders, "otlp-header", nil, "Header sent to the OTLP collector as KEY=VALUE (repeatable; also OTEL_EXPORTER_OTLP_HEADERS)")
+	serveCmd.Flags().StringVar(&notifyPath, "notify", "", "Webhook notification config file (default: ~/.sniffops/notify.yaml if present)")
+	serveCmd.Flags().StringVar(&budgetPath, "budget", "", "Tool call budgets per session, hour and day (default: ~/.sniffops/budget.yaml if present)")
+	serveCmd.Flags().StringVar(&loopsPath, "loops", "", "Agent loop detection config: thresholds and annotate, warn or block (default: ~/.sniffops/loops.yaml if present)")
+	serveCmd.Flags().StringVar(&pricingPath, "pricing", "", "Token pricing table per model (default: ~/.sniffops/pricing.yaml if present; without it only tokens are recorded)")
+
 	// web 명령어 - 웹 UI HTTP 서버 시작
 	var webPort int
+	var webRetentionPath string
+	var webLoopsPath string
 	webCmd := &cobra.Command{
 		Use:   "web",
 		Short: "Start web UI server",
 		Long:  "Start HTTP server to serve web-based trace viewer UI.",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runWeb(webPort)
+			retention, err := trace.LoadRetentionPolicy(webRetentionPath)
+			if err != nil {
+				return err
+			}
+			loops, err := loop.LoadConfig(webLoopsPath)
+			if err != nil {
+				return err
+			}
+			return runWeb(webPort, retention, loops)
 		},
 	}
 
 	webCmd.Flags().IntVarP(&webPort, "port", "p", 3000, "HTTP server port")
+	webCmd.Flags().StringVar(&webRetentionPath, "retention", "", "Trace retention policy file (default: ~/.sniffops/retention.yaml if present)")
+	webCmd.Flags().StringVar(&webLoopsPath, "loops", "", "Agent loop detection thresholds for session details (default: ~/.sniffops/loops.yaml if present)")
+
+	// approve 명령어 - 승인 대기 중인 작업 승인/거부
+	var deny bool
+	var approver, note string
+	approveCmd := &cobra.Command{
+		Use:   "approve [approval-id]",
+		Short: "Approve or deny a pending critical operation",
+		Long:  "Approve (or deny with --deny) a tool call waiting for human approval. Without an ID, lists pending approvals.",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return runListApprovals()
+			}
+			return runApprove(args[0], deny, approver, note)
+		},
+	}
+
+	approveCmd.Flags().BoolVar(&deny, "deny", false, "Deny the operation instead of approving it")
+	approveCmd.Flags().StringVar(&approver, "by", currentUser(), "Name recorded as the decision maker")
+	approveCmd.Flags().StringVar(&note, "note", "", "Optional note recorded with the decision")
+
+	// revert 명령어 - mutating trace를 이전 상태로 되돌리기
+	var force, dryRun bool
+	var revertPolicyPath string
+	revertCmd := &cobra.Command{
+		Use:   "revert <trace-id>",
+		Short: "Revert a sniff_apply, sniff_scale or sniff_delete call",
+		Long:  "Restore the state captured before a mutating tool call: re-apply the old spec, reset replicas, or re-create a deleted object. Refuses if the resource changed since the trace unless --force is given.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runRevert(cmd.Context(), tools.RevertInput{
+				TraceID: args[0],
+				Force:   force,
+				DryRun:  dryRun,
+			}, revertPolicyPath)
+		},
+	}
+
+	revertCmd.Flags().BoolVar(&force, "force", false, "Revert even if the resource changed since the trace")
+	revertCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Preview the revert with server-side dry run")
+	revertCmd.Flags().StringVar(&revertPolicyPath, "policy", "", "Risk policy file (default: ~/.sniffops/policy.yaml if present)")
+
+	// replay 명령어 - 기록된 세션의 Tool 호출을 serve와 같은 설정으로 다시 실행하고 결과 비교
+	var replaySession, replayContext, replayPolicyPath, replayMaxRisk string
+	var replayDryRun, replayJSON, replayEnforce, replayRequireApproval bool
+	var replayApprovalTimeout time.Duration
+	var replayOTLPEndpoint, replayNotifyPath, replayPricingPath, replayBudgetPath, replayLoopsPath string
+	var replayOTLPHeaders []string
+	replayCmd := &cobra.Command{
+		Use:   "replay --session <id>",
+		Short: "Re-run the tool calls of a recorded session and report divergences",
+		Long:  "Re-issue each recorded tool call of a session from its stored input, in order, through the same tool handlers, optionally against another kubeconfig context. Each call is compared with the original result. Mutating calls run with server-side dry run unless --dry-run=false is given; sniff_exec is skipped in dry run. Replayed calls go through the same enforcement, approval, budget, loop detection, webhook and OTLP settings as serve, so pass the flags serve runs with. Exits with an error if any call diverged.",
+		Args:  cobra.NoArgs,
+		// 결과 불일치는 사용법 오류가 아니므로 usage를 출력하지 않음
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runReplay(cmd.Context(), replaySession, &server.Config{
+				TraceDBPath:  traceDB,
+				KeyringPath:  encryptionKey,
+				PolicyPath:   replayPolicyPath,
+				KubeContext:  replayContext,
+				Enforce:      replayEnforce,
+				MaxRiskLevel: replayMaxRisk,
+
+				OTLPEndpoint: replayOTLPEndpoint,
+				OTLPHeaders:  replayOTLPHeaders,
+
+				NotifyPath: replayNotifyPath,
+
+				PricingPath: replayPricingPath,
+				BudgetPath:  replayBudgetPath,
+				LoopsPath:   replayLoopsPath,
+
+				RequireApproval: replayRequireApproval,
+				ApprovalTimeout: replayApprovalTimeout,
+			}, replayDryRun, replayJSON)
+		},
+	}
+
+	replayCmd.Flags().StringVar(&replaySession, "session", "", "ID of the session to replay (required)")
+	replayCmd.Flags().StringVar(&replayContext, "context", "", "Kubeconfig context to replay against (default: the current context)")
+	replayCmd.Flags().BoolVar(&replayDryRun, "dry-run", true, "Run mutating calls with server-side dry run (--dry-run=false lets them change the cluster)")
+	replayCmd.Flags().StringVar(&replayPolicyPath, "policy", "", "Risk policy file (default: ~/.sniffops/policy.yaml if present)")
+	replayCmd.Flags().BoolVar(&replayEnforce, "enforce", false, "Enforcement mode: block tool calls at or above the maximum risk level")
+	replayCmd.Flags().StringVar(&replayMaxRisk, "max-risk", "", "Maximum allowed risk level in enforcement mode (low, medium, high, critical; implies --enforce)")
+	replayCmd.Flags().BoolVar(&replayRequireApproval, "require-approval", false, "Ask a human before sniff_delete, sniff_exec and scale-to-zero")
+	replayCmd.Flags().DurationVar(&replayApprovalTimeout, "approval-timeout", 5*time.Minute, "How long to wait for an approval before denying the call")
+	replayCmd.Flags().StringVar(&replayOTLPEndpoint, "otlp-endpoint", defaultOTLPEndpoint(), "Also send traces as spans to this OTLP/HTTP collector (also OTEL_EXPORTER_OTLP_ENDPOINT)")
+	replayCmd.Flags().StringArrayVar(&replayOTLPHeaders, "otlp-header", nil, "Header sent to the OTLP collector as KEY=VALUE (repeatable; also OTEL_EXPORTER_OTLP_HEADERS)")
+	replayCmd.Flags().StringVar(&replayNotifyPath, "notify", "", "Webhook notification config file (default: ~/.sniffops/notify.yaml if present)")
+	replayCmd.Flags().StringVar(&replayBudgetPath, "budget", "", "Tool call budgets per session, hour and day (default: ~/.sniffops/budget.yaml if present)")
+	replayCmd.Flags().StringVar(&replayLoopsPath, "loops", "", "Agent loop detection config (default: ~/.sniffops/loops.yaml if present)")
+	replayCmd.Flags().StringVar(&replayPricingPath, "pricing", "", "Token pricing table per model (default: ~/.sniffops/pricing.yaml if present)")
+	replayCmd.Flags().BoolVar(&replayJSON, "json", false, "Print the divergence report as JSON")
+	_ = replayCmd.MarkFlagRequired("session")
+
+	// prune 명령어 - 보존 정책에 따라 오래된 trace 삭제
+	var pruneDryRun bool
+	var pruneRetentionPath, pruneMaxAge string
+	var pruneMaxRows int
+	var pruneKeep []string
+	pruneCmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Delete traces according to the retention policy",
+		Long:  "Delete traces older than their retention age or beyond the maximum row count, then VACUUM the database. Limits come from the retention policy file and can be overridden with flags.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			policy, err := trace.LoadRetentionPolicy(pruneRetentionPath)
+			if err != nil {
+				return err
+			}
+			if policy == nil {
+				policy = &trace.RetentionPolicy{}
+			}
+			if err := applyRetentionFlags(policy, cmd, pruneMaxAge, pruneMaxRows, pruneKeep); err != nil {
+				return err
+			}
+			return runPrune(policy, pruneDryRun)
+		},
+	}
+
+	pruneCmd.Flags().BoolVar(&pruneDryRun, "dry-run", false, "Only show what would be deleted")
+	pruneCmd.Flags().StringVar(&pruneRetentionPath, "retention", "", "Trace retention policy file (default: ~/.sniffops/retention.yaml if present)")
+	pruneCmd.Flags().StringVar(&pruneMaxAge, "max-age", "", "Delete traces older than this (e.g. 30d, 12h)")
+	pruneCmd.Flags().IntVar(&pruneMaxRows, "max-rows", 0, "Keep at most this many traces")
+	pruneCmd.Flags().StringArrayVar(&pruneKeep, "keep", nil, "Per-risk maximum age as LEVEL=AGE, e.g. critical=365d (repeatable)")
+
+	// export 명령어 - 필터에 맞는 trace를 ndjson/json/csv로 내보내기
+	var exportFormat, exportOutput, exportSince, exportUntil string
+	var exportFilter trace.ListFilter
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export traces as NDJSON, JSON or CSV",
+		Long:  "Stream every trace matching the filters, oldest first, to stdout or a file. Unlike the web UI and sniff_traces pages, there is no row limit unless --limit is given.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var err error
+			if exportFilter.StartTime, err = parseTimeFlag(exportSince); err != nil {
+				return fmt.Errorf("--since: %w", err)
+			}
+			if exportFilter.EndTime, err = parseTimeFlag(exportUntil); err != nil {
+				return fmt.Errorf("--until: %w", err)
+			}
+			return runExport(&exportFilter, exportFormat, exportOutput)
+		},
+	}
+
+	exportCmd.Flags().StringVarP(&exportFormat, "format", "f", trace.FormatNDJSON, "Output format: ndjson, json or csv")
+	exportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "Write to this file instead of stdout")
+	exportCmd.Flags().StringVar(&exportFilter.SessionID, "session", "", "Only traces of this session")
+	exportCmd.Flags().StringVar(&exportFilter.Tool, "tool", "", "Only traces of this tool (e.g. sniff_delete)")
+	exportCmd.Flags().StringVar(&exportFilter.Namespace, "namespace", "", "Only traces in this namespace")
+	exportCmd.Flags().StringVar(&exportFilter.RiskLevel, "risk", "", "Only traces with this risk level (low, medium, high, critical)")
+	exportCmd.Flags().StringVarP(&exportFilter.Query, "query", "q", "", "Only traces whose command, intent, output or error contain all these words")
+	exportCmd.Flags().StringVar(&exportSince, "since", "", "Only traces at or after this time (RFC 3339, YYYY-MM-DD, or an age such as 30d or 12h)")
+	exportCmd.Flags().StringVar(&exportUntil, "until", "", "Only traces at or before this time (same formats as --since)")
+	exportCmd.Flags().IntVar(&exportFilter.Limit, "limit", 0, "Export at most this many traces (0 = all)")
+	exportCmd.Flags().IntVar(&exportFilter.Offset, "offset", 0, "Skip this many matching traces")
+
+	// import 명령어 - 다른 머신의 export 파일이나 trace DB를 병합
+	var importSourceHost, importSourceUser string
+	importCmd := &cobra.Command{
+		Use:   "import <file>...",
+		Short: "Merge traces from NDJSON exports or other trace databases",
+		Long:  "Merge traces from 'sniffops export' NDJSON files (use - for stdin) or from other SQLite trace databases into the trace database. Traces that already exist are skipped, so importing the same file twice is safe. Imported traces are tagged with --source-host and --source-user, which default to this machine; set them when importing a teammate's file. Source databases are copied before reading and never modified.",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runImport(args, trace.ImportOptions{SourceHost: importSourceHost, SourceUser: importSourceUser})
+		},
+	}
 
-	rootCmd.AddCommand(serveCmd, webCmd)
+	hostname, _ := os.Hostname()
+	importCmd.Flags().StringVar(&importSourceHost, "source-host", hostname, "Host recorded on imported traces that don't have one yet")
+	importCmd.Flags().StringVar(&importSourceUser, "source-user", currentUser(), "User recorded on imported traces that don't have one yet")
+
+	// verify 명령어 - trace hash chain 무결성 검증
+	var verifyKeys []string
+	var verifyJSON bool
+	verifyCmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Verify the tamper-evident trace hash chain",
+		Long:  "Recompute the hash of every trace and check the links between them and the signed checkpoints. Exits with status 1 if a trace was modified, removed or reordered outside of retention pruning.",
+		Args:  cobra.NoArgs,
+		// 체인 손상은 사용법 오류가 아니므로 usage를 출력하지 않음
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runVerify(verifyKeys, verifyJSON)
+		},
+	}
+
+	verifyCmd.Flags().StringArrayVar(&verifyKeys, "key", nil, "Public (or private) key to check checkpoint signatures (repeatable; default: ~/.sniffops/chain.key if present)")
+	verifyCmd.Flags().BoolVar(&verifyJSON, "json", false, "Print the report as JSON")
+
+	// keygen 명령어 - 체크포인트 서명 키 또는 암호화 키 생성
+	var keygenPath string
+	var keygenEncryption bool
+	keygenCmd := &cobra.Command{
+		Use:   "keygen",
+		Short: "Create a key for signing hash chain checkpoints or encrypting traces",
+		Long:  "Create an Ed25519 key pair used by serve to sign hash chain checkpoints. The public key is written next to it with a .pub suffix; keep a copy elsewhere to verify the chain independently. With --encryption, add a new primary key to the trace encryption keyring instead (older keys are kept for reading; see sniffops rekey).",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if keygenEncryption {
+				return runEncryptionKeygen(keygenPath)
+			}
+			return runKeygen(keygenPath)
+		},
+	}
+
+	keygenCmd.Flags().StringVar(&keygenPath, "key", "", "Where to write the key (default: ~/.sniffops/chain.key, or ~/.sniffops/encryption.key with --encryption)")
+	keygenCmd.Flags().BoolVar(&keygenEncryption, "encryption", false, "Add a trace encryption key instead of a checkpoint signing key")
+
+	// rekey 명령어 - 암호화된 trace의 데이터 키를 새 primary 키로 다시 래핑
+	rekeyCmd := &cobra.Command{
+		Use:   "rekey",
+		Short: "Re-wrap encrypted traces with the primary encryption key",
+		Long:  "After adding a key with 'sniffops keygen --encryption', re-wrap the data key of every encrypted trace with the new primary key. Trace contents and the hash chain are unchanged. Once no trace needs an old key, it can be removed from the keyring.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runRekey()
+		},
+	}
+
+	// notify 명령어 - webhook 알림 테스트 및 전송 기록 조회
+	var notifyConfigPath, notifyWebhook, notifyTraceID string
+	var notifyLimit int
+	notifyCmd := &cobra.Command{
+		Use:   "notify",
+		Short: "Test webhook notifications and show the delivery log",
+		Long:  "Webhooks in ~/.sniffops/notify.yaml (or --config) are notified by serve about traces matching their rules. Use 'notify test' to send a sample trace and 'notify log' to see past deliveries.",
+	}
+	notifyCmd.PersistentFlags().StringVar(&notifyConfigPath, "config", "", "Webhook notification config file (default: ~/.sniffops/notify.yaml)")
+
+	notifyTestCmd := &cobra.Command{
+		Use:   "test",
+		Short: "Send a sample critical trace to every webhook (or one with --webhook)",
+		Long:  "Send a sample critical sniff_delete trace to the configured webhooks, ignoring their rules, and record the result in the delivery log.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runNotifyTest(notifyConfigPath, notifyWebhook)
+		},
+	}
+	notifyTestCmd.Flags().StringVar(&notifyWebhook, "webhook", "", "Only send to the webhook with this name")
+
+	notifyLogCmd := &cobra.Command{
+		Use:   "log",
+		Short: "Show recent webhook deliveries",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runNotifyLog(notifyTraceID, notifyLimit)
+		},
+	}
+	notifyLogCmd.Flags().StringVar(&notifyTraceID, "trace", "", "Only deliveries of this trace")
+	notifyLogCmd.Flags().IntVar(&notifyLimit, "limit", 20, "Show at most this many deliveries")
+
+	notifyCmd.AddCommand(notifyTestCmd, notifyLogCmd)
+
+	rootCmd.AddCommand(serveCmd, webCmd, approveCmd, revertCmd, replayCmd, pruneCmd, exportCmd, importCmd, verifyCmd, keygenCmd, rekeyCmd, notifyCmd)
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -55,8 +424,8 @@ func main() {
 	}
 }
 
-// runServe starts the MCP server (stdio transport)
-func runServe() error {
+// runServe starts the MCP server (stdio transport, or streamable HTTP if httpAddr is set)
+func runServe(httpAddr string, cfg *server.Config) error {
 	// Context with signal handling
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -71,19 +440,28 @@ func runServe() error {
 	}()
 
 	// 서버 초기화
-	cfg := &server.Config{
-		TraceDBPath: "", // 빈 문자열 = 기본 경로 (~/.sniffops/traces.db)
-	}
-
 	srv, err := server.New(cfg)
 	if err != nil {
 		return fmt.Errorf("failed to create server: %w", err)
 	}
 	defer srv.Close()
 
+	if httpAddr != "" {
+		fmt.Fprintln(os.Stderr, "SniffOps MCP server started (one session per MCP client)")
+		fmt.Fprintf(os.Stderr, "Trace database: %s\n", traceDBLabel())
+		printOTLPEndpoint(cfg)
+
+		// MCP 서버 실행 (blocking)
+		if err := srv.RunHTTP(ctx, httpAddr); err != nil {
+			return fmt.Errorf("server run failed: %w", err)
+		}
+		return nil
+	}
+
 	fmt.Fprintf(os.Stderr, "SniffOps MCP server started (session: %s)\n", srv.GetSessionID())
 	fmt.Fprintln(os.Stderr, "Registered tools: sniff_ping, sniff_get, sniff_logs")
-	fmt.Fprintln(os.Stderr, "Trace database: ~/.sniffops/traces.db")
+	fmt.Fprintf(os.Stderr, "Trace database: %s\n", traceDBLabel())
+	printOTLPEndpoint(cfg)
 	fmt.Fprintln(os.Stderr, "Listening on stdio...")
 
 	// MCP 서버 실행 (blocking)
@@ -94,8 +472,20 @@ func runServe() error {
 	return nil
 }
 
+// printOTLPEndpoint logs where spans are exported, hiding URL passwords
+func printOTLPEndpoint(cfg *server.Config) {
+	if cfg.OTLPEndpoint == "" {
+		return
+	}
+	endpoint := cfg.OTLPEndpoint
+	if u, err := url.Parse(endpoint); err == nil {
+		endpoint = u.Redacted()
+	}
+	fmt.Fprintf(os.Stderr, "Exporting spans to: %s\n", endpoint)
+}
+
 // runWeb starts the web UI HTTP server
-func runWeb(port int) error {
+func runWeb(port int, retention *trace.RetentionPolicy, loops *loop.Config) error {
 	// Context with signal handling
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -112,7 +502,10 @@ func runWeb(port int) error {
 	// Initialize web server
 	cfg := &web.Config{
 		Port:        port,
-		TraceDBPath: "", // Default path (~/.sniffops/traces.db)
+		TraceDBPath: traceDB, // Empty = default path (~/.sniffops/traces.db)
+		KeyringPath: encryptionKey,
+		Retention:   retention,
+		Loops:       loops,
 	}
 
 	srv, err := web.New(cfg)
@@ -128,3 +521,610 @@ func runWeb(port int) error {
 
 	return nil
 }
+
+// runListApprovals prints pending approval requests
+func runListApprovals() error {
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	approvals, err := store.ListApprovals(trace.ApprovalPending, 0)
+	if err != nil {
+		return err
+	}
+
+	if len(approvals) == 0 {
+		fmt.Println("No pending approvals.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tREQUESTED\tTOOL\tRISK\tCOMMAND")
+	for _, a := range approvals {
+		requested := time.UnixMilli(a.RequestedAt).Format(time.RFC3339)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", a.ID, requested, a.ToolName, a.RiskLevel, a.Command)
+	}
+	return w.Flush()
+}
+
+// runApprove approves or denies a pending approval request
+func runApprove(id string, deny bool, approver, note string) error {
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	status := trace.ApprovalApproved
+	if deny {
+		status = trace.ApprovalDenied
+	}
+
+	approval, err := store.DecideApproval(id, status, approver, note)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s %s: %s\n", approval.Status, approval.ID, approval.Command)
+	return nil
+}
+
+// runRevert reverts a mutating trace and prints the result
+func runRevert(ctx context.Context, input tools.RevertInput, policyPath string) error {
+	k8sClient, err := k8s.NewClient()
+	if err != nil {
+		return fmt.Errorf("failed to create K8s client: %w", err)
+	}
+
+	riskEvaluator, err := risk.LoadEvaluator(policyPath)
+	if err != nil {
+		return fmt.Errorf("failed to load risk policy: %w", err)
+	}
+
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	// CLI 실행마다 별도 세션으로 기록
+	sessionID := "cli-" + uuid.New().String()
+
+	output, err := tools.Revert(ctx, nil, k8sClient, store, riskEvaluator, nil, sessionID, input)
+	if err != nil {
+		return err
+	}
+
+	prefix := "Reverted"
+	if output.DryRun {
+		prefix = "Dry run: would revert"
+	}
+	fmt.Printf("%s trace %s (%s %s, revert trace: %s)\n", prefix, output.Reverted, output.Action, output.Resource, output.TraceID)
+	for _, change := range output.Diff {
+		fmt.Printf("  %s\n", change)
+	}
+
+	return nil
+}
+
+// runReplay re-runs the tool calls of a recorded session and prints the divergence report.
+// The calls go through a server built from the same config as serve, so they are
+// enforced, approved, budgeted, loop checked, notified and exported like live calls.
+func runReplay(ctx context.Context, sessionID string, cfg *server.Config, dryRun, asJSON bool) error {
+	srv, err := server.New(cfg)
+	if err != nil {
+		return err
+	}
+	defer srv.Close()
+
+	report, err := srv.Replay(ctx, sessionID, replay.Options{DryRun: dryRun})
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		printReplayReport(report)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if report.Diverged > 0 {
+		return fmt.Errorf("%d of %d replayed calls diverged", report.Diverged, report.Replayed)
+	}
+	return nil
+}
+
+// printReplayReport prints a replay report, one block per recorded call
+func printReplayReport(report *replay.Report) {
+	mode := "mutating calls in dry run"
+	if !report.DryRun {
+		mode = "mutating calls executed"
+	}
+	fmt.Printf("Replayed session %s against context %q (%s)\n", report.SessionID, report.Context, mode)
+	fmt.Printf("Replay traces: session %s\n\n", report.ReplaySessionID)
+
+	for i, step := range report.Steps {
+		fmt.Printf("%3d. %s: %s\n", i+1, step.Tool, step.Command)
+		switch {
+		case step.Skipped != "":
+			fmt.Printf("     skipped: %s\n", step.Skipped)
+		case len(step.Divergences) == 0:
+			fmt.Printf("     %s, same as the original%s\n", step.Result, dryRunNote(step))
+		default:
+			fmt.Printf("     %s → %s%s, diverged:\n", step.OriginalResult, step.Result, dryRunNote(step))
+			for _, divergence := range step.Divergences {
+				fmt.Printf("       %s\n", divergence)
+			}
+		}
+	}
+
+	fmt.Printf("\n%d of %d calls replayed, %d diverged, %d skipped\n",
+		report.Replayed, len(report.Steps), report.Diverged, report.Skipped)
+}
+
+// dryRunNote marks steps replayed with server-side dry run
+func dryRunNote(step *replay.Step) string {
+	if step.DryRun {
+		return " (dry run)"
+	}
+	return ""
+}
+
+// applyRetentionFlags overrides policy limits with the prune command flags
+func applyRetentionFlags(policy *trace.RetentionPolicy, cmd *cobra.Command, maxAge string, maxRows int, keep []string) error {
+	if maxAge != "" {
+		age, err := trace.ParseAge(maxAge)
+		if err != nil {
+			return fmt.Errorf("--max-age: %w", err)
+		}
+		policy.MaxAge = age
+	}
+
+	if cmd.Flags().Changed("max-rows") {
+		policy.MaxRows = maxRows
+	}
+
+	for _, value := range keep {
+		level, ageStr, found := strings.Cut(value, "=")
+		if !found {
+			return fmt.Errorf("--keep %q: expected LEVEL=AGE", value)
+		}
+		age, err := trace.ParseAge(ageStr)
+		if err != nil {
+			return fmt.Errorf("--keep %q: %w", value, err)
+		}
+		if policy.Risk == nil {
+			policy.Risk = make(map[string]trace.Age)
+		}
+		policy.Risk[level] = age
+	}
+
+	return policy.Validate()
+}
+
+// runPrune deletes traces according to the retention policy and prints a summary
+func runPrune(policy *trace.RetentionPolicy, dryRun bool) error {
+	if !policy.Enabled() {
+		return fmt.Errorf("no retention limits configured (use ~/.sniffops/retention.yaml, --max-age, --max-rows or --keep)")
+	}
+
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	result, err := store.Prune(policy, trace.PruneOptions{DryRun: dryRun, Source: "cli"})
+	if err != nil {
+		return err
+	}
+
+	verb := "Deleted"
+	if dryRun {
+		verb = "Would delete"
+	}
+	fmt.Printf("%s %d traces (%d by age, %d by row limit)\n", verb, result.Deleted, result.ByAge, result.ByRows)
+
+	if result.Deleted > 0 {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "RISK\tTRACES")
+		for _, level := range []string{"critical", "high", "medium", "low"} {
+			if n := result.ByRisk[level]; n > 0 {
+				fmt.Fprintf(w, "%s\t%d\n", level, n)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if result.Vacuumed {
+		fmt.Println("Database vacuumed.")
+	}
+	return nil
+}
+
+// runExport streams the traces matching filter to stdout or a file
+func runExport(filter *trace.ListFilter, format, outputPath string) error {
+	format, err := trace.ParseExportFormat(format)
+	if err != nil {
+		return err
+	}
+
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	out := os.Stdout
+	if outputPath != "" {
+		f, err := os.OpenFile(outputPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to create export file: %w", err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	n, err := trace.Export(out, store, filter, format)
+	if err != nil {
+		return fmt.Errorf("export failed after %d traces: %w", n, err)
+	}
+
+	if outputPath != "" {
+		if err := out.Close(); err != nil {
+			return fmt.Errorf("failed to write export file: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Exported %d traces to %s\n", n, outputPath)
+	}
+	return nil
+}
+
+// runImport merges each file into the trace database and prints a summary per file
+func runImport(paths []string, opts trace.ImportOptions) error {
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	for _, path := range paths {
+		result, err := importFile(store, path, opts)
+		if result != nil {
+			fmt.Printf("%s: %d imported, %d duplicates, %d unreadable, %d new sessions\n",
+				path, result.Imported, result.Duplicates, result.Unreadable, result.Sessions)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if result.Unreadable > 0 {
+			fmt.Fprintf(os.Stderr, "Warning: %d traces in %s are encrypted with a key missing from the keyring and were skipped\n", result.Unreadable, path)
+		}
+	}
+	return nil
+}
+
+// importFile imports one NDJSON export or SQLite trace database ("-" reads NDJSON from stdin)
+func importFile(store *trace.Store, path string, opts trace.ImportOptions) (*trace.ImportResult, error) {
+	if path == "-" {
+		return store.ImportNDJSON(os.Stdin, opts)
+	}
+
+	isDB, err := trace.IsSQLiteFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if isDB {
+		return store.ImportDatabase(path, opts)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return store.ImportNDJSON(f, opts)
+}
+
+// runNotifyTest sends a sample trace to the configured webhooks and prints each result
+func runNotifyTest(configPath, webhookName string) error {
+	if configPath == "" {
+		defaultPath, err := notify.DefaultConfigPath()
+		if err != nil {
+			return err
+		}
+		configPath = defaultPath
+	}
+	cfg, err := notify.LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	notifier := notify.New(store, cfg, store)
+	defer notifier.Close()
+
+	sample := &trace.Trace{
+		ID:             uuid.New().String(),
+		SessionID:      "notify-test",
+		Timestamp:      time.Now().UnixMilli(),
+		ToolName:       "sniff_delete",
+		Command:        "kubectl delete pod example -n default",
+		Namespace:      "default",
+		ResourceKind:   "pods",
+		TargetResource: "example",
+		RiskLevel:      string(risk.RiskCritical),
+		RiskReason:     "Sample trace sent by 'sniffops notify test'",
+		Result:         "success",
+	}
+
+	sent := 0
+	failed := 0
+	for _, wh := range cfg.Webhooks {
+		if webhookName != "" && wh.Name != webhookName {
+			continue
+		}
+		sent++
+		d := notifier.Deliver(wh, sample)
+		if d.Status == trace.DeliveryDelivered {
+			fmt.Printf("%s: delivered (HTTP %d, %d attempts)\n", wh.Name, d.StatusCode, d.Attempts)
+		} else {
+			failed++
+			fmt.Printf("%s: failed after %d attempts: %s\n", wh.Name, d.Attempts, d.Error)
+		}
+	}
+
+	if sent == 0 {
+		if webhookName != "" {
+			return fmt.Errorf("no webhook named %q in %s", webhookName, configPath)
+		}
+		return fmt.Errorf("no webhooks configured in %s", configPath)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d webhooks failed", failed, sent)
+	}
+	return nil
+}
+
+// runNotifyLog prints recent webhook deliveries, newest first
+func runNotifyLog(traceID string, limit int) error {
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	deliveries, err := store.ListDeliveries(traceID, limit)
+	if err != nil {
+		return err
+	}
+
+	if len(deliveries) == 0 {
+		fmt.Println("No webhook deliveries.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tWEBHOOK\tTRACE\tSTATUS\tATTEMPTS\tHTTP\tERROR")
+	for _, d := range deliveries {
+		created := time.UnixMilli(d.CreatedAt).Format(time.RFC3339)
+		code := "-"
+		if d.StatusCode != 0 {
+			code = fmt.Sprint(d.StatusCode)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", created, d.Webhook, d.TraceID, d.Status, d.Attempts, code, d.Error)
+	}
+	return w.Flush()
+}
+
+// parseTimeFlag parses an RFC 3339 time, a YYYY-MM-DD date (local time) or
+// an age relative to now ("30d", "12h"). Empty returns nil.
+func parseTimeFlag(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return &t, nil
+	}
+	if age, err := trace.ParseAge(value); err == nil {
+		t := time.Now().Add(-time.Duration(age))
+		return &t, nil
+	}
+	return nil, fmt.Errorf("invalid time %q (use RFC 3339, YYYY-MM-DD or an age such as 30d)", value)
+}
+
+// runVerify verifies the trace hash chain and prints the report
+func runVerify(keyPaths []string, asJSON bool) error {
+	if len(keyPaths) == 0 {
+		defaultPath, err := trace.DefaultChainKeyPath()
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(defaultPath); err == nil {
+			keyPaths = []string{defaultPath}
+		}
+	}
+
+	var keys []ed25519.PublicKey
+	for _, path := range keyPaths {
+		key, err := trace.LoadChainPublicKey(path)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	report, err := store.VerifyChain(trace.VerifyOptions{PublicKeys: keys})
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "Status:\t%s\n", report.Status)
+		fmt.Fprintf(w, "Verified traces:\t%d\n", report.Verified)
+		fmt.Fprintf(w, "Pruned traces:\t%d\n", report.Pruned)
+		if report.Unchained > 0 {
+			fmt.Fprintf(w, "Unchained traces:\t%d (written before the hash chain)\n", report.Unchained)
+		}
+		if report.HeadSeq > 0 {
+			fmt.Fprintf(w, "Head:\t#%d %s\n", report.HeadSeq, report.HeadHash)
+		}
+		fmt.Fprintf(w, "Checkpoints:\t%d (%d signature verified, %d unknown key)\n",
+			report.Checkpoints, report.SignedCheckpoints, report.UnverifiedCheckpoints)
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		if len(keys) == 0 && report.Checkpoints > 0 {
+			fmt.Println("No verification key given: checkpoint signatures were not checked (use --key).")
+		}
+	}
+
+	if report.Broken != nil {
+		if report.Broken.TraceID != "" {
+			return fmt.Errorf("hash chain broken at #%d (trace %s): %s", report.Broken.Seq, report.Broken.TraceID, report.Broken.Reason)
+		}
+		return fmt.Errorf("hash chain broken at #%d: %s", report.Broken.Seq, report.Broken.Reason)
+	}
+	return nil
+}
+
+// runKeygen creates a checkpoint signing key pair
+func runKeygen(path string) error {
+	if path == "" {
+		defaultPath, err := trace.DefaultChainKeyPath()
+		if err != nil {
+			return err
+		}
+		path = defaultPath
+	}
+
+	key, err := trace.GenerateChainKey(path)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Private key: %s\n", path)
+	fmt.Printf("Public key:  %s.pub\n", path)
+	fmt.Printf("Key ID:      %s\n", trace.ChainKeyID(key.Public().(ed25519.PublicKey)))
+	return nil
+}
+
+// runEncryptionKeygen adds a new primary key to the trace encryption keyring
+func runEncryptionKeygen(path string) error {
+	if path == "" {
+		path = encryptionKey
+	}
+	if path == "" {
+		defaultPath, err := trace.DefaultKeyringPath()
+		if err != nil {
+			return err
+		}
+		path = defaultPath
+	}
+
+	id, err := trace.GenerateEncryptionKey(path)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Added encryption key %s to %s\n", id, path)
+	fmt.Println("New traces are encrypted with it. Run 'sniffops rekey' to re-wrap traces encrypted with older keys.")
+	return nil
+}
+
+// runRekey re-wraps the data keys of encrypted traces with the primary key
+func runRekey() error {
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	result, err := store.Rekey()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Re-wrapped %d traces (%d already current)\n", result.Rekeyed, result.Current)
+	if result.Skipped > 0 {
+		return fmt.Errorf("%d traces need keys missing from the keyring: %s", result.Skipped, strings.Join(result.MissingKey, ", "))
+	}
+	return nil
+}
+
+// openStore opens the trace database with the configured encryption keys
+func openStore() (*trace.Store, error) {
+	keyring, err := trace.LoadKeyring(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := trace.NewStore(traceDB)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open trace store: %w", err)
+	}
+	store.SetKeyring(keyring)
+	return store, nil
+}
+
+// defaultOTLPEndpoint returns the span export URL from the standard OpenTelemetry
+// environment variables (the traces-specific one is used as is)
+func defaultOTLPEndpoint() string {
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); endpoint != "" {
+		return endpoint
+	}
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); endpoint != "" {
+		return strings.TrimRight(endpoint, "/") + "/v1/traces"
+	}
+	return ""
+}
+
+// traceDBLabel describes the trace database for log output, hiding DSN passwords
+func traceDBLabel() string {
+	if traceDB == "" {
+		return "~/.sniffops/traces.db"
+	}
+	if u, err := url.Parse(traceDB); err == nil && u.Scheme != "" {
+		return u.Redacted()
+	}
+	return traceDB
+}
+
+// currentUser returns the login name of the current OS user
+func currentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
@@ -0,0 +1,263 @@
+// Package approval implements the human approval workflow for critical operations.
+//
+// When the MCP client supports elicitation, the approval question is sent to the
+// client so the user can answer it inline. Otherwise the request is put into a
+// pending-approval queue (the approvals table of the trace database) where it
+// can be approved or denied from the web UI or with `sniffops approve <id>`.
+// Requests that are not decided within the timeout are denied.
+package approval
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sniffops/sniffops/internal/trace"
+)
+
+const (
+	// DefaultTimeout is how long a call waits for a decision before it is denied
+	DefaultTimeout = 5 * time.Minute
+
+	// DefaultPollInterval is how often the pending-approval queue is checked
+	DefaultPollInterval = time.Second
+)
+
+// Approval methods
+const (
+	MethodElicitation = "elicitation"
+	MethodQueue       = "queue"
+)
+
+// Config holds approval workflow settings
+type Config struct {
+	Timeout      time.Duration // Time to wait for a decision (default: 5m)
+	PollInterval time.Duration // Queue polling interval (default: 1s)
+}
+
+// Outcome is the result of an approval request
+type Outcome struct {
+	ApprovalID string        // Queue approval ID (empty for elicitation)
+	Method     string        // elicitation or queue
+	Status     string        // approved, denied or expired
+	DecidedBy  string        // Who made the decision
+	DecidedAt  time.Time     // When the decision was made
+	Wait       time.Duration // How long the call waited
+	Note       string        // Optional note from the decision maker
+}
+
+// Approved reports whether the operation may proceed
+func (o *Outcome) Approved() bool {
+	return o.Status == trace.ApprovalApproved
+}
+
+// Queue stores pending approval requests and their decisions; *trace.Store
+// implements it with the approvals table
+type Queue interface {
+	InsertApproval(approval *trace.Approval) error
+	GetApproval(id string) (*trace.Approval, error)
+	DecideApproval(id, status, decidedBy, note string) (*trace.Approval, error)
+}
+
+var _ Queue = (*trace.Store)(nil)
+
+// Manager coordinates approval requests
+type Manager struct {
+	queue        Queue
+	timeout      time.Duration
+	pollInterval time.Duration
+}
+
+// NewManager creates a new approval manager backed by the queue
+func NewManager(queue Queue, cfg Config) *Manager {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = DefaultPollInterval
+	}
+
+	return &Manager{
+		queue:        queue,
+		timeout:      cfg.Timeout,
+		pollInterval: cfg.PollInterval,
+	}
+}
+
+// Request asks a human to approve the operation described by tr and blocks
+// until a decision is made, the timeout expires or ctx is cancelled.
+//
+// session may be nil; elicitation is only used when the client advertised
+// support for it during initialization.
+func (m *Manager) Request(ctx context.Context, session *mcp.ServerSession, tr *trace.Trace) (*Outcome, error) {
+	start := time.Now()
+
+	if supportsElicitation(session) {
+		outcome, err := m.elicit(ctx, session, tr)
+		if err == nil {
+			outcome.Wait = time.Since(start)
+			return outcome, nil
+		}
+		// Client advertised elicitation but the request failed; use the queue instead
+		fmt.Fprintf(os.Stderr, "Warning: elicitation failed, falling back to approval queue: %v\n", err)
+	}
+
+	outcome, err := m.enqueue(ctx, tr)
+	if err != nil {
+		return nil, err
+	}
+	outcome.Wait = time.Since(start)
+
+	return outcome, nil
+}
+
+// elicit asks the MCP client to confirm the operation
+func (m *Manager) elicit(ctx context.Context, session *mcp.ServerSession, tr *trace.Trace) (*Outcome, error) {
+	elicitCtx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	// "approve" is not required: the SDK validates the content of decline and
+	// cancel results (which have none) against the schema too, and a missing
+	// answer counts as a denial anyway
+	result, err := session.Elicit(elicitCtx, &mcp.ElicitParams{
+		Message: describe(tr),
+		RequestedSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"approve": map[string]any{
+					"type":        "boolean",
+					"title":       "Approve",
+					"description": "Allow SniffOps to run this operation against the cluster",
+				},
+				"approver": map[string]any{
+					"type":        "string",
+					"title":       "Your name",
+					"description": "Recorded in the audit trail",
+				},
+			},
+		},
+	})
+
+	outcome := &Outcome{Method: MethodElicitation, DecidedAt: time.Now()}
+
+	if err != nil {
+		if errors.Is(elicitCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+			outcome.Status = trace.ApprovalExpired
+			outcome.DecidedBy = "sniffops"
+			outcome.Note = fmt.Sprintf("no response within %s", m.timeout)
+			return outcome, nil
+		}
+		return nil, err
+	}
+
+	outcome.DecidedBy = clientName(session)
+	if approver, ok := result.Content["approver"].(string); ok && approver != "" {
+		outcome.DecidedBy = approver
+	}
+
+	approve, _ := result.Content["approve"].(bool)
+	if result.Action == "accept" && approve {
+		outcome.Status = trace.ApprovalApproved
+	} else {
+		outcome.Status = trace.ApprovalDenied
+		outcome.Note = fmt.Sprintf("elicitation %s", result.Action)
+	}
+
+	return outcome, nil
+}
+
+// enqueue puts the request into the pending-approval queue and waits for a decision
+func (m *Manager) enqueue(ctx context.Context, tr *trace.Trace) (*Outcome, error) {
+	approval := &trace.Approval{
+		ID:             uuid.New().String(),
+		TraceID:        tr.ID,
+		SessionID:      tr.SessionID,
+		ToolName:       tr.ToolName,
+		Command:        tr.Command,
+		Namespace:      tr.Namespace,
+		ResourceKind:   tr.ResourceKind,
+		TargetResource: tr.TargetResource,
+		RiskLevel:      tr.RiskLevel,
+		RiskReason:     tr.RiskReason,
+		Status:         trace.ApprovalPending,
+		RequestedAt:    time.Now().UnixMilli(),
+	}
+
+	if err := m.queue.InsertApproval(approval); err != nil {
+		return nil, fmt.Errorf("failed to queue approval request: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Approval required for %q (approval id: %s). Run `sniffops approve %s` or use the web UI.\n",
+		tr.Command, approval.ID, approval.ID)
+
+	timeout := time.NewTimer(m.timeout)
+	defer timeout.Stop()
+	ticker := time.NewTicker(m.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return m.expire(approval.ID, "tool call cancelled")
+		case <-timeout.C:
+			return m.expire(approval.ID, fmt.Sprintf("no decision within %s", m.timeout))
+		case <-ticker.C:
+			current, err := m.queue.GetApproval(approval.ID)
+			if err != nil {
+				return nil, err
+			}
+			if current.Status != trace.ApprovalPending {
+				return queueOutcome(current), nil
+			}
+		}
+	}
+}
+
+// expire denies a pending request that was not decided in time
+func (m *Manager) expire(id, note string) (*Outcome, error) {
+	approval, err := m.queue.DecideApproval(id, trace.ApprovalExpired, "sniffops", note)
+	if err != nil && approval == nil {
+		return nil, err
+	}
+	// If a decision raced with the timeout, the stored decision wins
+	return queueOutcome(approval), nil
+}
+
+// queueOutcome converts a decided queue entry into an Outcome
+func queueOutcome(approval *trace.Approval) *Outcome {
+	return &Outcome{
+		ApprovalID: approval.ID,
+		Method:     MethodQueue,
+		Status:     approval.Status,
+		DecidedBy:  approval.DecidedBy,
+		DecidedAt:  time.UnixMilli(approval.DecidedAt),
+		Note:       approval.Note,
+	}
+}
+
+// describe builds the human-readable approval question
+func describe(tr *trace.Trace) string {
+	return fmt.Sprintf("SniffOps: an AI agent wants to run a %s-risk operation.\n\n%s\n\nReason: %s\n\nApprove?",
+		tr.RiskLevel, tr.Command, tr.RiskReason)
+}
+
+// supportsElicitation reports whether the client advertised elicitation support
+func supportsElicitation(session *mcp.ServerSession) bool {
+	if session == nil {
+		return false
+	}
+	params := session.InitializeParams()
+	return params != nil && params.Capabilities != nil && params.Capabilities.Elicitation != nil
+}
+
+// clientName returns an identifier for the MCP client of the session
+func clientName(session *mcp.ServerSession) string {
+	if params := session.InitializeParams(); params != nil && params.ClientInfo != nil && params.ClientInfo.Name != "" {
+		return "mcp-client:" + params.ClientInfo.Name
+	}
+	return "mcp-client"
+}
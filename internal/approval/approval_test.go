@@ -0,0 +1,199 @@
+package approval
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sniffops/sniffops/internal/trace"
+)
+
+func newStore(t *testing.T) *trace.Store {
+	t.Helper()
+	store, err := trace.NewStore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func criticalTrace() *trace.Trace {
+	return &trace.Trace{
+		ID:             "t1",
+		SessionID:      "s1",
+		ToolName:       "sniff_delete",
+		Command:        "kubectl delete namespace prod",
+		ResourceKind:   "Namespace",
+		TargetResource: "prod",
+		RiskLevel:      "critical",
+		RiskReason:     "deleting a namespace",
+	}
+}
+
+// connect returns the server side of a session with a client that answers
+// elicitation requests with handler
+func connect(t *testing.T, handler func(context.Context, *mcp.ElicitRequest) (*mcp.ElicitResult, error)) *mcp.ServerSession {
+	t.Helper()
+	ctx := context.Background()
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+
+	server := mcp.NewServer(&mcp.Implementation{Name: "sniffops", Version: "v0"}, nil)
+	ss, err := server.Connect(ctx, serverTransport, nil)
+	if err != nil {
+		t.Fatalf("server.Connect() error = %v", err)
+	}
+	client := mcp.NewClient(&mcp.Implementation{Name: "claude", Version: "v0"}, &mcp.ClientOptions{ElicitationHandler: handler})
+	cs, err := client.Connect(ctx, clientTransport, nil)
+	if err != nil {
+		t.Fatalf("client.Connect() error = %v", err)
+	}
+	t.Cleanup(func() { cs.Close() })
+	return ss
+}
+
+// decideWhenQueued decides the first pending approval as soon as it shows up
+func decideWhenQueued(t *testing.T, store *trace.Store, status string) {
+	go func() {
+		for i := 0; i < 200; i++ {
+			pending, err := store.ListApprovals(trace.ApprovalPending, 1)
+			if err == nil && len(pending) == 1 {
+				if _, err := store.DecideApproval(pending[0].ID, status, "alice", "checked"); err != nil {
+					t.Errorf("DecideApproval() error = %v", err)
+				}
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Error("approval was never queued")
+	}()
+}
+
+func TestElicitation(t *testing.T) {
+	tests := []struct {
+		name       string
+		result     *mcp.ElicitResult
+		wantStatus string
+		wantBy     string
+	}{
+		{
+			name:       "accept",
+			result:     &mcp.ElicitResult{Action: "accept", Content: map[string]any{"approve": true, "approver": "alice"}},
+			wantStatus: trace.ApprovalApproved,
+			wantBy:     "alice",
+		},
+		{
+			name:       "accept without approving",
+			result:     &mcp.ElicitResult{Action: "accept", Content: map[string]any{"approve": false}},
+			wantStatus: trace.ApprovalDenied,
+			wantBy:     "mcp-client:claude",
+		},
+		{
+			name:       "decline",
+			result:     &mcp.ElicitResult{Action: "decline"},
+			wantStatus: trace.ApprovalDenied,
+			wantBy:     "mcp-client:claude",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var question string
+			ss := connect(t, func(ctx context.Context, req *mcp.ElicitRequest) (*mcp.ElicitResult, error) {
+				question = req.Params.Message
+				return tt.result, nil
+			})
+			store := newStore(t)
+
+			outcome, err := NewManager(store, Config{}).Request(context.Background(), ss, criticalTrace())
+			if err != nil {
+				t.Fatalf("Request() error = %v", err)
+			}
+			if outcome.Method != MethodElicitation || outcome.Status != tt.wantStatus || outcome.DecidedBy != tt.wantBy {
+				t.Errorf("outcome = %+v", outcome)
+			}
+			if outcome.Approved() != (tt.wantStatus == trace.ApprovalApproved) {
+				t.Errorf("Approved() = %v", outcome.Approved())
+			}
+			if question != describe(criticalTrace()) {
+				t.Errorf("question = %q", question)
+			}
+
+			// Nothing is queued when the client answers
+			if pending, _ := store.ListApprovals("", 10); len(pending) != 0 {
+				t.Errorf("queued %d approvals", len(pending))
+			}
+		})
+	}
+}
+
+func TestElicitationTimeout(t *testing.T) {
+	ss := connect(t, func(ctx context.Context, req *mcp.ElicitRequest) (*mcp.ElicitResult, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	manager := NewManager(newStore(t), Config{Timeout: 50 * time.Millisecond})
+	outcome, err := manager.Request(context.Background(), ss, criticalTrace())
+	if err != nil {
+		t.Fatalf("Request() error = %v", err)
+	}
+	if outcome.Status != trace.ApprovalExpired || outcome.DecidedBy != "sniffops" {
+		t.Errorf("outcome = %+v", outcome)
+	}
+}
+
+func TestQueue(t *testing.T) {
+	for _, status := range []string{trace.ApprovalApproved, trace.ApprovalDenied} {
+		t.Run(status, func(t *testing.T) {
+			store := newStore(t)
+			manager := NewManager(store, Config{Timeout: 5 * time.Second, PollInterval: 10 * time.Millisecond})
+			decideWhenQueued(t, store, status)
+
+			// Without a session (or without elicitation support) the request is queued
+			outcome, err := manager.Request(context.Background(), nil, criticalTrace())
+			if err != nil {
+				t.Fatalf("Request() error = %v", err)
+			}
+			if outcome.Method != MethodQueue || outcome.Status != status || outcome.DecidedBy != "alice" || outcome.Note != "checked" {
+				t.Errorf("outcome = %+v", outcome)
+			}
+
+			approval, err := store.GetApproval(outcome.ApprovalID)
+			if err != nil {
+				t.Fatalf("GetApproval() error = %v", err)
+			}
+			if approval.TraceID != "t1" || approval.Command != "kubectl delete namespace prod" || approval.RiskLevel != "critical" {
+				t.Errorf("approval = %+v", approval)
+			}
+		})
+	}
+}
+
+func TestQueueTimeout(t *testing.T) {
+	store := newStore(t)
+	manager := NewManager(store, Config{Timeout: 50 * time.Millisecond, PollInterval: 10 * time.Millisecond})
+
+	outcome, err := manager.Request(context.Background(), nil, criticalTrace())
+	if err != nil {
+		t.Fatalf("Request() error = %v", err)
+	}
+	if outcome.Status != trace.ApprovalExpired || outcome.Approved() {
+		t.Errorf("outcome = %+v", outcome)
+	}
+
+	approval, err := store.GetApproval(outcome.ApprovalID)
+	if err != nil {
+		t.Fatalf("GetApproval() error = %v", err)
+	}
+	if approval.Status != trace.ApprovalExpired || approval.DecidedBy != "sniffops" {
+		t.Errorf("stored approval = %+v", approval)
+	}
+
+	// A late decision doesn't change the expired request
+	if _, err := store.DecideApproval(outcome.ApprovalID, trace.ApprovalApproved, "alice", ""); err == nil {
+		t.Error("DecideApproval() should fail on an expired request")
+	}
+}
@@ -0,0 +1,267 @@
+package budget
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sniffops/sniffops/internal/trace"
+)
+
+// newTestTracker returns a tracker whose clock is controlled by the returned pointer
+func newTestTracker(t *testing.T, config string) (*Tracker, *time.Time) {
+	t.Helper()
+	cfg, err := ParseConfig([]byte(config))
+	if err != nil {
+		t.Fatalf("ParseConfig() error = %v", err)
+	}
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	tracker := NewTracker(cfg)
+	tracker.now = func() time.Time { return now }
+	return tracker, &now
+}
+
+func testTrace(session, tool string, at time.Time) *trace.Trace {
+	return &trace.Trace{
+		ID:        uuid.New().String(),
+		SessionID: session,
+		Timestamp: at.UnixMilli(),
+		ToolName:  tool,
+		Command:   tool,
+		RiskLevel: "low",
+		Result:    "success",
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := ParseConfig([]byte("maxCallsPerSession: 10\nmaxCostPerDay: 2.5\n"))
+	if err != nil {
+		t.Fatalf("ParseConfig() error = %v", err)
+	}
+	if cfg.MaxCallsPerSession != 10 || cfg.MaxCostPerDay != 2.5 || !cfg.Enabled() {
+		t.Errorf("config = %+v", cfg)
+	}
+
+	empty, _ := ParseConfig([]byte("{}"))
+	if empty.Enabled() {
+		t.Error("a config without limits should not be enabled")
+	}
+	var none *Config
+	if none.Enabled() {
+		t.Error("a nil config should not be enabled")
+	}
+
+	for name, config := range map[string]string{
+		"negative limit": "maxTokensPerDay: -1",
+		"unknown field":  "maxCallsPerDay: 10",
+		"wrong type":     "maxCallsPerSession: many",
+	} {
+		if _, err := ParseConfig([]byte(config)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestCallsPerSession(t *testing.T) {
+	tracker, _ := newTestTracker(t, "maxCallsPerSession: 2")
+
+	for i := 0; i < 2; i++ {
+		if e := tracker.Allow(Call{SessionID: "a", Tool: "sniff_get"}); e != nil {
+			t.Fatalf("call %d refused: %v", i+1, e)
+		}
+	}
+	e := tracker.Allow(Call{SessionID: "a", Tool: "sniff_get"})
+	if e == nil || e.Budget != CallsPerSession || e.Used != 2 || !e.ResetAt.IsZero() {
+		t.Fatalf("Allow() = %+v, want the session budget exceeded", e)
+	}
+	if !strings.Contains(e.Error(), "2 of 2 tool calls allowed per session") {
+		t.Errorf("Error() = %q", e.Error())
+	}
+
+	// Other sessions have their own budget
+	if e := tracker.Allow(Call{SessionID: "b", Tool: "sniff_get"}); e != nil {
+		t.Errorf("another session was refused: %v", e)
+	}
+}
+
+func TestMutatingCallsPerHour(t *testing.T) {
+	tracker, now := newTestTracker(t, "maxMutatingCallsPerHour: 2")
+	start := *now
+
+	for _, call := range []Call{
+		{SessionID: "a", Tool: "sniff_delete"},
+		{SessionID: "a", Tool: "sniff_get"},                 // Not mutating
+		{SessionID: "a", Tool: "sniff_apply", DryRun: true}, // Dry runs don't count
+	} {
+		if e := tracker.Allow(call); e != nil {
+			t.Fatalf("Allow(%+v) = %v", call, e)
+		}
+	}
+	*now = start.Add(20 * time.Minute)
+	if e := tracker.Allow(Call{SessionID: "b", Tool: "sniff_scale"}); e != nil {
+		t.Fatalf("second mutating call refused: %v", e)
+	}
+
+	*now = start.Add(30 * time.Minute)
+	e := tracker.Allow(Call{SessionID: "c", Tool: "sniff_exec"})
+	if e == nil || e.Budget != MutatingCallsPerHour || e.Used != 2 {
+		t.Fatalf("Allow() = %+v, want the hourly budget exceeded", e)
+	}
+	if !e.ResetAt.Equal(start.Add(time.Hour)) {
+		t.Errorf("ResetAt = %v, want an hour after the first call", e.ResetAt)
+	}
+	if !strings.Contains(e.Error(), "retry after 2025-06-01T13:00:00Z") {
+		t.Errorf("Error() = %q", e.Error())
+	}
+
+	// Reads and dry runs are still allowed
+	if e := tracker.Allow(Call{SessionID: "c", Tool: "sniff_delete", DryRun: true}); e != nil {
+		t.Errorf("dry run refused: %v", e)
+	}
+
+	// Once the first call leaves the window, one more is allowed
+	*now = start.Add(time.Hour + time.Second)
+	if e := tracker.Allow(Call{SessionID: "c", Tool: "sniff_exec"}); e != nil {
+		t.Errorf("call refused after the window moved: %v", e)
+	}
+}
+
+func TestDailyUsage(t *testing.T) {
+	tracker, now := newTestTracker(t, "maxTokensPerDay: 1000\nmaxCostPerDay: 0.05")
+	start := *now
+
+	first := testTrace("a", "sniff_logs", start)
+	first.TokensInput, first.TokensOutput, first.CostEstimate = 100, 600, 0.01
+	tracker.Record(first)
+
+	*now = start.Add(time.Hour)
+	if e := tracker.Allow(Call{SessionID: "a", Tool: "sniff_get"}); e != nil {
+		t.Fatalf("call under budget refused: %v", e)
+	}
+	second := testTrace("a", "sniff_get", *now)
+	second.TokensInput, second.TokensOutput, second.CostEstimate = 50, 300, 0.01
+	tracker.Record(second)
+
+	// Refused calls don't use the budget
+	refused := testTrace("a", "sniff_get", *now)
+	refused.Result, refused.TokensInput = ResultExceeded, 5000
+	tracker.Record(refused)
+
+	e := tracker.Allow(Call{SessionID: "a", Tool: "sniff_get"})
+	if e == nil || e.Budget != TokensPerDay || e.Used != 1050 {
+		t.Fatalf("Allow() = %+v, want the token budget exceeded", e)
+	}
+	// Dropping the first call brings the usage under the limit
+	if !e.ResetAt.Equal(start.Add(24 * time.Hour)) {
+		t.Errorf("ResetAt = %v, want a day after the first call", e.ResetAt)
+	}
+
+	*now = start.Add(25 * time.Hour)
+	if e := tracker.Allow(Call{SessionID: "a", Tool: "sniff_get"}); e != nil {
+		t.Errorf("call refused after the day moved: %v", e)
+	}
+
+	// Cost
+	expensive := testTrace("b", "sniff_get", *now)
+	expensive.CostEstimate = 0.06
+	tracker.Record(expensive)
+	e = tracker.Allow(Call{SessionID: "b", Tool: "sniff_get"})
+	if e == nil || e.Budget != CostPerDay {
+		t.Fatalf("Allow() = %+v, want the cost budget exceeded", e)
+	}
+	if !strings.Contains(e.Error(), "$0.0600 of $0.05 estimated cost") {
+		t.Errorf("Error() = %q", e.Error())
+	}
+}
+
+func TestLoad(t *testing.T) {
+	store, err := trace.NewStore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	defer store.Close()
+
+	tracker, now := newTestTracker(t, "maxCallsPerSession: 3\nmaxMutatingCallsPerHour: 1\nmaxTokensPerDay: 500")
+
+	recent := testTrace("a", "sniff_delete", now.Add(-10*time.Minute))
+	recent.TokensInput = 300
+	earlier := testTrace("a", "sniff_apply", now.Add(-2*time.Hour))
+	earlier.TokensInput = 150
+	refused := testTrace("a", "sniff_get", now.Add(-time.Minute))
+	refused.Result = ResultExceeded
+	denied := testTrace("a", "sniff_scale", now.Add(-time.Minute))
+	denied.Result = "denied"
+	old := testTrace("a", "sniff_get", now.Add(-48*time.Hour))
+	old.TokensInput = 1000
+	for _, tr := range []*trace.Trace{recent, earlier, refused, denied, old} {
+		if err := store.Insert(tr); err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+	}
+
+	if err := tracker.Load(store); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	// The delete of the last hour uses the mutating budget
+	if e := tracker.Allow(Call{SessionID: "b", Tool: "sniff_scale"}); e == nil || e.Budget != MutatingCallsPerHour {
+		t.Errorf("Allow(sniff_scale) = %v, want the hourly budget exceeded", e)
+	}
+	// Two calls of session a in the last day (not the refused, denied or old ones)
+	if e := tracker.Allow(Call{SessionID: "a", Tool: "sniff_get"}); e != nil {
+		t.Errorf("third call of session a refused: %v", e)
+	}
+	if e := tracker.Allow(Call{SessionID: "a", Tool: "sniff_get"}); e == nil || e.Budget != CallsPerSession {
+		t.Errorf("fourth call of session a = %v, want the session budget exceeded", e)
+	}
+
+	// 450 tokens in the last day
+	more := testTrace("b", "sniff_get", *now)
+	more.TokensOutput = 50
+	tracker.Record(more)
+	if e := tracker.Allow(Call{SessionID: "c", Tool: "sniff_get"}); e == nil || e.Budget != TokensPerDay || e.Used != 500 {
+		t.Errorf("Allow() = %+v, want 500 tokens used", e)
+	}
+}
+
+func TestRefusedCallsGiveBackSlots(t *testing.T) {
+	tracker, now := newTestTracker(t, "maxCallsPerSession: 2\nmaxMutatingCallsPerHour: 1")
+
+	// A critical delete is allowed by the budgets, then blocked or denied
+	for _, result := range []string{"blocked", "denied"} {
+		if e := tracker.Allow(Call{SessionID: "a", Tool: "sniff_delete"}); e != nil {
+			t.Fatalf("%s: Allow() = %v", result, e)
+		}
+		refused := testTrace("a", "sniff_delete", *now)
+		refused.Result = result
+		tracker.Record(refused)
+	}
+
+	// Neither used up the session or the mutating budget
+	if e := tracker.Allow(Call{SessionID: "a", Tool: "sniff_scale"}); e != nil {
+		t.Fatalf("mutating call after refusals refused: %v", e)
+	}
+	tracker.Record(testTrace("a", "sniff_scale", *now))
+	if e := tracker.Allow(Call{SessionID: "a", Tool: "sniff_get"}); e != nil {
+		t.Fatalf("second call of the session refused: %v", e)
+	}
+	tracker.Record(testTrace("a", "sniff_get", *now))
+
+	// Calls that ran still count
+	if e := tracker.Allow(Call{SessionID: "a", Tool: "sniff_get"}); e == nil || e.Budget != CallsPerSession || e.Used != 2 {
+		t.Errorf("Allow() = %+v, want the session budget exceeded", e)
+	}
+	if e := tracker.Allow(Call{SessionID: "b", Tool: "sniff_apply"}); e == nil || e.Budget != MutatingCallsPerHour {
+		t.Errorf("Allow() = %+v, want the hourly budget exceeded", e)
+	}
+
+	// Calls refused before the budgets were checked don't give anything back
+	loopBlocked := testTrace("a", "sniff_scale", *now)
+	loopBlocked.Result = "loop_blocked"
+	tracker.Record(loopBlocked)
+	if e := tracker.Allow(Call{SessionID: "b", Tool: "sniff_apply"}); e == nil {
+		t.Error("a loop-blocked call freed a mutating slot")
+	}
+}
@@ -0,0 +1,81 @@
+package budget
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Config limits how much agents may do. A zero value disables the
+// corresponding limit.
+//
+// Example (~/.sniffops/budget.yaml):
+//
+//	maxCallsPerSession: 500        # tool calls of one MCP session
+//	maxMutatingCallsPerHour: 30    # sniff_apply, sniff_delete, sniff_scale, sniff_exec and sniff_revert
+//	maxTokensPerDay: 2000000       # estimated input and output tokens, all sessions
+//	maxCostPerDay: 20.00           # estimated cost in USD, all sessions
+//
+// Hours and days are rolling windows (the last 60 minutes and 24 hours).
+type Config struct {
+	MaxCallsPerSession      int     `json:"maxCallsPerSession,omitempty"`
+	MaxMutatingCallsPerHour int     `json:"maxMutatingCallsPerHour,omitempty"`
+	MaxTokensPerDay         int     `json:"maxTokensPerDay,omitempty"`
+	MaxCostPerDay           float64 `json:"maxCostPerDay,omitempty"`
+}
+
+// Enabled reports whether any limit is set
+func (c *Config) Enabled() bool {
+	return c != nil && (c.MaxCallsPerSession > 0 || c.MaxMutatingCallsPerHour > 0 || c.MaxTokensPerDay > 0 || c.MaxCostPerDay > 0)
+}
+
+// DefaultConfigPath returns the default budget config location (~/.sniffops/budget.yaml)
+func DefaultConfigPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".sniffops", "budget.yaml"), nil
+}
+
+// LoadConfig loads a budget config file.
+// If path is empty, the default path is used; a missing default file
+// returns nil (no budgets).
+func LoadConfig(path string) (*Config, error) {
+	if path == "" {
+		defaultPath, err := DefaultConfigPath()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(defaultPath); os.IsNotExist(err) {
+			return nil, nil
+		}
+		path = defaultPath
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read budget config %s: %w", path, err)
+	}
+
+	cfg, err := ParseConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid budget config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// ParseConfig parses and validates a YAML or JSON budget config
+func ParseConfig(data []byte) (*Config, error) {
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse budget config: %w", err)
+	}
+
+	if cfg.MaxCallsPerSession < 0 || cfg.MaxMutatingCallsPerHour < 0 || cfg.MaxTokensPerDay < 0 || cfg.MaxCostPerDay < 0 {
+		return nil, fmt.Errorf("limits must not be negative")
+	}
+	return cfg, nil
+}
@@ -0,0 +1,271 @@
+package budget
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sniffops/sniffops/internal/loop"
+	"github.com/sniffops/sniffops/internal/trace"
+)
+
+// Budget names, as reported in errors
+const (
+	CallsPerSession      = "calls_per_session"
+	MutatingCallsPerHour = "mutating_calls_per_hour"
+	TokensPerDay         = "tokens_per_day"
+	CostPerDay           = "cost_per_day"
+)
+
+// ResultExceeded is the result of the trace of a call refused by a budget.
+// These traces don't count against any budget.
+const ResultExceeded = "budget_exceeded"
+
+// Results of calls refused after the budgets allowed them (by enforcement
+// mode, or by an approver or the approval timeout). Their call slots are
+// given back, so refused calls don't use up the call budgets.
+const (
+	resultBlocked = "blocked"
+	resultDenied  = "denied"
+)
+
+// MutatingTools are the tools counted by maxMutatingCallsPerHour (dry runs excepted)
+var MutatingTools = map[string]bool{
+	"sniff_apply":  true,
+	"sniff_delete": true,
+	"sniff_scale":  true,
+	"sniff_exec":   true,
+	"sniff_revert": true,
+}
+
+// Budget windows
+const (
+	hour = time.Hour
+	day  = 24 * time.Hour
+)
+
+// Call is a tool call about to run
+type Call struct {
+	SessionID string
+	Tool      string
+	DryRun    bool
+}
+
+// mutating reports whether the call counts against maxMutatingCallsPerHour
+func (c Call) mutating() bool {
+	return MutatingTools[c.Tool] && !c.DryRun
+}
+
+// Exceeded describes the budget that refused a call
+type Exceeded struct {
+	Budget  string
+	Limit   float64
+	Used    float64
+	ResetAt time.Time // When calls are allowed again (zero for the per-session budget)
+}
+
+// Error explains which budget was hit, e.g. "budget exceeded: 30 of 30
+// mutating calls in the last hour (retry after 2025-01-02T15:04:05Z)"
+func (e *Exceeded) Error() string {
+	var usage string
+	switch e.Budget {
+	case CallsPerSession:
+		usage = fmt.Sprintf("%.0f of %.0f tool calls allowed per session", e.Used, e.Limit)
+	case MutatingCallsPerHour:
+		usage = fmt.Sprintf("%.0f of %.0f mutating calls in the last hour", e.Used, e.Limit)
+	case TokensPerDay:
+		usage = fmt.Sprintf("%.0f of %.0f estimated tokens in the last 24 hours", e.Used, e.Limit)
+	case CostPerDay:
+		usage = fmt.Sprintf("$%.4f of $%.2f estimated cost in the last 24 hours", e.Used, e.Limit)
+	default:
+		usage = fmt.Sprintf("%s: %v of %v", e.Budget, e.Used, e.Limit)
+	}
+
+	if e.ResetAt.IsZero() {
+		return fmt.Sprintf("budget exceeded: %s", usage)
+	}
+	return fmt.Sprintf("budget exceeded: %s (retry after %s)", usage, e.ResetAt.UTC().Format(time.RFC3339))
+}
+
+// Tracker enforces a budget config.
+//
+// Calls are counted when they are allowed, so concurrent calls can't
+// overshoot the call budgets, and given back by Record if risk enforcement
+// or approval refuses them afterwards; tokens and cost are only known once
+// a call is done, and are added by Record. Counts are kept in memory and seeded
+// from the trace store with Load, so hourly and daily budgets survive a
+// restart.
+type Tracker struct {
+	cfg Config
+	now func() time.Time
+
+	mu       sync.Mutex
+	sessions map[string]int // Calls per session
+	mutating []time.Time    // Mutating calls in the last hour, oldest first
+	usage    []usage        // Tokens and cost in the last 24 hours, oldest first
+}
+
+// usage is the tokens and cost of one call
+type usage struct {
+	at     time.Time
+	tokens int
+	cost   float64
+}
+
+// NewTracker creates a tracker for a budget config (nil disables all limits)
+func NewTracker(cfg *Config) *Tracker {
+	t := &Tracker{
+		now:      time.Now,
+		sessions: make(map[string]int),
+	}
+	if cfg != nil {
+		t.cfg = *cfg
+	}
+	return t
+}
+
+// Load counts the traces of the last 24 hours against the budgets
+func (t *Tracker) Load(backend trace.Backend) error {
+	since := t.now().Add(-day)
+	return backend.Each(&trace.ListFilter{StartTime: &since}, func(tr *trace.Trace) error {
+		if tr.Result == ResultExceeded {
+			return nil
+		}
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		at := time.UnixMilli(tr.Timestamp)
+		if !refused(tr.Result) {
+			t.sessions[tr.SessionID]++
+			if (Call{Tool: tr.ToolName, DryRun: tr.DryRun}).mutating() && at.After(t.now().Add(-hour)) {
+				t.mutating = append(t.mutating, at)
+			}
+		}
+		t.addUsage(at, tr)
+		return nil
+	})
+}
+
+// Allow checks a call against the budgets and counts it if it is allowed.
+// It returns the exceeded budget if the call must be refused.
+func (t *Tracker) Allow(call Call) *Exceeded {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	t.expire(now)
+
+	if max := t.cfg.MaxCallsPerSession; max > 0 && t.sessions[call.SessionID] >= max {
+		return &Exceeded{Budget: CallsPerSession, Limit: float64(max), Used: float64(t.sessions[call.SessionID])}
+	}
+
+	if max := t.cfg.MaxMutatingCallsPerHour; max > 0 && call.mutating() && len(t.mutating) >= max {
+		// Allowed again once enough of the oldest calls leave the window
+		resetAt := t.mutating[len(t.mutating)-max].Add(hour)
+		return &Exceeded{Budget: MutatingCallsPerHour, Limit: float64(max), Used: float64(len(t.mutating)), ResetAt: resetAt}
+	}
+
+	if max := t.cfg.MaxTokensPerDay; max > 0 {
+		if used := t.usedTokens(); used >= max {
+			resetAt := t.resetAt(func(u usage) float64 { return float64(u.tokens) }, float64(used), float64(max))
+			return &Exceeded{Budget: TokensPerDay, Limit: float64(max), Used: float64(used), ResetAt: resetAt}
+		}
+	}
+
+	if max := t.cfg.MaxCostPerDay; max > 0 {
+		if used := t.usedCost(); used >= max {
+			resetAt := t.resetAt(func(u usage) float64 { return u.cost }, used, max)
+			return &Exceeded{Budget: CostPerDay, Limit: max, Used: used, ResetAt: resetAt}
+		}
+	}
+
+	t.sessions[call.SessionID]++
+	if call.mutating() {
+		t.mutating = append(t.mutating, now)
+	}
+	return nil
+}
+
+// Record adds the estimated tokens and cost of a finished call. If risk
+// enforcement or approval refused the call, its call slots are given back.
+func (t *Tracker) Record(tr *trace.Trace) {
+	if tr.Result == ResultExceeded {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if tr.Result == resultBlocked || tr.Result == resultDenied {
+		t.release(Call{SessionID: tr.SessionID, Tool: tr.ToolName, DryRun: tr.DryRun})
+	}
+	t.addUsage(time.UnixMilli(tr.Timestamp), tr)
+}
+
+// release gives back the call slots taken by Allow (t.mu must be held).
+// The newest mutating call is dropped; with concurrent calls that may be
+// another call's, which only moves when one slot frees up by moments.
+func (t *Tracker) release(call Call) {
+	if t.sessions[call.SessionID] > 0 {
+		t.sessions[call.SessionID]--
+	}
+	if call.mutating() && len(t.mutating) > 0 {
+		t.mutating = t.mutating[:len(t.mutating)-1]
+	}
+}
+
+// refused reports whether a trace is of a call that was refused, and so
+// doesn't count against the call budgets
+func refused(result string) bool {
+	switch result {
+	case ResultExceeded, resultBlocked, resultDenied, loop.ResultBlocked:
+		return true
+	}
+	return false
+}
+
+// addUsage records the tokens and cost of a trace (t.mu must be held)
+func (t *Tracker) addUsage(at time.Time, tr *trace.Trace) {
+	if tokens := tr.TokensInput + tr.TokensOutput; tokens > 0 || tr.CostEstimate > 0 {
+		t.usage = append(t.usage, usage{at: at, tokens: tokens, cost: tr.CostEstimate})
+	}
+}
+
+// expire drops the calls that left their window (t.mu must be held)
+func (t *Tracker) expire(now time.Time) {
+	i := 0
+	for i < len(t.mutating) && !t.mutating[i].After(now.Add(-hour)) {
+		i++
+	}
+	t.mutating = t.mutating[i:]
+
+	i = 0
+	for i < len(t.usage) && !t.usage[i].at.After(now.Add(-day)) {
+		i++
+	}
+	t.usage = t.usage[i:]
+}
+
+func (t *Tracker) usedTokens() int {
+	var total int
+	for _, u := range t.usage {
+		total += u.tokens
+	}
+	return total
+}
+
+func (t *Tracker) usedCost() float64 {
+	var total float64
+	for _, u := range t.usage {
+		total += u.cost
+	}
+	return total
+}
+
+// resetAt returns when the usage in the daily window drops below the limit
+func (t *Tracker) resetAt(value func(usage) float64, used, limit float64) time.Time {
+	for _, u := range t.usage {
+		used -= value(u)
+		if used < limit {
+			return u.at.Add(day)
+		}
+	}
+	return t.now()
+}
@@ -28,6 +28,9 @@ import (
 	"sigs.k8s.io/yaml"
 )
 
+// InClusterContext is the context name reported when running with in-cluster config.
+const InClusterContext = "in-cluster"
+
 // Client wraps the Kubernetes dynamic client for flexible resource operations.
 type Client struct {
 	dynamicClient   dynamic.Interface
@@ -35,12 +38,20 @@ type Client struct {
 	restMapper      meta.RESTMapper
 	config          *rest.Config
 	clientset       *kubernetes.Clientset // For pod logs
+	contextName     string                // Kubeconfig context in use ("in-cluster" for in-cluster config)
 }
 
 // NewClient creates a new Kubernetes client.
 // It automatically detects in-cluster config or loads from kubeconfig.
 func NewClient() (*Client, error) {
-	config, err := loadKubeConfig()
+	return NewClientForContext("")
+}
+
+// NewClientForContext creates a Kubernetes client for a kubeconfig context.
+// An empty context name behaves like NewClient (in-cluster config, or the
+// kubeconfig's current context); otherwise the in-cluster config is not used.
+func NewClientForContext(contextName string) (*Client, error) {
+	config, contextName, err := loadKubeConfig(contextName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
 	}
@@ -74,18 +85,24 @@ func NewClient() (*Client, error) {
 		restMapper:      restMapper,
 		config:          config,
 		clientset:       clientset,
+		contextName:     contextName,
 	}, nil
 }
 
 // loadKubeConfig loads kubeconfig with the following precedence:
-// 1. In-cluster config (if running inside a pod)
+// 1. In-cluster config (if running inside a pod and no context is requested)
 // 2. KUBECONFIG environment variable
 // 3. ~/.kube/config (default location)
-func loadKubeConfig() (*rest.Config, error) {
+//
+// A non-empty contextName selects that kubeconfig context instead of the
+// current one.
+func loadKubeConfig(contextName string) (*rest.Config, string, error) {
 	// Try in-cluster config first
-	config, err := rest.InClusterConfig()
-	if err == nil {
-		return config, nil
+	if contextName == "" {
+		config, err := rest.InClusterConfig()
+		if err == nil {
+			return config, InClusterContext, nil
+		}
 	}
 
 	// Fall back to kubeconfig file
@@ -93,17 +110,37 @@ func loadKubeConfig() (*rest.Config, error) {
 	if kubeconfigPath == "" {
 		homeDir, err := os.UserHomeDir()
 		if err != nil {
-			return nil, fmt.Errorf("failed to get home directory: %w", err)
+			return nil, "", fmt.Errorf("failed to get home directory: %w", err)
 		}
 		kubeconfigPath = filepath.Join(homeDir, ".kube", "config")
 	}
 
-	config, err = clientcmd.BuildConfigFromFlags("", kubeconfigPath)
+	if contextName != "" {
+		raw, err := clientcmd.LoadFromFile(kubeconfigPath)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to load kubeconfig from %s: %w", kubeconfigPath, err)
+		}
+		if _, ok := raw.Contexts[contextName]; !ok {
+			return nil, "", fmt.Errorf("context %q not found in %s", contextName, kubeconfigPath)
+		}
+		config, err := clientcmd.NewNonInteractiveClientConfig(*raw, contextName, &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to load context %q from %s: %w", contextName, kubeconfigPath, err)
+		}
+		return config, contextName, nil
+	}
+
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load kubeconfig from %s: %w", kubeconfigPath, err)
+		return nil, "", fmt.Errorf("failed to load kubeconfig from %s: %w", kubeconfigPath, err)
+	}
+
+	// The context name is informational only (recorded in sessions)
+	if raw, err := clientcmd.LoadFromFile(kubeconfigPath); err == nil {
+		contextName = raw.CurrentContext
 	}
 
-	return config, nil
+	return config, contextName, nil
 }
 
 // GetResource retrieves a single Kubernetes resource by namespace, kind, and name.
@@ -315,6 +352,12 @@ func (c *Client) Config() *rest.Config {
 	return c.config
 }
 
+// ContextName returns the kubeconfig context in use, or InClusterContext
+// when running inside a pod. It is empty if the context could not be determined.
+func (c *Client) ContextName() string {
+	return c.contextName
+}
+
 // LogsRequest defines parameters for pod log retrieval
 type LogsRequest struct {
 	Namespace string
@@ -364,8 +407,10 @@ func (c *Client) Logs(ctx context.Context, req LogsRequest) (string, error) {
 	return string(logs), nil
 }
 
-// Apply applies a Kubernetes resource using server-side apply
-func (c *Client) Apply(ctx context.Context, manifest string) (*unstructured.Unstructured, error) {
+// ParseManifest parses a YAML or JSON manifest into an unstructured object.
+// It validates that kind and metadata.name are present, so callers can inspect
+// the target (e.g., for risk evaluation) before sending it to the API server.
+func ParseManifest(manifest string) (*unstructured.Unstructured, error) {
 	if manifest == "" {
 		return nil, fmt.Errorf("manifest cannot be empty")
 	}
@@ -379,18 +424,28 @@ func (c *Client) Apply(ctx context.Context, manifest string) (*unstructured.Unst
 		}
 	}
 
-	// Get GVK from object
-	gvk := obj.GroupVersionKind()
-	if gvk.Kind == "" {
+	if obj.GetKind() == "" {
 		return nil, fmt.Errorf("manifest must contain 'kind' field")
 	}
+	if obj.GetName() == "" {
+		return nil, fmt.Errorf("manifest must contain 'metadata.name' field")
+	}
+
+	return obj, nil
+}
+
+// Apply applies a Kubernetes resource using server-side apply.
+// If dryRun is true, the request is sent with DryRun=All: the API server runs
+// admission and validation and returns the resulting object without persisting it.
+func (c *Client) Apply(ctx context.Context, manifest string, dryRun bool) (*unstructured.Unstructured, error) {
+	obj, err := ParseManifest(manifest)
+	if err != nil {
+		return nil, err
+	}
 
-	// Get namespace from object (if specified)
+	gvk := obj.GroupVersionKind()
 	namespace := obj.GetNamespace()
 	name := obj.GetName()
-	if name == "" {
-		return nil, fmt.Errorf("manifest must contain 'metadata.name' field")
-	}
 
 	// Resolve GVR
 	mapping, err := c.restMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
@@ -418,6 +473,7 @@ func (c *Client) Apply(ctx context.Context, manifest string) (*unstructured.Unst
 	patchOptions := metav1.PatchOptions{
 		FieldManager: "sniffops",
 		Force:        boolPtr(true),
+		DryRun:       dryRunOption(dryRun),
 	}
 
 	data, err := obj.MarshalJSON()
@@ -434,8 +490,9 @@ func (c *Client) Apply(ctx context.Context, manifest string) (*unstructured.Unst
 	return result, nil
 }
 
-// Delete deletes a Kubernetes resource
-func (c *Client) Delete(ctx context.Context, namespace, kind, name string) error {
+// Delete deletes a Kubernetes resource.
+// If dryRun is true, the deletion is validated by the API server but not persisted.
+func (c *Client) Delete(ctx context.Context, namespace, kind, name string, dryRun bool) error {
 	if kind == "" {
 		return fmt.Errorf("kind is required")
 	}
@@ -465,7 +522,7 @@ func (c *Client) Delete(ctx context.Context, namespace, kind, name string) error
 	}
 
 	// Delete resource
-	deleteOptions := metav1.DeleteOptions{}
+	deleteOptions := metav1.DeleteOptions{DryRun: dryRunOption(dryRun)}
 	err = resource.Delete(ctx, name, deleteOptions)
 	if err != nil {
 		return fmt.Errorf("failed to delete resource namespace=%s kind=%s name=%s: %w",
@@ -475,8 +532,9 @@ func (c *Client) Delete(ctx context.Context, namespace, kind, name string) error
 	return nil
 }
 
-// Scale scales a Deployment or StatefulSet
-func (c *Client) Scale(ctx context.Context, namespace, kind, name string, replicas int32) (*unstructured.Unstructured, error) {
+// Scale scales a Deployment or StatefulSet.
+// If dryRun is true, the API server returns the scaled object without persisting it.
+func (c *Client) Scale(ctx context.Context, namespace, kind, name string, replicas int32, dryRun bool) (*unstructured.Unstructured, error) {
 	if kind == "" {
 		return nil, fmt.Errorf("kind is required")
 	}
@@ -513,7 +571,7 @@ func (c *Client) Scale(ctx context.Context, namespace, kind, name string, replic
 	}
 
 	// Update resource
-	result, err := resource.Update(ctx, obj, metav1.UpdateOptions{})
+	result, err := resource.Update(ctx, obj, metav1.UpdateOptions{DryRun: dryRunOption(dryRun)})
 	if err != nil {
 		return nil, fmt.Errorf("failed to scale resource namespace=%s kind=%s name=%s to replicas=%d: %w",
 			namespace, kind, name, replicas, err)
@@ -597,6 +655,14 @@ func (c *Client) Exec(ctx context.Context, req ExecRequest) (string, error) {
 	return output, nil
 }
 
+// dryRunOption returns the DryRun request option for server-side dry run
+func dryRunOption(dryRun bool) []string {
+	if dryRun {
+		return []string{metav1.DryRunAll}
+	}
+	return nil
+}
+
 // boolPtr returns a pointer to a bool value
 func boolPtr(b bool) *bool {
 	return &b
@@ -23,7 +23,7 @@ func TestLoadKubeConfig(t *testing.T) {
 		// Unset KUBECONFIG to force default path
 		os.Unsetenv("KUBECONFIG")
 
-		config, err := loadKubeConfig()
+		config, _, err := loadKubeConfig("")
 		
 		// If ~/.kube/config doesn't exist, we expect an error
 		homeDir, _ := os.UserHomeDir()
@@ -55,13 +55,52 @@ func TestLoadKubeConfig(t *testing.T) {
 		tmpPath := "/tmp/test-kubeconfig"
 		os.Setenv("KUBECONFIG", tmpPath)
 
-		_, err := loadKubeConfig()
+		_, _, err := loadKubeConfig("")
 		
 		// We expect an error since the file doesn't exist
 		if err == nil {
 			t.Error("Expected error when loading non-existent kubeconfig")
 		}
 	})
+
+	t.Run("SelectContext", func(t *testing.T) {
+		tmpPath := filepath.Join(t.TempDir(), "config")
+		kubeconfig := `apiVersion: v1
+kind: Config
+current-context: prod
+clusters:
+- name: prod
+  cluster: {server: "https://prod.example.com"}
+- name: staging
+  cluster: {server: "https://staging.example.com"}
+users:
+- name: dev
+  user: {token: abc}
+contexts:
+- name: prod
+  context: {cluster: prod, user: dev}
+- name: staging
+  context: {cluster: staging, user: dev}
+`
+		if err := os.WriteFile(tmpPath, []byte(kubeconfig), 0600); err != nil {
+			t.Fatalf("failed to write kubeconfig: %v", err)
+		}
+		os.Setenv("KUBECONFIG", tmpPath)
+
+		config, contextName, err := loadKubeConfig("")
+		if err != nil || contextName != "prod" || config.Host != "https://prod.example.com" {
+			t.Errorf("loadKubeConfig(\"\") = %v, %q, %v, want the current context", config, contextName, err)
+		}
+
+		config, contextName, err = loadKubeConfig("staging")
+		if err != nil || contextName != "staging" || config.Host != "https://staging.example.com" {
+			t.Errorf("loadKubeConfig(staging) = %v, %q, %v", config, contextName, err)
+		}
+
+		if _, _, err := loadKubeConfig("dev"); err == nil {
+			t.Error("Expected error for an unknown context")
+		}
+	})
 }
 
 // TestNewClient tests client initialization.
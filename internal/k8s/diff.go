@@ -0,0 +1,150 @@
+package k8s
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Field change operations
+const (
+	ChangeAdded    = "added"
+	ChangeRemoved  = "removed"
+	ChangeModified = "modified"
+)
+
+// FieldChange describes a single field-level difference between two objects
+type FieldChange struct {
+	Path string      `json:"path"`          // Dotted field path, e.g. spec.template.spec.containers[0].image
+	Op   string      `json:"op"`            // added, removed or modified
+	Old  interface{} `json:"old,omitempty"` // Value in the live object
+	New  interface{} `json:"new,omitempty"` // Value in the new object
+}
+
+// String returns a kubectl-diff-like one line description of the change
+func (c FieldChange) String() string {
+	switch c.Op {
+	case ChangeAdded:
+		return fmt.Sprintf("+ %s: %v", c.Path, c.New)
+	case ChangeRemoved:
+		return fmt.Sprintf("- %s: %v", c.Path, c.Old)
+	default:
+		return fmt.Sprintf("~ %s: %v -> %v", c.Path, c.Old, c.New)
+	}
+}
+
+// ignoredDiffPaths are server-managed fields that change on every write and
+// would only add noise to a diff
+var ignoredDiffPaths = map[string]bool{
+	"metadata.managedFields":     true,
+	"metadata.resourceVersion":   true,
+	"metadata.generation":        true,
+	"metadata.uid":               true,
+	"metadata.creationTimestamp": true,
+	"status":                     true,
+}
+
+// DiffObjects returns the field-level changes needed to turn live into updated.
+// live may be nil (the object doesn't exist yet), in which case every field of
+// updated is reported as added. Server-managed fields (managedFields,
+// resourceVersion, generation, uid, creationTimestamp) and status are ignored.
+// Changes are sorted by path.
+func DiffObjects(live, updated *unstructured.Unstructured) []FieldChange {
+	var oldObj, newObj map[string]interface{}
+	if live != nil {
+		oldObj = live.Object
+	}
+	if updated != nil {
+		newObj = updated.Object
+	}
+
+	var changes []FieldChange
+	diffMaps("", oldObj, newObj, &changes)
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+
+	return changes
+}
+
+// diffValues compares two values at path and appends the differences
+func diffValues(path string, oldVal, newVal interface{}, changes *[]FieldChange) {
+	if ignoredDiffPaths[path] {
+		return
+	}
+
+	oldMap, oldIsMap := oldVal.(map[string]interface{})
+	newMap, newIsMap := newVal.(map[string]interface{})
+	if oldIsMap && newIsMap {
+		diffMaps(path, oldMap, newMap, changes)
+		return
+	}
+
+	oldList, oldIsList := oldVal.([]interface{})
+	newList, newIsList := newVal.([]interface{})
+	if oldIsList && newIsList {
+		diffLists(path, oldList, newList, changes)
+		return
+	}
+
+	if !reflect.DeepEqual(oldVal, newVal) {
+		*changes = append(*changes, FieldChange{Path: path, Op: ChangeModified, Old: oldVal, New: newVal})
+	}
+}
+
+// diffMaps compares two objects key by key
+func diffMaps(path string, oldMap, newMap map[string]interface{}, changes *[]FieldChange) {
+	for key, oldVal := range oldMap {
+		childPath := joinPath(path, key)
+		if ignoredDiffPaths[childPath] {
+			continue
+		}
+		newVal, ok := newMap[key]
+		if !ok {
+			*changes = append(*changes, FieldChange{Path: childPath, Op: ChangeRemoved, Old: oldVal})
+			continue
+		}
+		diffValues(childPath, oldVal, newVal, changes)
+	}
+
+	for key, newVal := range newMap {
+		childPath := joinPath(path, key)
+		if ignoredDiffPaths[childPath] {
+			continue
+		}
+		if _, ok := oldMap[key]; !ok {
+			*changes = append(*changes, FieldChange{Path: childPath, Op: ChangeAdded, New: newVal})
+		}
+	}
+}
+
+// diffLists compares two lists element by element
+func diffLists(path string, oldList, newList []interface{}, changes *[]FieldChange) {
+	for i := 0; i < len(oldList) || i < len(newList); i++ {
+		childPath := fmt.Sprintf("%s[%d]", path, i)
+		switch {
+		case i >= len(newList):
+			*changes = append(*changes, FieldChange{Path: childPath, Op: ChangeRemoved, Old: oldList[i]})
+		case i >= len(oldList):
+			*changes = append(*changes, FieldChange{Path: childPath, Op: ChangeAdded, New: newList[i]})
+		default:
+			diffValues(childPath, oldList[i], newList[i], changes)
+		}
+	}
+}
+
+// joinPath appends a map key to a dotted field path
+func joinPath(path, key string) string {
+	if strings.ContainsAny(key, ".[]") {
+		// Keys like app.kubernetes.io/name would be ambiguous in dotted form
+		return path + "[" + key + "]"
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
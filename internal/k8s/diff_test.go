@@ -0,0 +1,90 @@
+package k8s
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestDiffObjects(t *testing.T) {
+	live := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]interface{}{
+			"name":            "web",
+			"resourceVersion": "100",
+			"labels": map[string]interface{}{
+				"app":                    "web",
+				"app.kubernetes.io/tier": "frontend",
+			},
+		},
+		"spec": map[string]interface{}{
+			"replicas": int64(2),
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{"name": "web", "image": "nginx:1.25"},
+					},
+				},
+			},
+		},
+		"status": map[string]interface{}{"readyReplicas": int64(2)},
+	}}
+
+	updated := live.DeepCopy()
+	unstructured.SetNestedField(updated.Object, "101", "metadata", "resourceVersion")
+	unstructured.SetNestedField(updated.Object, int64(3), "spec", "replicas")
+	unstructured.RemoveNestedField(updated.Object, "metadata", "labels", "app.kubernetes.io/tier")
+	unstructured.SetNestedField(updated.Object, "Recreate", "spec", "strategy", "type")
+	unstructured.SetNestedSlice(updated.Object, []interface{}{
+		map[string]interface{}{"name": "web", "image": "nginx:1.27"},
+		map[string]interface{}{"name": "sidecar", "image": "envoy"},
+	}, "spec", "template", "spec", "containers")
+	unstructured.SetNestedField(updated.Object, int64(0), "status", "readyReplicas")
+
+	changes := DiffObjects(live, updated)
+
+	want := []FieldChange{
+		{Path: "metadata.labels[app.kubernetes.io/tier]", Op: ChangeRemoved, Old: "frontend"},
+		{Path: "spec.replicas", Op: ChangeModified, Old: int64(2), New: int64(3)},
+		{Path: "spec.strategy", Op: ChangeAdded},
+		{Path: "spec.template.spec.containers[0].image", Op: ChangeModified, Old: "nginx:1.25", New: "nginx:1.27"},
+		{Path: "spec.template.spec.containers[1]", Op: ChangeAdded},
+	}
+
+	if len(changes) != len(want) {
+		t.Fatalf("DiffObjects() returned %d changes, want %d: %v", len(changes), len(want), changes)
+	}
+	for i, w := range want {
+		got := changes[i]
+		if got.Path != w.Path || got.Op != w.Op {
+			t.Errorf("change[%d] = %s %s, want %s %s", i, got.Op, got.Path, w.Op, w.Path)
+		}
+		if w.Op == ChangeModified && (got.Old != w.Old || got.New != w.New) {
+			t.Errorf("change[%d] = %v -> %v, want %v -> %v", i, got.Old, got.New, w.Old, w.New)
+		}
+	}
+}
+
+func TestDiffObjectsNewObject(t *testing.T) {
+	updated := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind": "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name": "settings",
+			"uid":  "1234",
+		},
+		"data": map[string]interface{}{"key": "value"},
+	}}
+
+	changes := DiffObjects(nil, updated)
+
+	// metadata.uid is server-managed and ignored
+	if len(changes) != 3 {
+		t.Fatalf("DiffObjects() returned %d changes, want 3: %v", len(changes), changes)
+	}
+	for _, c := range changes {
+		if c.Op != ChangeAdded {
+			t.Errorf("expected only added fields, got %s", c)
+		}
+	}
+}
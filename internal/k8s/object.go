@@ -0,0 +1,28 @@
+package k8s
+
+import "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+// serverManagedMetadata are metadata fields populated by the API server
+var serverManagedMetadata = []string{
+	"uid",
+	"resourceVersion",
+	"generation",
+	"creationTimestamp",
+	"deletionTimestamp",
+	"deletionGracePeriodSeconds",
+	"managedFields",
+	"selfLink",
+}
+
+// StripServerFields returns a copy of obj without server-managed metadata and
+// status, so it can be re-applied or re-created (e.g., to restore a snapshot).
+func StripServerFields(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	stripped := obj.DeepCopy()
+
+	for _, field := range serverManagedMetadata {
+		unstructured.RemoveNestedField(stripped.Object, "metadata", field)
+	}
+	unstructured.RemoveNestedField(stripped.Object, "status")
+
+	return stripped
+}
@@ -0,0 +1,44 @@
+package k8s
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestStripServerFields(t *testing.T) {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":              "settings",
+			"namespace":         "default",
+			"uid":               "1234",
+			"resourceVersion":   "42",
+			"creationTimestamp": "2024-01-01T00:00:00Z",
+			"managedFields":     []interface{}{map[string]interface{}{"manager": "kubectl"}},
+			"labels":            map[string]interface{}{"app": "web"},
+		},
+		"data":   map[string]interface{}{"key": "value"},
+		"status": map[string]interface{}{"phase": "Active"},
+	}}
+
+	stripped := StripServerFields(obj)
+
+	for _, field := range []string{"uid", "resourceVersion", "creationTimestamp", "managedFields"} {
+		if _, found, _ := unstructured.NestedFieldNoCopy(stripped.Object, "metadata", field); found {
+			t.Errorf("expected metadata.%s to be removed", field)
+		}
+	}
+	if _, found, _ := unstructured.NestedFieldNoCopy(stripped.Object, "status"); found {
+		t.Error("expected status to be removed")
+	}
+	if stripped.GetName() != "settings" || stripped.GetNamespace() != "default" || stripped.GetLabels()["app"] != "web" {
+		t.Errorf("expected user fields to be kept, got %v", stripped.Object["metadata"])
+	}
+
+	// The original object is not modified
+	if obj.GetResourceVersion() != "42" {
+		t.Error("expected original object to be unchanged")
+	}
+}
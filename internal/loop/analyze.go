@@ -0,0 +1,312 @@
+package loop
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sniffops/sniffops/internal/trace"
+)
+
+// Loop patterns
+const (
+	PatternRepeat     = "repeated_command"    // The same call many times in a row
+	PatternFlap       = "scale_flapping"      // Replicas switched back and forth between two values
+	PatternChurn      = "create_delete_churn" // One resource created and deleted again and again
+	PatternErrorStorm = "error_storm"         // Many failed calls in a short time
+)
+
+// Detection is one occurrence of a loop pattern in a session
+type Detection struct {
+	Pattern  string   `json:"pattern"`
+	Message  string   `json:"message"`
+	Resource string   `json:"resource,omitempty"` // kind/namespace/name, for resource patterns
+	Count    int      `json:"count"`              // Number of traces in the pattern
+	TraceIDs []string `json:"trace_ids"`          // Oldest first
+	FirstAt  int64    `json:"first_at"`           // Unix timestamp (ms)
+	LastAt   int64    `json:"last_at"`            // Unix timestamp (ms)
+}
+
+// last returns the ID of the newest trace of the detection
+func (d *Detection) last() string {
+	return d.TraceIDs[len(d.TraceIDs)-1]
+}
+
+// Analyze finds the loop patterns in the traces of a session (oldest first).
+// Each detection covers a maximal run, so a loop that goes on is reported
+// once, with all of its traces. Detections are ordered by their last trace.
+//
+// The traces can be full traces or compacted with Compact, but not a mix of
+// both: calls are compared by their input, which Compact replaces by a hash.
+func Analyze(traces []*trace.Trace, cfg *Config) []*Detection {
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+
+	// Calls refused because of a loop are not part of it
+	calls := make([]*trace.Trace, 0, len(traces))
+	for _, t := range traces {
+		if t.Result != ResultBlocked {
+			calls = append(calls, t)
+		}
+	}
+	traces = calls
+
+	var detections []*Detection
+	detections = append(detections, repeats(traces, cfg.Repeat)...)
+	detections = append(detections, flaps(traces, cfg.Flap)...)
+	detections = append(detections, churns(traces, cfg.Churn)...)
+	detections = append(detections, errorStorms(traces, cfg.ErrorStorm, time.Duration(cfg.ErrorStormWindow))...)
+
+	sort.SliceStable(detections, func(i, j int) bool {
+		return detections[i].LastAt < detections[j].LastAt
+	})
+	return detections
+}
+
+// newDetection builds a detection from its traces (oldest first)
+func newDetection(pattern, resource, message string, traces []*trace.Trace) *Detection {
+	d := &Detection{
+		Pattern:  pattern,
+		Message:  message,
+		Resource: resource,
+		Count:    len(traces),
+		FirstAt:  traces[0].Timestamp,
+		LastAt:   traces[len(traces)-1].Timestamp,
+	}
+	for _, t := range traces {
+		d.TraceIDs = append(d.TraceIDs, t.ID)
+	}
+	return d
+}
+
+// Compact returns a copy of a trace with only what Analyze needs. The input
+// is replaced by its hash, the output and after snapshot are dropped, and the
+// before snapshot is kept only as a marker: churn detection tells creates from
+// updates by it.
+func Compact(t *trace.Trace) *trace.Trace {
+	c := *t
+	c.Input = inputHash(t.Input)
+	c.Output, c.AfterSnapshot, c.Diff = "", "", ""
+	if t.BeforeSnapshot != "" {
+		c.BeforeSnapshot = "{}"
+	}
+	return &c
+}
+
+// inputHash returns the SHA-256 of a call's input ("" without input)
+func inputHash(input string) string {
+	if input == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(input))
+	return hex.EncodeToString(sum[:])
+}
+
+// callKey identifies identical calls: the same tool with the same input on the
+// same resource. The command alone doesn't tell calls apart (sniff_apply is
+// always "kubectl apply -f -"), but it is all that traces recorded before
+// inputs were stored have.
+func callKey(t *trace.Trace) string {
+	return strings.Join([]string{t.ToolName, t.Command, resourceKey(t), t.Input}, "\x00")
+}
+
+// resourceKey identifies the target resource of a trace as kind/namespace/name
+func resourceKey(t *trace.Trace) string {
+	if t.TargetResource == "" {
+		return ""
+	}
+	return strings.ToLower(t.ResourceKind) + "/" + t.Namespace + "/" + t.TargetResource
+}
+
+// repeats finds runs of at least n identical consecutive calls
+func repeats(traces []*trace.Trace, n int) []*Detection {
+	var detections []*Detection
+	for i := 0; i < len(traces); {
+		j := i + 1
+		for j < len(traces) && callKey(traces[j]) == callKey(traces[i]) {
+			j++
+		}
+		if run := traces[i:j]; len(run) >= n {
+			t := run[0]
+			message := fmt.Sprintf("%s was called %d times in a row with the same arguments: %s", t.ToolName, len(run), t.Command)
+			if failed := countResult(run, "failure"); failed > 0 {
+				message += fmt.Sprintf(" (%d failed)", failed)
+			}
+			detections = append(detections, newDetection(PatternRepeat, resourceKey(t), message, run))
+		}
+		i = j
+	}
+	return detections
+}
+
+// replicasPattern extracts the replica count from a sniff_scale command
+var replicasPattern = regexp.MustCompile(`--replicas=(\d+)`)
+
+// flaps finds runs of at least n scale calls on one resource that alternate
+// between two replica counts, e.g. 3, 0, 3, 0
+func flaps(traces []*trace.Trace, n int) []*Detection {
+	type scale struct {
+		trace    *trace.Trace
+		replicas int
+	}
+	byResource := make(map[string][]scale)
+	var order []string
+	for _, t := range traces {
+		if t.ToolName != "sniff_scale" || t.Result != "success" || t.DryRun {
+			continue
+		}
+		m := replicasPattern.FindStringSubmatch(t.Command)
+		if m == nil {
+			continue
+		}
+		replicas, _ := strconv.Atoi(m[1])
+		key := resourceKey(t)
+		if _, ok := byResource[key]; !ok {
+			order = append(order, key)
+		}
+		byResource[key] = append(byResource[key], scale{t, replicas})
+	}
+
+	var detections []*Detection
+	for _, key := range order {
+		scales := byResource[key]
+		for i := 0; i < len(scales); {
+			j := i + 1
+			for j < len(scales) && scales[j].replicas != scales[j-1].replicas &&
+				(j-i < 2 || scales[j].replicas == scales[j-2].replicas) {
+				j++
+			}
+			if j-i >= n {
+				run := make([]*trace.Trace, 0, j-i)
+				for _, s := range scales[i:j] {
+					run = append(run, s.trace)
+				}
+				message := fmt.Sprintf("%s was scaled back and forth between %d and %d replicas %d times",
+					key, scales[i].replicas, scales[i+1].replicas, j-i)
+				detections = append(detections, newDetection(PatternFlap, key, message, run))
+			}
+			// A run ends where the next one may start (its last two values)
+			if j-i >= 2 {
+				i = j - 1
+			} else {
+				i = j
+			}
+		}
+	}
+	return detections
+}
+
+// churns finds runs of at least n alternating creates and deletes of one resource
+func churns(traces []*trace.Trace, n int) []*Detection {
+	type event struct {
+		trace  *trace.Trace
+		create bool
+	}
+	byResource := make(map[string][]event)
+	var order []string
+	for _, t := range traces {
+		if t.Result != "success" || t.DryRun || t.TargetResource == "" {
+			continue
+		}
+		var create bool
+		switch {
+		case t.ToolName == "sniff_apply" && t.BeforeSnapshot == "":
+			create = true
+		case t.ToolName == "sniff_delete":
+			create = false
+		default:
+			continue
+		}
+		key := resourceKey(t)
+		if _, ok := byResource[key]; !ok {
+			order = append(order, key)
+		}
+		byResource[key] = append(byResource[key], event{t, create})
+	}
+
+	var detections []*Detection
+	for _, key := range order {
+		events := byResource[key]
+		for i := 0; i < len(events); {
+			j := i + 1
+			for j < len(events) && events[j].create != events[j-1].create {
+				j++
+			}
+			if j-i >= n {
+				run := make([]*trace.Trace, 0, j-i)
+				creates := 0
+				for _, e := range events[i:j] {
+					run = append(run, e.trace)
+					if e.create {
+						creates++
+					}
+				}
+				message := fmt.Sprintf("%s was created %d and deleted %d times", key, creates, j-i-creates)
+				detections = append(detections, newDetection(PatternChurn, key, message, run))
+			}
+			i = j
+		}
+	}
+	return detections
+}
+
+// errorStorms finds bursts of failed calls: each failure that has at least
+// n failures (itself included) within window before it belongs to a storm,
+// and overlapping bursts are merged
+func errorStorms(traces []*trace.Trace, n int, window time.Duration) []*Detection {
+	var failures []*trace.Trace
+	for _, t := range traces {
+		if t.Result == "failure" {
+			failures = append(failures, t)
+		}
+	}
+
+	var detections []*Detection
+	start, end := -1, -1 // Current storm, failures[start:end]
+	flush := func() {
+		if start >= 0 {
+			run := failures[start:end]
+			message := fmt.Sprintf("%d calls failed within %s", len(run),
+				time.Duration(run[len(run)-1].Timestamp-run[0].Timestamp)*time.Millisecond)
+			detections = append(detections, newDetection(PatternErrorStorm, "", message, run))
+		}
+		start, end = -1, -1
+	}
+
+	i := 0
+	for j, t := range failures {
+		for t.Timestamp-failures[i].Timestamp > window.Milliseconds() {
+			i++
+		}
+		if j-i+1 < n {
+			continue
+		}
+		if start >= 0 && i > end-1 {
+			// The burst doesn't overlap the current storm
+			flush()
+		}
+		if start < 0 {
+			start = i
+		}
+		end = j + 1
+	}
+	flush()
+	return detections
+}
+
+// countResult returns the number of traces with a result
+func countResult(traces []*trace.Trace, result string) int {
+	count := 0
+	for _, t := range traces {
+		if t.Result == result {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,140 @@
+package loop
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sniffops/sniffops/internal/trace"
+	"sigs.k8s.io/yaml"
+)
+
+// Actions taken when a tool call continues a loop
+const (
+	ActionAnnotate = "annotate" // Only record the pattern on the trace (the default)
+	ActionWarn     = "warn"     // Also add a warning to the tool result returned to the model
+	ActionBlock    = "block"    // Also refuse further calls of the session for the cooldown
+)
+
+// Defaults for unset config fields
+const (
+	DefaultRepeat          = 5
+	DefaultFlap            = 4
+	DefaultChurn           = 4
+	DefaultErrorStorm      = 5
+	DefaultErrorStormAfter = 2 * time.Minute
+	DefaultCooldown        = 5 * time.Minute
+)
+
+// Config sets the thresholds of the loop patterns and what to do about them.
+//
+// Example (~/.sniffops/loops.yaml):
+//
+//	action: warn          # annotate (default), warn or block
+//	repeat: 5             # identical consecutive calls
+//	flap: 4               # scale calls alternating between two replica counts
+//	churn: 4              # alternating creates and deletes of one resource
+//	errorStorm: 5         # failed calls ...
+//	errorStormWindow: 2m  # ... within this time
+//	cooldown: 5m          # how long block refuses calls after a loop
+//
+// A threshold below 2 is not allowed; unset fields use the defaults.
+type Config struct {
+	Action           string    `json:"action,omitempty"`
+	Repeat           int       `json:"repeat,omitempty"`
+	Flap             int       `json:"flap,omitempty"`
+	Churn            int       `json:"churn,omitempty"`
+	ErrorStorm       int       `json:"errorStorm,omitempty"`
+	ErrorStormWindow trace.Age `json:"errorStormWindow,omitempty"`
+	Cooldown         trace.Age `json:"cooldown,omitempty"`
+}
+
+// DefaultConfig returns the config used without a config file
+func DefaultConfig() *Config {
+	cfg := &Config{}
+	cfg.applyDefaults()
+	return cfg
+}
+
+func (c *Config) applyDefaults() {
+	if c.Action == "" {
+		c.Action = ActionAnnotate
+	}
+	if c.Repeat == 0 {
+		c.Repeat = DefaultRepeat
+	}
+	if c.Flap == 0 {
+		c.Flap = DefaultFlap
+	}
+	if c.Churn == 0 {
+		c.Churn = DefaultChurn
+	}
+	if c.ErrorStorm == 0 {
+		c.ErrorStorm = DefaultErrorStorm
+	}
+	if c.ErrorStormWindow == 0 {
+		c.ErrorStormWindow = trace.Age(DefaultErrorStormAfter)
+	}
+	if c.Cooldown == 0 {
+		c.Cooldown = trace.Age(DefaultCooldown)
+	}
+}
+
+// DefaultConfigPath returns the default loop config location (~/.sniffops/loops.yaml)
+func DefaultConfigPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".sniffops", "loops.yaml"), nil
+}
+
+// LoadConfig loads a loop config file.
+// If path is empty, the default path is used; a missing default file
+// returns DefaultConfig (loops are annotated only).
+func LoadConfig(path string) (*Config, error) {
+	if path == "" {
+		defaultPath, err := DefaultConfigPath()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(defaultPath); os.IsNotExist(err) {
+			return DefaultConfig(), nil
+		}
+		path = defaultPath
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read loop config %s: %w", path, err)
+	}
+
+	cfg, err := ParseConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid loop config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// ParseConfig parses and validates a YAML or JSON loop config
+func ParseConfig(data []byte) (*Config, error) {
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse loop config: %w", err)
+	}
+
+	switch cfg.Action {
+	case "", ActionAnnotate, ActionWarn, ActionBlock:
+	default:
+		return nil, fmt.Errorf("invalid action %q (expected annotate, warn or block)", cfg.Action)
+	}
+	for name, threshold := range map[string]int{"repeat": cfg.Repeat, "flap": cfg.Flap, "churn": cfg.Churn, "errorStorm": cfg.ErrorStorm} {
+		if threshold != 0 && threshold < 2 {
+			return nil, fmt.Errorf("%s must be at least 2", name)
+		}
+	}
+
+	cfg.applyDefaults()
+	return cfg, nil
+}
@@ -0,0 +1,153 @@
+package loop
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sniffops/sniffops/internal/trace"
+)
+
+// ResultBlocked is the result of the trace of a call refused because its
+// session was in a loop (action block). These traces are left out of the
+// analysis.
+const ResultBlocked = "loop_blocked"
+
+// Detector settings
+const (
+	historySize = 100            // Traces kept per session
+	sessionIdle = 24 * time.Hour // Sessions without calls for this long are forgotten
+)
+
+// Detector finds loops as tool calls happen.
+//
+// Observe runs Analyze over the recent traces of the call's session and
+// annotates the trace when it continues a loop. Depending on the action, the
+// detection is then queued as a warning for the next tool result of the
+// session (Warnings), or starts a cooldown during which the session's calls
+// are refused (Blocked).
+type Detector struct {
+	cfg *Config
+	now func() time.Time
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+// session is the loop state of one MCP session
+type session struct {
+	history      []*trace.Trace // Recent traces, oldest first (compacted, see Compact)
+	warnings     []string       // Not yet returned to the model (action warn)
+	blockedBy    *Detection     // Loop that started the cooldown (action block)
+	blockedUntil time.Time
+	lastSeen     time.Time
+}
+
+// NewDetector creates a detector (a nil config uses DefaultConfig)
+func NewDetector(cfg *Config) *Detector {
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	return &Detector{
+		cfg:      cfg,
+		now:      time.Now,
+		sessions: make(map[string]*session),
+	}
+}
+
+// Action returns the configured action (annotate, warn or block)
+func (d *Detector) Action() string {
+	return d.cfg.Action
+}
+
+// Observe adds a trace to its session's history and returns the loops it
+// continues. The patterns are recorded in the trace's Loop field, so Observe
+// must be called before the trace is saved.
+func (d *Detector) Observe(t *trace.Trace) []*Detection {
+	if t.Result == ResultBlocked {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := d.now()
+	d.forget(now)
+
+	s := d.sessions[t.SessionID]
+	if s == nil {
+		s = &session{}
+		d.sessions[t.SessionID] = s
+	}
+	s.lastSeen = now
+
+	// The analysis only needs the call and a hash of its input, not the (large) input and output
+	s.history = append(s.history, Compact(t))
+	if len(s.history) > historySize {
+		s.history = s.history[len(s.history)-historySize:]
+	}
+
+	var current []*Detection
+	var patterns []string
+	for _, detection := range Analyze(s.history, d.cfg) {
+		if detection.last() == t.ID {
+			current = append(current, detection)
+			patterns = append(patterns, detection.Pattern)
+		}
+	}
+	if len(current) == 0 {
+		return nil
+	}
+	t.Loop = strings.Join(patterns, ",")
+
+	switch d.cfg.Action {
+	case ActionWarn:
+		for _, detection := range current {
+			s.warnings = append(s.warnings, Warning(detection))
+		}
+	case ActionBlock:
+		s.blockedBy = current[0]
+		s.blockedUntil = now.Add(time.Duration(d.cfg.Cooldown))
+	}
+	return current
+}
+
+// Warnings returns and clears the warnings queued for a session (action warn)
+func (d *Detector) Warnings(sessionID string) []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := d.sessions[sessionID]
+	if s == nil {
+		return nil
+	}
+	warnings := s.warnings
+	s.warnings = nil
+	return warnings
+}
+
+// Blocked returns the loop that stops a session's calls and when the
+// cooldown ends, or nil if the session's calls are allowed (action block)
+func (d *Detector) Blocked(sessionID string) (*Detection, time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := d.sessions[sessionID]
+	if s == nil || s.blockedBy == nil || !d.now().Before(s.blockedUntil) {
+		return nil, time.Time{}
+	}
+	return s.blockedBy, s.blockedUntil
+}
+
+// forget drops the sessions idle for longer than sessionIdle (d.mu must be held)
+func (d *Detector) forget(now time.Time) {
+	for id, s := range d.sessions {
+		if now.Sub(s.lastSeen) > sessionIdle {
+			delete(d.sessions, id)
+		}
+	}
+}
+
+// Warning is the text added to a tool result about a loop
+func Warning(detection *Detection) string {
+	return fmt.Sprintf("SniffOps warning: possible agent loop (%s): %s. Stop and reconsider the approach instead of repeating it.",
+		detection.Pattern, detection.Message)
+}
@@ -0,0 +1,356 @@
+package loop
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sniffops/sniffops/internal/trace"
+)
+
+var start = time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// calls builds a session's traces, one second apart
+type calls struct {
+	traces []*trace.Trace
+}
+
+func (c *calls) add(tool, command, kind, name, result string) *trace.Trace {
+	t := &trace.Trace{
+		ID:             fmt.Sprintf("t%d", len(c.traces)+1),
+		SessionID:      "s",
+		Timestamp:      start.Add(time.Duration(len(c.traces)) * time.Second).UnixMilli(),
+		ToolName:       tool,
+		Command:        command,
+		Namespace:      "default",
+		ResourceKind:   kind,
+		TargetResource: name,
+		RiskLevel:      "low",
+		Result:         result,
+	}
+	c.traces = append(c.traces, t)
+	return t
+}
+
+// apply adds a sniff_apply of a manifest, recorded like the tool does: the
+// command is the same for every manifest, the manifest is in the input
+func (c *calls) apply(kind, name, manifest string) *trace.Trace {
+	t := c.add("sniff_apply", "kubectl apply -f -", kind, name, "success")
+	input, _ := json.Marshal(map[string]string{"manifest": manifest})
+	t.Input = string(input)
+	return t
+}
+
+func (c *calls) scale(replicas int) *trace.Trace {
+	return c.add("sniff_scale", fmt.Sprintf("kubectl scale deployment/web --replicas=%d -n default", replicas), "Deployment", "web", "success")
+}
+
+func patterns(detections []*Detection) []string {
+	var names []string
+	for _, d := range detections {
+		names = append(names, d.Pattern)
+	}
+	return names
+}
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := ParseConfig([]byte("action: block\nrepeat: 3\nerrorStormWindow: 30s\n"))
+	if err != nil {
+		t.Fatalf("ParseConfig() error = %v", err)
+	}
+	if cfg.Action != ActionBlock || cfg.Repeat != 3 || time.Duration(cfg.ErrorStormWindow) != 30*time.Second {
+		t.Errorf("config = %+v", cfg)
+	}
+	// Unset fields use the defaults
+	if cfg.Flap != DefaultFlap || time.Duration(cfg.Cooldown) != DefaultCooldown {
+		t.Errorf("defaults not applied: %+v", cfg)
+	}
+
+	for name, config := range map[string]string{
+		"unknown action": "action: kill",
+		"low threshold":  "repeat: 1",
+		"unknown field":  "repeats: 3",
+		"invalid window": "errorStormWindow: soon",
+		"wrong type":     "churn: often",
+		"negative":       "flap: -2",
+	} {
+		if _, err := ParseConfig([]byte(config)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestAnalyzeRepeat(t *testing.T) {
+	c := &calls{}
+	c.add("sniff_get", "kubectl get pods -n default", "Pod", "", "success")
+	for i := 0; i < 4; i++ {
+		c.add("sniff_logs", "kubectl logs api -n default", "Pod", "api", "failure")
+	}
+	c.add("sniff_get", "kubectl get pods -n default", "Pod", "", "success")
+
+	cfg := &Config{Repeat: 4}
+	cfg.applyDefaults()
+	detections := Analyze(c.traces, cfg)
+	if len(detections) != 1 || detections[0].Pattern != PatternRepeat {
+		t.Fatalf("Analyze() = %v, want one repeated command", patterns(detections))
+	}
+	d := detections[0]
+	if d.Count != 4 || d.TraceIDs[0] != "t2" || d.last() != "t5" || d.Resource != "pod/default/api" {
+		t.Errorf("detection = %+v", d)
+	}
+	if !strings.Contains(d.Message, "4 times in a row") || !strings.Contains(d.Message, "(4 failed)") {
+		t.Errorf("Message = %q", d.Message)
+	}
+
+	// Below the threshold
+	cfg.Repeat = 5
+	if detections := Analyze(c.traces, cfg); len(detections) != 0 {
+		t.Errorf("Analyze() = %v, want nothing below the threshold", patterns(detections))
+	}
+}
+
+func TestAnalyzeRepeatInput(t *testing.T) {
+	cfg := &Config{Repeat: 3}
+	cfg.applyDefaults()
+
+	// Iterative edits of one resource are not a loop
+	c := &calls{}
+	for i := 1; i <= 5; i++ {
+		c.apply("Deployment", "web", fmt.Sprintf("kind: Deployment\nmetadata:\n  name: web\nspec:\n  replicas: %d\n", i))
+	}
+	if detections := Analyze(c.traces, cfg); len(detections) != 0 {
+		t.Errorf("Analyze() = %v, want nothing for applies of different manifests", patterns(detections))
+	}
+
+	// The same manifest again and again is
+	c = &calls{}
+	for i := 0; i < 3; i++ {
+		c.apply("Deployment", "web", "kind: Deployment\nmetadata:\n  name: web\n")
+	}
+	detections := Analyze(c.traces, cfg)
+	if len(detections) != 1 || detections[0].Pattern != PatternRepeat || detections[0].Count != 3 {
+		t.Fatalf("Analyze() = %v, want the same manifest repeated", patterns(detections))
+	}
+
+	// Compacted traces compare the same way
+	var compacted []*trace.Trace
+	for _, tr := range c.traces {
+		compacted = append(compacted, Compact(tr))
+	}
+	if detections := Analyze(compacted, cfg); len(detections) != 1 {
+		t.Errorf("Analyze() = %v over compacted traces, want the repeat", patterns(detections))
+	}
+}
+
+func TestAnalyzeFlap(t *testing.T) {
+	c := &calls{}
+	c.scale(1)
+	c.scale(3) // 1 → 3 → 0 is not an alternation: the run starts at 3
+	c.scale(0)
+	c.scale(3)
+	c.scale(0)
+	c.add("sniff_get", "kubectl get deployment web -n default", "Deployment", "web", "success")
+	dry := c.scale(3) // Dry runs don't change anything
+	dry.DryRun = true
+
+	detections := Analyze(c.traces, DefaultConfig())
+	if len(detections) != 1 || detections[0].Pattern != PatternFlap {
+		t.Fatalf("Analyze() = %v, want scale flapping", patterns(detections))
+	}
+	d := detections[0]
+	if d.Count != 4 || d.TraceIDs[0] != "t2" || d.last() != "t5" || d.Resource != "deployment/default/web" {
+		t.Errorf("detection = %+v", d)
+	}
+	if !strings.Contains(d.Message, "between 3 and 0 replicas 4 times") {
+		t.Errorf("Message = %q", d.Message)
+	}
+}
+
+func TestAnalyzeChurn(t *testing.T) {
+	c := &calls{}
+	for i := 0; i < 2; i++ {
+		c.apply("Job", "migrate", "kind: Job\nmetadata:\n  name: migrate\n")
+		c.add("sniff_delete", "kubectl delete job migrate -n default", "Job", "migrate", "success")
+	}
+	// An update is not a create
+	update := c.apply("Job", "migrate", "kind: Job\nmetadata:\n  name: migrate\n")
+	update.BeforeSnapshot = `{"kind":"Job"}`
+
+	detections := Analyze(c.traces, DefaultConfig())
+	if len(detections) != 1 || detections[0].Pattern != PatternChurn {
+		t.Fatalf("Analyze() = %v, want create/delete churn", patterns(detections))
+	}
+	d := detections[0]
+	if d.Count != 4 || d.last() != "t4" || d.Message != "job/default/migrate was created 2 and deleted 2 times" {
+		t.Errorf("detection = %+v", d)
+	}
+}
+
+func TestAnalyzeErrorStorm(t *testing.T) {
+	c := &calls{}
+	for i := 0; i < 3; i++ {
+		c.add("sniff_get", fmt.Sprintf("kubectl get pod p%d -n default", i), "Pod", fmt.Sprintf("p%d", i), "failure")
+	}
+	c.add("sniff_get", "kubectl get pods -n default", "Pod", "", "success")
+	late := c.add("sniff_get", "kubectl get pod p3 -n default", "Pod", "p3", "failure")
+
+	cfg := &Config{ErrorStorm: 3, ErrorStormWindow: trace.Age(time.Minute)}
+	cfg.applyDefaults()
+	late.Timestamp = start.Add(10 * time.Minute).UnixMilli()
+
+	detections := Analyze(c.traces, cfg)
+	if len(detections) != 1 || detections[0].Pattern != PatternErrorStorm {
+		t.Fatalf("Analyze() = %v, want an error storm", patterns(detections))
+	}
+	if d := detections[0]; d.Count != 3 || d.last() != "t3" || d.Message != "3 calls failed within 2s" {
+		t.Errorf("detection = %+v", d)
+	}
+
+	// Failures within the window of each other merge into one storm
+	c.traces = c.traces[:4]
+	for i := 4; i < 7; i++ {
+		c.add("sniff_get", fmt.Sprintf("kubectl get pod p%d -n default", i), "Pod", fmt.Sprintf("p%d", i), "failure")
+	}
+	detections = Analyze(c.traces, cfg)
+	if len(detections) != 1 || detections[0].Count != 6 {
+		t.Errorf("Analyze() = %+v, want one storm of 6 failures", detections)
+	}
+}
+
+func TestAnalyzeSkipsBlocked(t *testing.T) {
+	c := &calls{}
+	for i := 0; i < 4; i++ {
+		c.add("sniff_delete", "kubectl delete pod api -n default", "Pod", "api", "success")
+		c.add("sniff_delete", "sniff_delete", "", "", ResultBlocked)
+	}
+
+	cfg := &Config{Repeat: 4}
+	cfg.applyDefaults()
+	detections := Analyze(c.traces, cfg)
+	if len(detections) != 1 || detections[0].Count != 4 {
+		t.Errorf("Analyze() = %+v, want the refused calls left out", detections)
+	}
+}
+
+func TestDetectorWarn(t *testing.T) {
+	cfg, _ := ParseConfig([]byte("action: warn\nrepeat: 3"))
+	detector := NewDetector(cfg)
+	c := &calls{}
+
+	for i := 0; i < 2; i++ {
+		if got := detector.Observe(c.add("sniff_get", "kubectl get pods -n default", "Pod", "", "success")); got != nil {
+			t.Fatalf("call %d: Observe() = %v", i+1, patterns(got))
+		}
+	}
+	third := c.add("sniff_get", "kubectl get pods -n default", "Pod", "", "success")
+	third.Output = strings.Repeat("x", 1000)
+	if got := detector.Observe(third); len(got) != 1 || got[0].Pattern != PatternRepeat {
+		t.Fatalf("Observe() = %v, want a repeated command", patterns(got))
+	}
+	if third.Loop != PatternRepeat {
+		t.Errorf("Loop = %q, want the trace annotated", third.Loop)
+	}
+
+	warnings := detector.Warnings("s")
+	if len(warnings) != 1 || !strings.HasPrefix(warnings[0], "SniffOps warning: possible agent loop (repeated_command)") {
+		t.Errorf("Warnings() = %q", warnings)
+	}
+	if warnings := detector.Warnings("s"); warnings != nil {
+		t.Errorf("Warnings() = %q after they were returned", warnings)
+	}
+	if d, _ := detector.Blocked("s"); d != nil {
+		t.Error("warn should not block the session")
+	}
+
+	// The loop goes on: the next call is annotated and warned about again
+	fourth := c.add("sniff_get", "kubectl get pods -n default", "Pod", "", "success")
+	detector.Observe(fourth)
+	if fourth.Loop != PatternRepeat || len(detector.Warnings("s")) != 1 {
+		t.Errorf("Loop = %q, want the continued loop annotated and warned about", fourth.Loop)
+	}
+
+	// The history doesn't keep outputs
+	if s := detector.sessions["s"]; s.history[2].Output != "" {
+		t.Error("history should not keep the output")
+	}
+}
+
+func TestDetectorBlockIterativeApplies(t *testing.T) {
+	cfg, _ := ParseConfig([]byte("action: block\nrepeat: 3"))
+	detector := NewDetector(cfg)
+	c := &calls{}
+
+	for i := 1; i <= 5; i++ {
+		manifest := fmt.Sprintf("kind: Deployment\nmetadata:\n  name: web\nspec:\n  replicas: %d\n", i)
+		if got := detector.Observe(c.apply("Deployment", "web", manifest)); got != nil {
+			t.Fatalf("apply %d: Observe() = %v, want different manifests not flagged", i, patterns(got))
+		}
+	}
+	if d, _ := detector.Blocked("s"); d != nil {
+		t.Errorf("Blocked() = %+v, want iterative edits allowed", d)
+	}
+
+	// The history keeps a hash of the input, not the manifest
+	if s := detector.sessions["s"]; strings.Contains(s.history[0].Input, "Deployment") || s.history[0].Input == "" {
+		t.Errorf("history input = %q, want a hash", s.history[0].Input)
+	}
+	// The call itself is saved with its input
+	if !strings.Contains(c.traces[0].Input, "Deployment") {
+		t.Errorf("Input = %q, want it left on the trace", c.traces[0].Input)
+	}
+}
+
+func TestDetectorBlock(t *testing.T) {
+	cfg, _ := ParseConfig([]byte("action: block\nrepeat: 2\ncooldown: 1m"))
+	detector := NewDetector(cfg)
+	now := start
+	detector.now = func() time.Time { return now }
+	c := &calls{}
+
+	detector.Observe(c.add("sniff_delete", "kubectl delete pod api -n default", "Pod", "api", "success"))
+	if d, _ := detector.Blocked("s"); d != nil {
+		t.Fatal("blocked before a loop")
+	}
+	detector.Observe(c.add("sniff_delete", "kubectl delete pod api -n default", "Pod", "api", "success"))
+
+	d, until := detector.Blocked("s")
+	if d == nil || d.Pattern != PatternRepeat || !until.Equal(start.Add(time.Minute)) {
+		t.Fatalf("Blocked() = %+v, %v", d, until)
+	}
+	if d, _ := detector.Blocked("other"); d != nil {
+		t.Error("another session was blocked")
+	}
+	if warnings := detector.Warnings("s"); warnings != nil {
+		t.Errorf("block should not queue warnings: %q", warnings)
+	}
+
+	// Refused calls are not observed
+	refused := &trace.Trace{ID: "r", SessionID: "s", ToolName: "sniff_delete", Result: ResultBlocked}
+	if got := detector.Observe(refused); got != nil || len(detector.sessions["s"].history) != 2 {
+		t.Error("a refused call was added to the history")
+	}
+
+	now = start.Add(time.Minute)
+	if d, _ := detector.Blocked("s"); d != nil {
+		t.Error("still blocked after the cooldown")
+	}
+}
+
+func TestDetectorForget(t *testing.T) {
+	detector := NewDetector(nil)
+	now := start
+	detector.now = func() time.Time { return now }
+
+	detector.Observe(&trace.Trace{ID: "a", SessionID: "old", ToolName: "sniff_get", Result: "success"})
+	now = start.Add(sessionIdle + time.Minute)
+	detector.Observe(&trace.Trace{ID: "b", SessionID: "new", ToolName: "sniff_get", Result: "success"})
+
+	if _, ok := detector.sessions["old"]; ok {
+		t.Error("idle session was not forgotten")
+	}
+	if detector.Action() != ActionAnnotate {
+		t.Errorf("Action() = %q, want the default", detector.Action())
+	}
+}
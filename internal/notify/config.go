@@ -0,0 +1,265 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/sniffops/sniffops/internal/risk"
+	"github.com/sniffops/sniffops/internal/trace"
+	"sigs.k8s.io/yaml"
+)
+
+// Webhook body formats
+const (
+	FormatJSON     = "json"     // Payload as JSON (the default)
+	FormatSlack    = "slack"    // Slack incoming webhook message ({"text": ...})
+	FormatTemplate = "template" // Webhook.Template rendered with Payload
+)
+
+// Webhook defaults
+const (
+	DefaultRetries = 3
+	DefaultTimeout = 10 * time.Second
+)
+
+// Config lists the webhooks notified about traces.
+//
+// Example (~/.sniffops/notify.yaml):
+//
+//	webhooks:
+//	  - name: prod-alerts
+//	    url: https://hooks.slack.com/services/T000/B000/XXXX
+//	    format: slack
+//	    rules:
+//	      - minRisk: high
+//	        namespaces: [production, "prod-*"]
+//	  - name: audit
+//	    url: https://audit.example.com/sniffops
+//	    secretEnv: SNIFFOPS_WEBHOOK_SECRET
+//	    rules:
+//	      - results: [failure, blocked, denied]
+//	  - name: pager
+//	    url: https://events.example.com/v2/enqueue
+//	    format: template
+//	    template: '{"summary": {{json .Summary}}, "severity": "critical"}'
+//	    rules:
+//	      - minRisk: critical
+//	        tools: [sniff_delete]
+//
+// A webhook is notified about a trace when any of its rules matches.
+type Config struct {
+	Webhooks []*Webhook `json:"webhooks"`
+}
+
+// Webhook is one notification target
+type Webhook struct {
+	Name        string            `json:"name"`
+	URL         string            `json:"url"`
+	Format      string            `json:"format,omitempty"`      // json, slack or template (default json)
+	Template    string            `json:"template,omitempty"`    // Go text/template rendered with Payload (format: template)
+	ContentType string            `json:"contentType,omitempty"` // Content-Type of template bodies (default application/json)
+	Headers     map[string]string `json:"headers,omitempty"`
+	// Secret signs the body with HMAC-SHA256 in the X-SniffOps-Signature header
+	Secret    string `json:"secret,omitempty"`
+	SecretEnv string `json:"secretEnv,omitempty"` // Environment variable holding the secret
+	// Retries after a failed attempt (default 3); 4xx responses other than 429 are not retried
+	Retries *int      `json:"retries,omitempty"`
+	Timeout trace.Age `json:"timeout,omitempty"` // Per attempt (default 10s)
+	Rules   []Rule    `json:"rules"`
+
+	tmpl *template.Template
+}
+
+// Rule selects the traces a webhook is notified about. Empty fields match
+// anything; all non-empty fields must match for the rule to fire.
+type Rule struct {
+	MinRisk    risk.RiskLevel `json:"minRisk,omitempty"`    // Risk level at or above, e.g. high
+	Namespaces []string       `json:"namespaces,omitempty"` // Glob patterns, e.g. prod-*
+	Tools      []string       `json:"tools,omitempty"`      // e.g. sniff_delete
+	Results    []string       `json:"results,omitempty"`    // success, failure, blocked or denied
+}
+
+// DefaultConfigPath returns the default notify config location (~/.sniffops/notify.yaml)
+func DefaultConfigPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".sniffops", "notify.yaml"), nil
+}
+
+// LoadConfig loads a notify config file.
+// If path is empty, the default path is used; a missing default file
+// returns nil (notifications disabled).
+func LoadConfig(path string) (*Config, error) {
+	if path == "" {
+		defaultPath, err := DefaultConfigPath()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(defaultPath); os.IsNotExist(err) {
+			return nil, nil
+		}
+		path = defaultPath
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read notify config %s: %w", path, err)
+	}
+
+	cfg, err := ParseConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid notify config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// ParseConfig parses and validates a YAML or JSON notify config
+func ParseConfig(data []byte) (*Config, error) {
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse notify config: %w", err)
+	}
+
+	names := make(map[string]bool)
+	for i, wh := range cfg.Webhooks {
+		if wh == nil {
+			return nil, fmt.Errorf("webhook %d is empty", i+1)
+		}
+		if wh.Name == "" {
+			wh.Name = fmt.Sprintf("webhook-%d", i+1)
+		}
+		if names[wh.Name] {
+			return nil, fmt.Errorf("duplicate webhook name %q", wh.Name)
+		}
+		names[wh.Name] = true
+
+		if err := wh.compile(); err != nil {
+			return nil, fmt.Errorf("webhook %s: %w", wh.Name, err)
+		}
+	}
+
+	return cfg, nil
+}
+
+// compile validates the webhook, applies defaults and parses its template
+func (wh *Webhook) compile() error {
+	u, err := url.Parse(wh.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid url %q: expected an http:// or https:// URL", wh.URL)
+	}
+
+	switch wh.Format {
+	case "":
+		wh.Format = FormatJSON
+	case FormatJSON, FormatSlack:
+	case FormatTemplate:
+		if wh.Template == "" {
+			return fmt.Errorf("format template requires a template")
+		}
+		tmpl, err := template.New(wh.Name).Funcs(templateFuncs).Parse(wh.Template)
+		if err != nil {
+			return fmt.Errorf("invalid template: %w", err)
+		}
+		wh.tmpl = tmpl
+	default:
+		return fmt.Errorf("invalid format %q (expected json, slack or template)", wh.Format)
+	}
+	if wh.ContentType == "" {
+		wh.ContentType = "application/json"
+	}
+
+	if wh.SecretEnv != "" {
+		if wh.Secret != "" {
+			return fmt.Errorf("secret and secretEnv are mutually exclusive")
+		}
+		wh.Secret = os.Getenv(wh.SecretEnv)
+		if wh.Secret == "" {
+			return fmt.Errorf("secretEnv %s is not set", wh.SecretEnv)
+		}
+	}
+
+	if wh.Retries == nil {
+		retries := DefaultRetries
+		wh.Retries = &retries
+	}
+	if *wh.Retries < 0 {
+		return fmt.Errorf("retries must not be negative")
+	}
+	if wh.Timeout <= 0 {
+		wh.Timeout = trace.Age(DefaultTimeout)
+	}
+
+	for i := range wh.Rules {
+		if err := wh.Rules[i].compile(); err != nil {
+			return fmt.Errorf("rule %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// compile validates the rule and normalizes its risk level
+func (r *Rule) compile() error {
+	if r.MinRisk != "" {
+		level, err := risk.ParseRiskLevel(string(r.MinRisk))
+		if err != nil {
+			return fmt.Errorf("minRisk: %w", err)
+		}
+		r.MinRisk = level
+	}
+	for _, pattern := range r.Namespaces {
+		if _, err := path.Match(pattern, ""); errors.Is(err, path.ErrBadPattern) {
+			return fmt.Errorf("invalid namespace pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+// Matches reports whether any of the webhook's rules matches the trace.
+// A webhook without rules matches every trace.
+func (wh *Webhook) Matches(t *trace.Trace) bool {
+	if len(wh.Rules) == 0 {
+		return true
+	}
+	for i := range wh.Rules {
+		if wh.Rules[i].matches(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) matches(t *trace.Trace) bool {
+	if r.MinRisk != "" && !risk.RiskLevel(t.RiskLevel).AtLeast(r.MinRisk) {
+		return false
+	}
+	if len(r.Namespaces) > 0 && !risk.MatchesAnyGlob(r.Namespaces, t.Namespace) {
+		return false
+	}
+	if len(r.Tools) > 0 && !risk.ContainsFold(r.Tools, t.ToolName) {
+		return false
+	}
+	if len(r.Results) > 0 && !risk.ContainsFold(r.Results, t.Result) {
+		return false
+	}
+	return true
+}
+
+// templateFuncs are available in webhook templates
+var templateFuncs = template.FuncMap{
+	// json encodes a value as JSON, e.g. {"text": {{json .Summary}}}
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"upper": strings.ToUpper,
+}
@@ -0,0 +1,373 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sniffops/sniffops/internal/trace"
+)
+
+// Request headers sent with every notification
+const (
+	SignatureHeader = "X-SniffOps-Signature" // sha256=<hex HMAC-SHA256 of the body> (if the webhook has a secret)
+	EventHeader     = "X-SniffOps-Event"
+	DeliveryHeader  = "X-SniffOps-Delivery" // Delivery ID, also the ID in the delivery log
+)
+
+// Notifier settings
+const (
+	notifyWorkers   = 4
+	notifyQueueSize = 256
+)
+
+// retryBackoff is the wait before the first retry, doubled for each further one
+var retryBackoff = time.Second
+
+// Payload is the body of json webhooks and the data of webhook templates
+type Payload struct {
+	Event   string       `json:"event"` // Always "trace"
+	Webhook string       `json:"webhook"`
+	Summary string       `json:"summary"` // One-line description of the call
+	Trace   *trace.Trace `json:"trace"`   // Without output and resource snapshots
+}
+
+// DeliveryLog records webhook deliveries (implemented by trace.Store)
+type DeliveryLog interface {
+	InsertDelivery(d *trace.WebhookDelivery) error
+}
+
+// Notifier sends webhook notifications about traces, in addition to saving
+// them in the wrapped backend.
+//
+// Matching traces are queued and delivered by background workers, so tool
+// calls never wait for a webhook. Failed attempts are retried with
+// exponential backoff, and the outcome of each notification is recorded in
+// the delivery log.
+type Notifier struct {
+	trace.Backend
+	webhooks []*Webhook
+	log      DeliveryLog
+	client   *http.Client
+
+	// omitEncrypted leaves the fields encrypted at rest out of notifications
+	omitEncrypted bool
+
+	mu     sync.Mutex
+	closed bool
+	queue  chan job
+	wg     sync.WaitGroup
+}
+
+// job is a trace waiting to be sent to one webhook
+type job struct {
+	webhook *Webhook
+	trace   *trace.Trace
+}
+
+// New starts a Notifier in front of backend. deliveries may be nil.
+func New(backend trace.Backend, cfg *Config, deliveries DeliveryLog) *Notifier {
+	n := &Notifier{
+		Backend: backend,
+		log:     deliveries,
+		client:  &http.Client{},
+		queue:   make(chan job, notifyQueueSize),
+	}
+	if cfg != nil {
+		n.webhooks = cfg.Webhooks
+	}
+
+	for i := 0; i < notifyWorkers; i++ {
+		n.wg.Add(1)
+		go func() {
+			defer n.wg.Done()
+			for j := range n.queue {
+				n.Deliver(j.webhook, j.trace)
+			}
+		}()
+	}
+	return n
+}
+
+// SetOmitEncrypted leaves the user intent and error message, which are
+// encrypted at rest, out of notifications, so that webhooks never get them
+// in plaintext. Call it when trace encryption is enabled, before the
+// notifier is used.
+func (n *Notifier) SetOmitEncrypted(omit bool) {
+	n.omitEncrypted = omit
+}
+
+// Insert saves a trace and notifies the matching webhooks
+func (n *Notifier) Insert(t *trace.Trace) error {
+	if t == nil {
+		return n.Backend.Insert(t)
+	}
+
+	// Copied before the backend sees it, since the store fills in the hash
+	// chain fields of the caller's trace from its writer goroutine
+	c := *t
+	if err := n.Backend.Insert(t); err != nil {
+		return err
+	}
+	n.Notify(&c)
+	return nil
+}
+
+// InsertBatch saves several traces and notifies the matching webhooks
+func (n *Notifier) InsertBatch(traces []*trace.Trace) error {
+	copies := make([]trace.Trace, 0, len(traces))
+	for _, t := range traces {
+		if t != nil {
+			copies = append(copies, *t)
+		}
+	}
+	if err := n.Backend.InsertBatch(traces); err != nil {
+		return err
+	}
+	for i := range copies {
+		n.Notify(&copies[i])
+	}
+	return nil
+}
+
+// Notify queues a notification to every webhook whose rules match the trace
+func (n *Notifier) Notify(t *trace.Trace) {
+	for _, wh := range n.webhooks {
+		if !wh.Matches(t) {
+			continue
+		}
+
+		// A copy per job, so that the caller can keep using its trace
+		c := *t
+		if !n.enqueue(job{webhook: wh, trace: &c}) {
+			log.Printf("Warning: webhook %s: notification queue full, dropping trace %s", wh.Name, t.ID)
+			n.record(&trace.WebhookDelivery{
+				ID:          uuid.New().String(),
+				Webhook:     wh.Name,
+				URL:         wh.URL,
+				TraceID:     t.ID,
+				Status:      trace.DeliveryFailed,
+				Error:       "notification queue full",
+				CreatedAt:   time.Now().UnixMilli(),
+				CompletedAt: time.Now().UnixMilli(),
+			})
+		}
+	}
+}
+
+func (n *Notifier) enqueue(j job) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return false
+	}
+	select {
+	case n.queue <- j:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close waits for queued notifications (including retries) to be delivered.
+// It does not close the underlying backend.
+func (n *Notifier) Close() error {
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		return nil
+	}
+	n.closed = true
+	close(n.queue)
+	n.mu.Unlock()
+
+	n.wg.Wait()
+	return nil
+}
+
+// Deliver sends a trace to a webhook now, retrying failed attempts, and
+// records the outcome in the delivery log
+func (n *Notifier) Deliver(wh *Webhook, t *trace.Trace) *trace.WebhookDelivery {
+	d := &trace.WebhookDelivery{
+		ID:        uuid.New().String(),
+		Webhook:   wh.Name,
+		URL:       wh.URL,
+		TraceID:   t.ID,
+		CreatedAt: time.Now().UnixMilli(),
+	}
+
+	if n.omitEncrypted {
+		c := *t
+		c.UserIntent, c.ErrorMessage = "", ""
+		t = &c
+	}
+	body, err := wh.render(t)
+	if err != nil {
+		d.Status, d.Error = trace.DeliveryFailed, err.Error()
+	} else {
+		backoff := retryBackoff
+		for {
+			d.Attempts++
+			var retry bool
+			d.StatusCode, retry, err = n.post(wh, d.ID, body)
+			if err == nil {
+				d.Status, d.Error = trace.DeliveryDelivered, ""
+				break
+			}
+			d.Status, d.Error = trace.DeliveryFailed, err.Error()
+			if !retry || d.Attempts > *wh.Retries {
+				break
+			}
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	d.CompletedAt = time.Now().UnixMilli()
+
+	if d.Status == trace.DeliveryFailed {
+		log.Printf("Warning: webhook %s: failed to deliver trace %s after %d attempts: %s", wh.Name, t.ID, d.Attempts, d.Error)
+	}
+	n.record(d)
+	return d
+}
+
+func (n *Notifier) record(d *trace.WebhookDelivery) {
+	if n.log == nil {
+		return
+	}
+	if err := n.log.InsertDelivery(d); err != nil {
+		log.Printf("Warning: failed to record webhook delivery: %v", err)
+	}
+}
+
+// post sends one attempt and reports whether a failure is worth retrying
+func (n *Notifier) post(wh *Webhook, deliveryID string, body []byte) (int, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(wh.Timeout))
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, false, err
+	}
+	req.Header.Set("Content-Type", wh.contentType())
+	req.Header.Set("User-Agent", "sniffops-webhook")
+	req.Header.Set(EventHeader, "trace")
+	req.Header.Set(DeliveryHeader, deliveryID)
+	if wh.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(wh.Secret, body))
+	}
+	for key, value := range wh.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return 0, true, err
+	}
+	defer resp.Body.Close()
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp.StatusCode, false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	err = fmt.Errorf("webhook returned %s", resp.Status)
+	if text := strings.TrimSpace(string(message)); text != "" {
+		err = fmt.Errorf("webhook returned %s: %s", resp.Status, text)
+	}
+	return resp.StatusCode, retry, err
+}
+
+// Sign returns the X-SniffOps-Signature value of a body:
+// "sha256=" followed by the hex HMAC-SHA256 of the body with the secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// contentType returns the Content-Type of the webhook's bodies
+func (wh *Webhook) contentType() string {
+	if wh.Format == FormatTemplate {
+		return wh.ContentType
+	}
+	return "application/json"
+}
+
+// render builds the request body for a trace
+func (wh *Webhook) render(t *trace.Trace) ([]byte, error) {
+	payload := newPayload(wh, t)
+
+	switch wh.Format {
+	case FormatSlack:
+		return json.Marshal(map[string]string{"text": slackText(t)})
+	case FormatTemplate:
+		var buf bytes.Buffer
+		if err := wh.tmpl.Execute(&buf, payload); err != nil {
+			return nil, fmt.Errorf("failed to render template: %w", err)
+		}
+		return buf.Bytes(), nil
+	default:
+		return json.Marshal(payload)
+	}
+}
+
+// newPayload builds the payload of a trace, leaving out the large and
+// possibly sensitive tool input, command output and resource snapshots
+func newPayload(wh *Webhook, t *trace.Trace) *Payload {
+	c := *t
+	c.Input, c.Output, c.BeforeSnapshot, c.AfterSnapshot = "", "", "", ""
+	return &Payload{
+		Event:   "trace",
+		Webhook: wh.Name,
+		Summary: Summary(t),
+		Trace:   &c,
+	}
+}
+
+// Summary describes a trace in one line, e.g.
+// "[CRITICAL] sniff_delete in production: kubectl delete pod nginx -n production (success)"
+func Summary(t *trace.Trace) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s] %s", strings.ToUpper(t.RiskLevel), t.ToolName)
+	if t.Namespace != "" {
+		fmt.Fprintf(&b, " in %s", t.Namespace)
+	}
+	fmt.Fprintf(&b, ": %s (%s)", t.Command, t.Result)
+	if t.ErrorMessage != "" {
+		fmt.Fprintf(&b, " - %s", t.ErrorMessage)
+	}
+	return b.String()
+}
+
+// slackText formats a trace as a Slack message (mrkdwn)
+func slackText(t *trace.Trace) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%s risk* `%s`", strings.ToUpper(t.RiskLevel), t.ToolName)
+	if t.Namespace != "" {
+		fmt.Fprintf(&b, " in `%s`", t.Namespace)
+	}
+	fmt.Fprintf(&b, " (%s)\n```%s```", t.Result, t.Command)
+	if t.RiskReason != "" {
+		fmt.Fprintf(&b, "\nReason: %s", t.RiskReason)
+	}
+	if t.ErrorMessage != "" {
+		fmt.Fprintf(&b, "\nError: %s", t.ErrorMessage)
+	}
+	if t.UserIntent != "" {
+		fmt.Fprintf(&b, "\nIntent: %s", t.UserIntent)
+	}
+	fmt.Fprintf(&b, "\nSession `%s`, trace `%s`", t.SessionID, t.ID)
+	return b.String()
+}
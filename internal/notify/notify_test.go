@@ -0,0 +1,354 @@
+package notify
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sniffops/sniffops/internal/trace"
+)
+
+// webhookStub is an in-process webhook receiver that records the requests it gets
+type webhookStub struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []*receivedRequest
+	failures int // Requests to answer with 503 before accepting
+	status   int // Status of accepted requests (default 200)
+}
+
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+func newWebhookStub(t *testing.T) *webhookStub {
+	t.Helper()
+	s := &webhookStub{status: http.StatusOK}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.requests = append(s.requests, &receivedRequest{header: r.Header, body: body})
+
+		if s.failures > 0 {
+			s.failures--
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(s.status)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *webhookStub) received() []*receivedRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*receivedRequest(nil), s.requests...)
+}
+
+func setupStore(t *testing.T) *trace.Store {
+	t.Helper()
+	store, err := trace.NewStore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func parseTestConfig(t *testing.T, config string) *Config {
+	t.Helper()
+	cfg, err := ParseConfig([]byte(config))
+	if err != nil {
+		t.Fatalf("ParseConfig() error = %v", err)
+	}
+	return cfg
+}
+
+func testTrace(tool, namespace, riskLevel, result string) *trace.Trace {
+	return &trace.Trace{
+		ID:        uuid.New().String(),
+		SessionID: "session-1",
+		Timestamp: time.Now().UnixMilli(),
+		ToolName:  tool,
+		Command:   "kubectl delete pod nginx -n " + namespace,
+		Namespace: namespace,
+		RiskLevel: riskLevel,
+		Result:    result,
+		Output:    "pod \"nginx\" deleted",
+	}
+}
+
+func TestRules(t *testing.T) {
+	cfg := parseTestConfig(t, `
+webhooks:
+  - name: prod
+    url: http://localhost/prod
+    rules:
+      - minRisk: high
+        namespaces: [production, "prod-*"]
+      - results: [failure]
+        tools: [sniff_apply]
+  - name: all
+    url: http://localhost/all
+`)
+	prod, all := cfg.Webhooks[0], cfg.Webhooks[1]
+
+	tests := []struct {
+		name  string
+		trace *trace.Trace
+		want  bool
+	}{
+		{"high risk in production", testTrace("sniff_delete", "production", "high", "success"), true},
+		{"critical in prod namespace pattern", testTrace("sniff_delete", "Prod-EU", "critical", "success"), true},
+		{"medium risk in production", testTrace("sniff_scale", "production", "medium", "success"), false},
+		{"high risk in staging", testTrace("sniff_delete", "staging", "high", "success"), false},
+		{"failed apply anywhere", testTrace("sniff_apply", "dev", "medium", "failure"), true},
+		{"failed get", testTrace("sniff_get", "dev", "low", "failure"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := prod.Matches(tt.trace); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+			if !all.Matches(tt.trace) {
+				t.Error("a webhook without rules should match every trace")
+			}
+		})
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	t.Setenv("NOTIFY_TEST_SECRET", "")
+	configs := map[string]string{
+		"missing url":      `webhooks: [{name: a}]`,
+		"invalid scheme":   `webhooks: [{name: a, url: "ftp://example.com"}]`,
+		"duplicate names":  `webhooks: [{name: a, url: "http://x"}, {name: a, url: "http://y"}]`,
+		"unknown format":   `webhooks: [{name: a, url: "http://x", format: xml}]`,
+		"missing template": `webhooks: [{name: a, url: "http://x", format: template}]`,
+		"bad template":     `webhooks: [{name: a, url: "http://x", format: template, template: "{{.Nope"}]`,
+		"bad risk level":   `webhooks: [{name: a, url: "http://x", rules: [{minRisk: extreme}]}]`,
+		"bad pattern":      `webhooks: [{name: a, url: "http://x", rules: [{namespaces: ["[prod"]}]}]`,
+		"unset secret env": `webhooks: [{name: a, url: "http://x", secretEnv: NOTIFY_TEST_SECRET}]`,
+		"unknown field":    `webhooks: [{name: a, url: "http://x", retry: 3}]`,
+	}
+	for name, config := range configs {
+		if _, err := ParseConfig([]byte(config)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestNotifier(t *testing.T) {
+	store := setupStore(t)
+	stub := newWebhookStub(t)
+	t.Setenv("NOTIFY_TEST_SECRET", "s3cret")
+	cfg := parseTestConfig(t, `
+webhooks:
+  - name: critical
+    url: `+stub.URL+`
+    secretEnv: NOTIFY_TEST_SECRET
+    headers: {Authorization: Bearer token}
+    rules:
+      - minRisk: critical
+`)
+
+	notifier := New(store, cfg, store)
+	get := testTrace("sniff_get", "default", "low", "success")
+	del := testTrace("sniff_delete", "production", "critical", "success")
+	for _, tr := range []*trace.Trace{get, del} {
+		if err := notifier.Insert(tr); err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+	}
+	if err := notifier.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	// Traces still reach the backend
+	if n, _ := store.Count(nil); n != 2 {
+		t.Errorf("Count() = %d, want 2", n)
+	}
+
+	requests := stub.received()
+	if len(requests) != 1 {
+		t.Fatalf("webhook received %d requests, want 1 (critical trace only)", len(requests))
+	}
+	req := requests[0]
+
+	if got, want := req.header.Get(SignatureHeader), Sign("s3cret", req.body); got != want || !strings.HasPrefix(got, "sha256=") {
+		t.Errorf("%s = %q, want %q", SignatureHeader, got, want)
+	}
+	if req.header.Get("Authorization") != "Bearer token" || req.header.Get(EventHeader) != "trace" {
+		t.Errorf("headers = %v", req.header)
+	}
+
+	var payload Payload
+	if err := json.Unmarshal(req.body, &payload); err != nil {
+		t.Fatalf("invalid JSON body: %v", err)
+	}
+	if payload.Event != "trace" || payload.Webhook != "critical" || payload.Trace == nil || payload.Trace.ID != del.ID {
+		t.Errorf("payload = %+v", payload)
+	}
+	if payload.Trace.Output != "" {
+		t.Error("payload should not include the command output")
+	}
+	if !strings.Contains(payload.Summary, "[CRITICAL] sniff_delete in production") {
+		t.Errorf("Summary = %q", payload.Summary)
+	}
+
+	deliveries, err := store.ListDeliveries(del.ID, 0)
+	if err != nil {
+		t.Fatalf("ListDeliveries() error = %v", err)
+	}
+	if len(deliveries) != 1 {
+		t.Fatalf("ListDeliveries() returned %d deliveries, want 1", len(deliveries))
+	}
+	d := deliveries[0]
+	if d.Status != trace.DeliveryDelivered || d.Attempts != 1 || d.StatusCode != http.StatusOK || d.Webhook != "critical" {
+		t.Errorf("delivery = %+v", d)
+	}
+	if d.ID != req.header.Get(DeliveryHeader) {
+		t.Errorf("delivery ID = %q, header = %q", d.ID, req.header.Get(DeliveryHeader))
+	}
+}
+
+func TestNotifierRetries(t *testing.T) {
+	defer func(backoff time.Duration) { retryBackoff = backoff }(retryBackoff)
+	retryBackoff = time.Millisecond
+
+	store := setupStore(t)
+	stub := newWebhookStub(t)
+	cfg := parseTestConfig(t, `
+webhooks:
+  - name: flaky
+    url: `+stub.URL+`
+    retries: 2
+`)
+	notifier := New(store, cfg, store)
+	defer notifier.Close()
+	wh := cfg.Webhooks[0]
+
+	// Two busy answers are retried; the third attempt succeeds
+	stub.failures = 2
+	d := notifier.Deliver(wh, testTrace("sniff_get", "default", "low", "success"))
+	if d.Status != trace.DeliveryDelivered || d.Attempts != 3 {
+		t.Errorf("delivery = %+v, want delivered on the third attempt", d)
+	}
+
+	// After all retries, the delivery fails
+	stub.failures = 3
+	d = notifier.Deliver(wh, testTrace("sniff_get", "default", "low", "success"))
+	if d.Status != trace.DeliveryFailed || d.Attempts != 3 || d.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("delivery = %+v, want failed after 3 attempts", d)
+	}
+
+	// Client errors are not retried
+	stub.status = http.StatusBadRequest
+	d = notifier.Deliver(wh, testTrace("sniff_get", "default", "low", "success"))
+	if d.Status != trace.DeliveryFailed || d.Attempts != 1 {
+		t.Errorf("delivery = %+v, want failed without retries", d)
+	}
+
+	deliveries, err := store.ListDeliveries("", 0)
+	if err != nil {
+		t.Fatalf("ListDeliveries() error = %v", err)
+	}
+	if len(deliveries) != 3 {
+		t.Errorf("ListDeliveries() returned %d deliveries, want 3", len(deliveries))
+	}
+}
+
+func TestFormats(t *testing.T) {
+	stub := newWebhookStub(t)
+	cfg := parseTestConfig(t, `
+webhooks:
+  - name: slack
+    url: `+stub.URL+`
+    format: slack
+  - name: pager
+    url: `+stub.URL+`
+    format: template
+    contentType: text/plain
+    template: '{{upper .Trace.RiskLevel}} {{json .Summary}} {{.Trace.Namespace}}'
+`)
+	notifier := New(nil, cfg, nil)
+	defer notifier.Close()
+
+	tr := testTrace("sniff_delete", "production", "critical", "blocked")
+	tr.ErrorMessage = "blocked by SniffOps enforcement"
+	for _, wh := range cfg.Webhooks {
+		if d := notifier.Deliver(wh, tr); d.Status != trace.DeliveryDelivered {
+			t.Fatalf("%s: delivery = %+v", wh.Name, d)
+		}
+	}
+
+	requests := stub.received()
+	var slack map[string]string
+	if err := json.Unmarshal(requests[0].body, &slack); err != nil {
+		t.Fatalf("invalid slack body: %v", err)
+	}
+	for _, want := range []string{"*CRITICAL risk*", "`sniff_delete`", "`production`", "Error: blocked by SniffOps enforcement"} {
+		if !strings.Contains(slack["text"], want) {
+			t.Errorf("slack text %q is missing %q", slack["text"], want)
+		}
+	}
+
+	body := string(requests[1].body)
+	if !strings.HasPrefix(body, `CRITICAL "[CRITICAL] sniff_delete in production:`) || !strings.HasSuffix(body, " production") {
+		t.Errorf("template body = %s", body)
+	}
+	if ct := requests[1].header.Get("Content-Type"); ct != "text/plain" {
+		t.Errorf("Content-Type = %q, want text/plain", ct)
+	}
+	if requests[1].header.Get(SignatureHeader) != "" {
+		t.Error("unexpected signature without a secret")
+	}
+}
+
+func TestOmitEncrypted(t *testing.T) {
+	stub := newWebhookStub(t)
+	cfg := parseTestConfig(t, `
+webhooks:
+  - name: slack
+    url: `+stub.URL+`
+    format: slack
+  - name: json
+    url: `+stub.URL+`
+`)
+	notifier := New(nil, cfg, nil)
+	defer notifier.Close()
+	notifier.SetOmitEncrypted(true)
+
+	tr := testTrace("sniff_exec", "production", "high", "failure")
+	tr.ErrorMessage = "psql: password hunter2 rejected"
+	tr.UserIntent = "Check the database password"
+	for _, wh := range cfg.Webhooks {
+		if d := notifier.Deliver(wh, tr); d.Status != trace.DeliveryDelivered {
+			t.Fatalf("%s: delivery = %+v", wh.Name, d)
+		}
+	}
+
+	for i, req := range stub.received() {
+		body := string(req.body)
+		if strings.Contains(body, "hunter2") || strings.Contains(body, "database password") {
+			t.Errorf("%s body has encrypted fields: %s", cfg.Webhooks[i].Name, body)
+		}
+		if !strings.Contains(body, "kubectl delete pod nginx -n production") {
+			t.Errorf("%s body = %s, want the command", cfg.Webhooks[i].Name, body)
+		}
+	}
+	if tr.ErrorMessage == "" || tr.UserIntent == "" {
+		t.Error("the caller's trace was modified")
+	}
+}
@@ -0,0 +1,101 @@
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sniffops/sniffops/internal/trace"
+)
+
+// ClientName is the MCP client name of replayed calls
+const ClientName = "sniffops-replay"
+
+// Recorder is a trace backend decorator that keeps the last trace saved
+// through it, so that a replayed call can be compared with the original.
+type Recorder struct {
+	trace.Backend
+
+	mu   sync.Mutex
+	last *trace.Trace
+}
+
+// NewRecorder wraps a backend
+func NewRecorder(backend trace.Backend) *Recorder {
+	return &Recorder{Backend: backend}
+}
+
+// Insert saves the trace and keeps a copy of it
+func (r *Recorder) Insert(t *trace.Trace) error {
+	if t != nil {
+		c := *t
+		r.mu.Lock()
+		r.last = &c
+		r.mu.Unlock()
+	}
+	return r.Backend.Insert(t)
+}
+
+// Take returns and clears the last trace saved (nil if there is none)
+func (r *Recorder) Take() *trace.Trace {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t := r.last
+	r.last = nil
+	return t
+}
+
+// MCPCaller replays calls through the tool handlers of an MCP server, over
+// an in-memory connection, so that they are risk evaluated and traced like
+// the original calls.
+type MCPCaller struct {
+	session  *mcp.ClientSession
+	recorder *Recorder
+}
+
+// Connect connects to an MCP server whose tools save their traces through
+// the recorder
+func Connect(ctx context.Context, server *mcp.Server, recorder *Recorder) (*MCPCaller, error) {
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	if _, err := server.Connect(ctx, serverTransport, nil); err != nil {
+		return nil, fmt.Errorf("failed to start MCP server: %w", err)
+	}
+
+	client := mcp.NewClient(&mcp.Implementation{Name: ClientName, Version: "v0.1.0"}, nil)
+	session, err := client.Connect(ctx, clientTransport, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MCP server: %w", err)
+	}
+
+	return &MCPCaller{session: session, recorder: recorder}, nil
+}
+
+// Call calls a tool and returns the trace it saved
+func (c *MCPCaller) Call(ctx context.Context, tool string, args json.RawMessage) (*trace.Trace, error) {
+	c.recorder.Take()
+	res, err := c.session.CallTool(ctx, &mcp.CallToolParams{Name: tool, Arguments: args})
+	replayed := c.recorder.Take()
+	if err != nil {
+		return replayed, err
+	}
+
+	if res.IsError {
+		var texts []string
+		for _, content := range res.Content {
+			if text, ok := content.(*mcp.TextContent); ok {
+				texts = append(texts, text.Text)
+			}
+		}
+		return replayed, errors.New(strings.Join(texts, "\n"))
+	}
+	return replayed, nil
+}
+
+// Close closes the MCP connection
+func (c *MCPCaller) Close() error {
+	return c.session.Close()
+}
@@ -0,0 +1,276 @@
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/sniffops/sniffops/internal/budget"
+	"github.com/sniffops/sniffops/internal/k8s"
+	"github.com/sniffops/sniffops/internal/loop"
+	"github.com/sniffops/sniffops/internal/trace"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Report settings
+const (
+	maxOutputChanges = 5   // Output changes listed per call
+	maxErrorLength   = 200 // Error messages are shortened to this many characters
+)
+
+// dryRunTools are the mutating tools that accept dry_run
+var dryRunTools = map[string]bool{
+	"sniff_apply":  true,
+	"sniff_delete": true,
+	"sniff_scale":  true,
+	"sniff_revert": true,
+}
+
+// refusedResults are the results of calls that never reached the cluster
+var refusedResults = map[string]bool{
+	"blocked":             true,
+	"denied":              true,
+	budget.ResultExceeded: true,
+	loop.ResultBlocked:    true,
+}
+
+// Caller issues a tool call. It returns the trace recorded for the call (nil
+// if the call didn't get that far) and the error of the call, if any.
+type Caller interface {
+	Call(ctx context.Context, tool string, args json.RawMessage) (*trace.Trace, error)
+}
+
+// Options control how calls are replayed
+type Options struct {
+	// DryRun runs mutating calls with server-side dry run. sniff_exec has no
+	// dry run, so it is skipped.
+	DryRun bool
+}
+
+// Step is the replay of one recorded call
+type Step struct {
+	TraceID        string   `json:"trace_id"` // Original trace
+	Tool           string   `json:"tool"`
+	Command        string   `json:"command"`
+	OriginalResult string   `json:"original_result"`
+	DryRun         bool     `json:"dry_run,omitempty"`         // Replayed with server-side dry run
+	Skipped        string   `json:"skipped,omitempty"`         // Why the call was not replayed
+	ReplayTraceID  string   `json:"replay_trace_id,omitempty"` // Trace of the replayed call
+	Result         string   `json:"result,omitempty"`          // Result of the replayed call ("error" without a trace)
+	Error          string   `json:"error,omitempty"`
+	Divergences    []string `json:"divergences,omitempty"` // How the replay differs from the original
+}
+
+// Report is the divergence report of a replayed session
+type Report struct {
+	SessionID       string  `json:"session_id"`        // Recorded session
+	ReplaySessionID string  `json:"replay_session_id"` // Session of the replayed calls' traces
+	Context         string  `json:"context,omitempty"` // Kubeconfig context replayed against
+	DryRun          bool    `json:"dry_run"`
+	Steps           []*Step `json:"steps"`
+	Replayed        int     `json:"replayed"`
+	Skipped         int     `json:"skipped"`
+	Diverged        int     `json:"diverged"`
+}
+
+// Run replays the recorded calls of a session (oldest first) from their
+// stored inputs, in order, and compares each with the original. Calls that
+// were refused originally, or can't be replayed safely, are skipped.
+func Run(ctx context.Context, traces []*trace.Trace, caller Caller, opts Options) *Report {
+	report := &Report{DryRun: opts.DryRun, Steps: []*Step{}}
+	for _, t := range traces {
+		if ctx.Err() != nil {
+			break
+		}
+
+		step := &Step{
+			TraceID:        t.ID,
+			Tool:           t.ToolName,
+			Command:        t.Command,
+			OriginalResult: t.Result,
+		}
+		report.Steps = append(report.Steps, step)
+
+		args, skipped := prepare(t, opts, step)
+		if skipped != "" {
+			step.Skipped = skipped
+			report.Skipped++
+			continue
+		}
+
+		replayed, err := caller.Call(ctx, t.ToolName, args)
+		if replayed != nil {
+			step.ReplayTraceID = replayed.ID
+			step.Result = replayed.Result
+			step.Error = replayed.ErrorMessage
+		} else {
+			step.Result = "error"
+			if err != nil {
+				step.Error = err.Error()
+			}
+		}
+		step.Divergences = compare(t, replayed, step)
+
+		report.Replayed++
+		if len(step.Divergences) > 0 {
+			report.Diverged++
+		}
+	}
+	return report
+}
+
+// prepare returns the arguments to replay a call with, or why it is skipped
+func prepare(t *trace.Trace, opts Options, step *Step) (json.RawMessage, string) {
+	if refusedResults[t.Result] {
+		return nil, fmt.Sprintf("refused originally (%s)", t.Result)
+	}
+	switch t.Input {
+	case "":
+		return nil, "no recorded input (traced before inputs were recorded)"
+	case trace.EncryptedMarker:
+		return nil, "input is encrypted and the key is not available"
+	}
+
+	var args map[string]interface{}
+	if err := json.Unmarshal([]byte(t.Input), &args); err != nil {
+		return nil, fmt.Sprintf("invalid recorded input: %v", err)
+	}
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+
+	step.DryRun = args["dry_run"] == true
+	if budget.MutatingTools[t.ToolName] && !step.DryRun {
+		switch {
+		case opts.DryRun && dryRunTools[t.ToolName]:
+			args["dry_run"] = true
+			step.DryRun = true
+		case opts.DryRun:
+			return nil, t.ToolName + " has no server-side dry run"
+		case trace.HasRedactionMarker(t.Input):
+			// Redacted values, including masked URL credentials, would be written to the cluster as is
+			return nil, "input has redacted values"
+		}
+	}
+
+	data, err := json.Marshal(args)
+	if err != nil {
+		return nil, fmt.Sprintf("invalid recorded input: %v", err)
+	}
+	return data, ""
+}
+
+// compare describes how a replayed call differs from the original
+func compare(original, replayed *trace.Trace, step *Step) []string {
+	var divergences []string
+	if step.Result != original.Result {
+		divergences = append(divergences, fmt.Sprintf("result: %s → %s", original.Result, step.Result))
+	}
+	if replayed == nil {
+		if step.Error != "" {
+			divergences = append(divergences, "error: "+shorten(step.Error))
+		}
+		return divergences
+	}
+
+	if replayed.RiskLevel != original.RiskLevel {
+		divergences = append(divergences, fmt.Sprintf("risk level: %s → %s", original.RiskLevel, replayed.RiskLevel))
+	}
+	switch {
+	case step.Result != original.Result:
+		if replayed.ErrorMessage != "" {
+			divergences = append(divergences, "error: "+shorten(replayed.ErrorMessage))
+		}
+	case replayed.ErrorMessage != original.ErrorMessage:
+		divergences = append(divergences, fmt.Sprintf("error: %s → %s", shorten(original.ErrorMessage), shorten(replayed.ErrorMessage)))
+	default:
+		divergences = append(divergences, compareOutput(original.Output, replayed.Output)...)
+	}
+	return divergences
+}
+
+// compareOutput describes how the sanitized output of a call changed.
+// JSON outputs are compared field by field, without server-managed metadata
+// and status; other outputs (logs, exec) line by line.
+func compareOutput(original, replayed string) []string {
+	if original == replayed || original == trace.EncryptedMarker || replayed == trace.EncryptedMarker {
+		return nil
+	}
+
+	var before, after map[string]interface{}
+	if json.Unmarshal([]byte(original), &before) == nil && json.Unmarshal([]byte(replayed), &after) == nil {
+		// Replays in dry run are otherwise the same call
+		delete(before, "dry_run")
+		delete(after, "dry_run")
+		normalize(before)
+		normalize(after)
+
+		changes := k8s.DiffObjects(&unstructured.Unstructured{Object: before}, &unstructured.Unstructured{Object: after})
+		var divergences []string
+		for i, change := range changes {
+			if i == maxOutputChanges {
+				divergences = append(divergences, fmt.Sprintf("output: %d more changes", len(changes)-i))
+				break
+			}
+			divergences = append(divergences, "output "+change.String())
+		}
+		return divergences
+	}
+
+	return []string{compareLines(original, replayed)}
+}
+
+// compareLines describes the first difference between two text outputs
+func compareLines(original, replayed string) string {
+	before := strings.Split(original, "\n")
+	after := strings.Split(replayed, "\n")
+	message := fmt.Sprintf("output: %d → %d lines", len(before), len(after))
+	for i := 0; i < len(before) || i < len(after); i++ {
+		var a, b string
+		if i < len(before) {
+			a = before[i]
+		}
+		if i < len(after) {
+			b = after[i]
+		}
+		if a != b {
+			return message + fmt.Sprintf(", first difference at line %d: %q → %q", i+1, shorten(a), shorten(b))
+		}
+	}
+	return message
+}
+
+// volatileMetadata are the server-managed metadata fields that differ
+// between any two clusters or calls
+var volatileMetadata = []string{"managedFields", "resourceVersion", "generation", "uid", "creationTimestamp", "selfLink"}
+
+// normalize removes the server-managed metadata and the status of the
+// Kubernetes objects in an output, in place
+func normalize(value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if metadata, ok := v["metadata"].(map[string]interface{}); ok {
+			for _, field := range volatileMetadata {
+				delete(metadata, field)
+			}
+			delete(v, "status")
+		}
+		for _, child := range v {
+			normalize(child)
+		}
+	case []interface{}:
+		for _, child := range v {
+			normalize(child)
+		}
+	}
+}
+
+// shorten truncates long messages for the report
+func shorten(s string) string {
+	runes := []rune(s)
+	if len(runes) <= maxErrorLength {
+		return s
+	}
+	return string(runes[:maxErrorLength]) + "…"
+}
@@ -0,0 +1,267 @@
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sniffops/sniffops/internal/trace"
+)
+
+// fakeCaller replays calls with canned traces, by tool name
+type fakeCaller struct {
+	results map[string]*trace.Trace
+	errs    map[string]error
+	calls   []string // "tool args" of each call
+}
+
+func (f *fakeCaller) Call(ctx context.Context, tool string, args json.RawMessage) (*trace.Trace, error) {
+	f.calls = append(f.calls, tool+" "+string(args))
+	return f.results[tool], f.errs[tool]
+}
+
+func recorded(id, tool, input, result, output string) *trace.Trace {
+	return &trace.Trace{
+		ID:        id,
+		SessionID: "s",
+		ToolName:  tool,
+		Command:   tool,
+		Input:     input,
+		RiskLevel: "low",
+		Result:    result,
+		Output:    output,
+	}
+}
+
+func TestRunDryRun(t *testing.T) {
+	traces := []*trace.Trace{
+		recorded("1", "sniff_get", `{"kind":"pod","namespace":"default"}`, "success", `{"count":1}`),
+		recorded("2", "sniff_scale", `{"name":"web","namespace":"default","replicas":0}`, "success", `{"scaled":true}`),
+		recorded("3", "sniff_exec", `{"pod":"api","command":["ls"]}`, "success", "bin\netc"),
+		recorded("4", "sniff_delete", `{"kind":"pod","name":"api"}`, "blocked", ""),
+		recorded("5", "sniff_logs", "", "success", "ok"),
+		recorded("6", "sniff_get", trace.EncryptedMarker, "success", ""),
+	}
+	caller := &fakeCaller{results: map[string]*trace.Trace{
+		"sniff_get":   {ID: "r1", Result: "success", RiskLevel: "low", Output: `{"count":1}`},
+		"sniff_scale": {ID: "r2", Result: "success", RiskLevel: "low", Output: `{"dry_run":true,"scaled":true}`},
+	}}
+
+	report := Run(context.Background(), traces, caller, Options{DryRun: true})
+	if report.Replayed != 2 || report.Skipped != 4 || report.Diverged != 0 || len(report.Steps) != 6 {
+		t.Fatalf("report = %+v", report)
+	}
+
+	// Mutating calls get dry_run, other calls are replayed as recorded
+	want := []string{
+		`sniff_get {"kind":"pod","namespace":"default"}`,
+		`sniff_scale {"dry_run":true,"name":"web","namespace":"default","replicas":0}`,
+	}
+	if strings.Join(caller.calls, "\n") != strings.Join(want, "\n") {
+		t.Errorf("calls = %q, want %q", caller.calls, want)
+	}
+	if step := report.Steps[1]; !step.DryRun || step.ReplayTraceID != "r2" || step.Result != "success" {
+		t.Errorf("scale step = %+v", step)
+	}
+
+	for i, reason := range map[int]string{
+		2: "sniff_exec has no server-side dry run",
+		3: "refused originally (blocked)",
+		4: "no recorded input",
+		5: "input is encrypted",
+	} {
+		if !strings.HasPrefix(report.Steps[i].Skipped, reason) {
+			t.Errorf("step %d skipped = %q, want %q", i+1, report.Steps[i].Skipped, reason)
+		}
+	}
+}
+
+func TestRunWithoutDryRun(t *testing.T) {
+	traces := []*trace.Trace{
+		recorded("1", "sniff_exec", `{"pod":"api","command":["ls"]}`, "success", "bin"),
+		recorded("2", "sniff_apply", `{"manifest":"{\"kind\":\"Secret\",\"data\":{\"password\":\"[REDACTED]\"}}"}`, "success", ""),
+		recorded("3", "sniff_delete", `{"kind":"pod","name":"api","dry_run":true}`, "success", ""),
+		recorded("4", "sniff_exec", `{"pod":"api","command":["psql","postgres://***:***@db:5432/app"]}`, "success", ""),
+	}
+	caller := &fakeCaller{results: map[string]*trace.Trace{
+		"sniff_exec":   {ID: "r1", Result: "success", RiskLevel: "low", Output: "bin"},
+		"sniff_delete": {ID: "r3", Result: "success", RiskLevel: "low"},
+	}}
+
+	report := Run(context.Background(), traces, caller, Options{DryRun: false})
+	if report.Replayed != 2 || report.Skipped != 2 {
+		t.Fatalf("report = %+v", report)
+	}
+	if report.Steps[0].DryRun {
+		t.Error("sniff_exec should run for real without --dry-run")
+	}
+	if report.Steps[1].Skipped != "input has redacted values" {
+		t.Errorf("apply skipped = %q", report.Steps[1].Skipped)
+	}
+	if report.Steps[3].Skipped != "input has redacted values" {
+		t.Errorf("exec with a masked URL credential skipped = %q", report.Steps[3].Skipped)
+	}
+	// Calls that were dry runs stay dry runs
+	if !report.Steps[2].DryRun {
+		t.Error("a recorded dry run should be replayed as a dry run")
+	}
+}
+
+func TestDivergences(t *testing.T) {
+	pod := func(name, image, uid string) string {
+		return fmt.Sprintf(`{"count":1,"resources":{"kind":"Pod","metadata":{"name":%q,"uid":%q,"resourceVersion":"1"},"spec":{"image":%q},"status":{"phase":"Running"}}}`, name, uid, image)
+	}
+
+	tests := []struct {
+		name     string
+		original *trace.Trace
+		replayed *trace.Trace
+		err      error
+		want     []string
+	}{
+		{
+			name:     "same object on another cluster",
+			original: recorded("1", "sniff_get", "{}", "success", pod("api", "nginx:1", "a")),
+			replayed: &trace.Trace{ID: "r", Result: "success", RiskLevel: "low", Output: pod("api", "nginx:1", "b")},
+		},
+		{
+			name:     "changed field",
+			original: recorded("1", "sniff_get", "{}", "success", pod("api", "nginx:1", "a")),
+			replayed: &trace.Trace{ID: "r", Result: "success", RiskLevel: "low", Output: pod("api", "nginx:2", "a")},
+			want:     []string{"output ~ resources.spec.image: nginx:1 -> nginx:2"},
+		},
+		{
+			name:     "failed",
+			original: recorded("1", "sniff_get", "{}", "success", "{}"),
+			replayed: &trace.Trace{ID: "r", Result: "failure", RiskLevel: "medium", ErrorMessage: "pods \"api\" not found"},
+			want:     []string{"result: success → failure", "risk level: low → medium", `error: pods "api" not found`},
+		},
+		{
+			name:     "different error",
+			original: &trace.Trace{Result: "failure", RiskLevel: "low", ErrorMessage: "timeout"},
+			replayed: &trace.Trace{ID: "r", Result: "failure", RiskLevel: "low", ErrorMessage: "forbidden"},
+			want:     []string{"error: timeout → forbidden"},
+		},
+		{
+			name:     "no trace",
+			original: recorded("1", "sniff_get", "{}", "success", "{}"),
+			err:      errors.New("unknown tool"),
+			want:     []string{"result: success → error", "error: unknown tool"},
+		},
+		{
+			name:     "text output",
+			original: recorded("1", "sniff_logs", "{}", "success", "start\nready"),
+			replayed: &trace.Trace{ID: "r", Result: "success", RiskLevel: "low", Output: "start\ncrash\nexit"},
+			want:     []string{`output: 2 → 3 lines, first difference at line 2: "ready" → "crash"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tool := tt.original.ToolName
+			if tool == "" {
+				tool, tt.original.ToolName, tt.original.Input = "sniff_get", "sniff_get", "{}"
+			}
+			caller := &fakeCaller{
+				results: map[string]*trace.Trace{tool: tt.replayed},
+				errs:    map[string]error{tool: tt.err},
+			}
+			report := Run(context.Background(), []*trace.Trace{tt.original}, caller, Options{DryRun: true})
+			got := report.Steps[0].Divergences
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("divergences = %q, want %q", got, tt.want)
+			}
+			if (report.Diverged == 1) != (len(tt.want) > 0) {
+				t.Errorf("Diverged = %d", report.Diverged)
+			}
+		})
+	}
+}
+
+func TestDivergenceLimit(t *testing.T) {
+	before, after := map[string]int{}, map[string]int{}
+	for i := 0; i < maxOutputChanges+3; i++ {
+		before[fmt.Sprintf("f%d", i)] = i
+		after[fmt.Sprintf("f%d", i)] = i + 1
+	}
+	a, _ := json.Marshal(before)
+	b, _ := json.Marshal(after)
+
+	got := compareOutput(string(a), string(b))
+	if len(got) != maxOutputChanges+1 || got[maxOutputChanges] != "output: 3 more changes" {
+		t.Errorf("compareOutput() = %q", got)
+	}
+}
+
+func TestMCPCaller(t *testing.T) {
+	store, err := trace.NewStore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	defer store.Close()
+	recorder := NewRecorder(store)
+
+	// A tool that traces its call like the K8s tools, and fails for "fail"
+	type echoInput struct {
+		Message string `json:"message"`
+		DryRun  bool   `json:"dry_run,omitempty"`
+	}
+	server := mcp.NewServer(&mcp.Implementation{Name: "test", Version: "v0"}, nil)
+	mcp.AddTool(server, &mcp.Tool{Name: "echo"}, func(ctx context.Context, req *mcp.CallToolRequest, in echoInput) (*mcp.CallToolResult, any, error) {
+		tr := &trace.Trace{
+			ID:        fmt.Sprintf("replay-%s", in.Message),
+			SessionID: "replay",
+			Timestamp: time.Now().UnixMilli(),
+			ToolName:  "echo",
+			Command:   "echo " + in.Message,
+			Input:     string(req.Params.Arguments),
+			RiskLevel: "low",
+			DryRun:    in.DryRun,
+			Result:    "success",
+			Output:    in.Message,
+		}
+		var err error
+		if in.Message == "fail" {
+			tr.Result, tr.Output, tr.ErrorMessage = "failure", "", "it failed"
+			err = errors.New("it failed")
+		}
+		if insertErr := recorder.Insert(tr); insertErr != nil {
+			return nil, nil, insertErr
+		}
+		return nil, map[string]string{"message": in.Message}, err
+	})
+
+	ctx := context.Background()
+	caller, err := Connect(ctx, server, recorder)
+	if err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer caller.Close()
+
+	replayed, err := caller.Call(ctx, "echo", json.RawMessage(`{"message":"hi"}`))
+	if err != nil || replayed == nil || replayed.ID != "replay-hi" || replayed.Output != "hi" {
+		t.Fatalf("Call() = %+v, %v", replayed, err)
+	}
+
+	replayed, err = caller.Call(ctx, "echo", json.RawMessage(`{"message":"fail"}`))
+	if err == nil || err.Error() != "it failed" || replayed == nil || replayed.Result != "failure" {
+		t.Errorf("Call() = %+v, %v, want the failure and its trace", replayed, err)
+	}
+
+	// A protocol error leaves no trace
+	replayed, err = caller.Call(ctx, "missing", json.RawMessage(`{}`))
+	if err == nil || replayed != nil {
+		t.Errorf("Call(missing) = %+v, %v", replayed, err)
+	}
+
+	// The replayed calls were saved
+	if _, err := store.GetByID("replay-hi"); err != nil {
+		t.Errorf("GetByID() error = %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package risk
 
 import (
 	"fmt"
+	"os"
 	"strings"
 )
 
@@ -25,16 +26,111 @@ type EvalContext struct {
 	TargetResource string // e.g., "pod/nginx-abc123"
 }
 
+// Decision is the outcome of a risk evaluation
+type Decision struct {
+	Level  RiskLevel
+	Reason string
+	Rule   string // Name of the policy rule that fired (empty for built-in heuristics)
+}
+
 // Evaluator evaluates the risk level of Kubernetes operations
-type Evaluator struct{}
+type Evaluator struct {
+	policy *Policy
+}
 
-// NewEvaluator creates a new risk evaluator
+// NewEvaluator creates a new risk evaluator using the built-in default policy
 func NewEvaluator() *Evaluator {
-	return &Evaluator{}
+	return &Evaluator{policy: DefaultPolicy()}
+}
+
+// NewEvaluatorWithPolicy creates a new risk evaluator using the given policy
+func NewEvaluatorWithPolicy(policy *Policy) *Evaluator {
+	if policy == nil {
+		policy = DefaultPolicy()
+	}
+	return &Evaluator{policy: policy}
+}
+
+// LoadEvaluator creates a risk evaluator from a policy file.
+// If policyPath is empty, ~/.sniffops/policy.yaml is used when it exists,
+// otherwise the built-in default policy applies.
+func LoadEvaluator(policyPath string) (*Evaluator, error) {
+	if policyPath == "" {
+		defaultPath, err := DefaultPolicyPath()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(defaultPath); os.IsNotExist(err) {
+			return NewEvaluator(), nil
+		}
+		policyPath = defaultPath
+	}
+
+	policy, err := LoadPolicy(policyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewEvaluatorWithPolicy(policy), nil
+}
+
+// EnableEnforcement turns on enforcement mode with the given global threshold.
+// Per-namespace thresholds from the policy file are kept.
+func (e *Evaluator) EnableEnforcement(maxLevel RiskLevel) {
+	e.policy.Enforcement.Enabled = true
+	if maxLevel != "" {
+		e.policy.Enforcement.MaxLevel = maxLevel
+	}
+}
+
+// Enforce reports whether a call with the given decision must be blocked,
+// along with the threshold that applied. It always returns false when
+// enforcement mode is disabled.
+func (e *Evaluator) Enforce(ctx EvalContext, decision Decision) (blocked bool, maxLevel RiskLevel) {
+	enforcement := e.policy.Enforcement
+	if !enforcement.Enabled {
+		return false, ""
+	}
+
+	maxLevel = enforcement.MaxLevel
+	if maxLevel == "" {
+		maxLevel = RiskCritical
+	}
+
+	for _, limit := range enforcement.Namespaces {
+		if ctx.Namespace != "" && MatchesAnyGlob([]string{limit.Pattern}, ctx.Namespace) {
+			maxLevel = limit.MaxLevel
+			break
+		}
+	}
+
+	return decision.Level.AtLeast(maxLevel), maxLevel
 }
 
 // Evaluate calculates the risk level and reason for the given context
 func (e *Evaluator) Evaluate(ctx EvalContext) (level RiskLevel, reason string) {
+	decision := e.Decide(ctx)
+	return decision.Level, decision.Reason
+}
+
+// Decide evaluates the context and reports which policy rule (if any) fired
+func (e *Evaluator) Decide(ctx EvalContext) Decision {
+	// Policy rules are evaluated in order; the first match wins
+	for i := range e.policy.Rules {
+		rule := &e.policy.Rules[i]
+		if !rule.matches(ctx) {
+			continue
+		}
+
+		reason := rule.Reason
+		if reason == "" {
+			reason = fmt.Sprintf("Matched policy rule: %s", rule.Name)
+		} else {
+			reason = fmt.Sprintf("%s (policy rule: %s)", reason, rule.Name)
+		}
+		return Decision{Level: rule.Level, Reason: reason, Rule: rule.Name}
+	}
+
 	// Rule 1: Get base risk from tool/command type
 	baseRisk := e.getCommandRisk(ctx.ToolName, ctx.Action)
 
@@ -54,26 +150,14 @@ func (e *Evaluator) Evaluate(ctx EvalContext) (level RiskLevel, reason string) {
 		baseRisk = RiskCritical
 	}
 
-	// Generate reason
-	reason = e.generateReason(ctx, baseRisk)
-
-	return baseRisk, reason
+	return Decision{Level: baseRisk, Reason: e.generateReason(ctx, baseRisk)}
 }
 
 // getCommandRisk returns the base risk level for a given tool/action
 func (e *Evaluator) getCommandRisk(tool, action string) RiskLevel {
 	// Priority 1: Check tool name (MCP tool convention)
-	switch tool {
-	case "sniff_get", "sniff_logs", "sniff_traces", "sniff_stats":
-		return RiskLow
-	case "sniff_apply":
-		return RiskMedium
-	case "sniff_delete":
-		return RiskCritical
-	case "sniff_exec":
-		return RiskCritical
-	case "sniff_scale":
-		return RiskHigh
+	if level, ok := e.policy.ToolLevels[tool]; ok {
+		return level
 	}
 
 	// Priority 2: Check action (for custom/direct calls)
@@ -105,23 +189,7 @@ func (e *Evaluator) isCriticalNamespace(ns string) bool {
 		return false
 	}
 
-	criticalNamespaces := []string{
-		"kube-system",
-		"kube-public",
-		"kube-node-lease",
-		"production",
-		"prod",
-		"default",
-	}
-
-	nsLower := strings.ToLower(ns)
-	for _, critical := range criticalNamespaces {
-		if nsLower == critical {
-			return true
-		}
-	}
-
-	return false
+	return MatchesAnyGlob(e.policy.CriticalNamespaces, ns)
 }
 
 // isSensitiveResource checks if the resource kind contains sensitive data
@@ -130,24 +198,7 @@ func (e *Evaluator) isSensitiveResource(kind string) bool {
 		return false
 	}
 
-	sensitiveResources := []string{
-		"secret",
-		"configmap",
-		"serviceaccount",
-		"clusterrole",
-		"clusterrolebinding",
-		"persistentvolume",
-		"storageclass",
-	}
-
-	kindLower := strings.ToLower(kind)
-	for _, sensitive := range sensitiveResources {
-		if kindLower == sensitive {
-			return true
-		}
-	}
-
-	return false
+	return ContainsFold(e.policy.SensitiveResources, kind)
 }
 
 // escalate increases the risk level by one step
@@ -0,0 +1,342 @@
+package risk
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Policy is a declarative risk policy loaded from a YAML or JSON file.
+//
+// Rules are evaluated in order and the first matching rule decides the risk
+// level. When no rule matches, the evaluator falls back to the built-in
+// heuristics driven by ToolLevels, CriticalNamespaces and SensitiveResources.
+//
+// Example (~/.sniffops/policy.yaml):
+//
+//	criticalNamespaces: [kube-system, production, "payments-*"]
+//	toolLevels:
+//	  sniff_apply: medium
+//	rules:
+//	  - name: dev-apply
+//	    match:
+//	      tools: [sniff_apply]
+//	      namespaces: [dev]
+//	    level: low
+//	    reason: Applying to the dev namespace is routine
+//	enforcement:
+//	  enabled: true
+//	  maxLevel: critical
+//	  namespaces:
+//	    - pattern: "prod-*"
+//	      maxLevel: high
+type Policy struct {
+	// CriticalNamespaces escalate risk by one level (glob patterns allowed)
+	CriticalNamespaces []string `json:"criticalNamespaces,omitempty"`
+	// SensitiveResources escalate risk by one level (resource kinds, case-insensitive)
+	SensitiveResources []string `json:"sensitiveResources,omitempty"`
+	// ToolLevels maps MCP tool names to their base risk level
+	ToolLevels map[string]RiskLevel `json:"toolLevels,omitempty"`
+	// Rules are evaluated in order; the first match wins
+	Rules []Rule `json:"rules,omitempty"`
+	// Enforcement blocks tool calls whose evaluated risk is too high
+	Enforcement Enforcement `json:"enforcement,omitempty"`
+}
+
+// Enforcement configures guardrail mode. When enabled, a call whose risk level
+// is at or above the applicable maximum is refused before it reaches the cluster.
+type Enforcement struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// MaxLevel is the global threshold (default: critical)
+	MaxLevel RiskLevel `json:"maxLevel,omitempty"`
+	// Namespaces override MaxLevel per namespace; the first matching pattern wins
+	Namespaces []NamespaceLimit `json:"namespaces,omitempty"`
+}
+
+// NamespaceLimit is a per-namespace enforcement threshold
+type NamespaceLimit struct {
+	Pattern  string    `json:"pattern"` // glob pattern, e.g., prod-*
+	MaxLevel RiskLevel `json:"maxLevel"`
+}
+
+// Rule is a single ordered policy rule
+type Rule struct {
+	Name   string    `json:"name"`
+	Match  RuleMatch `json:"match"`
+	Level  RiskLevel `json:"level"`
+	Reason string    `json:"reason,omitempty"`
+
+	namespaceRegex *regexp.Regexp
+}
+
+// RuleMatch defines the conditions of a rule. Empty fields match anything;
+// all non-empty fields must match for the rule to fire.
+type RuleMatch struct {
+	Tools          []string      `json:"tools,omitempty"`          // e.g., sniff_apply
+	Actions        []string      `json:"actions,omitempty"`        // e.g., delete, scale
+	Namespaces     []string      `json:"namespaces,omitempty"`     // glob patterns, e.g., payments-*
+	NamespaceRegex string        `json:"namespaceRegex,omitempty"` // e.g., ^team-[a-z]+-prod$
+	Kinds          []string      `json:"kinds,omitempty"`          // e.g., Deployment, secret
+	Names          []string      `json:"names,omitempty"`          // glob patterns on the target name
+	Replicas       *ReplicaRange `json:"replicas,omitempty"`       // only applies to scale operations
+}
+
+// ReplicaRange matches the target replica count of a scale operation (inclusive)
+type ReplicaRange struct {
+	Min *int `json:"min,omitempty"`
+	Max *int `json:"max,omitempty"`
+}
+
+// DefaultPolicy returns the built-in policy used when no policy file exists
+func DefaultPolicy() *Policy {
+	return &Policy{
+		CriticalNamespaces: []string{
+			"kube-system",
+			"kube-public",
+			"kube-node-lease",
+			"production",
+			"prod",
+			"default",
+		},
+		SensitiveResources: []string{
+			"secret",
+			"configmap",
+			"serviceaccount",
+			"clusterrole",
+			"clusterrolebinding",
+			"persistentvolume",
+			"storageclass",
+		},
+		ToolLevels: map[string]RiskLevel{
+			"sniff_get":    RiskLow,
+			"sniff_logs":   RiskLow,
+			"sniff_traces": RiskLow,
+			"sniff_stats":  RiskLow,
+			"sniff_apply":  RiskMedium,
+			"sniff_delete": RiskCritical,
+			"sniff_exec":   RiskCritical,
+			"sniff_scale":  RiskHigh,
+		},
+	}
+}
+
+// DefaultPolicyPath returns the default policy file location (~/.sniffops/policy.yaml)
+func DefaultPolicyPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".sniffops", "policy.yaml"), nil
+}
+
+// LoadPolicy reads and validates a policy file.
+// Fields omitted from the file keep their built-in defaults.
+func LoadPolicy(policyPath string) (*Policy, error) {
+	data, err := os.ReadFile(policyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file %s: %w", policyPath, err)
+	}
+
+	policy, err := ParsePolicy(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy file %s: %w", policyPath, err)
+	}
+
+	return policy, nil
+}
+
+// ParsePolicy parses and validates a YAML or JSON policy document
+func ParsePolicy(data []byte) (*Policy, error) {
+	policy := DefaultPolicy()
+	if err := yaml.UnmarshalStrict(data, policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policy: %w", err)
+	}
+
+	if err := policy.compile(); err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+// compile validates the policy and prepares compiled matchers
+func (p *Policy) compile() error {
+	for _, pattern := range p.CriticalNamespaces {
+		if err := validateGlob(pattern); err != nil {
+			return fmt.Errorf("criticalNamespaces: %w", err)
+		}
+	}
+
+	for tool, level := range p.ToolLevels {
+		if !level.valid() {
+			return fmt.Errorf("toolLevels[%s]: invalid risk level %q", tool, level)
+		}
+	}
+
+	if level := p.Enforcement.MaxLevel; level != "" && !level.valid() {
+		return fmt.Errorf("enforcement.maxLevel: invalid risk level %q", level)
+	}
+	for i, limit := range p.Enforcement.Namespaces {
+		if limit.Pattern == "" {
+			return fmt.Errorf("enforcement.namespaces[%d]: pattern is required", i)
+		}
+		if err := validateGlob(limit.Pattern); err != nil {
+			return fmt.Errorf("enforcement.namespaces[%d]: %w", i, err)
+		}
+		if !limit.MaxLevel.valid() {
+			return fmt.Errorf("enforcement.namespaces[%d]: invalid risk level %q", i, limit.MaxLevel)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+
+		if rule.Name == "" {
+			return fmt.Errorf("rules[%d]: name is required", i)
+		}
+		if seen[rule.Name] {
+			return fmt.Errorf("rules[%d]: duplicate rule name %q", i, rule.Name)
+		}
+		seen[rule.Name] = true
+
+		if !rule.Level.valid() {
+			return fmt.Errorf("rules[%d] %q: invalid risk level %q (expected low, medium, high or critical)", i, rule.Name, rule.Level)
+		}
+
+		for _, pattern := range append(append([]string{}, rule.Match.Namespaces...), rule.Match.Names...) {
+			if err := validateGlob(pattern); err != nil {
+				return fmt.Errorf("rules[%d] %q: %w", i, rule.Name, err)
+			}
+		}
+
+		if rule.Match.NamespaceRegex != "" {
+			re, err := regexp.Compile(rule.Match.NamespaceRegex)
+			if err != nil {
+				return fmt.Errorf("rules[%d] %q: invalid namespaceRegex: %w", i, rule.Name, err)
+			}
+			rule.namespaceRegex = re
+		}
+
+		if r := rule.Match.Replicas; r != nil && r.Min != nil && r.Max != nil && *r.Min > *r.Max {
+			return fmt.Errorf("rules[%d] %q: replicas.min (%d) is greater than replicas.max (%d)", i, rule.Name, *r.Min, *r.Max)
+		}
+	}
+
+	return nil
+}
+
+// matches reports whether the rule applies to the given context
+func (r *Rule) matches(ctx EvalContext) bool {
+	m := r.Match
+
+	if len(m.Tools) > 0 && !ContainsFold(m.Tools, ctx.ToolName) {
+		return false
+	}
+	if len(m.Actions) > 0 && !ContainsFold(m.Actions, ctx.Action) {
+		return false
+	}
+	if len(m.Namespaces) > 0 && !MatchesAnyGlob(m.Namespaces, ctx.Namespace) {
+		return false
+	}
+	if r.namespaceRegex != nil && !r.namespaceRegex.MatchString(ctx.Namespace) {
+		return false
+	}
+	if len(m.Kinds) > 0 && !ContainsFold(m.Kinds, ctx.ResourceKind) {
+		return false
+	}
+	if len(m.Names) > 0 && !MatchesAnyGlob(m.Names, ctx.TargetResource) {
+		return false
+	}
+	if m.Replicas != nil {
+		if !isScale(ctx) {
+			return false
+		}
+		if m.Replicas.Min != nil && ctx.ResourceCount < *m.Replicas.Min {
+			return false
+		}
+		if m.Replicas.Max != nil && ctx.ResourceCount > *m.Replicas.Max {
+			return false
+		}
+	}
+
+	return true
+}
+
+// valid reports whether the level is one of the known risk levels
+func (l RiskLevel) valid() bool {
+	switch l {
+	case RiskLow, RiskMedium, RiskHigh, RiskCritical:
+		return true
+	}
+	return false
+}
+
+// severity returns the numeric order of the level (0 for unknown levels)
+func (l RiskLevel) severity() int {
+	switch l {
+	case RiskLow:
+		return 1
+	case RiskMedium:
+		return 2
+	case RiskHigh:
+		return 3
+	case RiskCritical:
+		return 4
+	}
+	return 0
+}
+
+// AtLeast reports whether l is as severe as or more severe than other
+func (l RiskLevel) AtLeast(other RiskLevel) bool {
+	return l.severity() >= other.severity()
+}
+
+// ParseRiskLevel validates a risk level string
+func ParseRiskLevel(s string) (RiskLevel, error) {
+	level := RiskLevel(strings.ToLower(s))
+	if !level.valid() {
+		return "", fmt.Errorf("invalid risk level %q (expected low, medium, high or critical)", s)
+	}
+	return level, nil
+}
+
+// isScale reports whether the context describes a scale operation
+func isScale(ctx EvalContext) bool {
+	return ctx.ToolName == "sniff_scale" || strings.Contains(strings.ToLower(ctx.Action), "scale")
+}
+
+// validateGlob checks that a glob pattern is well-formed
+func validateGlob(pattern string) error {
+	if _, err := path.Match(pattern, ""); errors.Is(err, path.ErrBadPattern) {
+		return fmt.Errorf("invalid glob pattern %q", pattern)
+	}
+	return nil
+}
+
+// MatchesAnyGlob reports whether value matches any of the glob patterns (case-insensitive)
+func MatchesAnyGlob(patterns []string, value string) bool {
+	value = strings.ToLower(value)
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToLower(pattern), value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ContainsFold reports whether values contains value (case-insensitive)
+func ContainsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,330 @@
+package risk
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testPolicy = `
+criticalNamespaces: [kube-system, "payments-*"]
+rules:
+  - name: dev-apply
+    match:
+      tools: [sniff_apply]
+      namespaces: [dev]
+    level: low
+    reason: Applying to dev is routine
+  - name: team-prod
+    match:
+      namespaceRegex: "^team-[a-z]+-prod$"
+    level: critical
+  - name: big-scale
+    match:
+      tools: [sniff_scale]
+      replicas:
+        min: 50
+    level: high
+    reason: Large scale-out
+  - name: canary-delete
+    match:
+      actions: [delete]
+      kinds: [Pod]
+      names: ["canary-*"]
+    level: medium
+`
+
+func TestParsePolicy(t *testing.T) {
+	policy, err := ParsePolicy([]byte(testPolicy))
+	if err != nil {
+		t.Fatalf("ParsePolicy() error = %v", err)
+	}
+
+	if len(policy.Rules) != 4 {
+		t.Errorf("expected 4 rules, got %d", len(policy.Rules))
+	}
+
+	// Omitted fields keep their defaults
+	if policy.ToolLevels["sniff_delete"] != RiskCritical {
+		t.Errorf("expected default tool level for sniff_delete, got %q", policy.ToolLevels["sniff_delete"])
+	}
+	if len(policy.SensitiveResources) == 0 {
+		t.Error("expected default sensitive resources to be kept")
+	}
+}
+
+func TestParsePolicyInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		wantErr string
+	}{
+		{
+			name:    "unknown level",
+			policy:  "rules:\n  - name: r1\n    level: severe\n",
+			wantErr: "invalid risk level",
+		},
+		{
+			name:    "missing name",
+			policy:  "rules:\n  - level: low\n",
+			wantErr: "name is required",
+		},
+		{
+			name:    "duplicate name",
+			policy:  "rules:\n  - name: r1\n    level: low\n  - name: r1\n    level: high\n",
+			wantErr: "duplicate rule name",
+		},
+		{
+			name:    "bad regex",
+			policy:  "rules:\n  - name: r1\n    level: low\n    match:\n      namespaceRegex: \"([\"\n",
+			wantErr: "invalid namespaceRegex",
+		},
+		{
+			name:    "bad glob",
+			policy:  "criticalNamespaces: [\"prod-[\"]\n",
+			wantErr: "invalid glob pattern",
+		},
+		{
+			name:    "unknown field",
+			policy:  "rulez: []\n",
+			wantErr: "failed to parse policy",
+		},
+		{
+			name:    "invalid tool level",
+			policy:  "toolLevels:\n  sniff_get: none\n",
+			wantErr: "toolLevels[sniff_get]",
+		},
+		{
+			name:    "inverted replica range",
+			policy:  "rules:\n  - name: r1\n    level: low\n    match:\n      replicas: {min: 5, max: 1}\n",
+			wantErr: "replicas.min",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParsePolicy([]byte(tt.policy))
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %q, want to contain %q", err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDecideWithPolicy(t *testing.T) {
+	policy, err := ParsePolicy([]byte(testPolicy))
+	if err != nil {
+		t.Fatalf("ParsePolicy() error = %v", err)
+	}
+	e := NewEvaluatorWithPolicy(policy)
+
+	tests := []struct {
+		name      string
+		ctx       EvalContext
+		wantLevel RiskLevel
+		wantRule  string
+	}{
+		{
+			name:      "dev apply is downgraded",
+			ctx:       EvalContext{ToolName: "sniff_apply", Namespace: "dev", Action: "apply"},
+			wantLevel: RiskLow,
+			wantRule:  "dev-apply",
+		},
+		{
+			name:      "namespace regex match",
+			ctx:       EvalContext{ToolName: "sniff_get", Namespace: "team-checkout-prod"},
+			wantLevel: RiskCritical,
+			wantRule:  "team-prod",
+		},
+		{
+			name:      "replica range match",
+			ctx:       EvalContext{ToolName: "sniff_scale", Namespace: "dev", Action: "scale", ResourceCount: 100},
+			wantLevel: RiskHigh,
+			wantRule:  "big-scale",
+		},
+		{
+			name:      "replica range ignores non-scale tools",
+			ctx:       EvalContext{ToolName: "sniff_get", Namespace: "dev", ResourceCount: 100},
+			wantLevel: RiskLow,
+			wantRule:  "",
+		},
+		{
+			name:      "name glob match",
+			ctx:       EvalContext{ToolName: "sniff_delete", Namespace: "dev", ResourceKind: "pod", Action: "delete", TargetResource: "canary-abc"},
+			wantLevel: RiskMedium,
+			wantRule:  "canary-delete",
+		},
+		{
+			name:      "glob critical namespace escalates",
+			ctx:       EvalContext{ToolName: "sniff_apply", Namespace: "payments-eu", Action: "apply"},
+			wantLevel: RiskHigh,
+			wantRule:  "",
+		},
+		{
+			name:      "namespaces dropped from policy are no longer critical",
+			ctx:       EvalContext{ToolName: "sniff_apply", Namespace: "production", Action: "apply"},
+			wantLevel: RiskMedium,
+			wantRule:  "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := e.Decide(tt.ctx)
+			if got.Level != tt.wantLevel {
+				t.Errorf("Decide() level = %v, want %v", got.Level, tt.wantLevel)
+			}
+			if got.Rule != tt.wantRule {
+				t.Errorf("Decide() rule = %q, want %q", got.Rule, tt.wantRule)
+			}
+			if tt.wantRule != "" && !strings.Contains(got.Reason, tt.wantRule) {
+				t.Errorf("Decide() reason = %q, want to mention rule %q", got.Reason, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestLoadEvaluator(t *testing.T) {
+	t.Run("falls back to default policy when no file exists", func(t *testing.T) {
+		t.Setenv("HOME", t.TempDir())
+
+		e, err := LoadEvaluator("")
+		if err != nil {
+			t.Fatalf("LoadEvaluator() error = %v", err)
+		}
+		if level, _ := e.Evaluate(EvalContext{ToolName: "sniff_delete"}); level != RiskCritical {
+			t.Errorf("expected default policy, got level %v", level)
+		}
+	})
+
+	t.Run("loads default policy path", func(t *testing.T) {
+		home := t.TempDir()
+		t.Setenv("HOME", home)
+
+		dir := filepath.Join(home, ".sniffops")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "policy.yaml"), []byte(testPolicy), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		e, err := LoadEvaluator("")
+		if err != nil {
+			t.Fatalf("LoadEvaluator() error = %v", err)
+		}
+		if d := e.Decide(EvalContext{ToolName: "sniff_apply", Namespace: "dev"}); d.Rule != "dev-apply" {
+			t.Errorf("expected rule dev-apply to fire, got %q", d.Rule)
+		}
+	})
+
+	t.Run("explicit missing file fails", func(t *testing.T) {
+		_, err := LoadEvaluator(filepath.Join(t.TempDir(), "missing.yaml"))
+		if err == nil {
+			t.Error("expected error for missing policy file")
+		}
+	})
+
+	t.Run("invalid policy reports path", func(t *testing.T) {
+		policyPath := filepath.Join(t.TempDir(), "bad.yaml")
+		if err := os.WriteFile(policyPath, []byte("rules:\n  - name: r1\n    level: nope\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := LoadEvaluator(policyPath)
+		if err == nil || !strings.Contains(err.Error(), policyPath) {
+			t.Errorf("expected error mentioning %s, got %v", policyPath, err)
+		}
+	})
+}
+
+func TestEnforce(t *testing.T) {
+	policy, err := ParsePolicy([]byte(`
+enforcement:
+  enabled: true
+  maxLevel: critical
+  namespaces:
+    - pattern: "prod-*"
+      maxLevel: high
+    - pattern: "sandbox"
+      maxLevel: critical
+`))
+	if err != nil {
+		t.Fatalf("ParsePolicy() error = %v", err)
+	}
+	e := NewEvaluatorWithPolicy(policy)
+
+	tests := []struct {
+		name        string
+		ctx         EvalContext
+		wantBlocked bool
+		wantMax     RiskLevel
+	}{
+		{
+			name:        "critical delete is blocked globally",
+			ctx:         EvalContext{ToolName: "sniff_delete", Namespace: "dev", Action: "delete"},
+			wantBlocked: true,
+			wantMax:     RiskCritical,
+		},
+		{
+			name:        "high scale is allowed globally",
+			ctx:         EvalContext{ToolName: "sniff_scale", Namespace: "dev", Action: "scale", ResourceCount: 3},
+			wantBlocked: false,
+			wantMax:     RiskCritical,
+		},
+		{
+			name:        "namespace threshold applies",
+			ctx:         EvalContext{ToolName: "sniff_scale", Namespace: "prod-eu", Action: "scale", ResourceCount: 3},
+			wantBlocked: true,
+			wantMax:     RiskHigh,
+		},
+		{
+			name:        "read-only calls pass namespace threshold",
+			ctx:         EvalContext{ToolName: "sniff_get", Namespace: "prod-eu"},
+			wantBlocked: false,
+			wantMax:     RiskHigh,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocked, maxLevel := e.Enforce(tt.ctx, e.Decide(tt.ctx))
+			if blocked != tt.wantBlocked {
+				t.Errorf("Enforce() blocked = %v, want %v", blocked, tt.wantBlocked)
+			}
+			if maxLevel != tt.wantMax {
+				t.Errorf("Enforce() maxLevel = %v, want %v", maxLevel, tt.wantMax)
+			}
+		})
+	}
+
+	t.Run("disabled by default", func(t *testing.T) {
+		e := NewEvaluator()
+		ctx := EvalContext{ToolName: "sniff_delete", Action: "delete"}
+		if blocked, _ := e.Enforce(ctx, e.Decide(ctx)); blocked {
+			t.Error("expected enforcement to be disabled by default")
+		}
+	})
+
+	t.Run("EnableEnforcement overrides global threshold", func(t *testing.T) {
+		e := NewEvaluator()
+		e.EnableEnforcement(RiskMedium)
+		ctx := EvalContext{ToolName: "sniff_apply", Namespace: "dev", Action: "apply"}
+		if blocked, maxLevel := e.Enforce(ctx, e.Decide(ctx)); !blocked || maxLevel != RiskMedium {
+			t.Errorf("Enforce() = %v, %v; want true, medium", blocked, maxLevel)
+		}
+	})
+}
+
+func TestParseRiskLevel(t *testing.T) {
+	if level, err := ParseRiskLevel("HIGH"); err != nil || level != RiskHigh {
+		t.Errorf("ParseRiskLevel(HIGH) = %v, %v", level, err)
+	}
+	if _, err := ParseRiskLevel("severe"); err == nil {
+		t.Error("expected error for unknown level")
+	}
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/auth"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sniffops/sniffops/internal/trace"
+)
+
+// MCPPath는 streamable HTTP MCP 엔드포인트 경로입니다
+const MCPPath = "/mcp"
+
+// MetricsPath는 Prometheus 메트릭 엔드포인트 경로입니다 (Config.Metrics)
+const MetricsPath = "/metrics"
+
+// bearerToken은 HTTP transport에서 허용되는 토큰입니다
+type bearerToken struct {
+	name  string // trace/세션에 기록되는 사용자 이름
+	token string
+}
+
+// parseTokens는 "token" 또는 "name=token" 형식의 토큰 목록을 파싱합니다
+func parseTokens(values []string) ([]bearerToken, error) {
+	var tokens []bearerToken
+	for i, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		name, token, found := strings.Cut(value, "=")
+		if !found {
+			name, token = fmt.Sprintf("token-%d", i+1), value
+		}
+		if name == "" || token == "" {
+			return nil, fmt.Errorf("invalid token %d: expected TOKEN or NAME=TOKEN", i+1)
+		}
+
+		tokens = append(tokens, bearerToken{name: name, token: token})
+	}
+	return tokens, nil
+}
+
+// verifyToken은 bearer 토큰을 상수 시간 비교로 검증합니다
+func (s *Server) verifyToken(_ context.Context, token string, _ *http.Request) (*auth.TokenInfo, error) {
+	for _, t := range s.tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t.token)) == 1 {
+			return &auth.TokenInfo{
+				// UserID가 있으면 SDK가 다른 사용자의 세션 ID 재사용을 거부함
+				UserID: t.name,
+				// 정적 토큰은 만료되지 않지만 SDK는 만료 시간을 요구함
+				Expiration: time.Now().Add(time.Hour),
+			}, nil
+		}
+	}
+	return nil, auth.ErrInvalidToken
+}
+
+// RunHTTP는 MCP 서버를 streamable HTTP transport로 시작합니다.
+//
+// 모든 MCP 클라이언트가 하나의 서버와 trace store를 공유하며, 각 클라이언트는
+// 자신의 MCP 세션 ID(Mcp-Session-Id)로 trace에 기록됩니다.
+func (s *Server) RunHTTP(ctx context.Context, addr string) error {
+	if len(s.tokens) == 0 && !s.noAuth {
+		return fmt.Errorf("HTTP transport requires a bearer token (--token or SNIFFOPS_AUTH_TOKEN)")
+	}
+
+	var handler http.Handler = mcp.NewStreamableHTTPHandler(
+		func(*http.Request) *mcp.Server { return s.mcpServer },
+		nil,
+	)
+	if len(s.tokens) > 0 {
+		handler = auth.RequireBearerToken(s.verifyToken, nil)(handler)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(MCPPath, handler)
+	if s.metrics {
+		// Prometheus가 bearer 토큰 없이 수집할 수 있도록 MCP 엔드포인트와 별도로 인증하지 않음
+		mux.HandleFunc(MetricsPath, s.handleMetrics)
+	}
+
+	// 보존 정책에 따라 오래된 trace를 백그라운드에서 정리
+	go s.traceStore.RunRetention(ctx, s.retention, "serve")
+
+	httpServer := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	// Start server in a goroutine
+	errChan := make(chan error, 1)
+	go func() {
+		fmt.Fprintf(os.Stderr, "Listening on http://%s%s (streamable HTTP)\n", displayAddr(addr), MCPPath)
+		if s.metrics {
+			fmt.Fprintf(os.Stderr, "Prometheus metrics on http://%s%s\n", displayAddr(addr), MetricsPath)
+		}
+		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			errChan <- err
+		}
+	}()
+
+	// Wait for context cancellation or error
+	select {
+	case <-ctx.Done():
+		// Graceful shutdown with 5 second timeout
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return httpServer.Shutdown(shutdownCtx)
+	case err := <-errChan:
+		return fmt.Errorf("MCP HTTP server failed: %w", err)
+	}
+}
+
+// handleMetrics는 trace store 집계와 writer/exporter 카운터를 Prometheus 형식으로 반환합니다
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 버퍼에 남은 trace는 다음 배치 저장 후 집계됨 (scrape마다 flush하지 않음)
+	metrics, err := s.traceStore.Metrics()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writer := s.traceWriter.Counters()
+	metrics.Writer = &writer
+	if s.spanExporter != nil {
+		otlp := s.spanExporter.Counters()
+		metrics.OTLP = &otlp
+	}
+
+	w.Header().Set("Content-Type", trace.MetricsContentType)
+	if err := trace.WritePrometheus(w, metrics); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to write metrics: %v\n", err)
+	}
+}
+
+// displayAddr는 ":8080" 같은 주소를 "localhost:8080"으로 표시합니다
+func displayAddr(addr string) string {
+	if strings.HasPrefix(addr, ":") {
+		return "localhost" + addr
+	}
+	return addr
+}
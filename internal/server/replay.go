@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sniffops/sniffops/internal/replay"
+	"github.com/sniffops/sniffops/internal/tools"
+	"github.com/sniffops/sniffops/internal/trace"
+)
+
+// Replay는 기록된 세션의 Tool 호출을 serve와 같은 구성으로 다시 실행합니다.
+//
+// 다시 실행한 호출은 위험도 차단, 승인, 예산, 루프 감지를 똑같이 거치고,
+// trace는 알림과 span 전송을 포함한 같은 backend로 별도의 replay 세션에 기록됩니다.
+// Replay 세션은 Close에서 종료됩니다.
+func (s *Server) Replay(ctx context.Context, sessionID string, opts replay.Options) (*replay.Report, error) {
+	var traces []*trace.Trace
+	err := s.traceStore.Each(&trace.ListFilter{SessionID: sessionID}, func(t *trace.Trace) error {
+		traces = append(traces, t)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(traces) == 0 {
+		return nil, fmt.Errorf("no traces found for session %s", sessionID)
+	}
+
+	session := &trace.Session{
+		ID:          "replay-" + uuid.New().String(),
+		ClientName:  replay.ClientName,
+		StartedAt:   time.Now().UnixMilli(),
+		KubeContext: s.k8sClient.ContextName(),
+	}
+	if cwd, err := os.Getwd(); err == nil {
+		session.Cwd = cwd
+	}
+	if err := s.traceStore.SaveSession(session); err != nil {
+		return nil, err
+	}
+	s.sessionsMu.Lock()
+	s.openSessions[session.ID] = true
+	s.sessionsMu.Unlock()
+
+	// 가장 바깥 backend를 감싸서 다시 실행한 호출의 trace를 원본과 비교
+	recorder := replay.NewRecorder(s.traceBackend())
+	mcpServer := mcp.NewServer(&mcp.Implementation{Name: "sniffops", Version: "v0.1.0"}, nil)
+	tools.RegisterAllTools(
+		mcpServer,
+		s.k8sClient,
+		recorder,
+		s.riskEvaluator,
+		s.approvals,
+		s.meter,
+		s.budgets,
+		s.loops,
+		session.ID,
+	)
+
+	caller, err := replay.Connect(ctx, mcpServer, recorder)
+	if err != nil {
+		return nil, err
+	}
+	defer caller.Close()
+
+	report := replay.Run(ctx, traces, caller, opts)
+	report.SessionID = sessionID
+	report.ReplaySessionID = session.ID
+	report.Context = s.k8sClient.ContextName()
+	return report, nil
+}
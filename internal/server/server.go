@@ -3,17 +3,25 @@ package server
 import (
 	"context"
 	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sniffops/sniffops/internal/approval"
+	"github.com/sniffops/sniffops/internal/budget"
 	"github.com/sniffops/sniffops/internal/k8s"
+	"github.com/sniffops/sniffops/internal/loop"
+	"github.com/sniffops/sniffops/internal/notify"
 	"github.com/sniffops/sniffops/internal/risk"
 	"github.com/sniffops/sniffops/internal/tools"
 	"github.com/sniffops/sniffops/internal/trace"
 )
 
 var (
-	// sessionID는 프로세스 시작 시 한 번 생성되어 모든 trace에 사용됨
+	// sessionID는 프로세스 시작 시 한 번 생성되어 세션 ID가 없는 transport(stdio)의 trace에 사용됨
 	sessionID = uuid.New().String()
 )
 
@@ -23,12 +31,67 @@ type Server struct {
 	sessionID     string
 	k8sClient     *k8s.Client
 	traceStore    *trace.Store
+	traceWriter   *trace.Writer       // Tool 호출 경로의 trace 저장 (비동기 배치)
+	spanExporter  *trace.SpanExporter // OTLP span 전송 (nil이면 비활성화)
+	notifier      *notify.Notifier    // Webhook 알림 (nil이면 비활성화)
 	riskEvaluator *risk.Evaluator
+	approvals     *approval.Manager
+	meter         *trace.Meter    // Tool 호출의 토큰 수와 비용 추정
+	budgets       *budget.Tracker // Tool 호출 예산 (nil이면 제한 없음)
+	loops         *loop.Detector  // 세션별 에이전트 루프 감지
+	retention     *trace.RetentionPolicy
+	tokens        []bearerToken
+	noAuth        bool
+	metrics       bool
+
+	// 아직 종료 시간이 기록되지 않은 MCP 세션 (sessions 테이블)
+	sessionsMu   sync.Mutex
+	openSessions map[string]bool
 }
 
 // Config는 서버 초기화 설정입니다
 type Config struct {
-	TraceDBPath string // SQLite 데이터베이스 경로 (비어있으면 기본 경로)
+	TraceDBPath string // SQLite 데이터베이스 경로 또는 postgres:// DSN (비어있으면 기본 경로)
+	KeyringPath string // trace 출력 암호화 키 파일 (비어있으면 SNIFFOPS_ENCRYPTION_KEY 또는 ~/.sniffops/encryption.key, 없으면 평문 저장)
+	JournalDir  string // DB에 쓸 수 없을 때 trace를 임시 저장할 디렉토리 (비어있으면 ~/.sniffops/journal)
+	PolicyPath  string // Risk policy 파일 경로 (비어있으면 ~/.sniffops/policy.yaml, 없으면 기본 정책)
+	KubeContext string // Kubeconfig context (비어있으면 in-cluster 설정 또는 현재 context)
+
+	// Hash chain 체크포인트 서명 (sniffops keygen으로 생성)
+	CheckpointKeyPath string // 서명 키 경로 (비어있으면 ~/.sniffops/chain.key, 없으면 서명 안 함)
+	CheckpointEvery   int    // 체크포인트 간격 (trace 수, 0이면 기본값 100)
+
+	// Enforcement mode (정책 파일의 enforcement 설정을 덮어씀)
+	Enforce      bool   // true면 임계값 이상의 Tool 호출을 차단
+	MaxRiskLevel string // 전역 임계값 (low, medium, high, critical; 비어있으면 정책 파일 또는 critical)
+
+	// Human approval (sniff_delete, sniff_exec, scale to 0)
+	RequireApproval bool          // true면 critical 작업 전에 사람의 승인 대기
+	ApprovalTimeout time.Duration // 승인 대기 시간 (0이면 기본값 5분, 초과 시 거부)
+
+	// OpenTelemetry collector로 trace를 OTLP/HTTP span으로 전송
+	OTLPEndpoint string   // Collector URL (비어있으면 전송 안 함, 경로가 없으면 /v1/traces 추가)
+	OTLPHeaders  []string // 추가 요청 헤더 ("KEY=VALUE", OTEL_EXPORTER_OTLP_HEADERS에 더해짐)
+
+	// 규칙에 맞는 trace를 webhook으로 알림
+	NotifyPath string // Webhook 설정 파일 경로 (비어있으면 ~/.sniffops/notify.yaml, 없으면 알림 안 함)
+
+	// Tool 호출의 토큰 비용 추정
+	PricingPath string // 모델별 가격표 경로 (비어있으면 ~/.sniffops/pricing.yaml, 없으면 토큰 수만 기록)
+
+	// 세션당/시간당/일일 Tool 호출 예산
+	BudgetPath string // 예산 설정 파일 경로 (비어있으면 ~/.sniffops/budget.yaml, 없으면 제한 없음)
+
+	// 에이전트 루프 감지
+	LoopsPath string // 루프 감지 설정 파일 경로 (비어있으면 ~/.sniffops/loops.yaml, 없으면 trace에 기록만)
+
+	// Trace 보존 정책 (nil이면 백그라운드 정리 비활성화)
+	Retention *trace.RetentionPolicy
+
+	// HTTP transport 인증 (RunHTTP)
+	AuthTokens []string // 허용되는 bearer 토큰 ("TOKEN" 또는 "NAME=TOKEN")
+	NoAuth     bool     // true면 토큰 없이 HTTP transport 허용 (로컬 테스트용)
+	Metrics    bool     // true면 HTTP transport에서 인증 없이 /metrics (Prometheus) 제공
 }
 
 // New는 새로운 SniffOps MCP 서버를 생성합니다
@@ -38,56 +101,237 @@ func New(cfg *Config) (*Server, error) {
 	}
 
 	// 1. K8s client 초기화
-	k8sClient, err := k8s.NewClient()
+	k8sClient, err := k8s.NewClientForContext(cfg.KubeContext)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create K8s client: %w", err)
 	}
 
-	// 2. Trace store 초기화
+	// 2. Risk evaluator 초기화 (잘못된 정책은 시작 단계에서 실패)
+	riskEvaluator, err := risk.LoadEvaluator(cfg.PolicyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load risk policy: %w", err)
+	}
+	if cfg.Enforce || cfg.MaxRiskLevel != "" {
+		var maxLevel risk.RiskLevel
+		if cfg.MaxRiskLevel != "" {
+			maxLevel, err = risk.ParseRiskLevel(cfg.MaxRiskLevel)
+			if err != nil {
+				return nil, fmt.Errorf("invalid max risk level: %w", err)
+			}
+		}
+		riskEvaluator.EnableEnforcement(maxLevel)
+	}
+
+	tokens, err := parseTokens(cfg.AuthTokens)
+	if err != nil {
+		return nil, err
+	}
+
+	// 가격표 로드 (잘못된 가격표는 시작 단계에서 실패)
+	pricing, err := trace.LoadPricing(cfg.PricingPath)
+	if err != nil {
+		return nil, err
+	}
+	budgetConfig, err := budget.LoadConfig(cfg.BudgetPath)
+	if err != nil {
+		return nil, err
+	}
+	loopConfig, err := loop.LoadConfig(cfg.LoopsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. Trace store 초기화 (키가 있으면 input, output, error_message, user_intent 암호화)
+	keyring, err := trace.LoadKeyring(cfg.KeyringPath)
+	if err != nil {
+		return nil, err
+	}
 	traceStore, err := trace.NewStore(cfg.TraceDBPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create trace store: %w", err)
 	}
+	traceStore.SetKeyring(keyring)
 
-	// 3. Risk evaluator 초기화
-	riskEvaluator := risk.NewEvaluator()
+	// 서명 키가 있으면 일정 간격마다 chain head에 서명한 체크포인트 기록
+	if err := enableCheckpoints(traceStore, cfg.CheckpointKeyPath, cfg.CheckpointEvery); err != nil {
+		traceStore.Close()
+		return nil, err
+	}
 
-	// 4. MCP 서버 생성
-	mcpServer := mcp.NewServer(
-		&mcp.Implementation{
-			Name:    "sniffops",
-			Version: "v0.1.0",
-		},
-		nil, // ServerOptions (로깅 등 추가 가능)
-	)
+	// Tool 호출이 DB 쓰기를 기다리지 않도록 trace를 버퍼링해서 배치로 저장
+	journalDir := cfg.JournalDir
+	if journalDir == "" {
+		journalDir, err = trace.DefaultJournalDir()
+		if err != nil {
+			traceStore.Close()
+			return nil, err
+		}
+	}
+	traceWriter := trace.NewWriter(traceStore, trace.WriterConfig{JournalDir: journalDir})
+
+	// Collector가 설정되어 있으면 저장과 함께 span으로 전송
+	var spanExporter *trace.SpanExporter
+	if cfg.OTLPEndpoint != "" {
+		spanExporter, err = newSpanExporter(traceWriter, cfg.OTLPEndpoint, cfg.OTLPHeaders, keyring != nil)
+		if err != nil {
+			traceWriter.Close()
+			traceStore.Close()
+			return nil, err
+		}
+	}
+
+	// Webhook이 설정되어 있으면 규칙에 맞는 trace를 알림 (전송 결과는 webhook_deliveries에 기록)
+	notifyConfig, err := notify.LoadConfig(cfg.NotifyPath)
+	if err != nil {
+		if spanExporter != nil {
+			spanExporter.Close()
+		}
+		traceWriter.Close()
+		traceStore.Close()
+		return nil, err
+	}
+	var notifier *notify.Notifier
+	if notifyConfig != nil && len(notifyConfig.Webhooks) > 0 {
+		var backend trace.Backend = traceWriter
+		if spanExporter != nil {
+			backend = spanExporter
+		}
+		notifier = notify.New(backend, notifyConfig, traceStore)
+		notifier.SetOmitEncrypted(keyring != nil)
+	}
+
+	// 예산이 설정되어 있으면 최근 24시간의 trace로 사용량을 채워서 재시작 후에도 유지
+	var budgets *budget.Tracker
+	if budgetConfig.Enabled() {
+		budgets = budget.NewTracker(budgetConfig)
+		if err := budgets.Load(traceStore); err != nil {
+			if notifier != nil {
+				notifier.Close()
+			}
+			if spanExporter != nil {
+				spanExporter.Close()
+			}
+			traceWriter.Close()
+			traceStore.Close()
+			return nil, fmt.Errorf("failed to load budget usage: %w", err)
+		}
+	}
+
+	// 4. 승인 워크플로우 초기화 (활성화된 경우)
+	var approvals *approval.Manager
+	if cfg.RequireApproval {
+		approvals = approval.NewManager(traceStore, approval.Config{
+			Timeout: cfg.ApprovalTimeout,
+		})
+	}
 
 	s := &Server{
-		mcpServer:     mcpServer,
 		sessionID:     sessionID,
 		k8sClient:     k8sClient,
 		traceStore:    traceStore,
+		traceWriter:   traceWriter,
+		spanExporter:  spanExporter,
+		notifier:      notifier,
 		riskEvaluator: riskEvaluator,
+		approvals:     approvals,
+		meter:         trace.NewMeter(nil, pricing),
+		budgets:       budgets,
+		loops:         loop.NewDetector(loopConfig),
+		retention:     cfg.Retention,
+		tokens:        tokens,
+		noAuth:        cfg.NoAuth,
+		metrics:       cfg.Metrics,
+		openSessions:  make(map[string]bool),
 	}
 
-	// 5. Tool 등록
+	// 5. MCP 서버 생성 (initialize 핸드셰이크 시 클라이언트 세션 기록)
+	s.mcpServer = mcp.NewServer(
+		&mcp.Implementation{
+			Name:    "sniffops",
+			Version: "v0.1.0",
+		},
+		&mcp.ServerOptions{
+			InitializedHandler: s.onInitialized,
+		},
+	)
+
+	// 6. Tool 등록
 	s.registerTools()
 
 	return s, nil
 }
 
+// enableCheckpoints는 체크포인트 서명 키를 로드해 trace store에 설정합니다
+// keyPath가 비어있으면 기본 경로의 키를 사용하고, 키가 없으면 서명하지 않습니다
+func enableCheckpoints(traceStore *trace.Store, keyPath string, every int) error {
+	if keyPath == "" {
+		defaultPath, err := trace.DefaultChainKeyPath()
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(defaultPath); err != nil {
+			return nil
+		}
+		keyPath = defaultPath
+	}
+
+	key, err := trace.LoadChainKey(keyPath)
+	if err != nil {
+		return fmt.Errorf("failed to load checkpoint key: %w", err)
+	}
+	traceStore.EnableCheckpoints(key, every)
+	return nil
+}
+
+// newSpanExporter는 OTEL_EXPORTER_OTLP_HEADERS와 "KEY=VALUE" 헤더로 OTLP span exporter를 생성합니다.
+// trace가 암호화되면(encrypted) 암호화된 필드가 평문으로 collector에 전송되지 않도록 span에서 제외합니다.
+func newSpanExporter(backend trace.Backend, endpoint string, headerFlags []string, encrypted bool) (*trace.SpanExporter, error) {
+	headers, err := trace.ParseOTLPHeaders(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"))
+	if err != nil {
+		return nil, fmt.Errorf("OTEL_EXPORTER_OTLP_HEADERS: %w", err)
+	}
+	for _, value := range headerFlags {
+		key, val, found := strings.Cut(value, "=")
+		if !found || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid OTLP header %q: expected KEY=VALUE", value)
+		}
+		headers[strings.TrimSpace(key)] = val
+	}
+
+	return trace.NewSpanExporter(backend, trace.OTLPConfig{Endpoint: endpoint, Headers: headers, OmitEncrypted: encrypted})
+}
+
+// traceBackend는 Tool 호출이 trace를 저장하는 backend를 반환합니다 (알림, span 전송 순으로 가장 바깥 계층)
+func (s *Server) traceBackend() trace.Backend {
+	if s.notifier != nil {
+		return s.notifier
+	}
+	if s.spanExporter != nil {
+		return s.spanExporter
+	}
+	return s.traceWriter
+}
+
 // registerTools는 모든 MCP Tool을 등록합니다
 func (s *Server) registerTools() {
 	tools.RegisterAllTools(
 		s.mcpServer,
 		s.k8sClient,
-		s.traceStore,
+		s.traceBackend(),
 		s.riskEvaluator,
+		s.approvals,
+		s.meter,
+		s.budgets,
+		s.loops,
 		s.sessionID,
 	)
 }
 
 // Run은 MCP 서버를 stdio transport로 시작합니다
 func (s *Server) Run(ctx context.Context) error {
+	// 보존 정책에 따라 오래된 trace를 백그라운드에서 정리
+	go s.traceStore.RunRetention(ctx, s.retention, "serve")
+
 	// StdioTransport 생성 및 실행
 	transport := &mcp.StdioTransport{}
 
@@ -100,10 +344,35 @@ func (s *Server) Run(ctx context.Context) error {
 
 // Close는 서버 리소스를 정리합니다
 func (s *Server) Close() error {
-	if s.traceStore != nil {
-		return s.traceStore.Close()
+	if s.traceStore == nil {
+		return nil
 	}
-	return nil
+
+	// 대기 중인 webhook 알림 전송 (재시도 포함)
+	if s.notifier != nil {
+		s.notifier.Close()
+	}
+
+	// 버퍼에 남은 trace를 먼저 저장 (실패하면 journal로)
+	if err := s.traceWriter.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	if c := s.traceWriter.Counters(); c.Retried > 0 || c.Dropped > 0 {
+		fmt.Fprintf(os.Stderr, "Trace writer: %d written, %d retried, %d spilled to journal, %d dropped\n",
+			c.Written, c.Retried, c.Spilled, c.Dropped)
+	}
+
+	s.endAllSessions()
+
+	// 세션 root span까지 전송한 뒤 종료
+	if s.spanExporter != nil {
+		s.spanExporter.Close()
+		if c := s.spanExporter.Counters(); c.Failed > 0 || c.Dropped > 0 {
+			fmt.Fprintf(os.Stderr, "OTLP exporter: %d spans exported, %d failed, %d dropped\n",
+				c.Exported, c.Failed, c.Dropped)
+		}
+	}
+	return s.traceStore.Close()
 }
 
 // GetSessionID는 현재 세션 ID를 반환합니다
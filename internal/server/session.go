@@ -0,0 +1,130 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sniffops/sniffops/internal/trace"
+)
+
+// rootsTimeout는 클라이언트에 roots 목록을 요청할 때의 최대 대기 시간입니다
+const rootsTimeout = 5 * time.Second
+
+// onInitialized는 MCP initialize 핸드셰이크가 끝나면 클라이언트 세션을 기록합니다.
+//
+// 세션 ID는 trace와 같은 규칙을 따릅니다: HTTP는 Mcp-Session-Id,
+// stdio는 프로세스 세션 ID를 사용합니다.
+func (s *Server) onInitialized(_ context.Context, req *mcp.InitializedRequest) {
+	ss := req.Session
+
+	session := &trace.Session{
+		ID:        ss.ID(),
+		Transport: "http",
+		StartedAt: time.Now().UnixMilli(),
+	}
+	if session.ID == "" {
+		session.ID, session.Transport = s.sessionID, "stdio"
+	}
+	if s.k8sClient != nil {
+		session.KubeContext = s.k8sClient.ContextName()
+	}
+	if cwd, err := os.Getwd(); err == nil {
+		session.Cwd = cwd
+	}
+
+	var supportsRoots bool
+	if params := ss.InitializeParams(); params != nil {
+		session.ProtocolVersion = params.ProtocolVersion
+		if params.ClientInfo != nil {
+			session.ClientName = params.ClientInfo.Name
+			session.ClientVersion = params.ClientInfo.Version
+		}
+		supportsRoots = params.Capabilities != nil && params.Capabilities.RootsV2 != nil
+	}
+
+	if err := s.traceStore.SaveSession(session); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to save session: %v\n", err)
+		return
+	}
+
+	s.sessionsMu.Lock()
+	s.openSessions[session.ID] = true
+	s.sessionsMu.Unlock()
+
+	// roots 요청은 클라이언트 응답이 필요하므로 핸들러를 막지 않도록 별도 goroutine에서 처리
+	go s.watchSession(ss, session.ID, supportsRoots)
+}
+
+// watchSession은 클라이언트 root로 작업 디렉토리를 갱신하고, 세션이 끝나면 종료 시간을 기록합니다
+func (s *Server) watchSession(ss *mcp.ServerSession, id string, supportsRoots bool) {
+	if supportsRoots {
+		if cwd := s.clientRoot(ss); cwd != "" {
+			if err := s.traceStore.UpdateSessionCwd(id, cwd); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to update session: %v\n", err)
+			}
+		}
+	}
+
+	ss.Wait()
+	s.endSession(id)
+}
+
+// clientRoot는 클라이언트가 알려준 첫 번째 file:// root의 경로를 반환합니다
+func (s *Server) clientRoot(ss *mcp.ServerSession) string {
+	ctx, cancel := context.WithTimeout(context.Background(), rootsTimeout)
+	defer cancel()
+
+	result, err := ss.ListRoots(ctx, nil)
+	if err != nil {
+		return ""
+	}
+
+	for _, root := range result.Roots {
+		u, err := url.Parse(root.URI)
+		if err == nil && u.Scheme == "file" && u.Path != "" {
+			return u.Path
+		}
+	}
+	return ""
+}
+
+// endSession은 열린 세션의 종료 시간을 기록합니다 (이미 종료된 세션은 무시)
+func (s *Server) endSession(id string) {
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+
+	if !s.openSessions[id] {
+		return
+	}
+	delete(s.openSessions, id)
+
+	if err := s.traceStore.EndSession(id, time.Now().UnixMilli()); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to end session: %v\n", err)
+		return
+	}
+
+	// 세션이 끝나면 OTel trace의 root span 전송
+	if s.spanExporter != nil {
+		if session, err := s.traceStore.GetSession(id); err == nil {
+			s.spanExporter.ExportSession(session.Session)
+		}
+	}
+}
+
+// endAllSessions는 서버 종료 시 아직 열려있는 모든 세션을 종료합니다
+func (s *Server) endAllSessions() {
+	s.sessionsMu.Lock()
+	ids := make([]string, 0, len(s.openSessions))
+	for id := range s.openSessions {
+		ids = append(ids, id)
+	}
+	s.sessionsMu.Unlock()
+
+	for _, id := range ids {
+		s.endSession(id)
+	}
+}
@@ -12,27 +12,34 @@ import (
 	"github.com/sniffops/sniffops/internal/k8s"
 	"github.com/sniffops/sniffops/internal/risk"
 	"github.com/sniffops/sniffops/internal/trace"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 // ApplyInput은 sniff_apply Tool의 입력입니다
 type ApplyInput struct {
 	Manifest string `json:"manifest" jsonschema:"Kubernetes resource manifest (YAML or JSON string)"`
+	DryRun   bool   `json:"dry_run,omitempty" jsonschema:"Preview the change with server-side dry run without persisting it (default: false)"`
 }
 
 // ApplyOutput은 sniff_apply Tool의 출력입니다
 type ApplyOutput struct {
-	Applied  interface{} `json:"applied" jsonschema:"Applied resource in JSON format"`
-	Resource string      `json:"resource" jsonschema:"Resource identifier (kind/name)"`
+	Applied  interface{}       `json:"applied" jsonschema:"Applied resource in JSON format (for dry run, the object the API server would produce)"`
+	Resource string            `json:"resource" jsonschema:"Resource identifier (kind/name)"`
+	DryRun   bool              `json:"dry_run,omitempty" jsonschema:"True if the change was not persisted"`
+	Created  bool              `json:"created,omitempty" jsonschema:"True if the dry run would create a new resource"`
+	Diff     []k8s.FieldChange `json:"diff,omitempty" jsonschema:"Field-level diff against the live object (dry run only)"`
 }
 
 // ApplyHandler는 sniff_apply Tool의 핸들러입니다
 //
 // 이 Tool은 Kubernetes 리소스를 apply합니다:
 // - Server-side apply 사용
+// - dry_run이면 server-side dry run으로 결과 객체와 live 객체 대비 diff만 반환
 // - Trace 기록 및 위험도 평가 수행 (기본 high)
 func ApplyHandler(
 	k8sClient *k8s.Client,
-	traceStore *trace.Store,
+	traceStore trace.Backend,
 	riskEvaluator *risk.Evaluator,
 	sessionID string,
 ) mcp.ToolHandlerFor[ApplyInput, ApplyOutput] {
@@ -54,6 +61,9 @@ func ApplyHandler(
 
 		// Build command string
 		command := "kubectl apply -f -"
+		if input.DryRun {
+			command += " --dry-run=server"
+		}
 
 		// User intent 생성
 		userIntent := "Apply Kubernetes resource from manifest"
@@ -61,49 +71,76 @@ func ApplyHandler(
 		// 초기 trace 레코드 생성
 		tr := &trace.Trace{
 			ID:         traceID,
-			SessionID:  sessionID,
+			SessionID:  traceSessionID(req, sessionID),
 			Timestamp:  startTime.UnixMilli(),
 			UserIntent: userIntent,
 			ToolName:   "sniff_apply",
 			Command:    command,
+			DryRun:     input.DryRun,
+		}
+
+		// Manifest 파싱 (위험도 평가를 위해 apply 전에 대상 정보 추출)
+		var namespace, kind, name string
+		if obj, err := k8s.ParseManifest(input.Manifest); err == nil {
+			namespace = obj.GetNamespace()
+			kind = obj.GetKind()
+			name = obj.GetName()
+
+			tr.Namespace = namespace
+			tr.ResourceKind = kind
+			tr.TargetResource = name
+		}
+
+		// 위험도 평가 (apply 전 평가, enforcement mode에서는 차단될 수 있음)
+		if _, err := evaluateRisk(ctx, traceStore, riskEvaluator, tr, risk.EvalContext{
+			ToolName:       "sniff_apply",
+			Namespace:      namespace,
+			ResourceKind:   kind,
+			Action:         "apply",
+			TargetResource: name,
+		}); err != nil {
+			return nil, ApplyOutput{}, err
+		}
+
+		// 변경 전 snapshot과 diff를 위해 live 객체 조회 (없으면 새로 생성되는 리소스)
+		var live *unstructured.Unstructured
+		var notFound bool
+		if kind != "" {
+			obj, err := k8sClient.GetResource(ctx, namespace, kind, name)
+			if err == nil {
+				live = obj
+			} else if apierrors.IsNotFound(err) {
+				notFound = true
+			} else {
+				fmt.Fprintf(os.Stderr, "Warning: failed to get live object for snapshot: %v\n", err)
+			}
 		}
 
 		// K8s API 호출 (Apply)
-		result, execErr := k8sClient.Apply(ctx, input.Manifest)
+		result, execErr := k8sClient.Apply(ctx, input.Manifest, input.DryRun)
 
 		// Trace 완료 처리
 		endTime := time.Now()
 		duration := endTime.Sub(startTime)
 
 		var output ApplyOutput
-		var namespace, kind, name string
-
 		if execErr == nil && result != nil {
-			// Extract metadata for trace
-			namespace = result.GetNamespace()
-			kind = result.GetKind()
-			name = result.GetName()
-
 			output.Applied = result.Object
-			output.Resource = fmt.Sprintf("%s/%s", kind, name)
+			output.Resource = fmt.Sprintf("%s/%s", result.GetKind(), result.GetName())
 
-			tr.Namespace = namespace
-			tr.ResourceKind = kind
-			tr.TargetResource = name
-		}
+			if input.DryRun {
+				output.DryRun = true
+				output.Created = notFound
+				if live != nil || notFound {
+					output.Diff = k8s.DiffObjects(live, result)
+				}
+			}
 
-		// 위험도 평가
-		riskLevel, riskReason := riskEvaluator.Evaluate(risk.EvalContext{
-			ToolName:     "sniff_apply",
-			Namespace:    namespace,
-			ResourceKind: kind,
-			Action:       "apply",
-		})
+			recordSnapshots(tr, live, result)
+		}
 
 		// Trace 레코드 완성
 		tr.LatencyMs = int(duration.Milliseconds())
-		tr.RiskLevel = string(riskLevel)
-		tr.RiskReason = riskReason
 
 		if execErr != nil {
 			tr.Result = "failure"
@@ -116,9 +153,7 @@ func ApplyHandler(
 		}
 
 		// Trace 저장
-		if err := traceStore.Insert(tr); err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: failed to save trace: %v\n", err)
-		}
+		saveTrace(ctx, traceStore, tr)
 
 		// 에러 발생 시 반환
 		if execErr != nil {
@@ -133,6 +168,6 @@ func ApplyHandler(
 func GetApplyToolDefinition() *mcp.Tool {
 	return &mcp.Tool{
 		Name:        "sniff_apply",
-		Description: "Apply a Kubernetes resource using server-side apply. Accepts YAML or JSON manifest. Creates or updates the resource.",
+		Description: "Apply a Kubernetes resource using server-side apply. Accepts YAML or JSON manifest. Creates or updates the resource. Set dry_run to preview the result and a field-level diff against the live object without changing the cluster.",
 	}
 }
@@ -9,6 +9,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sniffops/sniffops/internal/approval"
 	"github.com/sniffops/sniffops/internal/k8s"
 	"github.com/sniffops/sniffops/internal/risk"
 	"github.com/sniffops/sniffops/internal/trace"
@@ -19,25 +20,31 @@ type DeleteInput struct {
 	Namespace string `json:"namespace" jsonschema:"Kubernetes namespace (required for namespaced resources)"`
 	Kind      string `json:"kind" jsonschema:"Resource kind (e.g., Pod, Deployment, Service)"`
 	Name      string `json:"name" jsonschema:"Resource name"`
+	DryRun    bool   `json:"dry_run,omitempty" jsonschema:"Validate the deletion with server-side dry run without deleting (default: false)"`
 }
 
 // DeleteOutput은 sniff_delete Tool의 출력입니다
 type DeleteOutput struct {
-	Deleted  string `json:"deleted" jsonschema:"Deleted resource identifier (kind/name)"`
-	Warning  string `json:"warning,omitempty" jsonschema:"Warning message for critical operations"`
-	RiskInfo string `json:"risk_info,omitempty" jsonschema:"Risk level and reason"`
+	Deleted  string      `json:"deleted" jsonschema:"Deleted resource identifier (kind/name)"`
+	Warning  string      `json:"warning,omitempty" jsonschema:"Warning message for critical operations"`
+	RiskInfo string      `json:"risk_info,omitempty" jsonschema:"Risk level and reason"`
+	DryRun   bool        `json:"dry_run,omitempty" jsonschema:"True if the deletion was not persisted"`
+	Object   interface{} `json:"object,omitempty" jsonschema:"Object that would be deleted (dry run only)"`
 }
 
 // DeleteHandler는 sniff_delete Tool의 핸들러입니다
 //
 // 이 Tool은 Kubernetes 리소스를 삭제합니다:
 // - 위험한 작업이므로 기본 위험도 critical
+// - 승인 워크플로우가 활성화되면 삭제 전 사람의 승인 필요 (dry run 제외)
+// - dry_run이면 server-side dry run으로 검증만 하고 삭제될 객체를 반환
 // - 경고 메시지 포함
 // - Trace 기록 및 위험도 평가 수행
 func DeleteHandler(
 	k8sClient *k8s.Client,
-	traceStore *trace.Store,
+	traceStore trace.Backend,
 	riskEvaluator *risk.Evaluator,
+	approvals *approval.Manager,
 	sessionID string,
 ) mcp.ToolHandlerFor[DeleteInput, DeleteOutput] {
 	return func(
@@ -58,6 +65,9 @@ func DeleteHandler(
 
 		// Build command string
 		command := fmt.Sprintf("kubectl delete %s -n %s %s", input.Kind, input.Namespace, input.Name)
+		if input.DryRun {
+			command += " --dry-run=server"
+		}
 
 		// User intent 생성
 		userIntent := fmt.Sprintf("Delete %s %s in namespace %s", input.Kind, input.Name, input.Namespace)
@@ -65,7 +75,7 @@ func DeleteHandler(
 		// 초기 trace 레코드 생성
 		tr := &trace.Trace{
 			ID:             traceID,
-			SessionID:      sessionID,
+			SessionID:      traceSessionID(req, sessionID),
 			Timestamp:      startTime.UnixMilli(),
 			UserIntent:     userIntent,
 			ToolName:       "sniff_delete",
@@ -73,18 +83,43 @@ func DeleteHandler(
 			Namespace:      input.Namespace,
 			ResourceKind:   input.Kind,
 			TargetResource: input.Name,
+			DryRun:         input.DryRun,
 		}
 
-		// 위험도 평가 (삭제 전 평가)
-		riskLevel, riskReason := riskEvaluator.Evaluate(risk.EvalContext{
-			ToolName:     "sniff_delete",
-			Namespace:    input.Namespace,
-			ResourceKind: input.Kind,
-			Action:       "delete",
+		// 위험도 평가 (삭제 전 평가, enforcement mode에서는 차단될 수 있음)
+		decision, err := evaluateRisk(ctx, traceStore, riskEvaluator, tr, risk.EvalContext{
+			ToolName:       "sniff_delete",
+			Namespace:      input.Namespace,
+			ResourceKind:   input.Kind,
+			Action:         "delete",
+			TargetResource: input.Name,
 		})
+		if err != nil {
+			return nil, DeleteOutput{}, err
+		}
+		riskLevel, riskReason := decision.Level, decision.Reason
+
+		// 사람의 승인 대기 (승인 워크플로우가 활성화된 경우)
+		if err := requireApproval(ctx, req, approvals, traceStore, tr); err != nil {
+			return nil, DeleteOutput{}, err
+		}
+
+		// 변경 전 snapshot을 위해 삭제될 객체를 먼저 조회
+		// (dry run은 조회 실패 시 에러, 실제 삭제는 경고만 출력)
+		var execErr error
+		target, err := k8sClient.GetResource(ctx, input.Namespace, input.Kind, input.Name)
+		if err != nil {
+			if input.DryRun {
+				execErr = err
+			} else {
+				fmt.Fprintf(os.Stderr, "Warning: failed to get object for snapshot: %v\n", err)
+			}
+		}
 
 		// K8s API 호출 (Delete)
-		execErr := k8sClient.Delete(ctx, input.Namespace, input.Kind, input.Name)
+		if execErr == nil {
+			execErr = k8sClient.Delete(ctx, input.Namespace, input.Kind, input.Name, input.DryRun)
+		}
 
 		// Trace 완료 처리
 		endTime := time.Now()
@@ -94,15 +129,22 @@ func DeleteHandler(
 		output.Deleted = fmt.Sprintf("%s/%s", input.Kind, input.Name)
 		output.RiskInfo = fmt.Sprintf("Risk Level: %s - %s", riskLevel, riskReason)
 
-		// 위험도가 critical이면 경고 메시지 추가
-		if riskLevel == risk.RiskCritical {
+		if input.DryRun {
+			output.DryRun = true
+			if target != nil {
+				output.Object = target.Object
+			}
+		} else if riskLevel == risk.RiskCritical {
+			// 위험도가 critical이면 경고 메시지 추가
 			output.Warning = "⚠️  CRITICAL OPERATION: This is a destructive action that cannot be undone. The resource has been permanently deleted."
 		}
 
+		if execErr == nil {
+			recordSnapshots(tr, target, nil)
+		}
+
 		// Trace 레코드 완성
 		tr.LatencyMs = int(duration.Milliseconds())
-		tr.RiskLevel = string(riskLevel)
-		tr.RiskReason = riskReason
 
 		if execErr != nil {
 			tr.Result = "failure"
@@ -115,9 +157,7 @@ func DeleteHandler(
 		}
 
 		// Trace 저장
-		if err := traceStore.Insert(tr); err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: failed to save trace: %v\n", err)
-		}
+		saveTrace(ctx, traceStore, tr)
 
 		// 에러 발생 시 반환
 		if execErr != nil {
@@ -132,6 +172,6 @@ func DeleteHandler(
 func GetDeleteToolDefinition() *mcp.Tool {
 	return &mcp.Tool{
 		Name:        "sniff_delete",
-		Description: "⚠️  Delete a Kubernetes resource. This is a CRITICAL operation that permanently removes the resource. Use with extreme caution.",
+		Description: "⚠️  Delete a Kubernetes resource. This is a CRITICAL operation that permanently removes the resource. Use with extreme caution. Set dry_run to validate the deletion without removing anything.",
 	}
 }
@@ -3,12 +3,12 @@ package tools
 import (
 	"context"
 	"fmt"
-	"os"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sniffops/sniffops/internal/approval"
 	"github.com/sniffops/sniffops/internal/k8s"
 	"github.com/sniffops/sniffops/internal/risk"
 	"github.com/sniffops/sniffops/internal/trace"
@@ -35,12 +35,14 @@ type ExecOutput struct {
 //
 // 이 Tool은 Kubernetes Pod에서 명령을 실행합니다:
 // - 위험한 작업이므로 기본 위험도 critical
+// - 승인 워크플로우가 활성화되면 실행 전 사람의 승인 필요
 // - 경고 메시지 포함
 // - Trace 기록 및 위험도 평가 수행
 func ExecHandler(
 	k8sClient *k8s.Client,
-	traceStore *trace.Store,
+	traceStore trace.Backend,
 	riskEvaluator *risk.Evaluator,
+	approvals *approval.Manager,
 	sessionID string,
 ) mcp.ToolHandlerFor[ExecInput, ExecOutput] {
 	return func(
@@ -73,7 +75,7 @@ func ExecHandler(
 		// 초기 trace 레코드 생성
 		tr := &trace.Trace{
 			ID:             traceID,
-			SessionID:      sessionID,
+			SessionID:      traceSessionID(req, sessionID),
 			Timestamp:      startTime.UnixMilli(),
 			UserIntent:     userIntent,
 			ToolName:       "sniff_exec",
@@ -83,13 +85,23 @@ func ExecHandler(
 			TargetResource: input.Pod,
 		}
 
-		// 위험도 평가 (exec 전 평가)
-		riskLevel, riskReason := riskEvaluator.Evaluate(risk.EvalContext{
-			ToolName:     "sniff_exec",
-			Namespace:    input.Namespace,
-			ResourceKind: "Pod",
-			Action:       "exec",
+		// 위험도 평가 (exec 전 평가, enforcement mode에서는 차단될 수 있음)
+		decision, err := evaluateRisk(ctx, traceStore, riskEvaluator, tr, risk.EvalContext{
+			ToolName:       "sniff_exec",
+			Namespace:      input.Namespace,
+			ResourceKind:   "Pod",
+			Action:         "exec",
+			TargetResource: input.Pod,
 		})
+		if err != nil {
+			return nil, ExecOutput{}, err
+		}
+		riskLevel, riskReason := decision.Level, decision.Reason
+
+		// 사람의 승인 대기 (승인 워크플로우가 활성화된 경우)
+		if err := requireApproval(ctx, req, approvals, traceStore, tr); err != nil {
+			return nil, ExecOutput{}, err
+		}
 
 		// K8s API 호출 (Exec)
 		execOutput, execErr := k8sClient.Exec(ctx, k8s.ExecRequest{
@@ -119,8 +131,6 @@ func ExecHandler(
 
 		// Trace 레코드 완성
 		tr.LatencyMs = int(duration.Milliseconds())
-		tr.RiskLevel = string(riskLevel)
-		tr.RiskReason = riskReason
 
 		if execErr != nil {
 			tr.Result = "failure"
@@ -132,9 +142,7 @@ func ExecHandler(
 		}
 
 		// Trace 저장
-		if err := traceStore.Insert(tr); err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: failed to save trace: %v\n", err)
-		}
+		saveTrace(ctx, traceStore, tr)
 
 		// 에러 발생 시 반환
 		if execErr != nil {
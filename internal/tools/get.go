@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"os"
 	"time"
 
 	"github.com/google/uuid"
@@ -35,7 +34,7 @@ type GetOutput struct {
 // - Trace 기록 및 위험도 평가 수행
 func GetHandler(
 	k8sClient *k8s.Client,
-	traceStore *trace.Store,
+	traceStore trace.Backend,
 	riskEvaluator *risk.Evaluator,
 	sessionID string,
 ) mcp.ToolHandlerFor[GetInput, GetOutput] {
@@ -70,7 +69,7 @@ func GetHandler(
 		// 초기 trace 레코드 생성
 		tr := &trace.Trace{
 			ID:             traceID,
-			SessionID:      sessionID,
+			SessionID:      traceSessionID(req, sessionID),
 			Timestamp:      startTime.UnixMilli(),
 			UserIntent:     userIntent,
 			ToolName:       "sniff_get",
@@ -80,6 +79,16 @@ func GetHandler(
 			TargetResource: input.Name,
 		}
 
+		// 위험도 평가 (조회 전 평가, enforcement mode에서는 차단될 수 있음)
+		if _, err := evaluateRisk(ctx, traceStore, riskEvaluator, tr, risk.EvalContext{
+			ToolName:       "sniff_get",
+			Namespace:      input.Namespace,
+			ResourceKind:   input.Kind,
+			TargetResource: input.Name,
+		}); err != nil {
+			return nil, GetOutput{}, err
+		}
+
 		// K8s API 호출
 		var output GetOutput
 		var execErr error
@@ -108,17 +117,8 @@ func GetHandler(
 		endTime := time.Now()
 		duration := endTime.Sub(startTime)
 
-		// 위험도 평가
-		riskLevel, riskReason := riskEvaluator.Evaluate(risk.EvalContext{
-			ToolName:     "sniff_get",
-			Namespace:    input.Namespace,
-			ResourceKind: input.Kind,
-		})
-
 		// Trace 레코드 완성
 		tr.LatencyMs = int(duration.Milliseconds())
-		tr.RiskLevel = string(riskLevel)
-		tr.RiskReason = riskReason
 
 		if execErr != nil {
 			tr.Result = "failure"
@@ -131,10 +131,7 @@ func GetHandler(
 		}
 
 		// Trace 저장
-		if err := traceStore.Insert(tr); err != nil {
-			// Trace 저장 실패는 로깅만 하고 Tool 실행은 계속
-			fmt.Fprintf(os.Stderr, "Warning: failed to save trace: %v\n", err)
-		}
+		saveTrace(ctx, traceStore, tr)
 
 		// 에러 발생 시 반환
 		if execErr != nil {
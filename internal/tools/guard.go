@@ -0,0 +1,335 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sniffops/sniffops/internal/approval"
+	"github.com/sniffops/sniffops/internal/budget"
+	"github.com/sniffops/sniffops/internal/loop"
+	"github.com/sniffops/sniffops/internal/risk"
+	"github.com/sniffops/sniffops/internal/trace"
+)
+
+// MCP 에러 코드 (JSON-RPC server error 범위 -32000 ~ -32099)
+const (
+	CodeRiskBlocked    = -32001 // enforcement mode에서 차단된 Tool 호출
+	CodeApprovalDenied = -32002 // 사람이 거부했거나 승인 대기 시간이 초과된 Tool 호출
+	CodeBudgetExceeded = -32003 // 세션 또는 시간당/일일 예산을 초과한 Tool 호출
+	CodeLoopDetected   = -32004 // 루프가 감지되어 cooldown 동안 차단된 세션의 Tool 호출
+)
+
+// BlockedError는 차단된 Tool 호출에 대한 MCP 에러의 구조화된 data입니다
+type BlockedError struct {
+	Blocked   bool   `json:"blocked"`
+	TraceID   string `json:"trace_id"`
+	Tool      string `json:"tool"`
+	Namespace string `json:"namespace,omitempty"`
+	RiskLevel string `json:"risk_level"`
+	MaxLevel  string `json:"max_level"`
+	Reason    string `json:"reason"`
+	Rule      string `json:"rule,omitempty"`
+}
+
+// evaluateRisk는 K8s 호출 전에 위험도를 평가하고 trace에 기록합니다.
+//
+// Enforcement mode가 켜져 있고 위험도가 임계값 이상이면 trace를 "blocked"로
+// 저장하고 구조화된 MCP 에러를 반환합니다. 이 경우 핸들러는 K8s API를
+// 호출하지 않고 즉시 에러를 반환해야 합니다.
+// Dry run은 클러스터를 변경하지 않으므로 위험도만 기록하고 차단하지 않습니다.
+func evaluateRisk(
+	ctx context.Context,
+	traceStore trace.Backend,
+	riskEvaluator *risk.Evaluator,
+	tr *trace.Trace,
+	evalCtx risk.EvalContext,
+) (risk.Decision, error) {
+	decision := riskEvaluator.Decide(evalCtx)
+	tr.RiskLevel = string(decision.Level)
+	tr.RiskReason = decision.Reason
+
+	if tr.DryRun {
+		return decision, nil
+	}
+
+	blocked, maxLevel := riskEvaluator.Enforce(evalCtx, decision)
+	if !blocked {
+		return decision, nil
+	}
+
+	message := fmt.Sprintf("blocked by SniffOps enforcement: %s risk is at or above the allowed maximum (%s) - %s",
+		decision.Level, maxLevel, decision.Reason)
+
+	tr.Result = "blocked"
+	tr.ErrorMessage = message
+	tr.LatencyMs = int(time.Since(time.UnixMilli(tr.Timestamp)).Milliseconds())
+	saveTrace(ctx, traceStore, tr)
+
+	data, _ := json.Marshal(BlockedError{
+		Blocked:   true,
+		TraceID:   tr.ID,
+		Tool:      tr.ToolName,
+		Namespace: tr.Namespace,
+		RiskLevel: string(decision.Level),
+		MaxLevel:  string(maxLevel),
+		Reason:    decision.Reason,
+		Rule:      decision.Rule,
+	})
+
+	return decision, &jsonrpc.Error{
+		Code:    CodeRiskBlocked,
+		Message: message,
+		Data:    data,
+	}
+}
+
+// ApprovalDeniedError는 승인되지 않은 Tool 호출에 대한 MCP 에러의 구조화된 data입니다
+type ApprovalDeniedError struct {
+	Denied     bool   `json:"denied"`
+	TraceID    string `json:"trace_id"`
+	Tool       string `json:"tool"`
+	Status     string `json:"status"` // denied, expired
+	DecidedBy  string `json:"decided_by,omitempty"`
+	Method     string `json:"method,omitempty"` // elicitation, queue
+	ApprovalID string `json:"approval_id,omitempty"`
+	Note       string `json:"note,omitempty"`
+}
+
+// requireApproval은 K8s 호출 전에 사람의 승인을 요청합니다.
+//
+// approvals가 nil이거나 (승인 워크플로우 비활성화) dry run이면 즉시 통과합니다.
+// 승인 결과(누가, 언제, 얼마나 대기했는지)는 trace에 기록되며, 거부되거나
+// 시간이 초과되면 trace를 "denied"로 저장하고 구조화된 MCP 에러를 반환합니다.
+func requireApproval(
+	ctx context.Context,
+	req *mcp.CallToolRequest,
+	approvals *approval.Manager,
+	traceStore trace.Backend,
+	tr *trace.Trace,
+) error {
+	if approvals == nil || tr.DryRun {
+		return nil
+	}
+
+	var session *mcp.ServerSession
+	if req != nil {
+		session = req.Session
+	}
+
+	outcome, err := approvals.Request(ctx, session, tr)
+	if err != nil {
+		// 승인 요청 자체가 실패하면 안전하게 거부 처리
+		outcome = &approval.Outcome{
+			Status:    trace.ApprovalDenied,
+			DecidedBy: "sniffops",
+			DecidedAt: time.Now(),
+			Wait:      time.Since(time.UnixMilli(tr.Timestamp)),
+			Note:      fmt.Sprintf("approval request failed: %v", err),
+		}
+	}
+
+	tr.ApprovalStatus = outcome.Status
+	tr.ApprovedBy = outcome.DecidedBy
+	tr.ApprovedAt = outcome.DecidedAt.UnixMilli()
+	tr.ApprovalWaitMs = int(outcome.Wait.Milliseconds())
+
+	if outcome.Approved() {
+		return nil
+	}
+
+	message := fmt.Sprintf("operation not approved (%s by %s)", outcome.Status, outcome.DecidedBy)
+	if outcome.Note != "" {
+		message += ": " + outcome.Note
+	}
+
+	tr.Result = "denied"
+	tr.ErrorMessage = message
+	tr.LatencyMs = int(time.Since(time.UnixMilli(tr.Timestamp)).Milliseconds())
+	saveTrace(ctx, traceStore, tr)
+
+	data, _ := json.Marshal(ApprovalDeniedError{
+		Denied:     true,
+		TraceID:    tr.ID,
+		Tool:       tr.ToolName,
+		Status:     outcome.Status,
+		DecidedBy:  outcome.DecidedBy,
+		Method:     outcome.Method,
+		ApprovalID: outcome.ApprovalID,
+		Note:       outcome.Note,
+	})
+
+	return &jsonrpc.Error{
+		Code:    CodeApprovalDenied,
+		Message: message,
+		Data:    data,
+	}
+}
+
+// BudgetExceededError는 예산을 초과한 Tool 호출에 대한 MCP 에러의 구조화된 data입니다
+type BudgetExceededError struct {
+	BudgetExceeded bool    `json:"budget_exceeded"`
+	TraceID        string  `json:"trace_id"`
+	Tool           string  `json:"tool"`
+	Budget         string  `json:"budget"` // calls_per_session, mutating_calls_per_hour, tokens_per_day, cost_per_day
+	Limit          float64 `json:"limit"`
+	Used           float64 `json:"used"`
+	RetryAfter     string  `json:"retry_after,omitempty"` // RFC 3339, 세션 예산은 없음
+}
+
+// enforceBudget은 핸들러 실행 전에 Tool 호출을 예산과 비교합니다.
+//
+// 예산 안이면 호출을 사용량에 더하고 통과합니다 (이후 위험도 차단이나 승인 거부로
+// 실행되지 않으면 trace 저장 시 사용량에서 되돌림). 초과하면 K8s API를 호출하지
+// 않고 trace를 "budget_exceeded"로 저장한 뒤, 어떤 예산인지 설명하는 구조화된
+// MCP 에러를 반환합니다.
+func enforceBudget(ctx context.Context, g *callGuard, req *mcp.CallToolRequest) error {
+	if g.budgets == nil || req == nil || req.Params == nil {
+		return nil
+	}
+
+	// 대상 namespace와 dry run 여부는 Tool 공통 인자에서 읽음
+	var args struct {
+		Namespace string `json:"namespace"`
+		DryRun    bool   `json:"dry_run"`
+	}
+	_ = json.Unmarshal(req.Params.Arguments, &args)
+
+	tool := req.Params.Name
+	tr := &trace.Trace{
+		ID:        uuid.New().String(),
+		SessionID: traceSessionID(req, g.sessionID),
+		Timestamp: time.Now().UnixMilli(),
+		ToolName:  tool,
+		Command:   tool,
+		Namespace: args.Namespace,
+		DryRun:    args.DryRun,
+	}
+
+	exceeded := g.budgets.Allow(budget.Call{SessionID: tr.SessionID, Tool: tool, DryRun: args.DryRun})
+	if exceeded == nil {
+		return nil
+	}
+
+	decision := g.riskEvaluator.Decide(risk.EvalContext{ToolName: tool, Namespace: args.Namespace})
+	message := exceeded.Error()
+	tr.UserIntent = fmt.Sprintf("Call refused by the %s budget", exceeded.Budget)
+	tr.RiskLevel = string(decision.Level)
+	tr.RiskReason = decision.Reason
+	tr.Result = budget.ResultExceeded
+	tr.ErrorMessage = message
+	saveTrace(ctx, g.traceStore, tr)
+
+	errData := BudgetExceededError{
+		BudgetExceeded: true,
+		TraceID:        tr.ID,
+		Tool:           tool,
+		Budget:         exceeded.Budget,
+		Limit:          exceeded.Limit,
+		Used:           exceeded.Used,
+	}
+	if !exceeded.ResetAt.IsZero() {
+		errData.RetryAfter = exceeded.ResetAt.UTC().Format(time.RFC3339)
+	}
+	data, _ := json.Marshal(errData)
+
+	return &jsonrpc.Error{
+		Code:    CodeBudgetExceeded,
+		Message: message,
+		Data:    data,
+	}
+}
+
+// LoopDetectedError는 루프로 차단된 Tool 호출에 대한 MCP 에러의 구조화된 data입니다
+type LoopDetectedError struct {
+	LoopDetected bool   `json:"loop_detected"`
+	TraceID      string `json:"trace_id"`
+	Tool         string `json:"tool"`
+	Pattern      string `json:"pattern"` // repeated_command, scale_flapping, create_delete_churn, error_storm
+	Message      string `json:"message"`
+	RetryAfter   string `json:"retry_after"` // RFC 3339, cooldown이 끝나는 시각
+}
+
+// enforceLoopBlock은 루프 감지 action이 block일 때 핸들러 실행 전에 세션이 차단
+// 중인지 확인합니다.
+//
+// 세션에서 루프가 감지된 뒤 cooldown 동안에는 K8s API를 호출하지 않고 trace를
+// "loop_blocked"로 저장한 뒤, 감지된 패턴을 설명하는 구조화된 MCP 에러를 반환합니다.
+func enforceLoopBlock(ctx context.Context, g *callGuard, req *mcp.CallToolRequest) error {
+	if g.loops == nil || g.loops.Action() != loop.ActionBlock || req == nil || req.Params == nil {
+		return nil
+	}
+
+	sessionID := traceSessionID(req, g.sessionID)
+	detection, until := g.loops.Blocked(sessionID)
+	if detection == nil {
+		return nil
+	}
+
+	var args struct {
+		Namespace string `json:"namespace"`
+		DryRun    bool   `json:"dry_run"`
+	}
+	_ = json.Unmarshal(req.Params.Arguments, &args)
+
+	tool := req.Params.Name
+	decision := g.riskEvaluator.Decide(risk.EvalContext{ToolName: tool, Namespace: args.Namespace})
+	retryAfter := until.UTC().Format(time.RFC3339)
+	message := fmt.Sprintf("loop detected (%s): %s; calls of this session are refused until %s",
+		detection.Pattern, detection.Message, retryAfter)
+
+	tr := &trace.Trace{
+		ID:           uuid.New().String(),
+		SessionID:    sessionID,
+		Timestamp:    time.Now().UnixMilli(),
+		ToolName:     tool,
+		Command:      tool,
+		Namespace:    args.Namespace,
+		DryRun:       args.DryRun,
+		UserIntent:   fmt.Sprintf("Call refused after a %s loop", detection.Pattern),
+		RiskLevel:    string(decision.Level),
+		RiskReason:   decision.Reason,
+		Result:       loop.ResultBlocked,
+		ErrorMessage: message,
+		Loop:         detection.Pattern,
+	}
+	saveTrace(ctx, g.traceStore, tr)
+
+	data, _ := json.Marshal(LoopDetectedError{
+		LoopDetected: true,
+		TraceID:      tr.ID,
+		Tool:         tool,
+		Pattern:      detection.Pattern,
+		Message:      detection.Message,
+		RetryAfter:   retryAfter,
+	})
+
+	return &jsonrpc.Error{
+		Code:    CodeLoopDetected,
+		Message: message,
+		Data:    data,
+	}
+}
+
+// saveTrace는 trace를 저장합니다.
+// 서버는 trace.Writer를 넘기므로 DB 쓰기를 기다리지 않고 버퍼에 넣은 뒤 바로 반환합니다.
+// Trace 저장 실패는 로깅만 하고 Tool 실행은 계속합니다.
+// guarded로 감싼 호출의 trace는 결과의 토큰 수와 비용을 기록한 뒤 호출이 끝날 때 저장됩니다 (guarded 참고).
+func saveTrace(ctx context.Context, traceStore trace.Backend, tr *trace.Trace) {
+	if recordCall(ctx, traceStore, tr) {
+		return
+	}
+	insertTrace(traceStore, tr)
+}
+
+// insertTrace는 trace를 backend에 저장하고 실패하면 로깅합니다
+func insertTrace(traceStore trace.Backend, tr *trace.Trace) {
+	if err := traceStore.Insert(tr); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to save trace: %v\n", err)
+	}
+}
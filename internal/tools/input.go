@@ -0,0 +1,44 @@
+package tools
+
+import (
+	"encoding/json"
+
+	"github.com/sniffops/sniffops/internal/k8s"
+	"github.com/sniffops/sniffops/internal/trace"
+)
+
+// redactedManifest는 sanitize할 수 없는 manifest 대신 저장되는 값입니다
+const redactedManifest = "[REDACTED]"
+
+// sanitizeInput은 클라이언트가 보낸 Tool 인자(raw JSON)를 trace에 저장할 수 있도록 sanitize합니다.
+//
+// 인자의 민감한 키와 값은 SanitizeOutput과 같은 규칙으로 마스킹합니다.
+// sniff_apply의 manifest는 문자열이라 키 기반 마스킹이 적용되지 않으므로, 파싱해서
+// 스냅샷과 같은 방식으로 sanitize한 JSON으로 바꿉니다 (JSON은 유효한 YAML이므로
+// 그대로 다시 apply할 수 있음). 파싱할 수 없는 manifest(잘못된 YAML, kind나 name
+// 없음)는 Secret data 같은 값이 평문으로 남을 수 있으므로 통째로 "[REDACTED]"로 바꿉니다.
+func sanitizeInput(args string) string {
+	if args == "" {
+		return ""
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(args), &fields); err != nil {
+		return trace.SanitizeOutput(args)
+	}
+
+	if manifest, ok := fields["manifest"].(string); ok {
+		fields["manifest"] = redactedManifest
+		if obj, err := k8s.ParseManifest(manifest); err == nil {
+			if sanitized, _, _ := sanitizeSnapshot(obj); sanitized != "" {
+				fields["manifest"] = sanitized
+			}
+		}
+	}
+
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return trace.SanitizeOutput(args)
+	}
+	return trace.SanitizeOutput(string(data))
+}
@@ -0,0 +1,97 @@
+package tools
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/sniffops/sniffops/internal/k8s"
+)
+
+// storedInput sanitizes args and decodes the stored JSON
+func storedInput(t *testing.T, args string) map[string]interface{} {
+	t.Helper()
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(sanitizeInput(args)), &fields); err != nil {
+		t.Fatalf("stored input is not JSON: %v", err)
+	}
+	return fields
+}
+
+func TestSanitizeInputSecretManifest(t *testing.T) {
+	manifest := `apiVersion: v1
+kind: Secret
+metadata:
+  name: db
+  namespace: default
+type: Opaque
+data:
+  password: aHVudGVyMg==
+stringData:
+  token: s3cr3t-t0ken
+`
+	args, _ := json.Marshal(map[string]interface{}{"manifest": manifest, "namespace": "default"})
+
+	stored := sanitizeInput(string(args))
+	for _, secret := range []string{"aHVudGVyMg==", "s3cr3t-t0ken"} {
+		if strings.Contains(stored, secret) {
+			t.Errorf("stored input has %q: %s", secret, stored)
+		}
+	}
+
+	// The manifest is stored as the sanitized object, which can still be applied
+	fields := storedInput(t, string(args))
+	obj, err := k8s.ParseManifest(fields["manifest"].(string))
+	if err != nil {
+		t.Fatalf("stored manifest can't be parsed: %v", err)
+	}
+	if obj.GetKind() != "Secret" || obj.GetName() != "db" || fields["namespace"] != "default" {
+		t.Errorf("stored input = %v", fields)
+	}
+}
+
+func TestSanitizeInputEnvPassword(t *testing.T) {
+	manifest := `{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"api"},"spec":{"template":{"spec":{"containers":[{"name":"api","image":"api:1","env":[{"name":"DB_PASSWORD","value":"hunter2"},{"name":"LOG_LEVEL","value":"debug"}]}]}}}}`
+	args, _ := json.Marshal(map[string]interface{}{"manifest": manifest})
+
+	stored := sanitizeInput(string(args))
+	if strings.Contains(stored, "hunter2") {
+		t.Errorf("stored input has the password: %s", stored)
+	}
+	if !strings.Contains(stored, "debug") || !strings.Contains(stored, "api:1") {
+		t.Errorf("stored input lost values that are not sensitive: %s", stored)
+	}
+
+	// Sensitive keys of the arguments themselves are masked too
+	stored = sanitizeInput(`{"pod":"api","command":["psql"],"password":"hunter2"}`)
+	if strings.Contains(stored, "hunter2") || !strings.Contains(stored, "psql") {
+		t.Errorf("stored input = %s", stored)
+	}
+}
+
+func TestSanitizeInputUnparsableManifest(t *testing.T) {
+	for name, manifest := range map[string]string{
+		"no name":     "apiVersion: v1\nkind: Secret\ndata:\n  password: aHVudGVyMg==\n",
+		"no kind":     "apiVersion: v1\nmetadata:\n  name: db\ndata:\n  password: aHVudGVyMg==\n",
+		"invalid":     "kind: Secret\ndata: [password: aHVudGVyMg==\n",
+		"not an obj":  "- aHVudGVyMg==\n",
+		"empty value": "",
+	} {
+		args, _ := json.Marshal(map[string]interface{}{"manifest": manifest, "dry_run": true})
+		fields := storedInput(t, string(args))
+		if fields["manifest"] != redactedManifest || fields["dry_run"] != true {
+			t.Errorf("%s: stored input = %v, want the manifest redacted", name, fields)
+		}
+	}
+}
+
+func TestSanitizeInputNotJSON(t *testing.T) {
+	if got := sanitizeInput(""); got != "" {
+		t.Errorf("sanitizeInput(\"\") = %q", got)
+	}
+
+	stored := sanitizeInput("pod=api password=hunter2")
+	if strings.Contains(stored, "hunter2") || !strings.Contains(stored, "pod=api") {
+		t.Errorf("sanitizeInput() = %q, want the text rules applied", stored)
+	}
+}
@@ -3,7 +3,6 @@ package tools
 import (
 	"context"
 	"fmt"
-	"os"
 	"time"
 
 	"github.com/google/uuid"
@@ -33,7 +32,7 @@ type LogsOutput struct {
 // - Trace 기록 및 위험도 평가 수행
 func LogsHandler(
 	k8sClient *k8s.Client,
-	traceStore *trace.Store,
+	traceStore trace.Backend,
 	riskEvaluator *risk.Evaluator,
 	sessionID string,
 ) mcp.ToolHandlerFor[LogsInput, LogsOutput] {
@@ -74,7 +73,7 @@ func LogsHandler(
 		// 초기 trace 레코드 생성
 		tr := &trace.Trace{
 			ID:             traceID,
-			SessionID:      sessionID,
+			SessionID:      traceSessionID(req, sessionID),
 			Timestamp:      startTime.UnixMilli(),
 			UserIntent:     userIntent,
 			ToolName:       "sniff_logs",
@@ -84,6 +83,16 @@ func LogsHandler(
 			TargetResource: input.Pod,
 		}
 
+		// 위험도 평가 (조회 전 평가, enforcement mode에서는 차단될 수 있음)
+		if _, err := evaluateRisk(ctx, traceStore, riskEvaluator, tr, risk.EvalContext{
+			ToolName:       "sniff_logs",
+			Namespace:      input.Namespace,
+			ResourceKind:   "Pod",
+			TargetResource: input.Pod,
+		}); err != nil {
+			return nil, LogsOutput{}, err
+		}
+
 		// K8s API 호출 (Pod 로그 조회)
 		logs, execErr := k8sClient.Logs(ctx, k8s.LogsRequest{
 			Namespace: input.Namespace,
@@ -96,17 +105,8 @@ func LogsHandler(
 		endTime := time.Now()
 		duration := endTime.Sub(startTime)
 
-		// 위험도 평가
-		riskLevel, riskReason := riskEvaluator.Evaluate(risk.EvalContext{
-			ToolName:     "sniff_logs",
-			Namespace:    input.Namespace,
-			ResourceKind: "Pod",
-		})
-
 		// Trace 레코드 완성
 		tr.LatencyMs = int(duration.Milliseconds())
-		tr.RiskLevel = string(riskLevel)
-		tr.RiskReason = riskReason
 
 		var output LogsOutput
 		if execErr != nil {
@@ -130,10 +130,7 @@ func LogsHandler(
 		}
 
 		// Trace 저장
-		if err := traceStore.Insert(tr); err != nil {
-			// Trace 저장 실패는 로깅만 하고 Tool 실행은 계속
-			fmt.Fprintf(os.Stderr, "Warning: failed to save trace: %v\n", err)
-		}
+		saveTrace(ctx, traceStore, tr)
 
 		// 에러 발생 시 반환
 		if execErr != nil {
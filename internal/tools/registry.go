@@ -2,7 +2,10 @@ package tools
 
 import (
 	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sniffops/sniffops/internal/approval"
+	"github.com/sniffops/sniffops/internal/budget"
 	"github.com/sniffops/sniffops/internal/k8s"
+	"github.com/sniffops/sniffops/internal/loop"
 	"github.com/sniffops/sniffops/internal/risk"
 	"github.com/sniffops/sniffops/internal/trace"
 )
@@ -17,14 +20,36 @@ import (
 //   - k8sClient: Kubernetes client for API calls (can be nil for tools that don't need it)
 //   - traceStore: SQLite store for trace recording (can be nil to disable tracing)
 //   - riskEvaluator: Risk evaluator for security assessment (can be nil to skip risk eval)
-//   - sessionID: Session ID for trace records
+//   - approvals: Human approval workflow for critical operations (can be nil to disable)
+//   - meter: Token and cost estimation of tool calls (can be nil to disable)
+//   - budgets: Call, token and cost budgets enforced before each K8s tool call
+//     (can be nil to disable); refused calls get a CodeBudgetExceeded error
+//   - loops: Loop detection over each session's calls (can be nil to disable);
+//     depending on its action, loops are annotated, warned about in the next
+//     tool result, or block the session's calls with a CodeLoopDetected error
+//   - sessionID: Session ID for trace records when the transport has none (stdio);
+//     over streamable HTTP each client's MCP session ID is used instead
 func RegisterAllTools(
 	server *mcp.Server,
 	k8sClient *k8s.Client,
-	traceStore *trace.Store,
+	traceStore trace.Backend,
 	riskEvaluator *risk.Evaluator,
+	approvals *approval.Manager,
+	meter *trace.Meter,
+	budgets *budget.Tracker,
+	loops *loop.Detector,
 	sessionID string,
 ) {
+	// K8s Tool 핸들러 앞에서 루프 감지, 예산 제한과 토큰 측정 적용
+	guard := &callGuard{
+		meter:         meter,
+		budgets:       budgets,
+		loops:         loops,
+		traceStore:    traceStore,
+		riskEvaluator: riskEvaluator,
+		sessionID:     sessionID,
+	}
+
 	// 1. sniff_ping - Health check (no dependencies)
 	mcp.AddTool(
 		server,
@@ -37,7 +62,7 @@ func RegisterAllTools(
 		mcp.AddTool(
 			server,
 			GetGetToolDefinition(),
-			GetHandler(k8sClient, traceStore, riskEvaluator, sessionID),
+			guarded(guard, GetHandler(k8sClient, traceStore, riskEvaluator, sessionID)),
 		)
 	}
 
@@ -46,7 +71,7 @@ func RegisterAllTools(
 		mcp.AddTool(
 			server,
 			GetLogsToolDefinition(),
-			LogsHandler(k8sClient, traceStore, riskEvaluator, sessionID),
+			guarded(guard, LogsHandler(k8sClient, traceStore, riskEvaluator, sessionID)),
 		)
 	}
 
@@ -55,7 +80,7 @@ func RegisterAllTools(
 		mcp.AddTool(
 			server,
 			GetApplyToolDefinition(),
-			ApplyHandler(k8sClient, traceStore, riskEvaluator, sessionID),
+			guarded(guard, ApplyHandler(k8sClient, traceStore, riskEvaluator, sessionID)),
 		)
 	}
 
@@ -64,7 +89,7 @@ func RegisterAllTools(
 		mcp.AddTool(
 			server,
 			GetDeleteToolDefinition(),
-			DeleteHandler(k8sClient, traceStore, riskEvaluator, sessionID),
+			guarded(guard, DeleteHandler(k8sClient, traceStore, riskEvaluator, approvals, sessionID)),
 		)
 	}
 
@@ -73,7 +98,7 @@ func RegisterAllTools(
 		mcp.AddTool(
 			server,
 			GetScaleToolDefinition(),
-			ScaleHandler(k8sClient, traceStore, riskEvaluator, sessionID),
+			guarded(guard, ScaleHandler(k8sClient, traceStore, riskEvaluator, approvals, sessionID)),
 		)
 	}
 
@@ -82,11 +107,20 @@ func RegisterAllTools(
 		mcp.AddTool(
 			server,
 			GetExecToolDefinition(),
-			ExecHandler(k8sClient, traceStore, riskEvaluator, sessionID),
+			guarded(guard, ExecHandler(k8sClient, traceStore, riskEvaluator, approvals, sessionID)),
+		)
+	}
+
+	// 8. sniff_revert - Revert a mutating trace using its before snapshot
+	if k8sClient != nil && traceStore != nil && riskEvaluator != nil {
+		mcp.AddTool(
+			server,
+			GetRevertToolDefinition(),
+			guarded(guard, RevertHandler(k8sClient, traceStore, riskEvaluator, approvals, sessionID)),
 		)
 	}
 
-	// 8. sniff_traces - Query trace records (TASK-010)
+	// 9. sniff_traces - Query trace records (TASK-010)
 	if traceStore != nil {
 		mcp.AddTool(
 			server,
@@ -95,7 +129,7 @@ func RegisterAllTools(
 		)
 	}
 
-	// 9. sniff_stats - Get trace statistics (TASK-010)
+	// 10. sniff_stats - Get trace statistics (TASK-010)
 	if traceStore != nil {
 		mcp.AddTool(
 			server,
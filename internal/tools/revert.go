@@ -0,0 +1,380 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sniffops/sniffops/internal/approval"
+	"github.com/sniffops/sniffops/internal/k8s"
+	"github.com/sniffops/sniffops/internal/risk"
+	"github.com/sniffops/sniffops/internal/trace"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Revert actions
+const (
+	RevertReapply  = "reapply"  // sniff_apply로 변경된 리소스에 이전 spec을 다시 apply
+	RevertDelete   = "delete"   // sniff_apply로 새로 생성된 리소스 삭제
+	RevertScale    = "scale"    // sniff_scale 이전 replica 수로 복원
+	RevertRecreate = "recreate" // sniff_delete로 삭제된 리소스 재생성
+)
+
+// RevertInput은 sniff_revert Tool의 입력입니다
+type RevertInput struct {
+	TraceID string `json:"trace_id" jsonschema:"ID of the sniff_apply, sniff_scale or sniff_delete trace to revert"`
+	Force   bool   `json:"force,omitempty" jsonschema:"Revert even if the resource changed since the trace (default: false)"`
+	DryRun  bool   `json:"dry_run,omitempty" jsonschema:"Preview the revert with server-side dry run without changing the cluster (default: false)"`
+}
+
+// RevertOutput은 sniff_revert Tool의 출력입니다
+type RevertOutput struct {
+	Reverted string            `json:"reverted" jsonschema:"ID of the reverted trace"`
+	TraceID  string            `json:"trace_id" jsonschema:"ID of the trace recording this revert"`
+	Action   string            `json:"action" jsonschema:"Revert action (reapply, delete, scale, recreate)"`
+	Resource string            `json:"resource" jsonschema:"Resource identifier (kind/name)"`
+	DryRun   bool              `json:"dry_run,omitempty" jsonschema:"True if the revert was not persisted"`
+	Diff     []k8s.FieldChange `json:"diff,omitempty" jsonschema:"Field-level changes made by the revert"`
+	RiskInfo string            `json:"risk_info,omitempty" jsonschema:"Risk level and reason"`
+}
+
+// revertPlan은 원래 trace의 snapshot으로부터 계산된 복원 작업입니다
+type revertPlan struct {
+	action    string
+	namespace string
+	kind      string
+	name      string
+
+	restore  *unstructured.Unstructured // reapply/recreate할 객체 (server 관리 필드 제거됨)
+	replicas int32                      // scale 복원 replica 수
+
+	// Drift 검사: trace 직후의 리소스 상태
+	expectExists    bool
+	expectedVersion string
+}
+
+// riskAction은 위험도 평가에 사용할 action 이름을 반환합니다
+func (p *revertPlan) riskAction() string {
+	switch p.action {
+	case RevertReapply, RevertRecreate:
+		return "apply"
+	default:
+		return p.action
+	}
+}
+
+// RevertHandler는 sniff_revert Tool의 핸들러입니다
+//
+// 이 Tool은 mutating trace(sniff_apply, sniff_scale, sniff_delete)를 저장된
+// before snapshot으로 되돌립니다:
+// - apply: 이전 spec 재적용 (새로 생성된 리소스였다면 삭제)
+// - scale: 이전 replica 수로 복원
+// - delete: server 관리 필드를 제거한 객체로 재생성
+// - trace 이후 resourceVersion이 바뀌었으면 force 없이는 거부
+// - Revert 자체도 trace로 기록되며 revert_of로 원래 trace와 연결
+func RevertHandler(
+	k8sClient *k8s.Client,
+	traceStore trace.Backend,
+	riskEvaluator *risk.Evaluator,
+	approvals *approval.Manager,
+	sessionID string,
+) mcp.ToolHandlerFor[RevertInput, RevertOutput] {
+	return func(
+		ctx context.Context,
+		req *mcp.CallToolRequest,
+		input RevertInput,
+	) (*mcp.CallToolResult, RevertOutput, error) {
+		// Context 취소 확인
+		select {
+		case <-ctx.Done():
+			return nil, RevertOutput{}, ctx.Err()
+		default:
+		}
+
+		output, err := Revert(ctx, req, k8sClient, traceStore, riskEvaluator, approvals, sessionID, input)
+		if err != nil {
+			return nil, RevertOutput{}, err
+		}
+
+		return &mcp.CallToolResult{}, output, nil
+	}
+}
+
+// Revert는 trace를 저장된 snapshot으로 되돌리고 그 결과를 trace로 기록합니다.
+// sniff_revert Tool과 `sniffops revert` CLI가 함께 사용하며, CLI에서는 req가 nil입니다.
+func Revert(
+	ctx context.Context,
+	req *mcp.CallToolRequest,
+	k8sClient *k8s.Client,
+	traceStore trace.Backend,
+	riskEvaluator *risk.Evaluator,
+	approvals *approval.Manager,
+	sessionID string,
+	input RevertInput,
+) (RevertOutput, error) {
+	// Trace 시작
+	startTime := time.Now()
+
+	command := "sniffops revert " + input.TraceID
+	if input.Force {
+		command += " --force"
+	}
+	if input.DryRun {
+		command += " --dry-run"
+	}
+
+	tr := &trace.Trace{
+		ID:         uuid.New().String(),
+		SessionID:  traceSessionID(req, sessionID),
+		Timestamp:  startTime.UnixMilli(),
+		UserIntent: fmt.Sprintf("Revert trace %s", input.TraceID),
+		ToolName:   "sniff_revert",
+		Command:    command,
+		DryRun:     input.DryRun,
+		RevertOf:   input.TraceID,
+	}
+
+	// fail은 실패를 trace로 기록하고 에러를 반환합니다
+	fail := func(err error) (RevertOutput, error) {
+		tr.Result = "failure"
+		tr.ErrorMessage = err.Error()
+		tr.LatencyMs = int(time.Since(startTime).Milliseconds())
+		saveTrace(ctx, traceStore, tr)
+		return RevertOutput{}, fmt.Errorf("failed to revert trace %s: %w", input.TraceID, err)
+	}
+
+	// 원래 trace 조회 및 복원 계획 수립
+	var plan *revertPlan
+	original, err := traceStore.GetByID(input.TraceID)
+	if err == nil {
+		plan, err = planRevert(original)
+	}
+	if err != nil {
+		// K8s 호출 전에 거부된 경우
+		tr.RiskLevel = string(risk.RiskLow)
+		tr.RiskReason = "Revert refused before any cluster call"
+		return fail(err)
+	}
+
+	tr.Namespace = plan.namespace
+	tr.ResourceKind = plan.kind
+	tr.TargetResource = plan.name
+
+	// 위험도 평가 (enforcement mode에서는 차단될 수 있음)
+	decision, err := evaluateRisk(ctx, traceStore, riskEvaluator, tr, risk.EvalContext{
+		ToolName:       "sniff_revert",
+		Namespace:      plan.namespace,
+		ResourceKind:   plan.kind,
+		Action:         plan.riskAction(),
+		ResourceCount:  int(plan.replicas),
+		TargetResource: plan.name,
+	})
+	if err != nil {
+		return RevertOutput{}, err
+	}
+
+	// Drift 검사: trace 이후 리소스가 변경되었으면 force 없이는 거부
+	live, err := k8sClient.GetResource(ctx, plan.namespace, plan.kind, plan.name)
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return fail(err)
+		}
+		live = nil
+	}
+	if err := checkDrift(plan, live, input.TraceID, input.Force); err != nil {
+		return fail(err)
+	}
+	// Apply 시점까지의 변경도 막기 위해 resourceVersion을 precondition으로 사용
+	if !input.Force && plan.restore != nil && live != nil {
+		plan.restore.SetResourceVersion(live.GetResourceVersion())
+	}
+
+	// 삭제와 scale to 0은 사람의 승인 대기 (승인 워크플로우가 활성화된 경우)
+	if plan.action == RevertDelete || (plan.action == RevertScale && plan.replicas == 0) {
+		if err := requireApproval(ctx, req, approvals, traceStore, tr); err != nil {
+			return RevertOutput{}, err
+		}
+	}
+
+	// K8s API 호출
+	var result *unstructured.Unstructured
+	var execErr error
+	switch plan.action {
+	case RevertReapply, RevertRecreate:
+		manifest, err := json.Marshal(plan.restore.Object)
+		if err != nil {
+			return fail(fmt.Errorf("failed to marshal snapshot: %w", err))
+		}
+		result, execErr = k8sClient.Apply(ctx, string(manifest), input.DryRun)
+	case RevertScale:
+		result, execErr = k8sClient.Scale(ctx, plan.namespace, plan.kind, plan.name, plan.replicas, input.DryRun)
+	case RevertDelete:
+		execErr = k8sClient.Delete(ctx, plan.namespace, plan.kind, plan.name, input.DryRun)
+	}
+	if execErr != nil {
+		return fail(execErr)
+	}
+
+	recordSnapshots(tr, live, result)
+
+	output := RevertOutput{
+		Reverted: input.TraceID,
+		TraceID:  tr.ID,
+		Action:   plan.action,
+		Resource: fmt.Sprintf("%s/%s", plan.kind, plan.name),
+		DryRun:   input.DryRun,
+		RiskInfo: fmt.Sprintf("Risk Level: %s - %s", decision.Level, decision.Reason),
+	}
+	if result != nil {
+		output.Diff = k8s.DiffObjects(live, result)
+	}
+
+	// Trace 레코드 완성
+	tr.Result = "success"
+	tr.LatencyMs = int(time.Since(startTime).Milliseconds())
+	outputJSON, _ := json.Marshal(output)
+	tr.Output = trace.SanitizeOutput(string(outputJSON))
+
+	// Trace 저장
+	saveTrace(ctx, traceStore, tr)
+
+	return output, nil
+}
+
+// planRevert는 원래 trace의 snapshot으로부터 복원 작업을 계산합니다
+func planRevert(original *trace.Trace) (*revertPlan, error) {
+	switch original.ToolName {
+	case "sniff_apply", "sniff_scale", "sniff_delete":
+	default:
+		return nil, fmt.Errorf("only sniff_apply, sniff_scale and sniff_delete traces can be reverted (trace is %s)", original.ToolName)
+	}
+	if original.Result != "success" {
+		return nil, fmt.Errorf("trace did not succeed (result: %s), nothing to revert", original.Result)
+	}
+	if original.DryRun {
+		return nil, fmt.Errorf("trace was a dry run, nothing to revert")
+	}
+
+	before, err := parseSnapshot(original.BeforeSnapshot)
+	if err != nil {
+		return nil, fmt.Errorf("invalid before snapshot: %w", err)
+	}
+	after, err := parseSnapshot(original.AfterSnapshot)
+	if err != nil {
+		return nil, fmt.Errorf("invalid after snapshot: %w", err)
+	}
+	if before == nil && after == nil {
+		return nil, fmt.Errorf("trace has no resource snapshots")
+	}
+
+	plan := &revertPlan{
+		namespace: original.Namespace,
+		kind:      original.ResourceKind,
+		name:      original.TargetResource,
+	}
+	if after != nil {
+		plan.expectExists = true
+		plan.expectedVersion = after.GetResourceVersion()
+	}
+
+	switch original.ToolName {
+	case "sniff_apply":
+		if before == nil {
+			// Apply가 리소스를 새로 생성한 경우
+			plan.action = RevertDelete
+		} else {
+			plan.action = RevertReapply
+			plan.restore = k8s.StripServerFields(before)
+		}
+
+	case "sniff_scale":
+		if before == nil {
+			return nil, fmt.Errorf("trace has no before snapshot")
+		}
+		replicas, found, err := unstructured.NestedInt64(before.Object, "spec", "replicas")
+		if err != nil || !found {
+			return nil, fmt.Errorf("before snapshot has no spec.replicas")
+		}
+		plan.action = RevertScale
+		plan.replicas = int32(replicas)
+
+	case "sniff_delete":
+		if before == nil {
+			return nil, fmt.Errorf("trace has no before snapshot")
+		}
+		plan.action = RevertRecreate
+		plan.restore = k8s.StripServerFields(before)
+	}
+
+	// Sanitize된 값은 복원할 수 없음 (예: Secret, ConfigMap data, URL credential)
+	// 마스킹 여부가 기록되기 전의 trace는 마스킹 표시로 판단
+	if plan.restore != nil && (original.BeforeSnapshotRedacted || trace.HasRedactionMarker(original.BeforeSnapshot)) {
+		return nil, fmt.Errorf("before snapshot contains redacted values (e.g., Secret or ConfigMap data, or credentials) and cannot be restored")
+	}
+
+	// Snapshot 정보로 대상 보완 (trace 필드가 비어 있는 경우)
+	snapshot := before
+	if snapshot == nil {
+		snapshot = after
+	}
+	if plan.kind == "" {
+		plan.kind = snapshot.GetKind()
+	}
+	if plan.name == "" {
+		plan.name = snapshot.GetName()
+	}
+	if plan.namespace == "" {
+		plan.namespace = snapshot.GetNamespace()
+	}
+
+	return plan, nil
+}
+
+// checkDrift는 trace 이후 리소스가 변경되었는지 확인합니다 (force면 검사하지 않음)
+func checkDrift(plan *revertPlan, live *unstructured.Unstructured, traceID string, force bool) error {
+	if force {
+		return nil
+	}
+
+	resource := fmt.Sprintf("%s/%s", plan.kind, plan.name)
+
+	switch {
+	case plan.expectExists && live == nil:
+		return fmt.Errorf("%s no longer exists (deleted after trace %s); use force to revert anyway", resource, traceID)
+	case !plan.expectExists && live != nil && live.GetDeletionTimestamp() != nil:
+		return fmt.Errorf("%s is still being deleted; retry once it is gone", resource)
+	case !plan.expectExists && live != nil:
+		return fmt.Errorf("%s was re-created after trace %s; use force to revert anyway", resource, traceID)
+	case plan.expectExists && plan.expectedVersion != "" && live.GetResourceVersion() != plan.expectedVersion:
+		return fmt.Errorf("%s changed after trace %s (resourceVersion %s, now %s); use force to revert anyway",
+			resource, traceID, plan.expectedVersion, live.GetResourceVersion())
+	}
+
+	return nil
+}
+
+// parseSnapshot은 trace에 저장된 snapshot JSON을 객체로 변환합니다 (비어 있으면 nil)
+func parseSnapshot(snapshot string) (*unstructured.Unstructured, error) {
+	if snapshot == "" {
+		return nil, nil
+	}
+
+	obj := &unstructured.Unstructured{}
+	if err := obj.UnmarshalJSON([]byte(snapshot)); err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+// GetRevertToolDefinition은 sniff_revert Tool의 MCP Tool 정의를 반환합니다
+func GetRevertToolDefinition() *mcp.Tool {
+	return &mcp.Tool{
+		Name:        "sniff_revert",
+		Description: "Revert a previous sniff_apply, sniff_scale or sniff_delete call using its stored before-snapshot: re-applies the old spec, restores the replica count, or re-creates the deleted object. Refuses if the resource changed since the trace unless force is set. Set dry_run to preview.",
+	}
+}
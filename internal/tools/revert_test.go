@@ -0,0 +1,231 @@
+package tools
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sniffops/sniffops/internal/trace"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	deploymentBefore = `{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"web","namespace":"default","uid":"u1","resourceVersion":"4"},"spec":{"replicas":3,"template":{"spec":{"containers":[{"name":"web","image":"nginx:1"}]}}},"status":{"readyReplicas":3}}`
+	deploymentAfter  = `{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"web","namespace":"default","uid":"u1","resourceVersion":"5"},"spec":{"replicas":0,"template":{"spec":{"containers":[{"name":"web","image":"nginx:2"}]}}}}`
+	secretSnapshot   = `{"apiVersion":"v1","kind":"Secret","metadata":{"name":"db","namespace":"default","resourceVersion":"7"},"data":{"password":"[REDACTED]"}}`
+	dbURLDeployment  = `{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"web","namespace":"default","resourceVersion":"4"},"spec":{"replicas":3,"template":{"spec":{"containers":[{"name":"web","image":"nginx:1","env":[{"name":"DATABASE","value":"postgres://app:hunter2@db:5432/app"}]}]}}}}`
+)
+
+func mutation(tool, before, after string) *trace.Trace {
+	return &trace.Trace{
+		ID:             "t1",
+		ToolName:       tool,
+		Namespace:      "default",
+		ResourceKind:   "Deployment",
+		TargetResource: "web",
+		Result:         "success",
+		BeforeSnapshot: before,
+		AfterSnapshot:  after,
+	}
+}
+
+func TestPlanRevert(t *testing.T) {
+	tests := []struct {
+		name         string
+		original     *trace.Trace
+		wantAction   string
+		wantReplicas int32
+		wantExists   bool
+		wantVersion  string
+		wantImage    string // Container image of the object to restore
+	}{
+		{
+			name:        "created by apply",
+			original:    mutation("sniff_apply", "", deploymentAfter),
+			wantAction:  RevertDelete,
+			wantExists:  true,
+			wantVersion: "5",
+		},
+		{
+			name:        "updated by apply",
+			original:    mutation("sniff_apply", deploymentBefore, deploymentAfter),
+			wantAction:  RevertReapply,
+			wantExists:  true,
+			wantVersion: "5",
+			wantImage:   "nginx:1",
+		},
+		{
+			name:         "scaled",
+			original:     mutation("sniff_scale", deploymentBefore, deploymentAfter),
+			wantAction:   RevertScale,
+			wantReplicas: 3,
+			wantExists:   true,
+			wantVersion:  "5",
+		},
+		{
+			name:       "deleted",
+			original:   mutation("sniff_delete", deploymentBefore, ""),
+			wantAction: RevertRecreate,
+			wantImage:  "nginx:1",
+		},
+		{
+			// Nothing is restored from the snapshot, so redacted data doesn't matter
+			name:        "secret created by apply",
+			original:    mutation("sniff_apply", "", secretSnapshot),
+			wantAction:  RevertDelete,
+			wantExists:  true,
+			wantVersion: "7",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := planRevert(tt.original)
+			if err != nil {
+				t.Fatalf("planRevert() error = %v", err)
+			}
+			if plan.action != tt.wantAction || plan.replicas != tt.wantReplicas {
+				t.Errorf("action = %s, replicas = %d", plan.action, plan.replicas)
+			}
+			if plan.expectExists != tt.wantExists || plan.expectedVersion != tt.wantVersion {
+				t.Errorf("expectExists = %v, expectedVersion = %q", plan.expectExists, plan.expectedVersion)
+			}
+			if plan.namespace != "default" || plan.kind != tt.original.ResourceKind || plan.name != tt.original.TargetResource {
+				t.Errorf("target = %s/%s/%s", plan.namespace, plan.kind, plan.name)
+			}
+
+			if tt.wantImage == "" {
+				if plan.restore != nil {
+					t.Errorf("restore = %v, want nothing to restore", plan.restore.Object)
+				}
+				return
+			}
+			containers, _, _ := unstructured.NestedSlice(plan.restore.Object, "spec", "template", "spec", "containers")
+			if len(containers) != 1 || containers[0].(map[string]interface{})["image"] != tt.wantImage {
+				t.Errorf("restored containers = %v", containers)
+			}
+			// Server-managed fields are not restored
+			if plan.restore.GetResourceVersion() != "" || plan.restore.GetUID() != "" || plan.restore.Object["status"] != nil {
+				t.Errorf("restore keeps server-managed fields: %v", plan.restore.Object)
+			}
+		})
+	}
+}
+
+func TestPlanRevertTargetFromSnapshot(t *testing.T) {
+	original := mutation("sniff_delete", secretSnapshot, "")
+	original.Namespace, original.ResourceKind, original.TargetResource = "", "", ""
+	original.BeforeSnapshot = strings.Replace(secretSnapshot, `"[REDACTED]"`, `"c2VjcmV0"`, 1)
+
+	plan, err := planRevert(original)
+	if err != nil {
+		t.Fatalf("planRevert() error = %v", err)
+	}
+	if plan.namespace != "default" || plan.kind != "Secret" || plan.name != "db" {
+		t.Errorf("target = %s/%s/%s, want it from the snapshot", plan.namespace, plan.kind, plan.name)
+	}
+}
+
+func TestPlanRevertRefused(t *testing.T) {
+	failed := mutation("sniff_scale", deploymentBefore, deploymentAfter)
+	failed.Result = "failure"
+	dryRun := mutation("sniff_delete", deploymentBefore, "")
+	dryRun.DryRun = true
+	secret := mutation("sniff_delete", secretSnapshot, "")
+	secret.ResourceKind, secret.TargetResource = "Secret", "db"
+
+	// A URL credential in the env is masked as ***:***@ when the snapshot is recorded
+	dbURL := &trace.Trace{ID: "t1", ToolName: "sniff_delete", Result: "success"}
+	recordSnapshots(dbURL, parseObject(t, dbURLDeployment), nil)
+	if !dbURL.BeforeSnapshotRedacted || strings.Contains(dbURL.BeforeSnapshot, "hunter2") {
+		t.Fatalf("recorded snapshot = %s (redacted: %v), want the credential masked and flagged", dbURL.BeforeSnapshot, dbURL.BeforeSnapshotRedacted)
+	}
+	// Traces recorded before the flag are refused by the masking marker
+	legacyDBURL := mutation("sniff_delete", dbURL.BeforeSnapshot, "")
+	// The flag is enough, whatever the masked value looks like
+	flagged := mutation("sniff_apply", deploymentBefore, deploymentAfter)
+	flagged.BeforeSnapshotRedacted = true
+
+	tests := []struct {
+		name     string
+		original *trace.Trace
+		want     string
+	}{
+		{"not a mutation", mutation("sniff_get", "", ""), "only sniff_apply, sniff_scale and sniff_delete"},
+		{"failed", failed, "did not succeed (result: failure)"},
+		{"dry run", dryRun, "was a dry run"},
+		{"no snapshots", mutation("sniff_apply", "", ""), "no resource snapshots"},
+		{"invalid snapshot", mutation("sniff_apply", "{", ""), "invalid before snapshot"},
+		{"scale without before", mutation("sniff_scale", "", deploymentAfter), "no before snapshot"},
+		{"scale without replicas", mutation("sniff_scale", secretSnapshot, deploymentAfter), "no spec.replicas"},
+		{"delete without before", mutation("sniff_delete", "", deploymentAfter), "no before snapshot"},
+		{"redacted snapshot", secret, "redacted values"},
+		{"redacted reapply", mutation("sniff_apply", secretSnapshot, secretSnapshot), "redacted values"},
+		{"URL credential", dbURL, "redacted values"},
+		{"URL credential before the flag", legacyDBURL, "redacted values"},
+		{"flagged snapshot", flagged, "redacted values"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := planRevert(tt.original)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("planRevert() = %+v, %v, want error containing %q", plan, err, tt.want)
+			}
+		})
+	}
+}
+
+// parseObject decodes a JSON object for recordSnapshots
+func parseObject(t *testing.T, data string) *unstructured.Unstructured {
+	t.Helper()
+	obj := &unstructured.Unstructured{}
+	if err := obj.UnmarshalJSON([]byte(data)); err != nil {
+		t.Fatalf("UnmarshalJSON() error = %v", err)
+	}
+	return obj
+}
+
+func TestCheckDrift(t *testing.T) {
+	live := func(version string, deleting bool) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetResourceVersion(version)
+		if deleting {
+			now := metav1.Now()
+			obj.SetDeletionTimestamp(&now)
+		}
+		return obj
+	}
+	existing := &revertPlan{kind: "Deployment", name: "web", expectExists: true, expectedVersion: "5"}
+	deleted := &revertPlan{kind: "Deployment", name: "web"}
+
+	tests := []struct {
+		name string
+		plan *revertPlan
+		live *unstructured.Unstructured
+		want string // Expected error without force ("" if none)
+	}{
+		{"unchanged", existing, live("5", false), ""},
+		{"changed", existing, live("9", false), "changed after trace t1 (resourceVersion 5, now 9)"},
+		{"deleted since", existing, nil, "no longer exists"},
+		{"still deleted", deleted, nil, ""},
+		{"re-created", deleted, live("12", false), "was re-created after trace t1"},
+		{"being deleted", deleted, live("12", true), "still being deleted"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkDrift(tt.plan, tt.live, "t1", false)
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("checkDrift() error = %v", err)
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Errorf("checkDrift() = %v, want error containing %q", err, tt.want)
+			}
+
+			if err := checkDrift(tt.plan, tt.live, "t1", true); err != nil {
+				t.Errorf("checkDrift() with force error = %v", err)
+			}
+		})
+	}
+}
@@ -4,11 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"os"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sniffops/sniffops/internal/approval"
 	"github.com/sniffops/sniffops/internal/k8s"
 	"github.com/sniffops/sniffops/internal/risk"
 	"github.com/sniffops/sniffops/internal/trace"
@@ -19,25 +19,30 @@ type ScaleInput struct {
 	Namespace string `json:"namespace" jsonschema:"Kubernetes namespace"`
 	Name      string `json:"name" jsonschema:"Resource name (Deployment or StatefulSet)"`
 	Replicas  int32  `json:"replicas" jsonschema:"Target replica count"`
+	DryRun    bool   `json:"dry_run,omitempty" jsonschema:"Preview the result with server-side dry run without scaling (default: false)"`
 }
 
 // ScaleOutput은 sniff_scale Tool의 출력입니다
 type ScaleOutput struct {
-	Scaled   string `json:"scaled" jsonschema:"Scaled resource identifier"`
-	Replicas int32  `json:"replicas" jsonschema:"New replica count"`
-	Warning  string `json:"warning,omitempty" jsonschema:"Warning message for risky operations"`
-	RiskInfo string `json:"risk_info,omitempty" jsonschema:"Risk level and reason"`
+	Scaled   string      `json:"scaled" jsonschema:"Scaled resource identifier"`
+	Replicas int32       `json:"replicas" jsonschema:"New replica count"`
+	Warning  string      `json:"warning,omitempty" jsonschema:"Warning message for risky operations"`
+	RiskInfo string      `json:"risk_info,omitempty" jsonschema:"Risk level and reason"`
+	DryRun   bool        `json:"dry_run,omitempty" jsonschema:"True if the change was not persisted"`
+	Object   interface{} `json:"object,omitempty" jsonschema:"Object the API server would produce (dry run only)"`
 }
 
 // ScaleHandler는 sniff_scale Tool의 핸들러입니다
 //
 // 이 Tool은 Kubernetes Deployment/StatefulSet을 스케일합니다:
-// - Scale to 0은 critical 위험도
+// - Scale to 0은 critical 위험도 (승인 워크플로우가 활성화되면 사람의 승인 필요)
+// - dry_run이면 server-side dry run으로 스케일된 객체만 반환
 // - Trace 기록 및 위험도 평가 수행
 func ScaleHandler(
 	k8sClient *k8s.Client,
-	traceStore *trace.Store,
+	traceStore trace.Backend,
 	riskEvaluator *risk.Evaluator,
+	approvals *approval.Manager,
 	sessionID string,
 ) mcp.ToolHandlerFor[ScaleInput, ScaleOutput] {
 	return func(
@@ -58,6 +63,9 @@ func ScaleHandler(
 
 		// Build command string (assume Deployment by default)
 		command := fmt.Sprintf("kubectl scale deployment -n %s %s --replicas=%d", input.Namespace, input.Name, input.Replicas)
+		if input.DryRun {
+			command += " --dry-run=server"
+		}
 
 		// User intent 생성
 		userIntent := fmt.Sprintf("Scale %s to %d replicas in namespace %s", input.Name, input.Replicas, input.Namespace)
@@ -65,7 +73,7 @@ func ScaleHandler(
 		// 초기 trace 레코드 생성
 		tr := &trace.Trace{
 			ID:             traceID,
-			SessionID:      sessionID,
+			SessionID:      traceSessionID(req, sessionID),
 			Timestamp:      startTime.UnixMilli(),
 			UserIntent:     userIntent,
 			ToolName:       "sniff_scale",
@@ -73,28 +81,44 @@ func ScaleHandler(
 			Namespace:      input.Namespace,
 			ResourceKind:   "Deployment", // 일반적으로 Deployment
 			TargetResource: input.Name,
+			DryRun:         input.DryRun,
 		}
 
-		// 위험도 평가 (scale 전 평가)
-		riskLevel, riskReason := riskEvaluator.Evaluate(risk.EvalContext{
-			ToolName:      "sniff_scale",
-			Namespace:     input.Namespace,
-			ResourceKind:  "Deployment",
-			Action:        "scale",
-			ResourceCount: int(input.Replicas),
+		// 위험도 평가 (scale 전 평가, enforcement mode에서는 차단될 수 있음)
+		decision, err := evaluateRisk(ctx, traceStore, riskEvaluator, tr, risk.EvalContext{
+			ToolName:       "sniff_scale",
+			Namespace:      input.Namespace,
+			ResourceKind:   "Deployment",
+			Action:         "scale",
+			ResourceCount:  int(input.Replicas),
+			TargetResource: input.Name,
 		})
+		if err != nil {
+			return nil, ScaleOutput{}, err
+		}
+		riskLevel, riskReason := decision.Level, decision.Reason
+
+		// Scale to 0은 사람의 승인 대기 (승인 워크플로우가 활성화된 경우)
+		if input.Replicas == 0 {
+			if err := requireApproval(ctx, req, approvals, traceStore, tr); err != nil {
+				return nil, ScaleOutput{}, err
+			}
+		}
 
 		// K8s API 호출 (Scale) - try Deployment first, then StatefulSet
 		var execErr error
 		var kind string
 
-		// Try Deployment first
-		_, err := k8sClient.Scale(ctx, input.Namespace, "Deployment", input.Name, input.Replicas)
+		// Try Deployment first (변경 전 snapshot을 위해 live 객체를 먼저 조회)
+		before, _ := k8sClient.GetResource(ctx, input.Namespace, "Deployment", input.Name)
+		result, err := k8sClient.Scale(ctx, input.Namespace, "Deployment", input.Name, input.Replicas, input.DryRun)
 		if err == nil {
 			kind = "Deployment"
 		} else {
 			// Try StatefulSet if Deployment fails
-			_, err2 := k8sClient.Scale(ctx, input.Namespace, "StatefulSet", input.Name, input.Replicas)
+			var err2 error
+			before, _ = k8sClient.GetResource(ctx, input.Namespace, "StatefulSet", input.Name)
+			result, err2 = k8sClient.Scale(ctx, input.Namespace, "StatefulSet", input.Name, input.Replicas, input.DryRun)
 			if err2 == nil {
 				kind = "StatefulSet"
 			} else {
@@ -113,20 +137,24 @@ func ScaleHandler(
 			output.Replicas = input.Replicas
 			output.RiskInfo = fmt.Sprintf("Risk Level: %s - %s", riskLevel, riskReason)
 
-			// Scale to 0은 critical
-			if input.Replicas == 0 {
+			if input.DryRun {
+				output.DryRun = true
+				if result != nil {
+					output.Object = result.Object
+				}
+			} else if input.Replicas == 0 {
+				// Scale to 0은 critical
 				output.Warning = "⚠️  CRITICAL: Scaled to 0 replicas. Service will be unavailable until scaled back up."
 			} else if riskLevel == risk.RiskCritical || riskLevel == risk.RiskHigh {
 				output.Warning = fmt.Sprintf("⚠️  %s: This scaling operation may affect service availability.", riskLevel)
 			}
 
 			tr.ResourceKind = kind
+			recordSnapshots(tr, before, result)
 		}
 
 		// Trace 레코드 완성
 		tr.LatencyMs = int(duration.Milliseconds())
-		tr.RiskLevel = string(riskLevel)
-		tr.RiskReason = riskReason
 
 		if execErr != nil {
 			tr.Result = "failure"
@@ -139,9 +167,7 @@ func ScaleHandler(
 		}
 
 		// Trace 저장
-		if err := traceStore.Insert(tr); err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: failed to save trace: %v\n", err)
-		}
+		saveTrace(ctx, traceStore, tr)
 
 		// 에러 발생 시 반환
 		if execErr != nil {
@@ -156,6 +182,6 @@ func ScaleHandler(
 func GetScaleToolDefinition() *mcp.Tool {
 	return &mcp.Tool{
 		Name:        "sniff_scale",
-		Description: "Scale a Kubernetes Deployment or StatefulSet to a specified number of replicas. ⚠️  Scaling to 0 will make the service unavailable.",
+		Description: "Scale a Kubernetes Deployment or StatefulSet to a specified number of replicas. ⚠️  Scaling to 0 will make the service unavailable. Set dry_run to preview the result without scaling.",
 	}
 }
@@ -0,0 +1,17 @@
+package tools
+
+import "github.com/modelcontextprotocol/go-sdk/mcp"
+
+// traceSessionID는 trace에 기록할 세션 ID를 반환합니다.
+//
+// Streamable HTTP transport에서는 MCP 클라이언트마다 고유한 세션 ID(Mcp-Session-Id)가
+// 있으므로 그 값을 사용하고, 세션 ID가 없는 stdio transport에서는 프로세스 세션 ID를
+// 사용합니다.
+func traceSessionID(req *mcp.CallToolRequest, fallback string) string {
+	if req != nil && req.Session != nil {
+		if id := req.Session.ID(); id != "" {
+			return id
+		}
+	}
+	return fallback
+}
@@ -0,0 +1,51 @@
+package tools
+
+import (
+	"encoding/json"
+
+	"github.com/sniffops/sniffops/internal/k8s"
+	"github.com/sniffops/sniffops/internal/trace"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// recordSnapshots는 변경 전/후 객체를 sanitize하여 trace에 저장하고 diff를 계산합니다.
+//
+// before는 호출 전 live 객체 (리소스가 없었으면 nil),
+// after는 호출 결과 객체 (삭제된 경우 nil)입니다.
+// Diff는 sanitize된 객체끼리 비교하므로 마스킹된 값은 diff에도 노출되지 않습니다.
+// Before 객체에서 마스킹된 값이 있으면 revert가 복원하지 않도록 표시합니다.
+func recordSnapshots(tr *trace.Trace, before, after *unstructured.Unstructured) {
+	if before == nil && after == nil {
+		return
+	}
+
+	var sanitizedBefore, sanitizedAfter *unstructured.Unstructured
+	tr.BeforeSnapshot, sanitizedBefore, tr.BeforeSnapshotRedacted = sanitizeSnapshot(before)
+	tr.AfterSnapshot, sanitizedAfter, _ = sanitizeSnapshot(after)
+
+	diff, err := json.Marshal(k8s.DiffObjects(sanitizedBefore, sanitizedAfter))
+	if err == nil {
+		tr.Diff = string(diff)
+	}
+}
+
+// sanitizeSnapshot은 객체를 sanitize된 JSON 문자열과 sanitize된 객체, 마스킹 여부로 반환합니다
+func sanitizeSnapshot(obj *unstructured.Unstructured) (string, *unstructured.Unstructured, bool) {
+	if obj == nil {
+		return "", nil, false
+	}
+
+	data, err := json.Marshal(obj.Object)
+	if err != nil {
+		return "", nil, false
+	}
+
+	sanitized, masked := trace.SanitizeOutputMasked(string(data))
+
+	var object map[string]interface{}
+	if err := json.Unmarshal([]byte(sanitized), &object); err != nil {
+		return sanitized, nil, masked
+	}
+
+	return sanitized, &unstructured.Unstructured{Object: object}, masked
+}
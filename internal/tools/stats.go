@@ -2,7 +2,6 @@ package tools
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
@@ -25,6 +24,15 @@ type StatsOutput struct {
 	SuccessRate      float64             `json:"success_rate" jsonschema:"Success rate (percentage)"`
 	ResultCounts     map[string]int      `json:"result_counts" jsonschema:"Count of traces per result (success/failure)"`
 	AvgLatencyMs     float64             `json:"avg_latency_ms" jsonschema:"Average latency in milliseconds"`
+
+	TotalTokensInput  int                          `json:"total_tokens_input" jsonschema:"Estimated tokens of all tool inputs"`
+	TotalTokensOutput int                          `json:"total_tokens_output" jsonschema:"Estimated tokens of all results returned to the model"`
+	TotalCost         float64                      `json:"total_cost_estimate" jsonschema:"Estimated cost in USD (from the pricing table)"`
+	CostByTool        map[string]trace.UsageTotals `json:"cost_by_tool" jsonschema:"Calls, estimated tokens and cost per tool"`
+	CostByNamespace   map[string]trace.UsageTotals `json:"cost_by_namespace" jsonschema:"Calls, estimated tokens and cost of the top 10 namespaces by cost"`
+	CostBySession     map[string]trace.UsageTotals `json:"cost_by_session" jsonschema:"Calls, estimated tokens and cost of the top 10 sessions by cost"`
+
+	TraceWriter *trace.WriterCounters `json:"trace_writer,omitempty" jsonschema:"Counters of the asynchronous trace writer (written, retried, spilled, dropped)"`
 }
 
 // StatsHandler는 sniff_stats Tool의 핸들러입니다
@@ -36,8 +44,9 @@ type StatsOutput struct {
 // - namespace별 카운트
 // - 성공률
 // - 평균 latency
+// - 추정 토큰 수와 비용 (tool, namespace, session별)
 func StatsHandler(
-	traceStore *trace.Store,
+	traceStore trace.Backend,
 ) mcp.ToolHandlerFor[StatsInput, StatsOutput] {
 	return func(
 		ctx context.Context,
@@ -51,115 +60,37 @@ func StatsHandler(
 		default:
 		}
 
-		// Get total count
-		totalTraces, err := traceStore.Count(&trace.ListFilter{})
+		// 전체 기간 통계 (집계는 backend가 수행)
+		stats, err := traceStore.Stats("")
 		if err != nil {
-			return nil, StatsOutput{}, fmt.Errorf("failed to count total traces: %w", err)
+			return nil, StatsOutput{}, fmt.Errorf("failed to query stats: %w", err)
 		}
 
-		// Initialize output
 		output := StatsOutput{
-			TotalTraces:      totalTraces,
-			ToolCounts:       make(map[string]int),
-			RiskDistribution: make(map[string]int),
-			NamespaceCounts:  make(map[string]int),
-			ResultCounts:     make(map[string]int),
-		}
-
-		// If no traces, return empty stats
-		if totalTraces == 0 {
-			return &mcp.CallToolResult{}, output, nil
-		}
-
-		// Get store's underlying DB for custom queries
-		// We need direct SQL access for aggregations
-		db := traceStore.DB()
-		if db == nil {
-			return nil, StatsOutput{}, fmt.Errorf("trace store db is nil")
-		}
+			TotalTraces:      stats.TotalOperations,
+			ToolCounts:       stats.ToolUsage,
+			RiskDistribution: stats.RiskDistribution,
+			NamespaceCounts:  stats.NamespaceUsage,
+			ResultCounts:     stats.ResultCounts,
+			AvgLatencyMs:     stats.AvgLatencyMs,
 
-		// Query tool counts
-		rows, err := db.QueryContext(ctx, "SELECT tool_name, COUNT(*) FROM traces GROUP BY tool_name")
-		if err != nil {
-			return nil, StatsOutput{}, fmt.Errorf("failed to query tool counts: %w", err)
-		}
-		defer rows.Close()
-
-		for rows.Next() {
-			var toolName string
-			var count int
-			if err := rows.Scan(&toolName, &count); err != nil {
-				return nil, StatsOutput{}, fmt.Errorf("failed to scan tool count: %w", err)
-			}
-			output.ToolCounts[toolName] = count
+			TotalTokensInput:  stats.TotalTokensInput,
+			TotalTokensOutput: stats.TotalTokensOutput,
+			TotalCost:         stats.TotalCost,
+			CostByTool:        stats.CostByTool,
+			CostByNamespace:   stats.CostByNamespace,
+			CostBySession:     stats.CostBySession,
 		}
-		rows.Close()
 
-		// Query risk distribution
-		rows, err = db.QueryContext(ctx, "SELECT risk_level, COUNT(*) FROM traces GROUP BY risk_level")
-		if err != nil {
-			return nil, StatsOutput{}, fmt.Errorf("failed to query risk distribution: %w", err)
+		// 비동기 writer 사용 시 카운터 포함
+		if w, ok := traceStore.(*trace.Writer); ok {
+			counters := w.Counters()
+			output.TraceWriter = &counters
 		}
-		defer rows.Close()
-
-		for rows.Next() {
-			var riskLevel string
-			var count int
-			if err := rows.Scan(&riskLevel, &count); err != nil {
-				return nil, StatsOutput{}, fmt.Errorf("failed to scan risk distribution: %w", err)
-			}
-			output.RiskDistribution[riskLevel] = count
-		}
-		rows.Close()
-
-		// Query namespace counts (top 10)
-		rows, err = db.QueryContext(ctx, "SELECT namespace, COUNT(*) FROM traces WHERE namespace != '' GROUP BY namespace ORDER BY COUNT(*) DESC LIMIT 10")
-		if err != nil {
-			return nil, StatsOutput{}, fmt.Errorf("failed to query namespace counts: %w", err)
-		}
-		defer rows.Close()
-
-		for rows.Next() {
-			var namespace string
-			var count int
-			if err := rows.Scan(&namespace, &count); err != nil {
-				return nil, StatsOutput{}, fmt.Errorf("failed to scan namespace count: %w", err)
-			}
-			output.NamespaceCounts[namespace] = count
-		}
-		rows.Close()
-
-		// Query result counts
-		rows, err = db.QueryContext(ctx, "SELECT result, COUNT(*) FROM traces GROUP BY result")
-		if err != nil {
-			return nil, StatsOutput{}, fmt.Errorf("failed to query result counts: %w", err)
-		}
-		defer rows.Close()
-
-		for rows.Next() {
-			var result string
-			var count int
-			if err := rows.Scan(&result, &count); err != nil {
-				return nil, StatsOutput{}, fmt.Errorf("failed to scan result count: %w", err)
-			}
-			output.ResultCounts[result] = count
-		}
-		rows.Close()
 
 		// Calculate success rate
-		successCount := output.ResultCounts["success"]
-		if totalTraces > 0 {
-			output.SuccessRate = float64(successCount) / float64(totalTraces) * 100
-		}
-
-		// Query average latency
-		var avgLatency sql.NullFloat64
-		err = db.QueryRowContext(ctx, "SELECT AVG(latency_ms) FROM traces WHERE latency_ms > 0").Scan(&avgLatency)
-		if err != nil {
-			return nil, StatsOutput{}, fmt.Errorf("failed to query average latency: %w", err)
-		}
-		if avgLatency.Valid {
-			output.AvgLatencyMs = avgLatency.Float64
+		if stats.TotalOperations > 0 {
+			output.SuccessRate = float64(stats.ResultCounts["success"]) / float64(stats.TotalOperations) * 100
 		}
 
 		return &mcp.CallToolResult{}, output, nil
@@ -170,6 +101,6 @@ func StatsHandler(
 func GetStatsToolDefinition() *mcp.Tool {
 	return &mcp.Tool{
 		Name:        "sniff_stats",
-		Description: "Get statistics about trace records: total count, tool usage, risk distribution, namespace activity, success rate, and average latency.",
+		Description: "Get statistics about trace records: total count, tool usage, risk distribution, namespace activity, success rate, average latency, and estimated tokens and cost per tool, namespace and session.",
 	}
 }
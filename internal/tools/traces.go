@@ -3,6 +3,7 @@ package tools
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 	"github.com/sniffops/sniffops/internal/trace"
@@ -13,25 +14,31 @@ type TracesInput struct {
 	Tool      string `json:"tool,omitempty" jsonschema:"Filter by tool name (e.g., sniff_get, sniff_delete)"`
 	Namespace string `json:"namespace,omitempty" jsonschema:"Filter by namespace"`
 	RiskLevel string `json:"risk_level,omitempty" jsonschema:"Filter by risk level (low, medium, high, critical)"`
+	Query     string `json:"q,omitempty" jsonschema:"Full-text search in command, user intent, output and error message (all words must match; results are ranked by relevance with a highlighted snippet)"`
 	Limit     int    `json:"limit,omitempty" jsonschema:"Maximum number of traces to return (default: 20, max: 100)"`
 	Offset    int    `json:"offset,omitempty" jsonschema:"Offset for pagination (default: 0)"`
+	Export    string `json:"export,omitempty" jsonschema:"Export all matching traces, oldest first, in this format instead of returning a page: ndjson, json or csv (limit and offset apply only if set)"`
 }
 
 // TracesOutput은 sniff_traces Tool의 출력입니다
 type TracesOutput struct {
-	Traces []*trace.Trace `json:"traces" jsonschema:"List of trace records"`
+	Traces []*trace.Trace `json:"traces" jsonschema:"List of trace records (with the sanitized tool input of each call)"`
 	Count  int            `json:"count" jsonschema:"Number of traces returned"`
 	Total  int            `json:"total" jsonschema:"Total number of traces matching filters"`
+	Format string         `json:"format,omitempty" jsonschema:"Export format (only set for exports)"`
+	Export string         `json:"export,omitempty" jsonschema:"Exported traces (only set for exports)"`
 }
 
 // TracesHandler는 sniff_traces Tool의 핸들러입니다
 //
 // 이 Tool은 SQLite에서 trace를 조회합니다:
 // - 필터링: tool, namespace, risk_level
+// - 전문 검색: q (관련도 순 정렬, 일치한 부분을 snippet으로 반환)
 // - 페이지네이션: limit, offset
 // - 기본 limit: 20
+// - export: 필터에 맞는 모든 trace를 ndjson/json/csv로 내보내기 (limit 제한 없음)
 func TracesHandler(
-	traceStore *trace.Store,
+	traceStore trace.Backend,
 ) mcp.ToolHandlerFor[TracesInput, TracesOutput] {
 	return func(
 		ctx context.Context,
@@ -45,6 +52,10 @@ func TracesHandler(
 		default:
 		}
 
+		if input.Export != "" {
+			return exportTraces(traceStore, input)
+		}
+
 		// Default limit to 20
 		if input.Limit <= 0 {
 			input.Limit = 20
@@ -60,6 +71,7 @@ func TracesHandler(
 			Tool:      input.Tool,
 			Namespace: input.Namespace,
 			RiskLevel: input.RiskLevel,
+			Query:     input.Query,
 			Limit:     input.Limit,
 			Offset:    input.Offset,
 		}
@@ -86,10 +98,49 @@ func TracesHandler(
 	}
 }
 
+// exportTraces는 필터에 맞는 trace를 지정한 형식으로 내보냅니다
+// Store.Each로 한 건씩 읽으므로 List의 100건 제한이 적용되지 않습니다
+func exportTraces(traceStore trace.Backend, input TracesInput) (*mcp.CallToolResult, TracesOutput, error) {
+	format, err := trace.ParseExportFormat(input.Export)
+	if err != nil {
+		return nil, TracesOutput{}, err
+	}
+
+	filter := &trace.ListFilter{
+		Tool:      input.Tool,
+		Namespace: input.Namespace,
+		RiskLevel: input.RiskLevel,
+		Query:     input.Query,
+		Limit:     input.Limit,
+		Offset:    input.Offset,
+	}
+
+	var buf strings.Builder
+	count, err := trace.Export(&buf, traceStore, filter, format)
+	if err != nil {
+		return nil, TracesOutput{}, fmt.Errorf("failed to export traces: %w", err)
+	}
+
+	total, err := traceStore.Count(filter)
+	if err != nil {
+		return nil, TracesOutput{}, fmt.Errorf("failed to count traces: %w", err)
+	}
+
+	output := TracesOutput{
+		Traces: []*trace.Trace{},
+		Count:  count,
+		Total:  total,
+		Format: format,
+		Export: buf.String(),
+	}
+
+	return &mcp.CallToolResult{}, output, nil
+}
+
 // GetTracesToolDefinition은 sniff_traces Tool의 MCP Tool 정의를 반환합니다
 func GetTracesToolDefinition() *mcp.Tool {
 	return &mcp.Tool{
 		Name:        "sniff_traces",
-		Description: "Query trace records from the audit log. Filter by tool, namespace, risk level. Supports pagination with limit and offset.",
+		Description: "Query trace records from the audit log. Filter by tool, namespace, risk level, or search command, intent, output and errors with q (e.g. OOMKilled). Each trace includes the sanitized tool input (arguments) of the call. Supports pagination with limit and offset, or export of all matching traces as NDJSON, JSON or CSV.",
 	}
 }
@@ -0,0 +1,189 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sniffops/sniffops/internal/budget"
+	"github.com/sniffops/sniffops/internal/loop"
+	"github.com/sniffops/sniffops/internal/risk"
+	"github.com/sniffops/sniffops/internal/trace"
+)
+
+// callGuard는 Tool 핸들러 앞에서 입력 기록, 루프 감지, 예산 제한과 토큰 측정을 적용합니다
+type callGuard struct {
+	meter         *trace.Meter    // nil이면 토큰 측정 안 함
+	budgets       *budget.Tracker // nil이면 예산 제한 없음
+	loops         *loop.Detector  // nil이면 루프 감지 안 함
+	traceStore    trace.Backend
+	riskEvaluator *risk.Evaluator
+	sessionID     string
+}
+
+// callKey는 Tool 호출 정보를 담는 context key입니다
+type callKey struct{}
+
+// toolCall은 핸들러가 trace를 저장할 때 입력, 토큰 수, 비용과 예산 사용량을 기록하는 데 필요한 정보입니다
+type toolCall struct {
+	guard *callGuard
+	model string // MCP 클라이언트 이름 (initialize 요청의 clientInfo.name)
+	input string // 클라이언트가 보낸 Tool 인자 (raw JSON)
+
+	// 호출 중 저장된 trace (결과를 측정한 뒤 finish에서 backend에 저장)
+	pending *trace.Trace
+	backend trace.Backend
+}
+
+// guarded는 Tool 핸들러를 감싸 호출 전에 루프 차단과 예산을 확인하고, 입력 인자와
+// 클라이언트 모델을 context로 전달합니다.
+//
+// 루프로 차단 중인 세션의 호출과 예산을 초과한 호출은 핸들러를 실행하지 않고
+// trace와 MCP 에러를 반환합니다. 허용된 호출은 saveTrace에서 sanitize된 입력 인자를
+// trace에 저장하고 루프를 감지합니다. 루프 경고(action warn)는 호출 결과에 덧붙입니다.
+//
+// 호출 중 저장된 trace는 핸들러와 루프 경고가 끝난 뒤 모델에 반환되는 결과로 입력과
+// 결과 payload의 토큰 수를 추정해 가격표에 따라 비용을 trace와 예산 사용량에 기록하고
+// 저장합니다 (trace의 Output은 sanitize되고 잘린 사본이므로 측정에 쓰지 않음).
+func guarded[In, Out any](g *callGuard, handler mcp.ToolHandlerFor[In, Out]) mcp.ToolHandlerFor[In, Out] {
+	return func(ctx context.Context, req *mcp.CallToolRequest, input In) (res *mcp.CallToolResult, out Out, err error) {
+		call := &toolCall{guard: g, model: clientModel(req)}
+		if req != nil && req.Params != nil {
+			call.input = string(req.Params.Arguments)
+		}
+		ctx = context.WithValue(ctx, callKey{}, call)
+		defer func() {
+			call.finish(resultPayload(res, out, err))
+		}()
+
+		// 차단된 호출은 예산을 쓰지 않도록 루프 차단을 먼저 확인
+		if err := enforceLoopBlock(ctx, g, req); err != nil {
+			return nil, out, err
+		}
+		if err := enforceBudget(ctx, g, req); err != nil {
+			return nil, out, err
+		}
+
+		res, out, err = handler(ctx, req, input)
+		if g.loops != nil && g.loops.Action() == loop.ActionWarn {
+			res, err = addLoopWarnings(g.loops, traceSessionID(req, g.sessionID), res, out, err)
+		}
+		return res, out, err
+	}
+}
+
+// resultPayload는 SDK가 Tool 핸들러의 반환값으로 클라이언트에 보내는 결과 JSON을 만듭니다.
+//
+// 구조화된 MCP 에러는 그대로, 일반 에러는 IsError 결과로 보내고, 성공한 호출은
+// 결과 객체를 StructuredContent와 (Content가 없으면) 텍스트 Content로 함께 보냅니다.
+func resultPayload[Out any](res *mcp.CallToolResult, out Out, err error) string {
+	var wireErr *jsonrpc.Error
+	if errors.As(err, &wireErr) {
+		data, _ := json.Marshal(wireErr)
+		return string(data)
+	}
+
+	var result mcp.CallToolResult
+	if err != nil {
+		result.SetError(err)
+	} else {
+		if res != nil {
+			result = *res
+		}
+		if outJSON, marshalErr := json.Marshal(out); marshalErr == nil {
+			result.StructuredContent = json.RawMessage(outJSON)
+			if result.Content == nil {
+				result.Content = []mcp.Content{&mcp.TextContent{Text: string(outJSON)}}
+			}
+		}
+	}
+	data, _ := json.Marshal(&result)
+	return string(data)
+}
+
+// addLoopWarnings는 세션에 쌓인 루프 경고를 Tool 결과에 덧붙입니다.
+//
+// 성공한 호출은 결과 JSON 앞에 경고 텍스트를 추가하고, 실패한 호출은 에러 메시지
+// 뒤에 붙입니다. 구조화된 MCP 에러(차단, 거부, 예산 초과)에는 붙일 수 없으므로
+// 경고를 다음 결과로 미룹니다.
+func addLoopWarnings[Out any](loops *loop.Detector, sessionID string, res *mcp.CallToolResult, out Out, err error) (*mcp.CallToolResult, error) {
+	var wireErr *jsonrpc.Error
+	if errors.As(err, &wireErr) {
+		return res, err
+	}
+	warnings := loops.Warnings(sessionID)
+	if len(warnings) == 0 {
+		return res, err
+	}
+	text := strings.Join(warnings, "\n")
+
+	if err != nil {
+		return res, fmt.Errorf("%w\n\n%s", err, text)
+	}
+	if res == nil {
+		res = &mcp.CallToolResult{}
+	}
+	if res.Content == nil {
+		// SDK가 채우는 것과 같은 결과 JSON을 경고 뒤에 유지
+		data, marshalErr := json.Marshal(out)
+		if marshalErr != nil {
+			return res, marshalErr
+		}
+		res.Content = []mcp.Content{&mcp.TextContent{Text: string(data)}}
+	}
+	res.Content = append([]mcp.Content{&mcp.TextContent{Text: text}}, res.Content...)
+	return res, nil
+}
+
+// recordCall은 guarded로 감싼 호출이면 trace에 입력 인자와 루프 패턴을 기록하고,
+// 결과를 측정한 뒤 저장하도록 호출에 보관합니다. 감싸지 않은 호출이면 false를 반환합니다.
+func recordCall(ctx context.Context, traceStore trace.Backend, tr *trace.Trace) bool {
+	call, ok := ctx.Value(callKey{}).(*toolCall)
+	if !ok {
+		return false
+	}
+	if tr.Input == "" {
+		tr.Input = sanitizeInput(call.input)
+	}
+	if call.guard.loops != nil {
+		call.guard.loops.Observe(tr)
+	}
+
+	// 호출마다 trace는 하나지만, 이전 trace가 남아있으면 먼저 저장
+	call.finish("")
+	call.pending, call.backend = tr, traceStore
+	return true
+}
+
+// finish는 보관된 trace에 모델에 반환된 결과 payload의 토큰 수와 비용을 기록하고,
+// 예산 사용량에 더한 뒤 저장합니다
+func (call *toolCall) finish(result string) {
+	tr := call.pending
+	if tr == nil {
+		return
+	}
+	call.pending = nil
+
+	if call.guard.meter != nil {
+		call.guard.meter.Measure(tr, call.model, call.input, result)
+	}
+	if call.guard.budgets != nil {
+		call.guard.budgets.Record(tr)
+	}
+	insertTrace(call.backend, tr)
+}
+
+// clientModel은 가격표에서 찾을 모델 이름으로 MCP 클라이언트 이름을 반환합니다
+func clientModel(req *mcp.CallToolRequest) string {
+	if req == nil || req.Session == nil {
+		return ""
+	}
+	if params := req.Session.InitializeParams(); params != nil && params.ClientInfo != nil {
+		return params.ClientInfo.Name
+	}
+	return ""
+}
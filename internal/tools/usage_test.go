@@ -0,0 +1,73 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sniffops/sniffops/internal/loop"
+	"github.com/sniffops/sniffops/internal/trace"
+)
+
+type listOutput struct {
+	Items []string `json:"items"`
+}
+
+func TestGuardedMeasuresReturnedResult(t *testing.T) {
+	store, err := trace.NewStore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	defer store.Close()
+
+	cfg, _ := loop.ParseConfig([]byte("action: warn\nrepeat: 2"))
+	g := &callGuard{
+		// One token per character, so token counts are payload lengths
+		meter:      trace.NewMeter(trace.TokenEstimatorFunc(func(text string) int { return len(text) }), nil),
+		loops:      loop.NewDetector(cfg),
+		traceStore: store,
+		sessionID:  "s",
+	}
+
+	// The handler stores a short output, but returns a large result
+	items := []string{strings.Repeat("a", 500), strings.Repeat("b", 500)}
+	calls := 0
+	handler := guarded(g, func(ctx context.Context, req *mcp.CallToolRequest, input struct{}) (*mcp.CallToolResult, listOutput, error) {
+		calls++
+		tr := &trace.Trace{ID: fmt.Sprintf("t%d", calls), SessionID: "s", ToolName: "sniff_get", Command: "kubectl get pods", RiskLevel: "low", Result: "success", Output: "truncated"}
+		saveTrace(ctx, store, tr)
+		if _, err := store.GetByID(tr.ID); err == nil {
+			t.Error("trace saved before the result was measured")
+		}
+		return nil, listOutput{Items: items}, nil
+	})
+
+	res, out, err := handler(context.Background(), nil, struct{}{})
+	if err != nil {
+		t.Fatalf("handler error = %v", err)
+	}
+	first, err := store.GetByID("t1")
+	if err != nil {
+		t.Fatalf("GetByID() error = %v", err)
+	}
+	if want := len(resultPayload(res, out, nil)); first.TokensOutput != want || want < 2000 {
+		t.Errorf("TokensOutput = %d, want the returned payload (%d), not the stored output", first.TokensOutput, want)
+	}
+
+	// The loop warning added to the second result is counted too
+	res, out, _ = handler(context.Background(), nil, struct{}{})
+	warning, ok := res.Content[0].(*mcp.TextContent)
+	if !ok || !strings.Contains(warning.Text, "possible agent loop") {
+		t.Fatalf("result = %+v, want the loop warning first", res.Content)
+	}
+	second, err := store.GetByID("t2")
+	if err != nil {
+		t.Fatalf("GetByID() error = %v", err)
+	}
+	if want := len(resultPayload(res, out, nil)); second.TokensOutput != want || want <= first.TokensOutput+len(warning.Text) {
+		t.Errorf("TokensOutput = %d, want %d with the warning", second.TokensOutput, want)
+	}
+}
@@ -0,0 +1,156 @@
+package trace
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// approvalColumns is the column list shared by the approval queries
+const approvalColumns = `
+		id, trace_id, session_id, tool_name, command,
+		namespace, resource_kind, target_resource,
+		risk_level, risk_reason,
+		status, requested_at, decided_at, decided_by, note`
+
+// InsertApproval saves a new approval request
+func (s *Store) InsertApproval(approval *Approval) error {
+	if approval == nil {
+		return fmt.Errorf("approval cannot be nil")
+	}
+
+	query := "INSERT INTO approvals (" + approvalColumns + ") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+
+	_, err := s.db.Exec(query,
+		approval.ID, approval.TraceID, approval.SessionID, approval.ToolName, approval.Command,
+		approval.Namespace, approval.ResourceKind, approval.TargetResource,
+		approval.RiskLevel, approval.RiskReason,
+		approval.Status, approval.RequestedAt, approval.DecidedAt, approval.DecidedBy, approval.Note,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert approval: %w", err)
+	}
+
+	return nil
+}
+
+// GetApproval retrieves a single approval request by ID
+func (s *Store) GetApproval(id string) (*Approval, error) {
+	if id == "" {
+		return nil, fmt.Errorf("id cannot be empty")
+	}
+
+	query := "SELECT " + approvalColumns + " FROM approvals WHERE id = ?"
+
+	approval, err := scanApproval(s.db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("approval not found: %s", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get approval: %w", err)
+	}
+
+	return approval, nil
+}
+
+// ListApprovals retrieves approval requests, newest first.
+// If status is empty, all approvals are returned.
+func (s *Store) ListApprovals(status string, limit int) ([]*Approval, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+
+	query := "SELECT " + approvalColumns + " FROM approvals"
+	var args []interface{}
+	if status != "" {
+		query += " WHERE status = ?"
+		args = append(args, status)
+	}
+	query += " ORDER BY requested_at DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query approvals: %w", err)
+	}
+	defer rows.Close()
+
+	var approvals []*Approval
+	for rows.Next() {
+		approval, err := scanApproval(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan approval: %w", err)
+		}
+		approvals = append(approvals, approval)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating approvals: %w", err)
+	}
+
+	return approvals, nil
+}
+
+// DecideApproval records a decision for a pending approval request.
+// status must be ApprovalApproved, ApprovalDenied or ApprovalExpired.
+// It fails if the request doesn't exist or was already decided.
+func (s *Store) DecideApproval(id, status, decidedBy, note string) (*Approval, error) {
+	switch status {
+	case ApprovalApproved, ApprovalDenied, ApprovalExpired:
+	default:
+		return nil, fmt.Errorf("invalid approval status: %s", status)
+	}
+
+	result, err := s.db.Exec(
+		"UPDATE approvals SET status = ?, decided_at = ?, decided_by = ?, note = ? WHERE id = ? AND status = ?",
+		status, time.Now().UnixMilli(), decidedBy, note, id, ApprovalPending,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update approval: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to update approval: %w", err)
+	}
+
+	approval, err := s.GetApproval(id)
+	if err != nil {
+		return nil, err
+	}
+	if affected == 0 {
+		return approval, fmt.Errorf("approval %s is already %s", id, approval.Status)
+	}
+
+	return approval, nil
+}
+
+// scanApproval scans a row selected with approvalColumns
+func scanApproval(row rowScanner) (*Approval, error) {
+	approval := &Approval{}
+	var (
+		namespace, resourceKind, targetResource sql.NullString
+		riskReason, decidedBy, note             sql.NullString
+		decidedAt                               sql.NullInt64
+	)
+
+	err := row.Scan(
+		&approval.ID, &approval.TraceID, &approval.SessionID, &approval.ToolName, &approval.Command,
+		&namespace, &resourceKind, &targetResource,
+		&approval.RiskLevel, &riskReason,
+		&approval.Status, &approval.RequestedAt, &decidedAt, &decidedBy, &note,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	approval.Namespace = namespace.String
+	approval.ResourceKind = resourceKind.String
+	approval.TargetResource = targetResource.String
+	approval.RiskReason = riskReason.String
+	approval.DecidedAt = decidedAt.Int64
+	approval.DecidedBy = decidedBy.String
+	approval.Note = note.String
+
+	return approval, nil
+}
@@ -0,0 +1,134 @@
+package trace
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func createTestApproval(traceID string) *Approval {
+	return &Approval{
+		ID:             uuid.New().String(),
+		TraceID:        traceID,
+		SessionID:      "session-1",
+		ToolName:       "sniff_delete",
+		Command:        "kubectl delete pod nginx -n production",
+		Namespace:      "production",
+		ResourceKind:   "pod",
+		TargetResource: "nginx",
+		RiskLevel:      "critical",
+		RiskReason:     "Delete operation",
+		Status:         ApprovalPending,
+		RequestedAt:    time.Now().UnixMilli(),
+	}
+}
+
+func TestInsertAndGetApproval(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	approval := createTestApproval("trace-1")
+	if err := store.InsertApproval(approval); err != nil {
+		t.Fatalf("InsertApproval() error = %v", err)
+	}
+
+	got, err := store.GetApproval(approval.ID)
+	if err != nil {
+		t.Fatalf("GetApproval() error = %v", err)
+	}
+
+	if got.TraceID != approval.TraceID || got.Command != approval.Command || got.Status != ApprovalPending {
+		t.Errorf("GetApproval() = %+v, want %+v", got, approval)
+	}
+
+	if _, err := store.GetApproval("missing"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected not found error, got %v", err)
+	}
+}
+
+func TestListApprovals(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	for i := 0; i < 3; i++ {
+		if err := store.InsertApproval(createTestApproval("trace-1")); err != nil {
+			t.Fatalf("InsertApproval() error = %v", err)
+		}
+	}
+
+	all, err := store.ListApprovals("", 0)
+	if err != nil {
+		t.Fatalf("ListApprovals() error = %v", err)
+	}
+	if _, err := store.DecideApproval(all[0].ID, ApprovalApproved, "alice", ""); err != nil {
+		t.Fatalf("DecideApproval() error = %v", err)
+	}
+
+	pending, err := store.ListApprovals(ApprovalPending, 10)
+	if err != nil {
+		t.Fatalf("ListApprovals() error = %v", err)
+	}
+	if len(pending) != 2 {
+		t.Errorf("expected 2 pending approvals, got %d", len(pending))
+	}
+}
+
+func TestDecideApproval(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	approval := createTestApproval("trace-1")
+	if err := store.InsertApproval(approval); err != nil {
+		t.Fatalf("InsertApproval() error = %v", err)
+	}
+
+	decided, err := store.DecideApproval(approval.ID, ApprovalDenied, "alice", "not during business hours")
+	if err != nil {
+		t.Fatalf("DecideApproval() error = %v", err)
+	}
+	if decided.Status != ApprovalDenied || decided.DecidedBy != "alice" || decided.DecidedAt == 0 {
+		t.Errorf("unexpected decision: %+v", decided)
+	}
+
+	t.Run("second decision fails", func(t *testing.T) {
+		got, err := store.DecideApproval(approval.ID, ApprovalApproved, "bob", "")
+		if err == nil {
+			t.Fatal("expected error for already decided approval")
+		}
+		if got == nil || got.Status != ApprovalDenied {
+			t.Errorf("expected stored decision to be kept, got %+v", got)
+		}
+	})
+
+	t.Run("invalid status", func(t *testing.T) {
+		if _, err := store.DecideApproval(approval.ID, ApprovalPending, "bob", ""); err == nil {
+			t.Error("expected error for invalid status")
+		}
+	})
+}
+
+func TestTraceApprovalFields(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	trace := createTestTrace("session-1", "sniff_delete")
+	trace.ApprovalStatus = ApprovalApproved
+	trace.ApprovedBy = "alice"
+	trace.ApprovedAt = time.Now().UnixMilli()
+	trace.ApprovalWaitMs = 1500
+
+	if err := store.Insert(trace); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+
+	got, err := store.GetByID(trace.ID)
+	if err != nil {
+		t.Fatalf("GetByID() error = %v", err)
+	}
+	if got.ApprovalStatus != ApprovalApproved || got.ApprovedBy != "alice" ||
+		got.ApprovedAt != trace.ApprovedAt || got.ApprovalWaitMs != 1500 {
+		t.Errorf("approval fields not round-tripped: %+v", got)
+	}
+}
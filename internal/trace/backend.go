@@ -0,0 +1,28 @@
+package trace
+
+// Backend is the trace storage used by the MCP tools and the web API.
+//
+// Store implements it for SQLite (the default, a local file) and for
+// PostgreSQL (selected by a postgres:// DSN, for shared team deployments).
+type Backend interface {
+	// Insert saves a new trace
+	Insert(trace *Trace) error
+	// InsertBatch saves several traces in one transaction, skipping IDs that already exist
+	InsertBatch(traces []*Trace) error
+	// GetByID retrieves a single trace; the error mentions "not found" if it doesn't exist
+	GetByID(id string) (*Trace, error)
+	// List retrieves traces matching the filter, newest first
+	List(filter *ListFilter) ([]*Trace, error)
+	// Each calls fn for every trace matching the filter, oldest first, without loading them all
+	Each(filter *ListFilter, fn func(*Trace) error) error
+	// Count returns the number of traces matching the filter (ignoring pagination)
+	Count(filter *ListFilter) (int, error)
+	// Stats returns aggregated statistics for a period ("1h", "24h", "7d", "30d" or "" for all-time)
+	Stats(period string) (*Stats, error)
+	// DistinctValues returns the distinct non-empty values of namespace or tool_name
+	DistinctValues(column string) ([]string, error)
+	// Close releases the underlying database connection
+	Close() error
+}
+
+var _ Backend = (*Store)(nil)
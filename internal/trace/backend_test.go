@@ -0,0 +1,320 @@
+package trace
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// postgresTestDSNEnv names the environment variable holding a PostgreSQL DSN
+// for the backend conformance tests. The tests are skipped for PostgreSQL
+// when it is unset. The database is wiped before each test.
+const postgresTestDSNEnv = "SNIFFOPS_TEST_POSTGRES_DSN"
+
+// backendFactories returns the backends the conformance suite runs against
+func backendFactories() map[string]func(t *testing.T) Backend {
+	return map[string]func(t *testing.T) Backend{
+		"sqlite": func(t *testing.T) Backend {
+			store, err := NewStore(filepath.Join(t.TempDir(), "conformance.db"))
+			if err != nil {
+				t.Fatalf("NewStore() error = %v", err)
+			}
+			t.Cleanup(func() { store.Close() })
+			return store
+		},
+		"postgres": func(t *testing.T) Backend {
+			dsn := os.Getenv(postgresTestDSNEnv)
+			if dsn == "" {
+				t.Skipf("%s not set", postgresTestDSNEnv)
+			}
+			resetPostgres(t, dsn)
+			store, err := NewStore(dsn)
+			if err != nil {
+				t.Fatalf("NewStore() error = %v", err)
+			}
+			t.Cleanup(func() { store.Close() })
+			return store
+		},
+	}
+}
+
+// resetPostgres recreates the public schema so each test starts from an empty
+// database, without tables, indexes or functions left by earlier migrations
+func resetPostgres(t *testing.T, dsn string) {
+	t.Helper()
+	store, err := NewStore(dsn)
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	defer store.Close()
+
+	for _, stmt := range []string{"DROP SCHEMA public CASCADE", "CREATE SCHEMA public"} {
+		if _, err := store.db.Exec(stmt); err != nil {
+			t.Fatalf("failed to reset database: %v", err)
+		}
+	}
+}
+
+// forEachBackend runs test against every available backend
+func forEachBackend(t *testing.T, test func(t *testing.T, b Backend)) {
+	for name, factory := range backendFactories() {
+		t.Run(name, func(t *testing.T) {
+			test(t, factory(t))
+		})
+	}
+}
+
+// insertTraces inserts test traces, failing the test on error
+func insertTraces(t *testing.T, b Backend, traces ...*Trace) {
+	t.Helper()
+	for _, tr := range traces {
+		if err := b.Insert(tr); err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+	}
+}
+
+func TestBackendRoundTrip(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b Backend) {
+		tr := createTestTrace("session-1", "sniff_apply")
+		tr.DryRun = true
+		tr.ApprovalStatus = ApprovalApproved
+		tr.ApprovedBy = "alice"
+		tr.ApprovedAt = tr.Timestamp + 1000
+		tr.BeforeSnapshot = `{"spec":{"replicas":1}}`
+		tr.AfterSnapshot = `{"spec":{"replicas":3}}`
+		tr.Diff = "spec.replicas: 1 -> 3"
+		tr.RevertOf = "previous-trace"
+		insertTraces(t, b, tr)
+
+		got, err := b.GetByID(tr.ID)
+		if err != nil {
+			t.Fatalf("GetByID() error = %v", err)
+		}
+		if *got != *tr {
+			t.Errorf("GetByID() = %+v, want %+v", got, tr)
+		}
+
+		_, err = b.GetByID("missing")
+		if err == nil || !strings.Contains(err.Error(), "not found") {
+			t.Errorf("GetByID(missing) error = %v, want not found", err)
+		}
+	})
+}
+
+func TestBackendListAndCount(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b Backend) {
+		now := time.Now().UnixMilli()
+		var traces []*Trace
+		for i := 0; i < 5; i++ {
+			tr := createTestTrace("session-a", "sniff_get")
+			tr.Timestamp = now - int64(5-i)*1000
+			traces = append(traces, tr)
+		}
+		traces[1].SessionID = "session-b"
+		traces[2].Namespace = "prod"
+		traces[3].RiskLevel = "high"
+		traces[3].ToolName = "sniff_delete"
+		insertTraces(t, b, traces...)
+
+		start := time.UnixMilli(traces[1].Timestamp)
+		end := time.UnixMilli(traces[3].Timestamp)
+
+		tests := []struct {
+			name      string
+			filter    *ListFilter
+			want      []*Trace // newest first
+			wantCount int      // Count ignores pagination
+		}{
+			{"all", &ListFilter{}, []*Trace{traces[4], traces[3], traces[2], traces[1], traces[0]}, 5},
+			{"session", &ListFilter{SessionID: "session-b"}, []*Trace{traces[1]}, 1},
+			{"namespace", &ListFilter{Namespace: "prod"}, []*Trace{traces[2]}, 1},
+			{"risk", &ListFilter{RiskLevel: "high"}, []*Trace{traces[3]}, 1},
+			{"tool", &ListFilter{Tool: "sniff_delete"}, []*Trace{traces[3]}, 1},
+			{"time range", &ListFilter{StartTime: &start, EndTime: &end}, []*Trace{traces[3], traces[2], traces[1]}, 3},
+			{"pagination", &ListFilter{Limit: 2, Offset: 1}, []*Trace{traces[3], traces[2]}, 5},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				got, err := b.List(tt.filter)
+				if err != nil {
+					t.Fatalf("List() error = %v", err)
+				}
+				if len(got) != len(tt.want) {
+					t.Fatalf("List() returned %d traces, want %d", len(got), len(tt.want))
+				}
+				for i := range got {
+					if got[i].ID != tt.want[i].ID {
+						t.Errorf("List()[%d] = %s, want %s", i, got[i].ID, tt.want[i].ID)
+					}
+				}
+
+				count, err := b.Count(tt.filter)
+				if err != nil {
+					t.Fatalf("Count() error = %v", err)
+				}
+				if count != tt.wantCount {
+					t.Errorf("Count() = %d, want %d", count, tt.wantCount)
+				}
+			})
+		}
+	})
+}
+
+func TestBackendStats(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b Backend) {
+		now := time.Now()
+		get := createTestTrace("session-1", "sniff_get")
+		get.LatencyMs = 100
+		get.Timestamp = now.Add(-30 * time.Minute).UnixMilli()
+		del := createTestTrace("session-1", "sniff_delete")
+		del.RiskLevel = "high"
+		del.Namespace = "prod"
+		del.Result = "failure"
+		del.LatencyMs = 300
+		del.Timestamp = now.Add(-10 * time.Minute).UnixMilli()
+		old := createTestTrace("session-1", "sniff_get")
+		old.Timestamp = now.Add(-48 * time.Hour).UnixMilli()
+		insertTraces(t, b, get, del, old)
+
+		stats, err := b.Stats("24h")
+		if err != nil {
+			t.Fatalf("Stats() error = %v", err)
+		}
+		if stats.TotalOperations != 2 {
+			t.Errorf("TotalOperations = %d, want 2", stats.TotalOperations)
+		}
+		if stats.RiskDistribution["low"] != 1 || stats.RiskDistribution["high"] != 1 {
+			t.Errorf("RiskDistribution = %v", stats.RiskDistribution)
+		}
+		if stats.ToolUsage["sniff_get"] != 1 || stats.ToolUsage["sniff_delete"] != 1 {
+			t.Errorf("ToolUsage = %v", stats.ToolUsage)
+		}
+		if stats.NamespaceUsage["default"] != 1 || stats.NamespaceUsage["prod"] != 1 {
+			t.Errorf("NamespaceUsage = %v", stats.NamespaceUsage)
+		}
+		if stats.ResultCounts["success"] != 1 || stats.ResultCounts["failure"] != 1 {
+			t.Errorf("ResultCounts = %v", stats.ResultCounts)
+		}
+		if stats.AvgLatencyMs != 200 {
+			t.Errorf("AvgLatencyMs = %v, want 200", stats.AvgLatencyMs)
+		}
+		if diff := stats.TotalCost - 0.002; diff > 1e-9 || diff < -1e-9 {
+			t.Errorf("TotalCost = %v, want 0.002", stats.TotalCost)
+		}
+
+		timelineTotal := 0
+		for _, point := range stats.Timeline {
+			if _, err := time.Parse(time.RFC3339, point.Hour); err != nil {
+				t.Errorf("timeline point %q is not RFC 3339: %v", point.Hour, err)
+			}
+			timelineTotal += point.Count
+		}
+		if timelineTotal != 2 {
+			t.Errorf("timeline total = %d, want 2", timelineTotal)
+		}
+
+		all, err := b.Stats("")
+		if err != nil {
+			t.Fatalf("Stats(all) error = %v", err)
+		}
+		if all.TotalOperations != 3 {
+			t.Errorf("all-time TotalOperations = %d, want 3", all.TotalOperations)
+		}
+	})
+}
+
+func TestBackendUsageRollups(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b Backend) {
+		get := createTestTrace("session-1", "sniff_get")
+		logs := createTestTrace("session-2", "sniff_logs")
+		logs.Namespace = "prod"
+		logs.TokensInput, logs.TokensOutput, logs.CostEstimate = 20, 400, 0.01
+		unpriced := createTestTrace("session-2", "sniff_get")
+		unpriced.Namespace = ""
+		unpriced.TokensInput, unpriced.TokensOutput, unpriced.CostEstimate = 10, 10, 0
+		insertTraces(t, b, get, logs, unpriced)
+
+		stats, err := b.Stats("")
+		if err != nil {
+			t.Fatalf("Stats() error = %v", err)
+		}
+		if stats.TotalTokensInput != 80 || stats.TotalTokensOutput != 440 {
+			t.Errorf("total tokens = %d/%d, want 80/440", stats.TotalTokensInput, stats.TotalTokensOutput)
+		}
+
+		if got, want := stats.CostByTool["sniff_get"], (UsageTotals{Calls: 2, TokensInput: 60, TokensOutput: 40, CostEstimate: 0.001}); !usageEqual(got, want) {
+			t.Errorf("CostByTool[sniff_get] = %+v, want %+v", got, want)
+		}
+		if got, want := stats.CostByNamespace["prod"], (UsageTotals{Calls: 1, TokensInput: 20, TokensOutput: 400, CostEstimate: 0.01}); !usageEqual(got, want) {
+			t.Errorf("CostByNamespace[prod] = %+v, want %+v", got, want)
+		}
+		if _, ok := stats.CostByNamespace[""]; ok || len(stats.CostByNamespace) != 2 {
+			t.Errorf("CostByNamespace = %v, want default and prod", stats.CostByNamespace)
+		}
+		if got, want := stats.CostBySession["session-2"], (UsageTotals{Calls: 2, TokensInput: 30, TokensOutput: 410, CostEstimate: 0.01}); !usageEqual(got, want) {
+			t.Errorf("CostBySession[session-2] = %+v, want %+v", got, want)
+		}
+	})
+}
+
+func usageEqual(a, b UsageTotals) bool {
+	diff := a.CostEstimate - b.CostEstimate
+	return a.Calls == b.Calls && a.TokensInput == b.TokensInput && a.TokensOutput == b.TokensOutput && diff < 1e-9 && diff > -1e-9
+}
+
+func TestBackendDistinctValues(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b Backend) {
+		a := createTestTrace("session-1", "sniff_get")
+		c := createTestTrace("session-1", "sniff_logs")
+		c.Namespace = "prod"
+		d := createTestTrace("session-1", "sniff_get")
+		d.Namespace = ""
+		insertTraces(t, b, a, c, d)
+
+		namespaces, err := b.DistinctValues("namespace")
+		if err != nil {
+			t.Fatalf("DistinctValues(namespace) error = %v", err)
+		}
+		if strings.Join(namespaces, ",") != "default,prod" {
+			t.Errorf("DistinctValues(namespace) = %v, want [default prod]", namespaces)
+		}
+
+		tools, err := b.DistinctValues("tool_name")
+		if err != nil {
+			t.Fatalf("DistinctValues(tool_name) error = %v", err)
+		}
+		if strings.Join(tools, ",") != "sniff_get,sniff_logs" {
+			t.Errorf("DistinctValues(tool_name) = %v, want [sniff_get sniff_logs]", tools)
+		}
+
+		if _, err := b.DistinctValues("command"); err == nil {
+			t.Error("expected error for a column that is not allowed")
+		}
+	})
+}
+
+func TestPostgresRebind(t *testing.T) {
+	got := postgresDialect{}.rebind("SELECT * FROM traces WHERE a = ? AND b IN (?, ?) LIMIT ?")
+	want := "SELECT * FROM traces WHERE a = $1 AND b IN ($2, $3) LIMIT $4"
+	if got != want {
+		t.Errorf("rebind() = %q, want %q", got, want)
+	}
+}
+
+func TestDialectFor(t *testing.T) {
+	tests := map[string]string{
+		"":                               "sqlite",
+		"/tmp/traces.db":                 "sqlite",
+		"postgres://user:pw@db/sniffops": "postgres",
+		"postgresql://db/sniffops?sslmode=disable": "postgres",
+	}
+	for dsn, want := range tests {
+		if got := dialectFor(dsn).name(); got != want {
+			t.Errorf("dialectFor(%q) = %s, want %s", dsn, got, want)
+		}
+	}
+}
@@ -0,0 +1,591 @@
+package trace
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultCheckpointInterval is how many traces are appended between signed checkpoints
+const DefaultCheckpointInterval = 100
+
+// ChainHash returns the SHA-256 hash of a trace's canonical content.
+//
+// The canonical content is the JSON encoding of the trace without its Hash
+// field. It includes ChainSeq and PrevHash, so each hash covers the position
+// of the trace and, through PrevHash, every trace before it. Encrypted
+// fields are hashed as stored, so the chain can be verified without the key.
+func ChainHash(t *Trace) (string, error) {
+	content := *t
+	content.Hash = ""
+
+	data, err := json.Marshal(&content)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode trace %s for hashing: %w", t.ID, err)
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// chainLink is a position in the hash chain
+type chainLink struct {
+	seq  int64
+	hash string
+}
+
+// chainHead returns the last link of the chain (zero if the chain is empty).
+// Traces removed by retention still count, through their pruned range.
+func chainHead(q queryer) (chainLink, error) {
+	var head chainLink
+
+	err := q.QueryRow("SELECT chain_seq, hash FROM traces WHERE chain_seq IS NOT NULL ORDER BY chain_seq DESC LIMIT 1").
+		Scan(&head.seq, &head.hash)
+	if err != nil && err != sql.ErrNoRows {
+		return head, fmt.Errorf("failed to read chain head: %w", err)
+	}
+
+	var pruned chainLink
+	err = q.QueryRow("SELECT last_seq, last_hash FROM chain_pruned ORDER BY last_seq DESC LIMIT 1").
+		Scan(&pruned.seq, &pruned.hash)
+	if err != nil && err != sql.ErrNoRows {
+		return head, fmt.Errorf("failed to read pruned chain head: %w", err)
+	}
+
+	if pruned.seq > head.seq {
+		return pruned, nil
+	}
+	return head, nil
+}
+
+// insertChained appends traces to the hash chain in one transaction.
+// The chain fields of the given traces are set once the transaction commits.
+func (s *Store) insertChained(traces []*Trace, skipExisting bool) error {
+	query := fmt.Sprintf("INSERT INTO traces (%s) VALUES (%s)",
+		traceColumns, strings.TrimSuffix(strings.Repeat("?, ", traceColumnCount), ", "))
+	if skipExisting {
+		query += " ON CONFLICT (id) DO NOTHING"
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin trace insert: %w", err)
+	}
+	defer tx.Rollback()
+
+	if lock := s.db.dialect.lockChain(); lock != "" {
+		if _, err := tx.Exec(lock); err != nil {
+			return fmt.Errorf("failed to lock hash chain: %w", err)
+		}
+	}
+
+	head, err := chainHead(tx)
+	if err != nil {
+		return err
+	}
+
+	linked := make([]*Trace, len(traces))
+	for i, trace := range traces {
+		c := *trace
+		if err := s.seal(&c); err != nil {
+			return err
+		}
+		c.ChainSeq = head.seq + 1
+		c.PrevHash = head.hash
+		if c.Hash, err = ChainHash(&c); err != nil {
+			return err
+		}
+
+		result, err := tx.Exec(query, traceValues(&c)...)
+		if err != nil {
+			return fmt.Errorf("failed to insert trace: %w", err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			continue // Already stored
+		}
+
+		head = chainLink{seq: c.ChainSeq, hash: c.Hash}
+		linked[i] = &c
+
+		if err := s.checkpoint(tx, head); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit trace insert: %w", err)
+	}
+
+	for i, c := range linked {
+		if c != nil {
+			traces[i].ChainSeq, traces[i].PrevHash, traces[i].Hash = c.ChainSeq, c.PrevHash, c.Hash
+		}
+	}
+
+	return nil
+}
+
+// prunedRange is a run of consecutive chain positions removed by retention.
+// It keeps the links needed to verify the chain across the gap.
+type prunedRange struct {
+	firstSeq      int64
+	lastSeq       int64
+	firstPrevHash string
+	lastHash      string
+}
+
+// recordPrunedRanges stores the chain ranges of the traces matching cond,
+// which are about to be deleted
+func recordPrunedRanges(tx *sqlTx, cond string, args []interface{}, prunedAt int64) error {
+	rows, err := tx.Query(
+		"SELECT chain_seq, prev_hash, hash FROM traces WHERE chain_seq IS NOT NULL AND ("+cond+") ORDER BY chain_seq", args...)
+	if err != nil {
+		return fmt.Errorf("failed to read chain of pruned traces: %w", err)
+	}
+
+	var ranges []prunedRange
+	for rows.Next() {
+		var (
+			seq            int64
+			prevHash, hash sql.NullString
+		)
+		if err := rows.Scan(&seq, &prevHash, &hash); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan chain of pruned traces: %w", err)
+		}
+
+		if n := len(ranges); n > 0 && ranges[n-1].lastSeq+1 == seq {
+			ranges[n-1].lastSeq = seq
+			ranges[n-1].lastHash = hash.String
+			continue
+		}
+		ranges = append(ranges, prunedRange{
+			firstSeq: seq, lastSeq: seq, firstPrevHash: prevHash.String, lastHash: hash.String,
+		})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read chain of pruned traces: %w", err)
+	}
+
+	for _, r := range ranges {
+		if _, err := tx.Exec(
+			"INSERT INTO chain_pruned (first_seq, last_seq, first_prev_hash, last_hash, pruned_at) VALUES (?, ?, ?, ?, ?)",
+			r.firstSeq, r.lastSeq, r.firstPrevHash, r.lastHash, prunedAt,
+		); err != nil {
+			return fmt.Errorf("failed to record pruned chain range: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Checkpoint is a signed statement of the chain head at some position
+type Checkpoint struct {
+	Seq       int64  `json:"seq"`
+	Hash      string `json:"hash"`
+	CreatedAt int64  `json:"created_at"` // Unix timestamp (ms)
+	KeyID     string `json:"key_id"`
+	Signature string `json:"signature"` // Base64 Ed25519 signature of checkpointMessage
+}
+
+// checkpointMessage is the signed content of a checkpoint
+func checkpointMessage(seq int64, hash string, createdAt int64) []byte {
+	return []byte(fmt.Sprintf("sniffops-checkpoint\n%d\n%s\n%d", seq, hash, createdAt))
+}
+
+// EnableCheckpoints makes the store write a checkpoint signed with key every
+// interval traces (0 = DefaultCheckpointInterval). Call it before inserting.
+func (s *Store) EnableCheckpoints(key ed25519.PrivateKey, interval int) {
+	if interval <= 0 {
+		interval = DefaultCheckpointInterval
+	}
+	s.checkpointKey = key
+	s.checkpointEvery = int64(interval)
+}
+
+// checkpoint writes a signed checkpoint if head is at a checkpoint position
+func (s *Store) checkpoint(tx *sqlTx, head chainLink) error {
+	if s.checkpointKey == nil || head.seq%s.checkpointEvery != 0 {
+		return nil
+	}
+
+	createdAt := time.Now().UnixMilli()
+	signature := ed25519.Sign(s.checkpointKey, checkpointMessage(head.seq, head.hash, createdAt))
+	keyID := ChainKeyID(s.checkpointKey.Public().(ed25519.PublicKey))
+
+	if _, err := tx.Exec(
+		"INSERT INTO chain_checkpoints (seq, hash, created_at, key_id, signature) VALUES (?, ?, ?, ?, ?)",
+		head.seq, head.hash, createdAt, keyID, base64.StdEncoding.EncodeToString(signature),
+	); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+// ListCheckpoints retrieves all checkpoints in chain order
+func (s *Store) ListCheckpoints() ([]*Checkpoint, error) {
+	rows, err := s.db.Query("SELECT seq, hash, created_at, key_id, signature FROM chain_checkpoints ORDER BY seq")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query checkpoints: %w", err)
+	}
+	defer rows.Close()
+
+	var checkpoints []*Checkpoint
+	for rows.Next() {
+		cp := &Checkpoint{}
+		if err := rows.Scan(&cp.Seq, &cp.Hash, &cp.CreatedAt, &cp.KeyID, &cp.Signature); err != nil {
+			return nil, fmt.Errorf("failed to scan checkpoint: %w", err)
+		}
+		checkpoints = append(checkpoints, cp)
+	}
+
+	return checkpoints, rows.Err()
+}
+
+// DefaultChainKeyPath returns the default checkpoint signing key location (~/.sniffops/chain.key)
+func DefaultChainKeyPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".sniffops", "chain.key"), nil
+}
+
+// ChainKeyID returns a short identifier of a checkpoint verification key
+func ChainKeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// GenerateChainKey creates a new Ed25519 signing key at path (PKCS #8 PEM)
+// and its public key at path + ".pub". An existing key is never overwritten.
+func GenerateChainKey(path string) (ed25519.PrivateKey, error) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode key: %w", err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode public key: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create key file: %w", err)
+	}
+	if err := pem.Encode(f, &pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to write key file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write key file: %w", err)
+	}
+
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+	if err := os.WriteFile(path+".pub", pubPEM, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write public key file: %w", err)
+	}
+
+	return key, nil
+}
+
+// LoadChainKey loads an Ed25519 signing key written by GenerateChainKey
+func LoadChainKey(path string) (ed25519.PrivateKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("%s is not a private key (PEM type %q)", path, block.Type)
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an Ed25519 key", path)
+	}
+
+	return key, nil
+}
+
+// LoadChainPublicKey loads a checkpoint verification key from a public key
+// file, or derives it from a private key file
+func LoadChainPublicKey(path string) (ed25519.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type == "PRIVATE KEY" {
+		key, err := LoadChainKey(path)
+		if err != nil {
+			return nil, err
+		}
+		return key.Public().(ed25519.PublicKey), nil
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	pub, ok := parsed.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an Ed25519 key", path)
+	}
+
+	return pub, nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s does not contain a PEM key", path)
+	}
+	return block, nil
+}
+
+// Chain verification status values
+const (
+	ChainOK     = "ok"
+	ChainBroken = "broken"
+	ChainEmpty  = "empty"
+)
+
+// ChainReport is the result of verifying the hash chain
+type ChainReport struct {
+	Status    string      `json:"status"`           // ok, broken or empty
+	Verified  int         `json:"verified"`         // Traces whose hash and link were checked
+	Pruned    int64       `json:"pruned"`           // Traces removed by retention (verified through their recorded range)
+	Unchained int         `json:"unchained"`        // Traces written before the hash chain existed
+	HeadSeq   int64       `json:"head_seq"`         // Last position verified
+	HeadHash  string      `json:"head_hash"`        // Hash at HeadSeq
+	Broken    *ChainBreak `json:"broken,omitempty"` // First broken link
+
+	Checkpoints           int `json:"checkpoints"`            // Checkpoints found
+	SignedCheckpoints     int `json:"signed_checkpoints"`     // Checkpoints with a valid signature
+	UnverifiedCheckpoints int `json:"unverified_checkpoints"` // Checkpoints signed by a key that wasn't provided
+
+	CheckedAt int64 `json:"checked_at"` // Unix timestamp (ms)
+}
+
+// ChainBreak describes where and why the chain is broken
+type ChainBreak struct {
+	Seq     int64  `json:"seq"`
+	TraceID string `json:"trace_id,omitempty"`
+	Reason  string `json:"reason"`
+}
+
+// VerifyOptions controls chain verification
+type VerifyOptions struct {
+	// PublicKeys verify checkpoint signatures. Checkpoints signed by other
+	// keys are counted as unverified.
+	PublicKeys []ed25519.PublicKey
+}
+
+// VerifyChain walks the hash chain from the first trace and reports the
+// first broken link: a modified trace, a missing or reordered trace, a
+// checkpoint the chain doesn't match, or an invalid checkpoint signature.
+//
+// Without checkpoints, removing the newest traces can't be detected.
+func (s *Store) VerifyChain(opts VerifyOptions) (*ChainReport, error) {
+	report := &ChainReport{CheckedAt: time.Now().UnixMilli()}
+
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM traces WHERE chain_seq IS NULL").Scan(&report.Unchained); err != nil {
+		return nil, fmt.Errorf("failed to count unchained traces: %w", err)
+	}
+
+	ranges, err := s.listPrunedRanges()
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoints, err := s.ListCheckpoints()
+	if err != nil {
+		return nil, err
+	}
+	report.Checkpoints = len(checkpoints)
+
+	// Hashes at checkpoint positions, collected during the walk
+	checkpointHashes := make(map[int64]string, len(checkpoints))
+	for _, cp := range checkpoints {
+		checkpointHashes[cp.Seq] = ""
+	}
+
+	expected := int64(1)
+	prevHash := ""
+
+	// skipPruned moves past pruned ranges that start at the expected position
+	skipPruned := func() *ChainBreak {
+		for len(ranges) > 0 && ranges[0].firstSeq <= expected {
+			r := ranges[0]
+			ranges = ranges[1:]
+			if r.firstSeq != expected {
+				return &ChainBreak{Seq: r.firstSeq, Reason: fmt.Sprintf("pruned range #%d-#%d overlaps the chain", r.firstSeq, r.lastSeq)}
+			}
+			if r.firstPrevHash != prevHash {
+				return &ChainBreak{Seq: r.firstSeq, Reason: fmt.Sprintf("pruned range #%d-#%d does not link to the previous trace", r.firstSeq, r.lastSeq)}
+			}
+			if _, ok := checkpointHashes[r.lastSeq]; ok {
+				checkpointHashes[r.lastSeq] = r.lastHash
+			}
+			report.Pruned += r.lastSeq - r.firstSeq + 1
+			prevHash = r.lastHash
+			expected = r.lastSeq + 1
+		}
+		return nil
+	}
+
+	rows, err := s.db.Query("SELECT " + traceColumns + " FROM traces WHERE chain_seq IS NOT NULL ORDER BY chain_seq")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query traces: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		tr, err := scanTrace(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan trace: %w", err)
+		}
+
+		if report.Broken = skipPruned(); report.Broken != nil {
+			break
+		}
+		report.Broken = checkLink(tr, expected, prevHash)
+		if report.Broken != nil {
+			break
+		}
+
+		if _, ok := checkpointHashes[tr.ChainSeq]; ok {
+			checkpointHashes[tr.ChainSeq] = tr.Hash
+		}
+		report.Verified++
+		prevHash = tr.Hash
+		expected++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating traces: %w", err)
+	}
+
+	if report.Broken == nil {
+		report.Broken = skipPruned()
+	}
+	if report.Broken == nil && len(ranges) > 0 {
+		report.Broken = &ChainBreak{Seq: expected, Reason: fmt.Sprintf("trace #%d is missing", expected)}
+	}
+
+	report.HeadSeq = expected - 1
+	report.HeadHash = prevHash
+
+	if report.Broken == nil {
+		report.Broken = report.checkCheckpoints(checkpoints, checkpointHashes, opts.PublicKeys)
+	}
+
+	switch {
+	case report.Broken != nil:
+		report.Status = ChainBroken
+	case report.HeadSeq == 0:
+		report.Status = ChainEmpty
+	default:
+		report.Status = ChainOK
+	}
+
+	return report, nil
+}
+
+// checkLink verifies that tr is the trace expected at position seq after prevHash
+func checkLink(tr *Trace, seq int64, prevHash string) *ChainBreak {
+	switch {
+	case tr.ChainSeq > seq:
+		return &ChainBreak{Seq: seq, Reason: fmt.Sprintf("trace #%d is missing", seq)}
+	case tr.ChainSeq < seq:
+		return &ChainBreak{Seq: tr.ChainSeq, TraceID: tr.ID, Reason: fmt.Sprintf("duplicate position #%d", tr.ChainSeq)}
+	case tr.PrevHash != prevHash:
+		return &ChainBreak{Seq: seq, TraceID: tr.ID, Reason: "previous hash does not match the preceding trace"}
+	}
+
+	hash, err := ChainHash(tr)
+	if err != nil || hash != tr.Hash {
+		return &ChainBreak{Seq: seq, TraceID: tr.ID, Reason: "content does not match its hash (trace was modified)"}
+	}
+
+	return nil
+}
+
+// checkCheckpoints verifies checkpoint signatures and that the chain still contains each checkpoint
+func (r *ChainReport) checkCheckpoints(checkpoints []*Checkpoint, hashes map[int64]string, keys []ed25519.PublicKey) *ChainBreak {
+	byID := make(map[string]ed25519.PublicKey, len(keys))
+	for _, key := range keys {
+		byID[ChainKeyID(key)] = key
+	}
+
+	for _, cp := range checkpoints {
+		if cp.Seq > r.HeadSeq {
+			return &ChainBreak{Seq: cp.Seq, Reason: fmt.Sprintf("chain ends at #%d but checkpoint #%d exists (newest traces were removed)", r.HeadSeq, cp.Seq)}
+		}
+		// Empty if the position was pruned in the middle of a range
+		if hash := hashes[cp.Seq]; hash != "" && hash != cp.Hash {
+			return &ChainBreak{Seq: cp.Seq, Reason: fmt.Sprintf("checkpoint #%d does not match the chain", cp.Seq)}
+		}
+
+		key, ok := byID[cp.KeyID]
+		if !ok {
+			r.UnverifiedCheckpoints++
+			continue
+		}
+		signature, err := base64.StdEncoding.DecodeString(cp.Signature)
+		if err != nil || !ed25519.Verify(key, checkpointMessage(cp.Seq, cp.Hash, cp.CreatedAt), signature) {
+			return &ChainBreak{Seq: cp.Seq, Reason: fmt.Sprintf("checkpoint #%d has an invalid signature", cp.Seq)}
+		}
+		r.SignedCheckpoints++
+	}
+
+	return nil
+}
+
+// listPrunedRanges retrieves the pruned chain ranges in chain order
+func (s *Store) listPrunedRanges() ([]prunedRange, error) {
+	rows, err := s.db.Query("SELECT first_seq, last_seq, first_prev_hash, last_hash FROM chain_pruned ORDER BY first_seq")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pruned chain ranges: %w", err)
+	}
+	defer rows.Close()
+
+	var ranges []prunedRange
+	for rows.Next() {
+		var r prunedRange
+		if err := rows.Scan(&r.firstSeq, &r.lastSeq, &r.firstPrevHash, &r.lastHash); err != nil {
+			return nil, fmt.Errorf("failed to scan pruned chain range: %w", err)
+		}
+		ranges = append(ranges, r)
+	}
+
+	return ranges, rows.Err()
+}
@@ -0,0 +1,217 @@
+package trace
+
+import (
+	"crypto/ed25519"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// insertChain inserts n traces and returns them in chain order
+func insertChain(t *testing.T, store *Store, n int) []*Trace {
+	t.Helper()
+	var traces []*Trace
+	for i := 0; i < n; i++ {
+		tr := createTestTrace("session-1", "sniff_get")
+		if err := store.Insert(tr); err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+		traces = append(traces, tr)
+	}
+	return traces
+}
+
+// verifyChain runs VerifyChain, failing the test on error
+func verifyChain(t *testing.T, store *Store, keys ...ed25519.PublicKey) *ChainReport {
+	t.Helper()
+	report, err := store.VerifyChain(VerifyOptions{PublicKeys: keys})
+	if err != nil {
+		t.Fatalf("VerifyChain() error = %v", err)
+	}
+	return report
+}
+
+func TestChainLinksInserts(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	traces := insertChain(t, store, 2)
+	batch := []*Trace{createTestTrace("session-1", "sniff_get"), createTestTrace("session-1", "sniff_logs")}
+	// The already stored trace is skipped and doesn't take a position
+	if err := store.InsertBatch(append([]*Trace{traces[0]}, batch...)); err != nil {
+		t.Fatalf("InsertBatch() error = %v", err)
+	}
+	traces = append(traces, batch...)
+
+	prev := ""
+	for i, tr := range traces {
+		if tr.ChainSeq != int64(i+1) || tr.PrevHash != prev || tr.Hash == "" {
+			t.Errorf("trace %d: seq=%d prev=%q hash=%q, want seq=%d prev=%q", i, tr.ChainSeq, tr.PrevHash, tr.Hash, i+1, prev)
+		}
+		prev = tr.Hash
+	}
+
+	report := verifyChain(t, store)
+	if report.Status != ChainOK || report.Verified != 4 || report.HeadSeq != 4 || report.HeadHash != prev {
+		t.Errorf("VerifyChain() = %+v, want ok with 4 verified", report)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name    string
+		tamper  string
+		wantSeq int64
+		reason  string
+	}{
+		{"modified", "UPDATE traces SET result = 'success', output = 'nothing happened' WHERE chain_seq = 2", 2, "modified"},
+		{"deleted", "DELETE FROM traces WHERE chain_seq = 3", 3, "missing"},
+		{"relinked", "UPDATE traces SET prev_hash = 'forged' WHERE chain_seq = 4", 4, "previous hash"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, cleanup := setupTestDB(t)
+			defer cleanup()
+
+			traces := insertChain(t, store, 5)
+			if _, err := store.db.Exec(tt.tamper); err != nil {
+				t.Fatalf("failed to tamper: %v", err)
+			}
+
+			report := verifyChain(t, store)
+			if report.Status != ChainBroken || report.Broken == nil {
+				t.Fatalf("VerifyChain() = %+v, want broken", report)
+			}
+			if report.Broken.Seq != tt.wantSeq || !strings.Contains(report.Broken.Reason, tt.reason) {
+				t.Errorf("Broken = %+v, want seq %d with %q", report.Broken, tt.wantSeq, tt.reason)
+			}
+			if tt.name == "modified" && report.Broken.TraceID != traces[1].ID {
+				t.Errorf("Broken.TraceID = %s, want %s", report.Broken.TraceID, traces[1].ID)
+			}
+			if report.Verified != int(tt.wantSeq-1) {
+				t.Errorf("Verified = %d, want %d", report.Verified, tt.wantSeq-1)
+			}
+		})
+	}
+}
+
+func TestVerifyAfterPrune(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	now := time.Now()
+	insertAgedTrace(t, store, now, "low", 10*24*time.Hour) // #1 pruned
+	insertAgedTrace(t, store, now, "low", 9*24*time.Hour)  // #2 pruned
+	insertAgedTrace(t, store, now, "high", 8*24*time.Hour) // #3 kept
+	insertAgedTrace(t, store, now, "low", 8*24*time.Hour)  // #4 pruned
+	insertAgedTrace(t, store, now, "low", 1*time.Hour)     // #5 kept
+
+	policy := &RetentionPolicy{Risk: map[string]Age{"low": Age(7 * 24 * time.Hour)}}
+	if _, err := store.Prune(policy, PruneOptions{Now: now, Source: "test"}); err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+
+	report := verifyChain(t, store)
+	if report.Status != ChainOK || report.Verified != 2 || report.Pruned != 3 || report.HeadSeq != 5 {
+		t.Errorf("VerifyChain() = %+v, want ok with 2 verified and 3 pruned", report)
+	}
+
+	// Appending continues after pruned positions, even if the newest trace was pruned
+	if _, err := store.Prune(&RetentionPolicy{MaxAge: Age(time.Minute)}, PruneOptions{Now: now, Source: "test"}); err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	next := insertChain(t, store, 1)[0]
+	if next.ChainSeq != 6 {
+		t.Errorf("ChainSeq after pruning everything = %d, want 6", next.ChainSeq)
+	}
+	if report := verifyChain(t, store); report.Status != ChainOK || report.Pruned != 5 {
+		t.Errorf("VerifyChain() = %+v, want ok with 5 pruned", report)
+	}
+}
+
+func TestCheckpoints(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	keyPath := filepath.Join(t.TempDir(), "chain.key")
+	key, err := GenerateChainKey(keyPath)
+	if err != nil {
+		t.Fatalf("GenerateChainKey() error = %v", err)
+	}
+	if _, err := GenerateChainKey(keyPath); err == nil {
+		t.Error("expected GenerateChainKey() to refuse overwriting a key")
+	}
+
+	pub, err := LoadChainPublicKey(keyPath + ".pub")
+	if err != nil {
+		t.Fatalf("LoadChainPublicKey(.pub) error = %v", err)
+	}
+	fromPrivate, err := LoadChainPublicKey(keyPath)
+	if err != nil {
+		t.Fatalf("LoadChainPublicKey(private) error = %v", err)
+	}
+	if !pub.Equal(fromPrivate) || !pub.Equal(key.Public()) {
+		t.Fatal("loaded public keys don't match the generated key")
+	}
+
+	store.EnableCheckpoints(key, 2)
+	insertChain(t, store, 5)
+
+	checkpoints, err := store.ListCheckpoints()
+	if err != nil {
+		t.Fatalf("ListCheckpoints() error = %v", err)
+	}
+	if len(checkpoints) != 2 || checkpoints[0].Seq != 2 || checkpoints[1].Seq != 4 {
+		t.Fatalf("checkpoints = %+v, want at #2 and #4", checkpoints)
+	}
+
+	report := verifyChain(t, store, pub)
+	if report.Status != ChainOK || report.SignedCheckpoints != 2 {
+		t.Errorf("VerifyChain(key) = %+v, want 2 signed checkpoints", report)
+	}
+	report = verifyChain(t, store)
+	if report.Status != ChainOK || report.UnverifiedCheckpoints != 2 {
+		t.Errorf("VerifyChain(no key) = %+v, want 2 unverified checkpoints", report)
+	}
+
+	// Removing the newest traces is caught by the last checkpoint
+	if _, err := store.db.Exec("DELETE FROM traces WHERE chain_seq >= 4"); err != nil {
+		t.Fatalf("failed to delete traces: %v", err)
+	}
+	report = verifyChain(t, store, pub)
+	if report.Status != ChainBroken || report.Broken.Seq != 4 {
+		t.Errorf("VerifyChain() after truncation = %+v, want broken at checkpoint #4", report)
+	}
+
+	// A forged checkpoint fails its signature
+	if _, err := store.db.Exec("DELETE FROM chain_checkpoints WHERE seq = 4"); err != nil {
+		t.Fatalf("failed to delete checkpoint: %v", err)
+	}
+	if _, err := store.db.Exec("UPDATE chain_checkpoints SET created_at = created_at + 1 WHERE seq = 2"); err != nil {
+		t.Fatalf("failed to forge checkpoint: %v", err)
+	}
+	report = verifyChain(t, store, pub)
+	if report.Status != ChainBroken || !strings.Contains(report.Broken.Reason, "signature") {
+		t.Errorf("VerifyChain() with forged checkpoint = %+v, want invalid signature", report)
+	}
+}
+
+func TestVerifyUnchainedTraces(t *testing.T) {
+	store, err := NewStore(createV1Database(t))
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	defer store.Close()
+
+	report := verifyChain(t, store)
+	if report.Status != ChainEmpty || report.Unchained != 2 {
+		t.Errorf("VerifyChain() = %+v, want empty chain with 2 unchained traces", report)
+	}
+
+	insertChain(t, store, 1)
+	if report := verifyChain(t, store); report.Status != ChainOK || report.Verified != 1 {
+		t.Errorf("VerifyChain() = %+v, want ok with 1 verified", report)
+	}
+}
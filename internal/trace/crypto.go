@@ -0,0 +1,458 @@
+package trace
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// EncryptedMarker replaces encrypted trace fields when the key that
+// encrypted them is not available
+const EncryptedMarker = "[encrypted]"
+
+// EncryptionKeyEnv holds encryption keys when no keyring file is given.
+// Keys are base64 encoded and separated by commas; the first one encrypts.
+const EncryptionKeyEnv = "SNIFFOPS_ENCRYPTION_KEY"
+
+// encryptedPrefix marks a field value sealed with the trace's data key
+const encryptedPrefix = "enc:v1:"
+
+// encryptionKeySize is the size of key encryption keys and data keys (AES-256)
+const encryptionKeySize = 32
+
+// Keyring holds the keys that protect trace payloads at rest.
+//
+// Traces are encrypted with envelope encryption: every trace gets a random
+// data key that encrypts its UserIntent, Input, Output and ErrorMessage, and
+// the data key is stored wrapped by the keyring's primary key. Older keys stay
+// in the keyring to read traces written before a rotation, until Rekey has
+// re-wrapped them with the primary key.
+type Keyring struct {
+	keys []*encryptionKey // keys[0] is the primary key
+}
+
+type encryptionKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// newEncryptionKey creates a key encryption key from raw key bytes
+func newEncryptionKey(raw []byte) (*encryptionKey, error) {
+	if len(raw) != encryptionKeySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes, got %d", encryptionKeySize, len(raw))
+	}
+
+	aead, err := newAEAD(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(raw)
+	return &encryptionKey{id: hex.EncodeToString(sum[:4]), aead: aead}, nil
+}
+
+// newAEAD returns AES-256-GCM with the given key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// ParseKeyring parses base64 encoded 32-byte keys, one per line (or
+// separated by commas). Empty lines and lines starting with # are ignored.
+// The first key is the primary key.
+func ParseKeyring(data []byte) (*Keyring, error) {
+	kr := &Keyring{}
+	seen := make(map[string]bool)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		for _, encoded := range strings.Split(line, ",") {
+			encoded = strings.TrimSpace(encoded)
+			if encoded == "" {
+				continue
+			}
+
+			raw, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				return nil, fmt.Errorf("invalid encryption key: %w", err)
+			}
+			key, err := newEncryptionKey(raw)
+			if err != nil {
+				return nil, err
+			}
+
+			if !seen[key.id] {
+				seen[key.id] = true
+				kr.keys = append(kr.keys, key)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(kr.keys) == 0 {
+		return nil, fmt.Errorf("no encryption keys found")
+	}
+	return kr, nil
+}
+
+// DefaultKeyringPath returns the default encryption keyring location (~/.sniffops/encryption.key)
+func DefaultKeyringPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".sniffops", "encryption.key"), nil
+}
+
+// LoadKeyring loads the encryption keyring from path. If path is empty, the
+// keys come from SNIFFOPS_ENCRYPTION_KEY or ~/.sniffops/encryption.key, and
+// nil is returned if neither exists (traces are then stored in plaintext).
+func LoadKeyring(path string) (*Keyring, error) {
+	if path == "" {
+		if env := os.Getenv(EncryptionKeyEnv); env != "" {
+			kr, err := ParseKeyring([]byte(env))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", EncryptionKeyEnv, err)
+			}
+			return kr, nil
+		}
+
+		defaultPath, err := DefaultKeyringPath()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(defaultPath); errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		path = defaultPath
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read encryption keys: %w", err)
+	}
+	kr, err := ParseKeyring(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return kr, nil
+}
+
+// GenerateEncryptionKey adds a new random key to the keyring file at path,
+// creating it if needed. The new key becomes the primary key; existing keys
+// are kept so that older traces can still be read. Returns the new key ID.
+func GenerateEncryptionKey(path string) (string, error) {
+	raw := make([]byte, encryptionKeySize)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate key: %w", err)
+	}
+	key, err := newEncryptionKey(raw)
+	if err != nil {
+		return "", err
+	}
+
+	existing, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("failed to read encryption keys: %w", err)
+	}
+	if len(existing) > 0 {
+		if _, err := ParseKeyring(existing); err != nil {
+			return "", fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	// Write the new keyring next to the old one, then replace it
+	data := append([]byte(base64.StdEncoding.EncodeToString(raw)+"\n"), existing...)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return "", fmt.Errorf("failed to write encryption keys: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return "", fmt.Errorf("failed to write encryption keys: %w", err)
+	}
+
+	return key.id, nil
+}
+
+// PrimaryKeyID returns the ID of the key that encrypts new traces
+func (kr *Keyring) PrimaryKeyID() string {
+	return kr.keys[0].id
+}
+
+// KeyIDs returns the IDs of all keys, primary first
+func (kr *Keyring) KeyIDs() []string {
+	ids := make([]string, len(kr.keys))
+	for i, key := range kr.keys {
+		ids[i] = key.id
+	}
+	return ids
+}
+
+// key returns the key with the given ID, or nil
+func (kr *Keyring) key(id string) *encryptionKey {
+	for _, key := range kr.keys {
+		if key.id == id {
+			return key
+		}
+	}
+	return nil
+}
+
+// wrap encrypts a data key with the primary key, bound to the trace ID
+func (kr *Keyring) wrap(dataKey []byte, traceID string) (string, error) {
+	primary := kr.keys[0]
+	sealed, err := seal(primary.aead, dataKey, []byte(traceID))
+	if err != nil {
+		return "", err
+	}
+	return primary.id + ":" + sealed, nil
+}
+
+// unwrap decrypts a wrapped data key. It returns errKeyUnavailable if the
+// key that wrapped it is not in the keyring.
+func (kr *Keyring) unwrap(wrapped, traceID string) ([]byte, error) {
+	keyID, sealed, found := strings.Cut(wrapped, ":")
+	if !found {
+		return nil, fmt.Errorf("malformed data key")
+	}
+
+	var key *encryptionKey
+	if kr != nil {
+		key = kr.key(keyID)
+	}
+	if key == nil {
+		return nil, errKeyUnavailable
+	}
+
+	return open(key.aead, sealed, []byte(traceID))
+}
+
+// errKeyUnavailable means a trace was encrypted with a key that isn't loaded
+var errKeyUnavailable = errors.New("encryption key not available")
+
+// seal encrypts plaintext with a random nonce and returns base64(nonce|ciphertext)
+func seal(aead cipher.AEAD, plaintext, additionalData []byte) (string, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, additionalData)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// open reverses seal
+func open(aead cipher.AEAD, encoded string, additionalData []byte) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
+
+// encryptedFields returns the trace fields that are encrypted at rest, by column name
+func encryptedFields(t *Trace) map[string]*string {
+	return map[string]*string{
+		"user_intent":   &t.UserIntent,
+		"input":         &t.Input,
+		"output":        &t.Output,
+		"error_message": &t.ErrorMessage,
+	}
+}
+
+// SetKeyring enables payload encryption. New traces are encrypted with the
+// primary key, and traces read back are decrypted with any key in the
+// keyring. With a nil keyring, new traces are stored in plaintext and
+// encrypted fields read back as EncryptedMarker.
+func (s *Store) SetKeyring(kr *Keyring) {
+	s.keyring = kr
+}
+
+// seal encrypts the payload fields of a trace that is about to be stored
+func (s *Store) seal(t *Trace) error {
+	t.DataKey = ""
+	if s.keyring == nil {
+		return nil
+	}
+
+	fields := encryptedFields(t)
+	empty := true
+	for _, value := range fields {
+		if *value != "" {
+			empty = false
+		}
+	}
+	if empty {
+		return nil
+	}
+
+	dataKey := make([]byte, encryptionKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return fmt.Errorf("failed to generate data key: %w", err)
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return err
+	}
+
+	for column, value := range fields {
+		if *value == "" {
+			continue
+		}
+		// The trace ID and column are authenticated, so ciphertexts can't be swapped
+		sealed, err := seal(aead, []byte(*value), []byte(t.ID+"/"+column))
+		if err != nil {
+			return fmt.Errorf("failed to encrypt trace %s: %w", t.ID, err)
+		}
+		*value = encryptedPrefix + sealed
+	}
+
+	if t.DataKey, err = s.keyring.wrap(dataKey, t.ID); err != nil {
+		return fmt.Errorf("failed to encrypt trace %s: %w", t.ID, err)
+	}
+	return nil
+}
+
+// open decrypts the payload fields of a stored trace in place. Without the
+// key, the encrypted fields are replaced with EncryptedMarker.
+func (s *Store) open(t *Trace) error {
+	if t.DataKey == "" {
+		return nil
+	}
+
+	fields := encryptedFields(t)
+	dataKey, err := s.keyring.unwrap(t.DataKey, t.ID)
+	if errors.Is(err, errKeyUnavailable) {
+		for _, value := range fields {
+			if strings.HasPrefix(*value, encryptedPrefix) {
+				*value = EncryptedMarker
+			}
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to decrypt trace %s: %w", t.ID, err)
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return err
+	}
+	for column, value := range fields {
+		sealed, ok := strings.CutPrefix(*value, encryptedPrefix)
+		if !ok {
+			continue
+		}
+		plaintext, err := open(aead, sealed, []byte(t.ID+"/"+column))
+		if err != nil {
+			return fmt.Errorf("failed to decrypt %s of trace %s: %w", column, t.ID, err)
+		}
+		*value = string(plaintext)
+	}
+
+	return nil
+}
+
+// RekeyResult summarizes a Rekey run
+type RekeyResult struct {
+	Rekeyed    int      `json:"rekeyed"`               // Data keys re-wrapped with the primary key
+	Current    int      `json:"current"`               // Data keys already wrapped with the primary key
+	MissingKey []string `json:"missing_key,omitempty"` // IDs of keys not in the keyring
+	Skipped    int      `json:"skipped"`               // Traces that couldn't be re-wrapped
+}
+
+// Rekey re-wraps the data keys of all encrypted traces with the keyring's
+// primary key. The encrypted fields and the hash chain are unchanged; once
+// it succeeds, older keys can be removed from the keyring.
+func (s *Store) Rekey() (*RekeyResult, error) {
+	if s.keyring == nil {
+		return nil, fmt.Errorf("no encryption keys configured")
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin rekey: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT id, data_key FROM traces WHERE data_key IS NOT NULL AND data_key <> ''")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query data keys: %w", err)
+	}
+	wrapped := make(map[string]string)
+	for rows.Next() {
+		var id, dataKey string
+		if err := rows.Scan(&id, &dataKey); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan data key: %w", err)
+		}
+		wrapped[id] = dataKey
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating data keys: %w", err)
+	}
+
+	result := &RekeyResult{}
+	missing := make(map[string]bool)
+	primary := s.keyring.PrimaryKeyID() + ":"
+	for id, dataKey := range wrapped {
+		if strings.HasPrefix(dataKey, primary) {
+			result.Current++
+			continue
+		}
+
+		raw, err := s.keyring.unwrap(dataKey, id)
+		if err != nil {
+			keyID, _, _ := strings.Cut(dataKey, ":")
+			if errors.Is(err, errKeyUnavailable) && !missing[keyID] {
+				missing[keyID] = true
+				result.MissingKey = append(result.MissingKey, keyID)
+			}
+			result.Skipped++
+			continue
+		}
+
+		rewrapped, err := s.keyring.wrap(raw, id)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec("UPDATE traces SET data_key = ? WHERE id = ?", rewrapped, id); err != nil {
+			return nil, fmt.Errorf("failed to update data key: %w", err)
+		}
+		result.Rekeyed++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit rekey: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,257 @@
+package trace
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestKeyring returns a keyring with one random key and its file path
+func newTestKeyring(t *testing.T) (*Keyring, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "encryption.key")
+	if _, err := GenerateEncryptionKey(path); err != nil {
+		t.Fatalf("GenerateEncryptionKey() error = %v", err)
+	}
+	kr, err := LoadKeyring(path)
+	if err != nil {
+		t.Fatalf("LoadKeyring() error = %v", err)
+	}
+	return kr, path
+}
+
+// createSecretTrace returns a trace with all encrypted fields set
+func createSecretTrace() *Trace {
+	tr := createTestTrace("session-1", "sniff_exec")
+	tr.UserIntent = "check the database password"
+	tr.Input = `{"command":["env"],"pod":"db"}`
+	tr.Output = "DB_PASSWORD=hunter2"
+	tr.ErrorMessage = "exit status 1"
+	return tr
+}
+
+// rawPayload reads the stored encrypted columns of a trace
+func rawPayload(t *testing.T, store *Store, id string) (output, errorMessage, dataKey string) {
+	t.Helper()
+	err := store.db.QueryRow("SELECT output, error_message, data_key FROM traces WHERE id = ?", id).
+		Scan(&output, &errorMessage, &dataKey)
+	if err != nil {
+		t.Fatalf("failed to read raw trace: %v", err)
+	}
+	return output, errorMessage, dataKey
+}
+
+func TestEncryptedRoundTrip(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	kr, _ := newTestKeyring(t)
+	store.SetKeyring(kr)
+
+	tr := createSecretTrace()
+	if err := store.Insert(tr); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+	if tr.Output != "DB_PASSWORD=hunter2" || tr.DataKey != "" {
+		t.Errorf("Insert() modified the caller's trace: %+v", tr)
+	}
+
+	output, errorMessage, dataKey := rawPayload(t, store, tr.ID)
+	if strings.Contains(output, "hunter2") || !strings.HasPrefix(output, encryptedPrefix) || !strings.HasPrefix(errorMessage, encryptedPrefix) {
+		t.Errorf("payload stored in plaintext: output=%q error=%q", output, errorMessage)
+	}
+	if !strings.HasPrefix(dataKey, kr.PrimaryKeyID()+":") {
+		t.Errorf("data_key = %q, want wrapped by %s", dataKey, kr.PrimaryKeyID())
+	}
+
+	got, err := store.GetByID(tr.ID)
+	if err != nil {
+		t.Fatalf("GetByID() error = %v", err)
+	}
+	if got.UserIntent != tr.UserIntent || got.Input != tr.Input || got.Output != tr.Output || got.ErrorMessage != tr.ErrorMessage {
+		t.Errorf("GetByID() = %+v, want decrypted payload", got)
+	}
+	var input string
+	if err := store.db.QueryRow("SELECT input FROM traces WHERE id = ?", tr.ID).Scan(&input); err != nil || !strings.HasPrefix(input, encryptedPrefix) {
+		t.Errorf("input stored as %q (%v), want encrypted", input, err)
+	}
+
+	traces, err := store.List(nil)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(traces) != 1 || traces[0].Output != tr.Output {
+		t.Errorf("List() = %+v, want decrypted payload", traces)
+	}
+
+	// The chain covers the stored ciphertext and verifies without the key
+	store.SetKeyring(nil)
+	if report := verifyChain(t, store); report.Status != ChainOK || report.Verified != 1 {
+		t.Errorf("VerifyChain() = %+v, want ok", report)
+	}
+}
+
+func TestEncryptedWithoutKey(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	kr, _ := newTestKeyring(t)
+	store.SetKeyring(kr)
+	secret := createSecretTrace()
+	if err := store.Insert(secret); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+
+	// Traces written without a key stay readable
+	store.SetKeyring(nil)
+	plain := createSecretTrace()
+	if err := store.Insert(plain); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+
+	got, err := store.GetByID(secret.ID)
+	if err != nil {
+		t.Fatalf("GetByID() error = %v", err)
+	}
+	if got.UserIntent != EncryptedMarker || got.Input != EncryptedMarker || got.Output != EncryptedMarker || got.ErrorMessage != EncryptedMarker {
+		t.Errorf("GetByID() without key = %+v, want %q markers", got, EncryptedMarker)
+	}
+	if got.Command != secret.Command {
+		t.Errorf("Command = %q, want unencrypted %q", got.Command, secret.Command)
+	}
+
+	got, err = store.GetByID(plain.ID)
+	if err != nil {
+		t.Fatalf("GetByID() error = %v", err)
+	}
+	if got.Output != plain.Output {
+		t.Errorf("Output = %q, want plaintext %q", got.Output, plain.Output)
+	}
+
+	// A different key is no better than no key
+	other, _ := newTestKeyring(t)
+	store.SetKeyring(other)
+	if got, _ := store.GetByID(secret.ID); got == nil || got.Output != EncryptedMarker {
+		t.Errorf("GetByID() with wrong key = %+v, want %q", got, EncryptedMarker)
+	}
+}
+
+func TestEncryptedTamperingFails(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	kr, _ := newTestKeyring(t)
+	store.SetKeyring(kr)
+	a, b := createSecretTrace(), createSecretTrace()
+	b.Output = "something else"
+	if err := store.InsertBatch([]*Trace{a, b}); err != nil {
+		t.Fatalf("InsertBatch() error = %v", err)
+	}
+
+	// Ciphertexts are bound to their trace and column
+	output, _, _ := rawPayload(t, store, b.ID)
+	if _, err := store.db.Exec("UPDATE traces SET output = ? WHERE id = ?", output, a.ID); err != nil {
+		t.Fatalf("failed to tamper: %v", err)
+	}
+	if _, err := store.GetByID(a.ID); err == nil {
+		t.Error("expected GetByID() to fail for a swapped ciphertext")
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	oldKeyring, path := newTestKeyring(t)
+	store.SetKeyring(oldKeyring)
+	tr := createSecretTrace()
+	if err := store.Insert(tr); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+
+	// Adding a key makes it the primary one; the old key still decrypts
+	newID, err := GenerateEncryptionKey(path)
+	if err != nil {
+		t.Fatalf("GenerateEncryptionKey() error = %v", err)
+	}
+	rotated, err := LoadKeyring(path)
+	if err != nil {
+		t.Fatalf("LoadKeyring() error = %v", err)
+	}
+	if ids := rotated.KeyIDs(); len(ids) != 2 || ids[0] != newID || ids[1] != oldKeyring.PrimaryKeyID() {
+		t.Fatalf("KeyIDs() = %v, want [%s %s]", ids, newID, oldKeyring.PrimaryKeyID())
+	}
+	store.SetKeyring(rotated)
+
+	result, err := store.Rekey()
+	if err != nil {
+		t.Fatalf("Rekey() error = %v", err)
+	}
+	if result.Rekeyed != 1 || result.Skipped != 0 {
+		t.Errorf("Rekey() = %+v, want 1 rekeyed", result)
+	}
+
+	// After rekeying, the new key alone is enough
+	data, _ := os.ReadFile(path)
+	newOnly, err := ParseKeyring([]byte(strings.SplitN(string(data), "\n", 2)[0]))
+	if err != nil {
+		t.Fatalf("ParseKeyring() error = %v", err)
+	}
+	store.SetKeyring(newOnly)
+	got, err := store.GetByID(tr.ID)
+	if err != nil {
+		t.Fatalf("GetByID() error = %v", err)
+	}
+	if got.Output != tr.Output {
+		t.Errorf("Output = %q after rotation, want %q", got.Output, tr.Output)
+	}
+
+	if report := verifyChain(t, store); report.Status != ChainOK {
+		t.Errorf("VerifyChain() after rekey = %+v, want ok", report)
+	}
+	if result, _ := store.Rekey(); result.Current != 1 || result.Rekeyed != 0 {
+		t.Errorf("second Rekey() = %+v, want 1 current", result)
+	}
+}
+
+func TestLoadKeyring(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(make([]byte, encryptionKeySize))
+	t.Setenv("HOME", t.TempDir())
+
+	t.Setenv(EncryptionKeyEnv, "")
+	if kr, err := LoadKeyring(""); err != nil || kr != nil {
+		t.Errorf("LoadKeyring() without keys = %v, %v; want nil, nil", kr, err)
+	}
+
+	t.Setenv(EncryptionKeyEnv, key)
+	if kr, err := LoadKeyring(""); err != nil || kr == nil {
+		t.Errorf("LoadKeyring() from %s = %v, %v", EncryptionKeyEnv, kr, err)
+	}
+
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+		wantIDs int
+	}{
+		{"comments and duplicates", "# primary\n" + key + "\n\n" + key + "\n", false, 1},
+		{"comma separated", key + "," + base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32))), false, 2},
+		{"short key", base64.StdEncoding.EncodeToString([]byte("short")), true, 0},
+		{"not base64", "not a key!", true, 0},
+		{"empty", "# nothing\n", true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kr, err := ParseKeyring([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseKeyring() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && len(kr.KeyIDs()) != tt.wantIDs {
+				t.Errorf("KeyIDs() = %v, want %d keys", kr.KeyIDs(), tt.wantIDs)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package trace
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// InsertDelivery records a webhook delivery
+func (s *Store) InsertDelivery(d *WebhookDelivery) error {
+	if d == nil {
+		return fmt.Errorf("delivery cannot be nil")
+	}
+
+	_, err := s.db.Exec(`
+		INSERT INTO webhook_deliveries (
+			id, webhook, url, trace_id, status, attempts, status_code, error, created_at, completed_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		d.ID, d.Webhook, d.URL, d.TraceID, d.Status, d.Attempts,
+		nullInt64(int64(d.StatusCode)), d.Error, d.CreatedAt, d.CompletedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// ListDeliveries retrieves webhook deliveries, newest first.
+// An empty traceID returns deliveries for all traces.
+func (s *Store) ListDeliveries(traceID string, limit int) ([]*WebhookDelivery, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+
+	query := "SELECT id, webhook, url, trace_id, status, attempts, status_code, error, created_at, completed_at FROM webhook_deliveries"
+	var args []interface{}
+	if traceID != "" {
+		query += " WHERE trace_id = ?"
+		args = append(args, traceID)
+	}
+	query += " ORDER BY created_at DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []*WebhookDelivery
+	for rows.Next() {
+		d := &WebhookDelivery{}
+		var statusCode sql.NullInt64
+		var errorMessage sql.NullString
+		if err := rows.Scan(&d.ID, &d.Webhook, &d.URL, &d.TraceID, &d.Status, &d.Attempts,
+			&statusCode, &errorMessage, &d.CreatedAt, &d.CompletedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		d.StatusCode = int(statusCode.Int64)
+		d.Error = errorMessage.String
+		deliveries = append(deliveries, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
@@ -0,0 +1,221 @@
+package trace
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"  // PostgreSQL driver
+	_ "modernc.org/sqlite" // SQLite driver (CGO-free)
+)
+
+// sqliteBusyTimeout is how long a SQLite connection waits for a lock held by
+// another process (e.g., sniffops web) before failing with "database is locked"
+const sqliteBusyTimeout = 5 * time.Second
+
+// dialect describes the SQL differences between the supported databases.
+// Queries are written with "?" placeholders and rebound for the dialect.
+type dialect interface {
+	// name is the backend name shown to users (sqlite, postgres)
+	name() string
+	// driver is the database/sql driver name
+	driver() string
+	// dataSource returns the driver data source name for dsn (e.g., with connection options added)
+	dataSource(dsn string) string
+	// rebind converts "?" placeholders to the dialect's placeholder syntax
+	rebind(query string) string
+	// migrations returns the ordered schema migrations for the dialect
+	migrations() []migration
+	// tableExistsQuery returns a query selecting the name of the table given as its only argument
+	tableExistsQuery() string
+	// hourBucket returns an expression formatting a millisecond timestamp column
+	// as an ISO 8601 hour (e.g., 2024-01-02T15:00:00Z)
+	hourBucket(column string) string
+	// lockChain returns a statement that serializes hash chain appends across
+	// processes for the rest of the transaction ("" if Begin already does)
+	lockChain() string
+	// noLimit is the LIMIT value meaning "no limit" (needed to use OFFSET alone)
+	noLimit() string
+	// sizeQuery returns a query selecting the size of the database in bytes
+	sizeQuery() string
+	// searchQuery converts a user's full-text query to the dialect's syntax
+	searchQuery(q string) string
+	// searchCondition returns a condition on traces matching the full-text
+	// query given as its only argument
+	searchCondition() string
+	// searchJoin returns a JOIN of traces with the full-text matches of the
+	// query given as its only argument, as "search" with the columns
+	// search_rank (best match first) and search_snippet
+	searchJoin() string
+}
+
+// isPostgresDSN reports whether dsn selects the PostgreSQL backend
+func isPostgresDSN(dsn string) bool {
+	return strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://")
+}
+
+// dialectFor returns the dialect selected by dsn.
+// PostgreSQL URLs select PostgreSQL; anything else is a SQLite file path.
+func dialectFor(dsn string) dialect {
+	if isPostgresDSN(dsn) {
+		return postgresDialect{}
+	}
+	return sqliteDialect{}
+}
+
+// sqliteDialect is the default, file-based backend
+type sqliteDialect struct{}
+
+func (sqliteDialect) name() string               { return "sqlite" }
+func (sqliteDialect) driver() string             { return "sqlite" }
+func (sqliteDialect) rebind(query string) string { return query }
+func (sqliteDialect) migrations() []migration    { return sqliteMigrations }
+func (sqliteDialect) noLimit() string            { return "-1" }
+func (sqliteDialect) lockChain() string          { return "" }
+
+// dataSource enables WAL mode and a busy timeout on every connection, so that
+// serve and web can read while the other writes instead of failing immediately.
+// Transactions take the write lock when they begin (BEGIN IMMEDIATE), which
+// also serializes hash chain appends between processes.
+func (sqliteDialect) dataSource(path string) string {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return fmt.Sprintf("%s%s_pragma=busy_timeout(%d)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_txlock=immediate",
+		path, sep, sqliteBusyTimeout.Milliseconds())
+}
+
+func (sqliteDialect) sizeQuery() string {
+	return "SELECT page_count * page_size FROM pragma_page_count(), pragma_page_size()"
+}
+
+func (sqliteDialect) searchQuery(q string) string { return sqliteSearchQuery(q) }
+
+func (sqliteDialect) searchCondition() string {
+	return "traces.rowid IN (SELECT rowid FROM traces_fts WHERE traces_fts MATCH ?)"
+}
+
+func (sqliteDialect) searchJoin() string {
+	return fmt.Sprintf(` JOIN (
+		SELECT rowid AS search_key, rank AS search_rank,
+			snippet(traces_fts, -1, '%s', '%s', '…', %d) AS search_snippet
+		FROM traces_fts WHERE traces_fts MATCH ?
+	) search ON search.search_key = traces.rowid`, SnippetOpen, SnippetClose, snippetWords)
+}
+
+func (sqliteDialect) tableExistsQuery() string {
+	return "SELECT name FROM sqlite_master WHERE type = 'table' AND name = ?"
+}
+
+func (sqliteDialect) hourBucket(column string) string {
+	// SQLite doesn't have built-in date_trunc, so we'll use strftime
+	return "strftime('%Y-%m-%dT%H:00:00Z', datetime(" + column + "/1000, 'unixepoch'))"
+}
+
+// postgresDialect is the shared backend for team deployments
+type postgresDialect struct{}
+
+func (postgresDialect) name() string                 { return "postgres" }
+func (postgresDialect) driver() string               { return "postgres" }
+func (postgresDialect) migrations() []migration      { return postgresMigrations }
+func (postgresDialect) noLimit() string              { return "ALL" }
+func (postgresDialect) dataSource(dsn string) string { return dsn }
+
+func (postgresDialect) lockChain() string {
+	return "SELECT pg_advisory_xact_lock(hashtext('sniffops_trace_chain'))"
+}
+
+func (postgresDialect) sizeQuery() string {
+	return "SELECT pg_database_size(current_database())"
+}
+
+func (postgresDialect) searchQuery(q string) string { return q }
+
+func (postgresDialect) searchCondition() string {
+	return "to_tsvector('simple', " + searchDocument + ") @@ plainto_tsquery('simple', ?)"
+}
+
+func (postgresDialect) searchJoin() string {
+	return fmt.Sprintf(` JOIN (
+		SELECT id AS search_key, -ts_rank(to_tsvector('simple', %[1]s), query) AS search_rank,
+			ts_headline('simple', %[1]s, query, 'StartSel="%[2]s", StopSel="%[3]s", MaxWords=%[4]d, MinWords=%[5]d, MaxFragments=1') AS search_snippet
+		FROM traces, plainto_tsquery('simple', ?) query
+		WHERE to_tsvector('simple', %[1]s) @@ query
+	) search ON search.search_key = traces.id`, searchDocument, SnippetOpen, SnippetClose, snippetWords, snippetWords/2)
+}
+
+func (postgresDialect) tableExistsQuery() string {
+	return "SELECT table_name FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?"
+}
+
+func (postgresDialect) hourBucket(column string) string {
+	return "to_char(to_timestamp(" + column + " / 1000) AT TIME ZONE 'UTC', 'YYYY-MM-DD\"T\"HH24:00:00\"Z\"')"
+}
+
+// rebind converts "?" placeholders to $1, $2, ...
+func (postgresDialect) rebind(query string) string {
+	if !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// sqlDB is a *sql.DB that rebinds queries for its dialect
+type sqlDB struct {
+	*sql.DB
+	dialect dialect
+}
+
+func (db *sqlDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return db.DB.Exec(db.dialect.rebind(query), args...)
+}
+
+func (db *sqlDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.DB.Query(db.dialect.rebind(query), args...)
+}
+
+func (db *sqlDB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return db.DB.QueryRow(db.dialect.rebind(query), args...)
+}
+
+// Begin starts a transaction that rebinds queries for the dialect
+func (db *sqlDB) Begin() (*sqlTx, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &sqlTx{Tx: tx, dialect: db.dialect}, nil
+}
+
+// sqlTx is a *sql.Tx that rebinds queries for its dialect
+type sqlTx struct {
+	*sql.Tx
+	dialect dialect
+}
+
+func (tx *sqlTx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return tx.Tx.Exec(tx.dialect.rebind(query), args...)
+}
+
+func (tx *sqlTx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.Tx.Query(tx.dialect.rebind(query), args...)
+}
+
+func (tx *sqlTx) QueryRow(query string, args ...interface{}) *sql.Row {
+	return tx.Tx.QueryRow(tx.dialect.rebind(query), args...)
+}
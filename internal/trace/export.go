@@ -0,0 +1,212 @@
+package trace
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Export formats
+const (
+	FormatNDJSON = "ndjson" // One JSON trace per line (the default, also read by import)
+	FormatJSON   = "json"   // A single JSON array
+	FormatCSV    = "csv"    // One row per trace with a header row of JSON field names
+)
+
+// ExportFormats lists the supported export formats
+var ExportFormats = []string{FormatNDJSON, FormatJSON, FormatCSV}
+
+// ParseExportFormat validates an export format name (empty = ndjson)
+func ParseExportFormat(format string) (string, error) {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format == "" {
+		return FormatNDJSON, nil
+	}
+	for _, f := range ExportFormats {
+		if format == f {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("invalid export format %q (valid: %s)", format, strings.Join(ExportFormats, ", "))
+}
+
+// ExportContentType returns the MIME type of an export format
+func ExportContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatJSON:
+		return "application/json"
+	default:
+		return "application/x-ndjson"
+	}
+}
+
+// Export writes the traces matching filter to w, oldest first, and returns
+// how many were written. Traces are streamed one at a time, so the export
+// isn't limited by memory or by List's default limit; a zero filter Limit
+// exports every matching trace.
+func Export(w io.Writer, b Backend, filter *ListFilter, format string) (int, error) {
+	format, err := ParseExportFormat(format)
+	if err != nil {
+		return 0, err
+	}
+
+	buf := bufio.NewWriter(w)
+	var enc traceEncoder
+	switch format {
+	case FormatJSON:
+		enc = &jsonArrayEncoder{w: buf}
+	case FormatCSV:
+		enc = &csvEncoder{w: csv.NewWriter(buf)}
+	default:
+		enc = newNDJSONEncoder(buf)
+	}
+
+	n := 0
+	if err := enc.begin(); err != nil {
+		return 0, err
+	}
+	err = b.Each(filter, func(t *Trace) error {
+		if err := enc.encode(t); err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		return n, err
+	}
+	if err := enc.end(); err != nil {
+		return n, err
+	}
+
+	return n, buf.Flush()
+}
+
+// traceEncoder writes traces in one export format
+type traceEncoder interface {
+	begin() error
+	encode(t *Trace) error
+	end() error
+}
+
+type ndjsonEncoder struct {
+	enc *json.Encoder
+}
+
+func newNDJSONEncoder(w io.Writer) *ndjsonEncoder {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return &ndjsonEncoder{enc: enc}
+}
+
+func (e *ndjsonEncoder) begin() error          { return nil }
+func (e *ndjsonEncoder) encode(t *Trace) error { return e.enc.Encode(t) }
+func (e *ndjsonEncoder) end() error            { return nil }
+
+type jsonArrayEncoder struct {
+	w     io.Writer
+	count int
+}
+
+func (e *jsonArrayEncoder) begin() error {
+	_, err := io.WriteString(e.w, "[")
+	return err
+}
+
+func (e *jsonArrayEncoder) encode(t *Trace) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+
+	sep := ",\n  "
+	if e.count == 0 {
+		sep = "\n  "
+	}
+	e.count++
+
+	if _, err := io.WriteString(e.w, sep); err != nil {
+		return err
+	}
+	_, err = e.w.Write(data)
+	return err
+}
+
+func (e *jsonArrayEncoder) end() error {
+	end := "\n]\n"
+	if e.count == 0 {
+		end = "]\n"
+	}
+	_, err := io.WriteString(e.w, end)
+	return err
+}
+
+type csvEncoder struct {
+	w *csv.Writer
+}
+
+func (e *csvEncoder) begin() error {
+	header := make([]string, len(csvFields))
+	for i, f := range csvFields {
+		header[i] = f.name
+	}
+	return e.w.Write(header)
+}
+
+func (e *csvEncoder) encode(t *Trace) error {
+	v := reflect.ValueOf(t).Elem()
+	record := make([]string, len(csvFields))
+	for i, f := range csvFields {
+		record[i] = formatCSVValue(v.Field(f.index))
+	}
+	return e.w.Write(record)
+}
+
+func (e *csvEncoder) end() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// csvField is an exported Trace field and its column name
+type csvField struct {
+	name  string
+	index int
+}
+
+// csvFields are the stored Trace fields in declaration order, named by their
+// JSON keys, so that CSV columns follow new fields automatically
+var csvFields = func() []csvField {
+	var fields []csvField
+	typ := reflect.TypeOf(Trace{})
+	for i := 0; i < typ.NumField(); i++ {
+		name, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" || typ.Field(i).Tag.Get("db") == "-" {
+			continue
+		}
+		fields = append(fields, csvField{name: name, index: i})
+	}
+	return fields
+}()
+
+// formatCSVValue formats a Trace field value for a CSV cell
+func formatCSVValue(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Int, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
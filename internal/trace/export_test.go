@@ -0,0 +1,171 @@
+package trace
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// insertExportTraces inserts n traces one second apart, starting at base
+func insertExportTraces(t *testing.T, store *Store, n int, base time.Time) []*Trace {
+	t.Helper()
+	traces := make([]*Trace, n)
+	for i := range traces {
+		tr := createTestTrace("session-1", "sniff_get")
+		tr.Timestamp = base.Add(time.Duration(i) * time.Second).UnixMilli()
+		traces[i] = tr
+	}
+	if err := store.InsertBatch(traces); err != nil {
+		t.Fatalf("InsertBatch() error = %v", err)
+	}
+	return traces
+}
+
+func TestEach(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	base := time.Now().Add(-time.Hour)
+	traces := insertExportTraces(t, store, 150, base)
+	other := createTestTrace("session-2", "sniff_logs")
+	if err := store.Insert(other); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+
+	start := base.Add(10 * time.Second)
+	tests := []struct {
+		name    string
+		filter  *ListFilter
+		wantIDs []string
+	}{
+		{"no limit", &ListFilter{SessionID: "session-1"}, ids(traces)},
+		{"limit and offset", &ListFilter{SessionID: "session-1", Limit: 3, Offset: 5}, ids(traces[5:8])},
+		{"offset only", &ListFilter{SessionID: "session-1", Offset: 148}, ids(traces[148:])},
+		{"time range", &ListFilter{StartTime: &start, Tool: "sniff_get"}, ids(traces[10:])},
+		{"other session", &ListFilter{SessionID: "session-2"}, []string{other.ID}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			err := store.Each(tt.filter, func(tr *Trace) error {
+				got = append(got, tr.ID)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Each() error = %v", err)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.wantIDs, ",") {
+				t.Errorf("Each() returned %d traces, want %d in timestamp order", len(got), len(tt.wantIDs))
+			}
+		})
+	}
+}
+
+func ids(traces []*Trace) []string {
+	out := make([]string, len(traces))
+	for i, tr := range traces {
+		out[i] = tr.ID
+	}
+	return out
+}
+
+func TestExportFormats(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	traces := insertExportTraces(t, store, 120, time.Now().Add(-time.Hour))
+	traces[0].Output = "line 1\nline \"2\", <b>"
+	if _, err := store.db.Exec("UPDATE traces SET output = ? WHERE id = ?", traces[0].Output, traces[0].ID); err != nil {
+		t.Fatalf("failed to set output: %v", err)
+	}
+	filter := &ListFilter{SessionID: "session-1"}
+
+	t.Run("ndjson", func(t *testing.T) {
+		var buf bytes.Buffer
+		n, err := Export(&buf, store, filter, FormatNDJSON)
+		if err != nil || n != 120 {
+			t.Fatalf("Export() = %d, %v; want 120 traces", n, err)
+		}
+
+		var got []*Trace
+		scanner := bufio.NewScanner(&buf)
+		for scanner.Scan() {
+			var tr Trace
+			if err := json.Unmarshal(scanner.Bytes(), &tr); err != nil {
+				t.Fatalf("invalid NDJSON line: %v", err)
+			}
+			got = append(got, &tr)
+		}
+		if len(got) != 120 || got[0].ID != traces[0].ID || got[0].Output != traces[0].Output {
+			t.Errorf("NDJSON export has %d traces, first %+v", len(got), got[0])
+		}
+		if got[0].Hash == "" || got[0].ChainSeq == 0 {
+			t.Error("expected chain fields in the export")
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+		if _, err := Export(&buf, store, filter, "JSON"); err != nil {
+			t.Fatalf("Export() error = %v", err)
+		}
+		var got []*Trace
+		if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+			t.Fatalf("invalid JSON export: %v", err)
+		}
+		if len(got) != 120 || got[119].ID != traces[119].ID {
+			t.Errorf("JSON export has %d traces", len(got))
+		}
+
+		buf.Reset()
+		if _, err := Export(&buf, store, &ListFilter{SessionID: "none"}, FormatJSON); err != nil {
+			t.Fatalf("Export() error = %v", err)
+		}
+		if err := json.Unmarshal(buf.Bytes(), &got); err != nil || len(got) != 0 {
+			t.Errorf("empty JSON export = %q", buf.String())
+		}
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		var buf bytes.Buffer
+		if _, err := Export(&buf, store, filter, FormatCSV); err != nil {
+			t.Fatalf("Export() error = %v", err)
+		}
+		records, err := csv.NewReader(&buf).ReadAll()
+		if err != nil {
+			t.Fatalf("invalid CSV export: %v", err)
+		}
+		if len(records) != 121 {
+			t.Fatalf("CSV export has %d rows, want header + 120", len(records))
+		}
+
+		header := records[0]
+		column := func(name string) int {
+			for i, h := range header {
+				if h == name {
+					return i
+				}
+			}
+			t.Fatalf("CSV header %v has no %s column", header, name)
+			return -1
+		}
+		first := records[1]
+		if first[column("id")] != traces[0].ID || first[column("output")] != traces[0].Output || first[column("latency_ms")] != "100" {
+			t.Errorf("unexpected first CSV row: %v", first)
+		}
+		for _, h := range header {
+			if h == "data_key" || h == "" {
+				t.Errorf("unexpected CSV column %q", h)
+			}
+		}
+	})
+
+	if _, err := Export(&bytes.Buffer{}, store, filter, "xml"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
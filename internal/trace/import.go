@@ -0,0 +1,290 @@
+package trace
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// importBatchSize is how many traces are inserted per transaction on import
+const importBatchSize = 500
+
+// sqliteHeader is the first bytes of every SQLite database file
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+// ImportOptions controls how traces from another machine are merged
+type ImportOptions struct {
+	// SourceHost and SourceUser tag imported traces that don't already carry
+	// a source (traces merged earlier keep their original tags)
+	SourceHost string
+	SourceUser string
+}
+
+// ImportResult summarizes an import
+type ImportResult struct {
+	Read       int `json:"read"`       // Traces read from the source
+	Imported   int `json:"imported"`   // New traces added to the store
+	Duplicates int `json:"duplicates"` // Traces skipped because their ID already exists
+	Unreadable int `json:"unreadable"` // Traces skipped because they are encrypted with a key that isn't available
+	Sessions   int `json:"sessions"`   // Sessions added to the store
+}
+
+// IsSQLiteFile reports whether path is a SQLite database (rather than an NDJSON export)
+func IsSQLiteFile(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	header := make([]byte, len(sqliteHeader))
+	if _, err := io.ReadFull(f, header); err != nil {
+		return false, nil
+	}
+	return bytes.Equal(header, sqliteHeader), nil
+}
+
+// ImportNDJSON merges traces from an NDJSON export (see Export) into the store.
+// Traces whose ID already exists are skipped, and traces keep their session
+// IDs; a session row is created for sessions the store doesn't know yet.
+// Imported traces are appended to this store's hash chain.
+func (s *Store) ImportNDJSON(r io.Reader, opts ImportOptions) (*ImportResult, error) {
+	imp := s.newImporter(opts)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024) // Outputs and snapshots can be large
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		t := &Trace{}
+		if err := json.Unmarshal(data, t); err != nil {
+			return imp.result, fmt.Errorf("line %d: invalid trace: %w", line, err)
+		}
+		if t.ID == "" || t.SessionID == "" {
+			return imp.result, fmt.Errorf("line %d: trace without id or session_id", line)
+		}
+		if err := imp.add(t); err != nil {
+			return imp.result, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return imp.result, fmt.Errorf("failed to read export: %w", err)
+	}
+
+	return imp.finish()
+}
+
+// ImportDatabase merges the traces and sessions of another SQLite trace
+// database into the store. The source file is not modified: it is copied
+// and the copy is upgraded to the current schema. Encrypted traces are
+// decrypted with this store's keyring and re-encrypted on insert.
+func (s *Store) ImportDatabase(path string, opts ImportOptions) (*ImportResult, error) {
+	tmpDir, err := os.MkdirTemp("", "sniffops-import-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// VACUUM INTO takes a consistent copy, including changes still in the WAL
+	copyPath := filepath.Join(tmpDir, "source.db")
+	if err := copySQLiteDatabase(path, copyPath); err != nil {
+		return nil, err
+	}
+
+	src, err := NewStore(copyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer src.Close()
+	src.SetKeyring(s.keyring)
+
+	imp := s.newImporter(opts)
+
+	sessions, err := src.allSessions()
+	if err != nil {
+		return nil, err
+	}
+	for _, session := range sessions {
+		if err := imp.addSession(session); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := src.Each(nil, imp.add); err != nil {
+		return imp.result, err
+	}
+	return imp.finish()
+}
+
+// copySQLiteDatabase writes a consistent copy of a SQLite database to dst
+func copySQLiteDatabase(src, dst string) error {
+	if _, err := os.Stat(src); err != nil {
+		return err
+	}
+
+	db, err := sql.Open("sqlite", "file:"+src+"?mode=ro")
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec("VACUUM INTO ?", dst); err != nil {
+		return fmt.Errorf("failed to copy %s: %w", src, err)
+	}
+	return nil
+}
+
+// allSessions returns every session in the store
+func (s *Store) allSessions() ([]*Session, error) {
+	rows, err := s.db.Query("SELECT " + sessionColumns + " FROM sessions ORDER BY started_at")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []*Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// importer batches imported traces into a store
+type importer struct {
+	store  *Store
+	opts   ImportOptions
+	result *ImportResult
+	batch  []*Trace
+
+	// Sessions referenced by imported traces, with their first trace time
+	sessions map[string]int64
+	// Sessions already created from the source
+	known map[string]bool
+}
+
+func (s *Store) newImporter(opts ImportOptions) *importer {
+	return &importer{
+		store:    s,
+		opts:     opts,
+		result:   &ImportResult{},
+		sessions: make(map[string]int64),
+		known:    make(map[string]bool),
+	}
+}
+
+// add queues a trace for import
+func (imp *importer) add(t *Trace) error {
+	imp.result.Read++
+
+	// Importing a marker would silently replace the payload
+	if isUnreadable(t) {
+		imp.result.Unreadable++
+		return nil
+	}
+
+	// The trace gets a new position in this store's chain
+	t.ChainSeq, t.PrevHash, t.Hash, t.DataKey = 0, "", "", ""
+	if t.SourceHost == "" {
+		t.SourceHost = imp.opts.SourceHost
+	}
+	if t.SourceUser == "" {
+		t.SourceUser = imp.opts.SourceUser
+	}
+
+	if first, ok := imp.sessions[t.SessionID]; !ok || t.Timestamp < first {
+		imp.sessions[t.SessionID] = t.Timestamp
+	}
+
+	imp.batch = append(imp.batch, t)
+	if len(imp.batch) >= importBatchSize {
+		return imp.flush()
+	}
+	return nil
+}
+
+// addSession copies a session row unless the store already has it
+func (imp *importer) addSession(session *Session) error {
+	imp.known[session.ID] = true
+	return imp.insertSession(session)
+}
+
+// insertSession creates a session if it doesn't exist yet
+func (imp *importer) insertSession(session *Session) error {
+	result, err := imp.store.db.Exec(
+		"INSERT INTO sessions ("+sessionColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (id) DO NOTHING",
+		session.ID, session.ClientName, session.ClientVersion, session.ProtocolVersion, session.Transport,
+		session.StartedAt, nullInt64(session.EndedAt), session.Cwd, session.KubeContext,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to import session: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		imp.result.Sessions++
+	}
+	return nil
+}
+
+// flush inserts the queued traces, skipping IDs that already exist
+func (imp *importer) flush() error {
+	if len(imp.batch) == 0 {
+		return nil
+	}
+
+	if err := imp.store.InsertBatch(imp.batch); err != nil {
+		return fmt.Errorf("failed to import traces: %w", err)
+	}
+	for _, t := range imp.batch {
+		// Only inserted traces are linked into the chain
+		if t.ChainSeq != 0 {
+			imp.result.Imported++
+		} else {
+			imp.result.Duplicates++
+		}
+	}
+
+	imp.batch = imp.batch[:0]
+	return nil
+}
+
+// finish inserts the remaining traces and creates missing sessions
+func (imp *importer) finish() (*ImportResult, error) {
+	if err := imp.flush(); err != nil {
+		return imp.result, err
+	}
+
+	for id, first := range imp.sessions {
+		if imp.known[id] {
+			continue
+		}
+		if err := imp.insertSession(&Session{ID: id, StartedAt: first}); err != nil {
+			return imp.result, err
+		}
+	}
+
+	return imp.result, nil
+}
+
+// isUnreadable reports whether a trace's payload was replaced by
+// EncryptedMarker because its key wasn't available
+func isUnreadable(t *Trace) bool {
+	for _, value := range encryptedFields(t) {
+		if *value == EncryptedMarker {
+			return true
+		}
+	}
+	return false
+}
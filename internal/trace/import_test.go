@@ -0,0 +1,224 @@
+package trace
+
+import (
+	"bytes"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// createSourceDatabase creates a trace database with two sessions and returns its path
+func createSourceDatabase(t *testing.T, keyring *Keyring) (string, []*Trace) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "alice.db")
+	src, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	defer src.Close()
+	src.SetKeyring(keyring)
+
+	now := time.Now()
+	if err := src.SaveSession(createTestSession("alice-1", now.Add(-time.Hour).UnixMilli())); err != nil {
+		t.Fatalf("SaveSession() error = %v", err)
+	}
+
+	var traces []*Trace
+	for i, sessionID := range []string{"alice-1", "alice-1", "alice-2"} {
+		tr := createSecretTrace()
+		tr.SessionID = sessionID
+		tr.Timestamp = now.Add(time.Duration(i-10) * time.Minute).UnixMilli()
+		traces = append(traces, tr)
+	}
+	if err := src.InsertBatch(traces); err != nil {
+		t.Fatalf("InsertBatch() error = %v", err)
+	}
+
+	return path, traces
+}
+
+func TestImportNDJSON(t *testing.T) {
+	srcPath, traces := createSourceDatabase(t, nil)
+	src, err := NewStore(srcPath)
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	defer src.Close()
+
+	var export bytes.Buffer
+	if _, err := Export(&export, src, nil, FormatNDJSON); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+	local := insertChain(t, store, 2)
+
+	opts := ImportOptions{SourceHost: "alice-laptop", SourceUser: "alice"}
+	result, err := store.ImportNDJSON(bytes.NewReader(export.Bytes()), opts)
+	if err != nil {
+		t.Fatalf("ImportNDJSON() error = %v", err)
+	}
+	if result.Read != 3 || result.Imported != 3 || result.Duplicates != 0 || result.Sessions != 2 {
+		t.Errorf("ImportNDJSON() = %+v, want 3 imported and 2 sessions", result)
+	}
+
+	got, err := store.GetByID(traces[2].ID)
+	if err != nil {
+		t.Fatalf("GetByID() error = %v", err)
+	}
+	if got.SessionID != "alice-2" || got.SourceHost != "alice-laptop" || got.SourceUser != "alice" || got.Output != traces[2].Output {
+		t.Errorf("imported trace = %+v", got)
+	}
+	if got.ChainSeq != 5 {
+		t.Errorf("ChainSeq = %d, want 5 (appended after 2 local traces)", got.ChainSeq)
+	}
+	if session, err := store.GetSession("alice-2"); err != nil || session.TraceCount != 1 || session.StartedAt != traces[2].Timestamp {
+		t.Errorf("GetSession() = %+v, %v; want a session for the imported trace", session, err)
+	}
+
+	// Importing again only finds duplicates, and local traces keep no source
+	result, err = store.ImportNDJSON(bytes.NewReader(export.Bytes()), opts)
+	if err != nil {
+		t.Fatalf("ImportNDJSON() error = %v", err)
+	}
+	if result.Imported != 0 || result.Duplicates != 3 || result.Sessions != 0 {
+		t.Errorf("second ImportNDJSON() = %+v, want 3 duplicates", result)
+	}
+	if got, _ := store.GetByID(local[0].ID); got.SourceHost != "" {
+		t.Errorf("local trace SourceHost = %q, want empty", got.SourceHost)
+	}
+
+	if report := verifyChain(t, store); report.Status != ChainOK || report.Verified != 5 {
+		t.Errorf("VerifyChain() = %+v, want 5 verified", report)
+	}
+
+	// Tags from an earlier merge win over the options
+	var retagged bytes.Buffer
+	if _, err := Export(&retagged, store, &ListFilter{SessionID: "alice-2"}, FormatNDJSON); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	other, otherCleanup := setupTestDB(t)
+	defer otherCleanup()
+	if _, err := other.ImportNDJSON(&retagged, ImportOptions{SourceHost: "lead", SourceUser: "bob"}); err != nil {
+		t.Fatalf("ImportNDJSON() error = %v", err)
+	}
+	if got, _ := other.GetByID(traces[2].ID); got == nil || got.SourceUser != "alice" {
+		t.Errorf("re-imported trace = %+v, want the original source tags", got)
+	}
+}
+
+func TestImportNDJSONInvalid(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	input := `{"id":"a","session_id":"s","timestamp":1,"tool_name":"sniff_get","command":"x","risk_level":"low","result":"success"}
+
+not json
+`
+	result, err := store.ImportNDJSON(strings.NewReader(input), ImportOptions{})
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Fatalf("ImportNDJSON() error = %v, want an error for line 3", err)
+	}
+	if result.Read != 1 {
+		t.Errorf("Read = %d, want 1", result.Read)
+	}
+}
+
+func TestImportDatabase(t *testing.T) {
+	srcPath, traces := createSourceDatabase(t, nil)
+
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	result, err := store.ImportDatabase(srcPath, ImportOptions{SourceHost: "alice-laptop", SourceUser: "alice"})
+	if err != nil {
+		t.Fatalf("ImportDatabase() error = %v", err)
+	}
+	if result.Imported != 3 || result.Sessions != 2 {
+		t.Errorf("ImportDatabase() = %+v, want 3 traces and 2 sessions", result)
+	}
+
+	// Session rows are copied, not just recreated from traces
+	session, err := store.GetSession("alice-1")
+	if err != nil {
+		t.Fatalf("GetSession() error = %v", err)
+	}
+	if session.ClientName != "claude-code" || session.TraceCount != 2 {
+		t.Errorf("GetSession() = %+v, want the source session with 2 traces", session)
+	}
+
+	got, err := store.GetByID(traces[0].ID)
+	if err != nil {
+		t.Fatalf("GetByID() error = %v", err)
+	}
+	if got.SourceUser != "alice" || got.ErrorMessage != traces[0].ErrorMessage {
+		t.Errorf("imported trace = %+v", got)
+	}
+
+	if ok, err := IsSQLiteFile(srcPath); err != nil || !ok {
+		t.Errorf("IsSQLiteFile(%s) = %v, %v; want true", srcPath, ok, err)
+	}
+}
+
+func TestImportOldDatabaseLeavesSourceUnchanged(t *testing.T) {
+	srcPath := createV1Database(t)
+
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	result, err := store.ImportDatabase(srcPath, ImportOptions{SourceUser: "bob"})
+	if err != nil {
+		t.Fatalf("ImportDatabase() error = %v", err)
+	}
+	if result.Imported != 2 {
+		t.Errorf("ImportDatabase() = %+v, want 2 imported", result)
+	}
+	if got, err := store.GetByID("v1-trace-1"); err != nil || got.SourceUser != "bob" || got.SessionID == "" {
+		t.Errorf("GetByID() = %+v, %v", got, err)
+	}
+
+	db, err := sql.Open("sqlite", srcPath)
+	if err != nil {
+		t.Fatalf("failed to open source: %v", err)
+	}
+	defer db.Close()
+	if version, err := schemaVersion(db, sqliteDialect{}); err != nil || version != 1 {
+		t.Errorf("source schema version = %d, %v; want it left at 1", version, err)
+	}
+}
+
+func TestImportEncryptedDatabase(t *testing.T) {
+	kr, _ := newTestKeyring(t)
+	srcPath, traces := createSourceDatabase(t, kr)
+
+	// Without the source key, the payloads can't be imported
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+	result, err := store.ImportDatabase(srcPath, ImportOptions{})
+	if err != nil {
+		t.Fatalf("ImportDatabase() error = %v", err)
+	}
+	if result.Unreadable != 3 || result.Imported != 0 {
+		t.Errorf("ImportDatabase() without key = %+v, want 3 unreadable", result)
+	}
+
+	// With it, they are decrypted and encrypted again for this store
+	store.SetKeyring(kr)
+	if result, err = store.ImportDatabase(srcPath, ImportOptions{}); err != nil {
+		t.Fatalf("ImportDatabase() error = %v", err)
+	}
+	if result.Imported != 3 {
+		t.Errorf("ImportDatabase() with key = %+v, want 3 imported", result)
+	}
+	output, _, dataKey := rawPayload(t, store, traces[0].ID)
+	if !strings.HasPrefix(output, encryptedPrefix) || dataKey == "" {
+		t.Errorf("imported trace stored as %q, want encrypted", output)
+	}
+	if got, _ := store.GetByID(traces[0].ID); got == nil || got.Output != traces[0].Output {
+		t.Errorf("GetByID() = %+v, want decrypted output", got)
+	}
+}
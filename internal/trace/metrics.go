@@ -0,0 +1,240 @@
+package trace
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// MetricsContentType is the Content-Type of the Prometheus text exposition format
+const MetricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// LatencyBuckets are the upper bounds, in seconds, of the tool call latency histogram
+var LatencyBuckets = []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// refusalResults are the results of calls refused before they reached the
+// cluster: by enforcement mode, by an approver (or the approval timeout), by
+// a budget and by loop blocking
+var refusalResults = map[string]bool{
+	"blocked":         true,
+	"denied":          true,
+	"budget_exceeded": true,
+	"loop_blocked":    true,
+}
+
+// Metrics is a snapshot of the trace store for Prometheus scraping.
+//
+// Tool call counts are computed from the stored traces, so they include
+// calls from every process writing to the database and go down when traces
+// are pruned (which Prometheus treats as a counter reset).
+type Metrics struct {
+	ToolCalls        []ToolCallCount
+	Latency          []LatencyHistogram
+	Traces           int64 // Stored traces
+	Sessions         int64 // Stored sessions
+	DatabaseBytes    int64 // Size of the database (0 if unknown)
+	PendingApprovals int64 // Approval requests waiting for a decision
+
+	// In-process counters of a running server (nil when not available)
+	Writer *WriterCounters
+	OTLP   *OTLPCounters
+}
+
+// ToolCallCount is the number of traces with one combination of labels
+type ToolCallCount struct {
+	Tool      string
+	Namespace string
+	RiskLevel string
+	Result    string
+	Count     int64
+}
+
+// LatencyHistogram is the latency distribution of one tool
+type LatencyHistogram struct {
+	Tool    string
+	Buckets []int64 // Cumulative counts for each of LatencyBuckets
+	Count   int64
+	SumMs   int64
+}
+
+// Metrics computes a metrics snapshot from the stored traces
+func (s *Store) Metrics() (*Metrics, error) {
+	m := &Metrics{}
+
+	rows, err := s.db.Query(`
+		SELECT tool_name, COALESCE(namespace, ''), risk_level, result, COUNT(*)
+		FROM traces
+		GROUP BY tool_name, COALESCE(namespace, ''), risk_level, result
+		ORDER BY tool_name, COALESCE(namespace, ''), risk_level, result`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tool calls: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c ToolCallCount
+		if err := rows.Scan(&c.Tool, &c.Namespace, &c.RiskLevel, &c.Result, &c.Count); err != nil {
+			return nil, err
+		}
+		m.ToolCalls = append(m.ToolCalls, c)
+		m.Traces += c.Count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if m.Latency, err = s.latencyHistograms(); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM sessions").Scan(&m.Sessions); err != nil {
+		return nil, fmt.Errorf("failed to count sessions: %w", err)
+	}
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM approvals WHERE status = ?", ApprovalPending).Scan(&m.PendingApprovals); err != nil {
+		return nil, fmt.Errorf("failed to count pending approvals: %w", err)
+	}
+	if err := s.db.QueryRow(s.db.dialect.sizeQuery()).Scan(&m.DatabaseBytes); err != nil {
+		return nil, fmt.Errorf("failed to get database size: %w", err)
+	}
+
+	return m, nil
+}
+
+// latencyHistograms computes the latency histogram of each tool in one query
+func (s *Store) latencyHistograms() ([]LatencyHistogram, error) {
+	var cols strings.Builder
+	for _, le := range LatencyBuckets {
+		fmt.Fprintf(&cols, ", SUM(CASE WHEN COALESCE(latency_ms, 0) <= %d THEN 1 ELSE 0 END)", int64(le*1000))
+	}
+
+	rows, err := s.db.Query("SELECT tool_name, COUNT(*), COALESCE(SUM(latency_ms), 0)" + cols.String() +
+		" FROM traces GROUP BY tool_name ORDER BY tool_name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query latency: %w", err)
+	}
+	defer rows.Close()
+
+	var histograms []LatencyHistogram
+	for rows.Next() {
+		h := LatencyHistogram{Buckets: make([]int64, len(LatencyBuckets))}
+		dest := []interface{}{&h.Tool, &h.Count, &h.SumMs}
+		for i := range h.Buckets {
+			dest = append(dest, &h.Buckets[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		histograms = append(histograms, h)
+	}
+	return histograms, rows.Err()
+}
+
+// WritePrometheus writes metrics in the Prometheus text exposition format
+func WritePrometheus(w io.Writer, m *Metrics) error {
+	p := &promWriter{w: bufio.NewWriter(w)}
+
+	p.family("sniffops_tool_calls_total", "counter", "Tool calls recorded in the trace store.")
+	for _, c := range m.ToolCalls {
+		p.sample("sniffops_tool_calls_total", float64(c.Count),
+			"tool", c.Tool, "namespace", c.Namespace, "risk_level", c.RiskLevel, "result", c.Result)
+	}
+
+	p.family("sniffops_blocked_calls_total", "counter", "Tool calls refused before reaching the cluster, by the refusal result.")
+	for _, c := range m.ToolCalls {
+		if refusalResults[c.Result] {
+			p.sample("sniffops_blocked_calls_total", float64(c.Count),
+				"tool", c.Tool, "namespace", c.Namespace, "risk_level", c.RiskLevel, "reason", c.Result)
+		}
+	}
+
+	p.family("sniffops_tool_call_duration_seconds", "histogram", "Tool call latency.")
+	for _, h := range m.Latency {
+		for i, le := range LatencyBuckets {
+			p.sample("sniffops_tool_call_duration_seconds_bucket", float64(h.Buckets[i]),
+				"tool", h.Tool, "le", formatFloat(le))
+		}
+		p.sample("sniffops_tool_call_duration_seconds_bucket", float64(h.Count), "tool", h.Tool, "le", "+Inf")
+		p.sample("sniffops_tool_call_duration_seconds_sum", float64(h.SumMs)/1000, "tool", h.Tool)
+		p.sample("sniffops_tool_call_duration_seconds_count", float64(h.Count), "tool", h.Tool)
+	}
+
+	p.gauge("sniffops_approvals_pending", "Approval requests waiting for a decision.", m.PendingApprovals)
+	p.gauge("sniffops_traces", "Traces in the trace store.", m.Traces)
+	p.gauge("sniffops_sessions", "Sessions in the trace store.", m.Sessions)
+	p.gauge("sniffops_trace_store_bytes", "Size of the trace database.", m.DatabaseBytes)
+
+	if c := m.Writer; c != nil {
+		p.gauge("sniffops_trace_writer_buffered", "Traces waiting in memory to be written.", c.Buffered)
+		p.counter("sniffops_trace_writer_written_total", "Traces written to the database.", c.Written)
+		p.counter("sniffops_trace_writer_retried_total", "Trace writes that failed and were retried.", c.Retried)
+		p.counter("sniffops_trace_writer_spilled_total", "Traces spilled to the on-disk journal.", c.Spilled)
+		p.counter("sniffops_trace_writer_dropped_total", "Traces lost by the writer.", c.Dropped)
+	}
+	if c := m.OTLP; c != nil {
+		p.gauge("sniffops_otlp_spans_queued", "Spans waiting to be sent to the OTLP collector.", c.Queued)
+		p.counter("sniffops_otlp_spans_exported_total", "Spans accepted by the OTLP collector.", c.Exported)
+		p.counter("sniffops_otlp_spans_failed_total", "Spans that could not be sent to the OTLP collector.", c.Failed)
+		p.counter("sniffops_otlp_spans_dropped_total", "Spans dropped because the export queue was full.", c.Dropped)
+	}
+
+	if p.err != nil {
+		return p.err
+	}
+	return p.w.Flush()
+}
+
+// promWriter writes the Prometheus text format, keeping the first error
+type promWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (p *promWriter) printf(format string, args ...interface{}) {
+	if p.err == nil {
+		_, p.err = fmt.Fprintf(p.w, format, args...)
+	}
+}
+
+func (p *promWriter) family(name, typ, help string) {
+	p.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// sample writes one sample; labels are name, value pairs
+func (p *promWriter) sample(name string, value float64, labels ...string) {
+	var b strings.Builder
+	b.WriteString(name)
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i == 0 {
+			b.WriteByte('{')
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(labels[i])
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(labels[i+1]))
+		b.WriteByte('"')
+	}
+	if len(labels) > 0 {
+		b.WriteByte('}')
+	}
+	p.printf("%s %s\n", b.String(), formatFloat(value))
+}
+
+func (p *promWriter) gauge(name, help string, value int64) {
+	p.family(name, "gauge", help)
+	p.sample(name, float64(value))
+}
+
+func (p *promWriter) counter(name, help string, value int64) {
+	p.family(name, "counter", help)
+	p.sample(name, float64(value))
+}
+
+// labelEscaper escapes label values as required by the text format
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,112 @@
+package trace
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	var traces []*Trace
+	for _, latency := range []int{5, 80, 3000} {
+		tr := createTestTrace("session-1", "sniff_get")
+		tr.LatencyMs = latency
+		traces = append(traces, tr)
+	}
+	blocked := createTestTrace("session-1", "sniff_delete")
+	blocked.Namespace = "kube-system"
+	blocked.RiskLevel = "critical"
+	blocked.Result = "blocked"
+	blocked.LatencyMs = 0
+	traces = append(traces, blocked)
+	for _, result := range []string{"denied", "budget_exceeded", "loop_blocked", "failure"} {
+		refused := createTestTrace("session-1", "sniff_scale")
+		refused.Result = result
+		traces = append(traces, refused)
+	}
+	if err := store.InsertBatch(traces); err != nil {
+		t.Fatalf("InsertBatch() error = %v", err)
+	}
+	if err := store.SaveSession(createTestSession("session-1", traces[0].Timestamp)); err != nil {
+		t.Fatalf("SaveSession() error = %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := store.InsertApproval(createTestApproval(blocked.ID)); err != nil {
+			t.Fatalf("InsertApproval() error = %v", err)
+		}
+	}
+
+	m, err := store.Metrics()
+	if err != nil {
+		t.Fatalf("Metrics() error = %v", err)
+	}
+	if m.Traces != 8 || m.Sessions != 1 || m.PendingApprovals != 2 || m.DatabaseBytes <= 0 {
+		t.Errorf("Metrics() = %+v", m)
+	}
+	if len(m.ToolCalls) != 6 || m.ToolCalls[1] != (ToolCallCount{"sniff_get", "default", "low", "success", 3}) {
+		t.Errorf("ToolCalls = %+v", m.ToolCalls)
+	}
+	if len(m.Latency) != 3 || m.Latency[1].Tool != "sniff_get" {
+		t.Fatalf("Latency = %+v", m.Latency)
+	}
+	get := m.Latency[1]
+	// Buckets: 10ms, 25ms, 50ms, 100ms, ..., 2.5s, 5s, ...
+	if get.Count != 3 || get.SumMs != 3085 || get.Buckets[0] != 1 || get.Buckets[3] != 2 || get.Buckets[7] != 2 || get.Buckets[8] != 3 {
+		t.Errorf("sniff_get histogram = %+v", get)
+	}
+
+	m.Writer = &WriterCounters{Written: 4}
+	var buf bytes.Buffer
+	if err := WritePrometheus(&buf, m); err != nil {
+		t.Fatalf("WritePrometheus() error = %v", err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		`sniffops_tool_calls_total{tool="sniff_get",namespace="default",risk_level="low",result="success"} 3`,
+		`sniffops_blocked_calls_total{tool="sniff_delete",namespace="kube-system",risk_level="critical",reason="blocked"} 1`,
+		`sniffops_blocked_calls_total{tool="sniff_scale",namespace="default",risk_level="low",reason="denied"} 1`,
+		`sniffops_blocked_calls_total{tool="sniff_scale",namespace="default",risk_level="low",reason="budget_exceeded"} 1`,
+		`sniffops_blocked_calls_total{tool="sniff_scale",namespace="default",risk_level="low",reason="loop_blocked"} 1`,
+		`sniffops_tool_call_duration_seconds_bucket{tool="sniff_get",le="0.01"} 1`,
+		`sniffops_tool_call_duration_seconds_bucket{tool="sniff_get",le="+Inf"} 3`,
+		`sniffops_tool_call_duration_seconds_sum{tool="sniff_get"} 3.085`,
+		`sniffops_approvals_pending 2`,
+		`sniffops_traces 8`,
+		`sniffops_trace_writer_written_total 4`,
+		"# TYPE sniffops_tool_call_duration_seconds histogram",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metrics output is missing %q", want)
+		}
+	}
+	if strings.Contains(out, `reason="failure"`) {
+		t.Error("failed calls are not refusals")
+	}
+	if strings.Contains(out, "sniffops_otlp") {
+		t.Error("expected no OTLP metrics without an exporter")
+	}
+
+	// Every line is a comment or a valid sample
+	sample := regexp.MustCompile(`^[a-z_]+(\{([a-z_]+="([^"\\]|\\.)*",?)+\})? [0-9.e+-]+$`)
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if !strings.HasPrefix(line, "# ") && !sample.MatchString(line) {
+			t.Errorf("invalid line %q", line)
+		}
+	}
+}
+
+func TestPrometheusLabelEscaping(t *testing.T) {
+	m := &Metrics{ToolCalls: []ToolCallCount{{Tool: "sniff_get", Namespace: "a\"b\\c\nd", RiskLevel: "low", Result: "success", Count: 1}}}
+	var buf bytes.Buffer
+	if err := WritePrometheus(&buf, m); err != nil {
+		t.Fatalf("WritePrometheus() error = %v", err)
+	}
+	if want := `namespace="a\"b\\c\nd"`; !strings.Contains(buf.String(), want) {
+		t.Errorf("output = %s, want %s", buf.String(), want)
+	}
+}
@@ -0,0 +1,394 @@
+package trace
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ErrSchemaTooNew is returned when the database was written by a newer version of sniffops
+var ErrSchemaTooNew = errors.New("database schema is newer than this version of sniffops")
+
+// migration upgrades the schema from version-1 to version
+type migration struct {
+	version     int
+	description string
+	up          func(tx *sqlTx) error
+}
+
+// sqliteMigrations is the ordered list of SQLite schema migrations.
+// Append new migrations at the end; never change a released migration.
+// Every schema change must be added to postgresMigrations with the same version.
+var sqliteMigrations = []migration{
+	{1, "initial schema", execStatements(`
+	CREATE TABLE IF NOT EXISTS traces (
+		-- Identity
+		id              TEXT PRIMARY KEY,
+		session_id      TEXT NOT NULL,
+		timestamp       INTEGER NOT NULL,
+
+		-- Request Context
+		user_intent     TEXT,
+		tool_name       TEXT NOT NULL,
+
+		-- K8s Command Details
+		command         TEXT NOT NULL,
+		target_resource TEXT,
+		namespace       TEXT,
+		resource_kind   TEXT,
+
+		-- Risk & Security
+		risk_level      TEXT NOT NULL,
+		risk_reason     TEXT,
+
+		-- Execution Result
+		result          TEXT NOT NULL,
+		output          TEXT,
+		error_message   TEXT,
+
+		-- Metrics
+		latency_ms      INTEGER,
+		tokens_input    INTEGER,
+		tokens_output   INTEGER,
+		cost_estimate   REAL,
+
+		-- Metadata
+		kubeconfig      TEXT,
+		cluster_name    TEXT
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_session_id ON traces(session_id);
+	CREATE INDEX IF NOT EXISTS idx_timestamp ON traces(timestamp DESC);
+	CREATE INDEX IF NOT EXISTS idx_namespace ON traces(namespace);
+	CREATE INDEX IF NOT EXISTS idx_risk_level ON traces(risk_level);
+	CREATE INDEX IF NOT EXISTS idx_tool_name ON traces(tool_name);
+
+	CREATE TABLE IF NOT EXISTS metadata (
+		key   TEXT PRIMARY KEY,
+		value TEXT
+	);
+
+	INSERT OR IGNORE INTO metadata (key, value) VALUES ('created_at', datetime('now'));
+	`)},
+
+	{2, "human approval", func(tx *sqlTx) error {
+		if err := addColumns(tx, "traces", []column{
+			{"approval_status", "TEXT"},
+			{"approved_by", "TEXT"},
+			{"approved_at", "INTEGER"},
+			{"approval_wait_ms", "INTEGER"},
+		}); err != nil {
+			return err
+		}
+		return execStatements(`
+		CREATE TABLE IF NOT EXISTS approvals (
+			id              TEXT PRIMARY KEY,
+			trace_id        TEXT NOT NULL,
+			session_id      TEXT NOT NULL,
+			tool_name       TEXT NOT NULL,
+			command         TEXT NOT NULL,
+			namespace       TEXT,
+			resource_kind   TEXT,
+			target_resource TEXT,
+			risk_level      TEXT NOT NULL,
+			risk_reason     TEXT,
+			status          TEXT NOT NULL,
+			requested_at    INTEGER NOT NULL,
+			decided_at      INTEGER,
+			decided_by      TEXT,
+			note            TEXT
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_approvals_status ON approvals(status, requested_at);
+		`)(tx)
+	}},
+
+	{3, "server-side dry run", func(tx *sqlTx) error {
+		return addColumns(tx, "traces", []column{
+			{"dry_run", "INTEGER NOT NULL DEFAULT 0"},
+		})
+	}},
+
+	{4, "resource snapshots", func(tx *sqlTx) error {
+		return addColumns(tx, "traces", []column{
+			{"before_snapshot", "TEXT"},
+			{"after_snapshot", "TEXT"},
+			{"diff", "TEXT"},
+		})
+	}},
+
+	{5, "revert", func(tx *sqlTx) error {
+		return addColumns(tx, "traces", []column{
+			{"revert_of", "TEXT"},
+		})
+	}},
+
+	{6, "sessions", execStatements(`
+	CREATE TABLE IF NOT EXISTS sessions (
+		id               TEXT PRIMARY KEY,
+		client_name      TEXT,
+		client_version   TEXT,
+		protocol_version TEXT,
+		transport        TEXT,
+		started_at       INTEGER NOT NULL,
+		ended_at         INTEGER,
+		cwd              TEXT,
+		kube_context     TEXT
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_sessions_started_at ON sessions(started_at DESC);
+	`)},
+
+	{7, "prune audit log", execStatements(`
+	CREATE TABLE IF NOT EXISTS prune_log (
+		id        INTEGER PRIMARY KEY AUTOINCREMENT,
+		pruned_at INTEGER NOT NULL,
+		source    TEXT NOT NULL,
+		deleted   INTEGER NOT NULL,
+		by_risk   TEXT,
+		policy    TEXT
+	);
+	`)},
+
+	{8, "hash chain", func(tx *sqlTx) error {
+		if err := addColumns(tx, "traces", []column{
+			{"chain_seq", "INTEGER"},
+			{"prev_hash", "TEXT"},
+			{"hash", "TEXT"},
+		}); err != nil {
+			return err
+		}
+		return execStatements(chainSchema)(tx)
+	}},
+
+	{9, "payload encryption", func(tx *sqlTx) error {
+		return addColumns(tx, "traces", []column{
+			{"data_key", "TEXT"},
+		})
+	}},
+
+	{10, "import source", func(tx *sqlTx) error {
+		return addColumns(tx, "traces", []column{
+			{"source_host", "TEXT"},
+			{"source_user", "TEXT"},
+		})
+	}},
+
+	{11, "webhook deliveries", execStatements(deliveriesSchema)},
+
+	{12, "full-text search", execStatements(sqliteSearchSchema)},
+
+	{13, "loop detection", func(tx *sqlTx) error {
+		return addColumns(tx, "traces", []column{
+			{"loop", "TEXT"},
+		})
+	}},
+
+	{14, "tool input", func(tx *sqlTx) error {
+		return addColumns(tx, "traces", []column{
+			{"input", "TEXT"},
+		})
+	}},
+
+	{15, "snapshot redaction", func(tx *sqlTx) error {
+		return addColumns(tx, "traces", []column{
+			{"before_snapshot_redacted", "INTEGER NOT NULL DEFAULT 0"},
+		})
+	}},
+}
+
+// chainSchema creates the hash chain tables; it is valid SQL for both dialects
+const chainSchema = `
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_chain_seq ON traces(chain_seq);
+
+	CREATE TABLE IF NOT EXISTS chain_checkpoints (
+		seq        BIGINT PRIMARY KEY,
+		hash       TEXT NOT NULL,
+		created_at BIGINT NOT NULL,
+		key_id     TEXT NOT NULL,
+		signature  TEXT NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS chain_pruned (
+		first_seq       BIGINT PRIMARY KEY,
+		last_seq        BIGINT NOT NULL,
+		first_prev_hash TEXT NOT NULL,
+		last_hash       TEXT NOT NULL,
+		pruned_at       BIGINT NOT NULL
+	);
+	`
+
+// deliveriesSchema creates the webhook delivery log; it is valid SQL for both dialects
+const deliveriesSchema = `
+	CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id           TEXT PRIMARY KEY,
+		webhook      TEXT NOT NULL,
+		url          TEXT NOT NULL,
+		trace_id     TEXT NOT NULL,
+		status       TEXT NOT NULL,
+		attempts     INTEGER NOT NULL,
+		status_code  INTEGER,
+		error        TEXT,
+		created_at   BIGINT NOT NULL,
+		completed_at BIGINT NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_created_at ON webhook_deliveries(created_at DESC);
+	CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_trace_id ON webhook_deliveries(trace_id);
+	`
+
+// LatestSchemaVersion returns the schema version this binary writes
+func LatestSchemaVersion() int {
+	return sqliteMigrations[len(sqliteMigrations)-1].version
+}
+
+// SchemaVersion returns the schema version of the database
+func (s *Store) SchemaVersion() (int, error) {
+	return schemaVersion(s.db, s.db.dialect)
+}
+
+// migrate upgrades the database to the latest schema version.
+//
+// All pending migrations run in a single transaction, so a failed upgrade
+// leaves the database at its previous version. A database with a newer
+// version than this binary knows about is refused with ErrSchemaTooNew.
+func (s *Store) migrate() error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin migration: %w", err)
+	}
+	defer tx.Rollback()
+
+	current, err := schemaVersion(tx, s.db.dialect)
+	if err != nil {
+		return err
+	}
+
+	latest := LatestSchemaVersion()
+	if current > latest {
+		return fmt.Errorf("%w (database version %d, supported version %d)", ErrSchemaTooNew, current, latest)
+	}
+	if current == latest {
+		return nil
+	}
+
+	for _, m := range s.db.dialect.migrations() {
+		if m.version <= current {
+			continue
+		}
+		if err := m.up(tx); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.description, err)
+		}
+	}
+
+	if _, err := tx.Exec(
+		`INSERT INTO metadata (key, value) VALUES ('schema_version', ?)
+			ON CONFLICT(key) DO UPDATE SET value = excluded.value`,
+		strconv.Itoa(latest),
+	); err != nil {
+		return fmt.Errorf("failed to update schema version: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migration: %w", err)
+	}
+
+	return nil
+}
+
+// queryer is implemented by *sql.DB, *sql.Tx and their dialect wrappers
+type queryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// schemaVersion reads the schema version from the metadata table.
+// A database without a metadata table is empty (version 0).
+func schemaVersion(q queryer, d dialect) (int, error) {
+	var name string
+	err := q.QueryRow(d.rebind(d.tableExistsQuery()), "metadata").Scan(&name)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	var value string
+	err = q.QueryRow("SELECT value FROM metadata WHERE key = 'schema_version'").Scan(&value)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	version, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid schema version %q: %w", value, err)
+	}
+
+	return version, nil
+}
+
+// execStatements returns a migration step that executes the given SQL
+func execStatements(statements string) func(tx *sqlTx) error {
+	return func(tx *sqlTx) error {
+		_, err := tx.Exec(statements)
+		return err
+	}
+}
+
+// column is a column definition added by a migration
+type column struct {
+	name string
+	typ  string
+}
+
+// addColumns adds columns to a SQLite table, skipping columns that already exist.
+// Development builds added some columns before migrations were versioned,
+// so such databases may already have them at version 1.
+func addColumns(tx *sqlTx, table string, columns []column) error {
+	existing, err := tableColumns(tx, table)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range columns {
+		if existing[c.name] {
+			continue
+		}
+		if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, c.name, c.typ)); err != nil {
+			return fmt.Errorf("failed to add column %s.%s: %w", table, c.name, err)
+		}
+	}
+
+	return nil
+}
+
+// tableColumns returns the set of column names of a table
+func tableColumns(q queryer, table string) (map[string]bool, error) {
+	rows, err := q.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns of %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var (
+			cid        int
+			name, typ  string
+			notNull    int
+			defaultVal sql.NullString
+			pk         int
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &defaultVal, &pk); err != nil {
+			return nil, fmt.Errorf("failed to scan column info: %w", err)
+		}
+		existing[name] = true
+	}
+
+	return existing, rows.Err()
+}
@@ -0,0 +1,156 @@
+package trace
+
+// postgresMigrations is the ordered list of PostgreSQL schema migrations.
+//
+// PostgreSQL support was added at schema version 7, so its first migration
+// creates the complete version 7 schema. Version numbers match
+// sqliteMigrations: a schema change gets the same version in both lists.
+var postgresMigrations = []migration{
+	{7, "initial schema", execStatements(`
+	CREATE TABLE IF NOT EXISTS traces (
+		-- Identity
+		id              TEXT PRIMARY KEY,
+		session_id      TEXT NOT NULL,
+		timestamp       BIGINT NOT NULL,
+
+		-- Request Context
+		user_intent     TEXT,
+		tool_name       TEXT NOT NULL,
+
+		-- K8s Command Details
+		command         TEXT NOT NULL,
+		target_resource TEXT,
+		namespace       TEXT,
+		resource_kind   TEXT,
+
+		-- Risk & Security
+		risk_level      TEXT NOT NULL,
+		risk_reason     TEXT,
+
+		-- Execution Result
+		result          TEXT NOT NULL,
+		output          TEXT,
+		error_message   TEXT,
+
+		-- Metrics
+		latency_ms      INTEGER,
+		tokens_input    INTEGER,
+		tokens_output   INTEGER,
+		cost_estimate   DOUBLE PRECISION,
+
+		-- Metadata
+		kubeconfig      TEXT,
+		cluster_name    TEXT,
+
+		-- Human Approval
+		approval_status  TEXT,
+		approved_by      TEXT,
+		approved_at      BIGINT,
+		approval_wait_ms INTEGER,
+
+		-- Dry Run (server-side dry run, the cluster was not changed)
+		dry_run          BOOLEAN NOT NULL DEFAULT FALSE,
+
+		-- Resource Snapshots (sanitized JSON, mutating tools only)
+		before_snapshot  TEXT,
+		after_snapshot   TEXT,
+		diff             TEXT,
+
+		-- Revert (ID of the trace this call reverted)
+		revert_of        TEXT
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_session_id ON traces(session_id);
+	CREATE INDEX IF NOT EXISTS idx_timestamp ON traces(timestamp DESC);
+	CREATE INDEX IF NOT EXISTS idx_namespace ON traces(namespace);
+	CREATE INDEX IF NOT EXISTS idx_risk_level ON traces(risk_level);
+	CREATE INDEX IF NOT EXISTS idx_tool_name ON traces(tool_name);
+
+	CREATE TABLE IF NOT EXISTS metadata (
+		key   TEXT PRIMARY KEY,
+		value TEXT
+	);
+
+	INSERT INTO metadata (key, value) VALUES ('created_at', to_char(now() AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS'))
+		ON CONFLICT (key) DO NOTHING;
+
+	CREATE TABLE IF NOT EXISTS approvals (
+		id              TEXT PRIMARY KEY,
+		trace_id        TEXT NOT NULL,
+		session_id      TEXT NOT NULL,
+		tool_name       TEXT NOT NULL,
+		command         TEXT NOT NULL,
+		namespace       TEXT,
+		resource_kind   TEXT,
+		target_resource TEXT,
+		risk_level      TEXT NOT NULL,
+		risk_reason     TEXT,
+		status          TEXT NOT NULL,
+		requested_at    BIGINT NOT NULL,
+		decided_at      BIGINT,
+		decided_by      TEXT,
+		note            TEXT
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_approvals_status ON approvals(status, requested_at);
+
+	CREATE TABLE IF NOT EXISTS sessions (
+		id               TEXT PRIMARY KEY,
+		client_name      TEXT,
+		client_version   TEXT,
+		protocol_version TEXT,
+		transport        TEXT,
+		started_at       BIGINT NOT NULL,
+		ended_at         BIGINT,
+		cwd              TEXT,
+		kube_context     TEXT
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_sessions_started_at ON sessions(started_at DESC);
+
+	CREATE TABLE IF NOT EXISTS prune_log (
+		id        BIGSERIAL PRIMARY KEY,
+		pruned_at BIGINT NOT NULL,
+		source    TEXT NOT NULL,
+		deleted   INTEGER NOT NULL,
+		by_risk   TEXT,
+		policy    TEXT
+	);
+	`)},
+
+	{8, "hash chain", func(tx *sqlTx) error {
+		if err := execStatements(`
+		ALTER TABLE traces ADD COLUMN IF NOT EXISTS chain_seq BIGINT;
+		ALTER TABLE traces ADD COLUMN IF NOT EXISTS prev_hash TEXT;
+		ALTER TABLE traces ADD COLUMN IF NOT EXISTS hash TEXT;
+		`)(tx); err != nil {
+			return err
+		}
+		return execStatements(chainSchema)(tx)
+	}},
+
+	{9, "payload encryption", execStatements(`
+	ALTER TABLE traces ADD COLUMN IF NOT EXISTS data_key TEXT;
+	`)},
+
+	{10, "import source", execStatements(`
+	ALTER TABLE traces ADD COLUMN IF NOT EXISTS source_host TEXT;
+	ALTER TABLE traces ADD COLUMN IF NOT EXISTS source_user TEXT;
+	`)},
+
+	{11, "webhook deliveries", execStatements(deliveriesSchema)},
+
+	{12, "full-text search", execStatements(postgresSearchSchema)},
+
+	{13, "loop detection", execStatements(`
+	ALTER TABLE traces ADD COLUMN IF NOT EXISTS loop TEXT;
+	`)},
+
+	{14, "tool input", execStatements(`
+	ALTER TABLE traces ADD COLUMN IF NOT EXISTS input TEXT;
+	`)},
+
+	{15, "snapshot redaction", execStatements(`
+	ALTER TABLE traces ADD COLUMN IF NOT EXISTS before_snapshot_redacted BOOLEAN NOT NULL DEFAULT FALSE;
+	`)},
+}
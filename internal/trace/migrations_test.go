@@ -0,0 +1,211 @@
+package trace
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// createV1Database creates a database from the v1 fixture and returns its path
+func createV1Database(t *testing.T) string {
+	t.Helper()
+
+	fixture, err := os.ReadFile(filepath.Join("testdata", "v1.sql"))
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+
+	dbPath := filepath.Join(t.TempDir(), "v1.db")
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(string(fixture)); err != nil {
+		t.Fatalf("failed to load fixture: %v", err)
+	}
+
+	return dbPath
+}
+
+func TestMigrateNewDatabase(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	version, err := store.SchemaVersion()
+	if err != nil {
+		t.Fatalf("SchemaVersion() error = %v", err)
+	}
+	if version != LatestSchemaVersion() {
+		t.Errorf("SchemaVersion() = %d, want %d", version, LatestSchemaVersion())
+	}
+}
+
+func TestMigrateV1Database(t *testing.T) {
+	dbPath := createV1Database(t)
+
+	store, err := NewStore(dbPath)
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	defer store.Close()
+
+	version, err := store.SchemaVersion()
+	if err != nil {
+		t.Fatalf("SchemaVersion() error = %v", err)
+	}
+	if version != LatestSchemaVersion() {
+		t.Errorf("SchemaVersion() = %d, want %d", version, LatestSchemaVersion())
+	}
+
+	// Existing traces are kept and readable with the new columns
+	old, err := store.GetByID("v1-trace-1")
+	if err != nil {
+		t.Fatalf("GetByID() error = %v", err)
+	}
+	if old.Command != "kubectl get pods -n default" || old.ClusterName != "kind-dev" || old.LatencyMs != 42 {
+		t.Errorf("unexpected v1 trace after upgrade: %+v", old)
+	}
+	if old.DryRun || old.ApprovalStatus != "" || old.Diff != "" {
+		t.Errorf("expected empty new fields on v1 trace, got %+v", old)
+	}
+
+	count, err := store.Count(nil)
+	if err != nil {
+		t.Fatalf("Count() error = %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Count() = %d, want 2", count)
+	}
+
+	// New columns and tables are usable
+	tr := createTestTrace("v2-session", "sniff_apply")
+	tr.DryRun = true
+	tr.ApprovalStatus = ApprovalApproved
+	tr.RevertOf = "v1-trace-2"
+	if err := store.Insert(tr); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+	if err := store.InsertApproval(createTestApproval(tr.ID)); err != nil {
+		t.Fatalf("InsertApproval() error = %v", err)
+	}
+	if err := store.SaveSession(createTestSession("v2-session", tr.Timestamp)); err != nil {
+		t.Fatalf("SaveSession() error = %v", err)
+	}
+
+	got, err := store.GetByID(tr.ID)
+	if err != nil {
+		t.Fatalf("GetByID() error = %v", err)
+	}
+	if !got.DryRun || got.RevertOf != "v1-trace-2" {
+		t.Errorf("new fields not round-tripped: %+v", got)
+	}
+}
+
+func TestMigrationVersionsMatch(t *testing.T) {
+	latest := postgresMigrations[len(postgresMigrations)-1].version
+	if latest != LatestSchemaVersion() {
+		t.Errorf("latest PostgreSQL schema version = %d, SQLite = %d; add the migration to both lists", latest, LatestSchemaVersion())
+	}
+}
+
+func TestMigrateIsIdempotent(t *testing.T) {
+	dbPath := createV1Database(t)
+
+	for i := 0; i < 2; i++ {
+		store, err := NewStore(dbPath)
+		if err != nil {
+			t.Fatalf("NewStore() #%d error = %v", i+1, err)
+		}
+		store.Close()
+	}
+}
+
+func TestMigrateV1WithDevelopmentColumns(t *testing.T) {
+	dbPath := createV1Database(t)
+
+	// Development builds added columns without bumping the schema version
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if _, err := db.Exec("ALTER TABLE traces ADD COLUMN dry_run INTEGER NOT NULL DEFAULT 0"); err != nil {
+		t.Fatalf("failed to add column: %v", err)
+	}
+	db.Close()
+
+	store, err := NewStore(dbPath)
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	defer store.Close()
+
+	if version, _ := store.SchemaVersion(); version != LatestSchemaVersion() {
+		t.Errorf("SchemaVersion() = %d, want %d", version, LatestSchemaVersion())
+	}
+}
+
+func TestMigrateRefusesNewerDatabase(t *testing.T) {
+	dbPath := createV1Database(t)
+
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	newer := fmt.Sprint(LatestSchemaVersion() + 1)
+	if _, err := db.Exec("UPDATE metadata SET value = ? WHERE key = 'schema_version'", newer); err != nil {
+		t.Fatalf("failed to set schema version: %v", err)
+	}
+	db.Close()
+
+	_, err = NewStore(dbPath)
+	if !errors.Is(err, ErrSchemaTooNew) {
+		t.Fatalf("NewStore() error = %v, want ErrSchemaTooNew", err)
+	}
+}
+
+func TestMigrateRollsBackOnFailure(t *testing.T) {
+	dbPath := createV1Database(t)
+
+	original := sqliteMigrations
+	defer func() { sqliteMigrations = original }()
+
+	// Append a good migration followed by a failing one
+	next := LatestSchemaVersion() + 1
+	sqliteMigrations = append(append([]migration{}, original...),
+		migration{next, "add column", func(tx *sqlTx) error {
+			return addColumns(tx, "traces", []column{{"extra", "TEXT"}})
+		}},
+		migration{next + 1, "broken", execStatements("ALTER TABLE missing_table ADD COLUMN x TEXT")},
+	)
+
+	if _, err := NewStore(dbPath); err == nil {
+		t.Fatal("expected migration error")
+	}
+
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	version, err := schemaVersion(db, sqliteDialect{})
+	if err != nil {
+		t.Fatalf("schemaVersion() error = %v", err)
+	}
+	if version != 1 {
+		t.Errorf("schema version = %d after failed upgrade, want 1", version)
+	}
+
+	columns, err := tableColumns(db, "traces")
+	if err != nil {
+		t.Fatalf("tableColumns() error = %v", err)
+	}
+	if columns["extra"] || columns["dry_run"] {
+		t.Errorf("expected schema changes to be rolled back, got columns %v", columns)
+	}
+}
@@ -12,6 +12,7 @@ type Trace struct {
 	// Request Context
 	UserIntent string `json:"user_intent,omitempty" db:"user_intent"`
 	ToolName   string `json:"tool_name" db:"tool_name"`
+	Input      string `json:"input,omitempty" db:"input"` // Sanitized tool arguments as sent by the client (JSON)
 
 	// K8s Command Details
 	Command        string `json:"command" db:"command"`
@@ -37,16 +38,135 @@ type Trace struct {
 	// Metadata
 	Kubeconfig  string `json:"kubeconfig,omitempty" db:"kubeconfig"`
 	ClusterName string `json:"cluster_name,omitempty" db:"cluster_name"`
+
+	// Human Approval (only set for calls that required approval)
+	ApprovalStatus string `json:"approval_status,omitempty" db:"approval_status"`   // approved, denied, expired
+	ApprovedBy     string `json:"approved_by,omitempty" db:"approved_by"`           // Who made the decision
+	ApprovedAt     int64  `json:"approved_at,omitempty" db:"approved_at"`           // Unix timestamp (ms) of the decision
+	ApprovalWaitMs int    `json:"approval_wait_ms,omitempty" db:"approval_wait_ms"` // How long the call waited
+
+	// DryRun is true for server-side dry-run calls that did not change the cluster
+	DryRun bool `json:"dry_run,omitempty" db:"dry_run"`
+
+	// Resource Snapshots (sanitized JSON, only set by mutating tools)
+	BeforeSnapshot string `json:"before_snapshot,omitempty" db:"before_snapshot"` // Live object before the call (empty if it didn't exist)
+	AfterSnapshot  string `json:"after_snapshot,omitempty" db:"after_snapshot"`   // Resulting object after the call (empty if deleted)
+	Diff           string `json:"diff,omitempty" db:"diff"`                       // JSON array of field-level changes
+
+	// RevertOf is the ID of the trace reverted by this call (sniff_revert only)
+	RevertOf string `json:"revert_of,omitempty" db:"revert_of"`
+
+	// Hash chain (set by the store on insert, see ChainHash).
+	// Fields added to Trace after these must use omitempty so that the
+	// canonical content, and therefore the hash, of older traces is unchanged.
+	ChainSeq int64  `json:"chain_seq,omitempty" db:"chain_seq"` // Position in the chain (1-based)
+	PrevHash string `json:"prev_hash,omitempty" db:"prev_hash"` // Hash of the previous trace in the chain
+	Hash     string `json:"hash,omitempty" db:"hash"`           // SHA-256 of ChainSeq, PrevHash and the canonical content
+
+	// DataKey is the wrapped key that encrypts UserIntent, Input, Output and
+	// ErrorMessage at rest (empty if they are stored in plaintext, see
+	// Keyring). It is not part of the canonical content, so keys can be
+	// rotated without breaking the hash chain.
+	DataKey string `json:"-" db:"data_key"`
+
+	// Origin of traces merged in with sniffops import (empty for local traces)
+	SourceHost string `json:"source_host,omitempty" db:"source_host"`
+	SourceUser string `json:"source_user,omitempty" db:"source_user"`
+
+	// Loop lists the loop patterns this call continued, comma-separated
+	// (e.g. "repeated_command", set by the loop detector before saving)
+	Loop string `json:"loop,omitempty" db:"loop"`
+
+	// BeforeSnapshotRedacted is true if sanitizing BeforeSnapshot masked values,
+	// so the snapshot no longer matches the live object and can't be restored
+	BeforeSnapshotRedacted bool `json:"before_snapshot_redacted,omitempty" db:"before_snapshot_redacted"`
+
+	// Snippet is the best matching part of the trace, with the matched words
+	// between SnippetOpen and SnippetClose (set by List for full-text
+	// queries, not stored)
+	Snippet string `json:"snippet,omitempty" db:"-"`
+}
+
+// Approval status values
+const (
+	ApprovalPending  = "pending"
+	ApprovalApproved = "approved"
+	ApprovalDenied   = "denied"
+	ApprovalExpired  = "expired"
+)
+
+// Approval represents a pending or decided human approval request
+type Approval struct {
+	ID             string `json:"id" db:"id"`
+	TraceID        string `json:"trace_id" db:"trace_id"`
+	SessionID      string `json:"session_id" db:"session_id"`
+	ToolName       string `json:"tool_name" db:"tool_name"`
+	Command        string `json:"command" db:"command"`
+	Namespace      string `json:"namespace,omitempty" db:"namespace"`
+	ResourceKind   string `json:"resource_kind,omitempty" db:"resource_kind"`
+	TargetResource string `json:"target_resource,omitempty" db:"target_resource"`
+	RiskLevel      string `json:"risk_level" db:"risk_level"`
+	RiskReason     string `json:"risk_reason,omitempty" db:"risk_reason"`
+	Status         string `json:"status" db:"status"`
+	RequestedAt    int64  `json:"requested_at" db:"requested_at"` // Unix timestamp (ms)
+	DecidedAt      int64  `json:"decided_at,omitempty" db:"decided_at"`
+	DecidedBy      string `json:"decided_by,omitempty" db:"decided_by"`
+	Note           string `json:"note,omitempty" db:"note"`
+}
+
+// Session represents an MCP client session, recorded from the initialize handshake.
+// Traces are linked to a session by Trace.SessionID.
+type Session struct {
+	ID              string `json:"id" db:"id"`
+	ClientName      string `json:"client_name,omitempty" db:"client_name"`
+	ClientVersion   string `json:"client_version,omitempty" db:"client_version"`
+	ProtocolVersion string `json:"protocol_version,omitempty" db:"protocol_version"`
+	Transport       string `json:"transport,omitempty" db:"transport"` // stdio or http
+	StartedAt       int64  `json:"started_at" db:"started_at"`         // Unix timestamp (ms)
+	EndedAt         int64  `json:"ended_at,omitempty" db:"ended_at"`   // Unix timestamp (ms), 0 while active
+	Cwd             string `json:"cwd,omitempty" db:"cwd"`             // Working directory (client root or server cwd)
+	KubeContext     string `json:"kube_context,omitempty" db:"kube_context"`
+}
+
+// Webhook delivery status values
+const (
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDelivery is the log record of one webhook notification about a trace
+type WebhookDelivery struct {
+	ID          string `json:"id" db:"id"`
+	Webhook     string `json:"webhook" db:"webhook"` // Name of the webhook in the notify config
+	URL         string `json:"url" db:"url"`
+	TraceID     string `json:"trace_id" db:"trace_id"`
+	Status      string `json:"status" db:"status"`     // delivered or failed
+	Attempts    int    `json:"attempts" db:"attempts"` // Including retries
+	StatusCode  int    `json:"status_code,omitempty" db:"status_code"`
+	Error       string `json:"error,omitempty" db:"error"`
+	CreatedAt   int64  `json:"created_at" db:"created_at"`     // Unix timestamp (ms) of the first attempt
+	CompletedAt int64  `json:"completed_at" db:"completed_at"` // Unix timestamp (ms) of the last attempt
+}
+
+// SessionSummary is a session with aggregates over its traces
+type SessionSummary struct {
+	*Session
+	TraceCount    int            `json:"trace_count"`
+	RiskBreakdown map[string]int `json:"risk_breakdown"`
+	LastActivity  int64          `json:"last_activity,omitempty"` // Timestamp of the newest trace (ms)
+	DurationMs    int64          `json:"duration_ms"`             // Until EndedAt, or the last trace while active
 }
 
 // ListFilter defines filtering options for trace queries
 type ListFilter struct {
 	// Filtering
+	SessionID string
 	Tool      string
 	Namespace string
 	RiskLevel string
 	StartTime *time.Time
 	EndTime   *time.Time
+	Query     string // Full-text search in command, intent, output and error (all words must match)
 
 	// Pagination
 	Limit  int
@@ -0,0 +1,502 @@
+package trace
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Default SpanExporter settings (the same as the OpenTelemetry batch span processor)
+const (
+	DefaultOTLPQueueSize     = 2048
+	DefaultOTLPBatchSize     = 512
+	DefaultOTLPFlushInterval = 5 * time.Second
+	DefaultOTLPTimeout       = 10 * time.Second
+)
+
+// otlpTracesPath is the OTLP/HTTP path for spans, appended to base endpoints
+const otlpTracesPath = "/v1/traces"
+
+// otlpMaxAttempts is how many times a batch is sent before it is dropped
+const otlpMaxAttempts = 3
+
+// otlpRetryBackoff is the wait before the first retry, doubled for each further one
+var otlpRetryBackoff = time.Second
+
+// SessionSpanName is the name of the root span of a session (tool call spans are named after the tool)
+const SessionSpanName = "mcp.session"
+
+// OTLP span kinds and status codes
+const (
+	otlpKindInternal = 1
+	otlpKindServer   = 2
+	otlpStatusError  = 2
+)
+
+// OTLPConfig configures a SpanExporter
+type OTLPConfig struct {
+	// Endpoint is the collector URL. A URL without a path (e.g.
+	// http://localhost:4318) gets /v1/traces appended, as with
+	// OTEL_EXPORTER_OTLP_ENDPOINT; a URL with a path is used as is.
+	Endpoint      string
+	Headers       map[string]string // Extra request headers (e.g. authentication)
+	ServiceName   string            // service.name resource attribute (empty = OTEL_SERVICE_NAME or "sniffops")
+	QueueSize     int               // Spans held in memory before new ones are dropped (0 = DefaultOTLPQueueSize)
+	BatchSize     int               // Spans per export request (0 = DefaultOTLPBatchSize)
+	FlushInterval time.Duration     // How often queued spans are sent (0 = DefaultOTLPFlushInterval)
+	Timeout       time.Duration     // Timeout of one export request (0 = DefaultOTLPTimeout)
+
+	// OmitEncrypted leaves the error message, which is encrypted at rest, and
+	// the command, which repeats the encrypted input, out of the spans. Set
+	// it when trace encryption is enabled.
+	OmitEncrypted bool
+}
+
+// OTLPCounters reports what happened to the spans passed to a SpanExporter
+type OTLPCounters struct {
+	Queued   int64 `json:"queued"`   // Waiting to be sent
+	Exported int64 `json:"exported"` // Accepted by the collector
+	Failed   int64 `json:"failed"`   // Rejected by the collector or unreachable after all attempts
+	Dropped  int64 `json:"dropped"`  // Lost because the queue was full or the exporter closed
+}
+
+// SpanExporter sends traces to an OpenTelemetry collector as OTLP/HTTP spans,
+// in addition to saving them in the wrapped backend.
+//
+// Each MCP session is one OTel trace: tool calls are spans named after the
+// tool, children of a root span for the session that is sent by
+// ExportSession when the session ends. Trace and span IDs are derived from
+// the session and trace IDs, so a span can be found from its SniffOps trace
+// and the other way around.
+//
+// Spans are sent in batches by a background goroutine, and export failures
+// never affect the tool call or the backend. The request body uses the OTLP
+// JSON encoding.
+type SpanExporter struct {
+	Backend
+	cfg      OTLPConfig
+	url      string
+	client   *http.Client
+	resource otlpResource
+
+	mu      sync.Mutex
+	pending []*otlpSpan
+	closed  bool
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+
+	exported atomic.Int64
+	failed   atomic.Int64
+	dropped  atomic.Int64
+}
+
+// NewSpanExporter starts a SpanExporter in front of backend
+func NewSpanExporter(backend Backend, cfg OTLPConfig) (*SpanExporter, error) {
+	endpoint, err := otlpTracesURL(cfg.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = os.Getenv("OTEL_SERVICE_NAME")
+	}
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = "sniffops"
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = DefaultOTLPQueueSize
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultOTLPBatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = DefaultOTLPFlushInterval
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultOTLPTimeout
+	}
+
+	resource := otlpResource{Attributes: []otlpKeyValue{stringAttr("service.name", cfg.ServiceName)}}
+	if host, err := os.Hostname(); err == nil {
+		resource.Attributes = append(resource.Attributes, stringAttr("host.name", host))
+	}
+
+	e := &SpanExporter{
+		Backend:  backend,
+		cfg:      cfg,
+		url:      endpoint,
+		client:   &http.Client{Timeout: cfg.Timeout},
+		resource: resource,
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go e.run()
+	return e, nil
+}
+
+// otlpTracesURL returns the span export URL for a collector endpoint
+func otlpTracesURL(endpoint string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(endpoint))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid OTLP endpoint %q: expected an http:// or https:// URL", endpoint)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = otlpTracesPath
+	}
+	return u.String(), nil
+}
+
+// ParseOTLPHeaders parses headers in the OTEL_EXPORTER_OTLP_HEADERS format:
+// comma-separated key=value pairs with URL-encoded values
+func ParseOTLPHeaders(value string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, val, found := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return nil, fmt.Errorf("invalid OTLP header %q: expected key=value", pair)
+		}
+		decoded, err := url.QueryUnescape(strings.TrimSpace(val))
+		if err != nil {
+			return nil, fmt.Errorf("invalid OTLP header %q: %w", key, err)
+		}
+		headers[key] = decoded
+	}
+	return headers, nil
+}
+
+// Insert saves a trace and queues its span
+func (e *SpanExporter) Insert(trace *Trace) error {
+	err := e.Backend.Insert(trace)
+	if trace != nil {
+		e.enqueue(toolSpan(trace, e.cfg.OmitEncrypted))
+	}
+	return err
+}
+
+// InsertBatch saves several traces and queues their spans
+func (e *SpanExporter) InsertBatch(traces []*Trace) error {
+	if err := e.Backend.InsertBatch(traces); err != nil {
+		return err
+	}
+	for _, trace := range traces {
+		e.enqueue(toolSpan(trace, e.cfg.OmitEncrypted))
+	}
+	return nil
+}
+
+// ExportSession queues the root span of a session. It is called once the
+// session has ended; until then its tool call spans reference a parent the
+// collector hasn't received yet.
+func (e *SpanExporter) ExportSession(session *Session) {
+	if session == nil {
+		return
+	}
+	e.enqueue(sessionSpan(session))
+}
+
+func (e *SpanExporter) enqueue(span *otlpSpan) {
+	e.mu.Lock()
+	if e.closed || len(e.pending) >= e.cfg.QueueSize {
+		e.mu.Unlock()
+		e.dropped.Add(1)
+		return
+	}
+	e.pending = append(e.pending, span)
+	full := len(e.pending) >= e.cfg.BatchSize
+	e.mu.Unlock()
+
+	if full {
+		select {
+		case e.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// run sends queued spans until Close is called
+func (e *SpanExporter) run() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(e.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.stop:
+			e.flush()
+			return
+		case <-e.wake:
+		case <-ticker.C:
+		}
+
+		e.flush()
+	}
+}
+
+// flush sends all queued spans, one request per batch
+func (e *SpanExporter) flush() {
+	for {
+		e.mu.Lock()
+		n := len(e.pending)
+		if n > e.cfg.BatchSize {
+			n = e.cfg.BatchSize
+		}
+		batch := e.pending[:n:n]
+		e.pending = e.pending[n:]
+		e.mu.Unlock()
+
+		if len(batch) == 0 {
+			return
+		}
+
+		if err := e.send(batch); err != nil {
+			e.failed.Add(int64(len(batch)))
+			log.Printf("Warning: failed to export %d spans to %s: %v", len(batch), e.url, err)
+			continue
+		}
+		e.exported.Add(int64(len(batch)))
+	}
+}
+
+// send posts one batch, retrying when the collector is unavailable or throttling
+func (e *SpanExporter) send(spans []*otlpSpan) error {
+	body, err := json.Marshal(otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   e.resource,
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "sniffops"}, Spans: spans}},
+	}}})
+	if err != nil {
+		return err
+	}
+
+	backoff := otlpRetryBackoff
+	for attempt := 1; ; attempt++ {
+		retry, err := e.post(body)
+		if err == nil || !retry || attempt == otlpMaxAttempts {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post sends one export request and reports whether a failure is worth retrying
+func (e *SpanExporter) post(body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range e.cfg.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true, fmt.Errorf("collector returned %s", resp.Status)
+	}
+	return false, fmt.Errorf("collector returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+}
+
+// Close sends the queued spans and stops the exporter.
+// It does not close the underlying backend.
+func (e *SpanExporter) Close() error {
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		return nil
+	}
+	e.closed = true
+	e.mu.Unlock()
+
+	close(e.stop)
+	<-e.done
+	return nil
+}
+
+// Counters returns the exporter's counters
+func (e *SpanExporter) Counters() OTLPCounters {
+	e.mu.Lock()
+	queued := len(e.pending)
+	e.mu.Unlock()
+
+	return OTLPCounters{
+		Queued:   int64(queued),
+		Exported: e.exported.Load(),
+		Failed:   e.failed.Load(),
+		Dropped:  e.dropped.Load(),
+	}
+}
+
+// toolSpan converts a tool call trace to a child span of its session.
+// With omitEncrypted, the span has no command or error message.
+func toolSpan(t *Trace, omitEncrypted bool) *otlpSpan {
+	start := time.UnixMilli(t.Timestamp)
+	end := start.Add(time.Duration(t.LatencyMs) * time.Millisecond)
+
+	span := &otlpSpan{
+		TraceID:           otlpTraceID(t.SessionID),
+		SpanID:            otlpSpanID("trace/" + t.ID),
+		ParentSpanID:      otlpSpanID("session/" + t.SessionID),
+		Name:              t.ToolName,
+		Kind:              otlpKindServer,
+		StartTimeUnixNano: otlpTime(start),
+		EndTimeUnixNano:   otlpTime(end),
+	}
+
+	span.addString("sniffops.trace.id", t.ID)
+	span.addString("session.id", t.SessionID)
+	span.addString("gen_ai.tool.name", t.ToolName)
+	span.addString("k8s.namespace.name", t.Namespace)
+	span.addString("k8s.cluster.name", t.ClusterName)
+	span.addString("sniffops.resource.kind", t.ResourceKind)
+	span.addString("sniffops.resource.name", t.TargetResource)
+	if !omitEncrypted {
+		span.addString("sniffops.command", t.Command)
+	}
+	span.addString("sniffops.risk.level", t.RiskLevel)
+	span.addString("sniffops.risk.reason", t.RiskReason)
+	span.addString("sniffops.result", t.Result)
+	span.addString("sniffops.approval.status", t.ApprovalStatus)
+	if t.DryRun {
+		dryRun := true
+		span.Attributes = append(span.Attributes, otlpKeyValue{Key: "sniffops.dry_run", Value: otlpAnyValue{BoolValue: &dryRun}})
+	}
+
+	if t.ErrorMessage != "" || t.Result == "failure" {
+		span.Status = otlpStatus{Code: otlpStatusError, Message: t.ErrorMessage}
+		if omitEncrypted {
+			span.Status.Message = ""
+		}
+	}
+	return span
+}
+
+// sessionSpan converts a session to the root span of its OTel trace
+func sessionSpan(s *Session) *otlpSpan {
+	end := s.EndedAt
+	if end == 0 {
+		end = time.Now().UnixMilli()
+	}
+
+	span := &otlpSpan{
+		TraceID:           otlpTraceID(s.ID),
+		SpanID:            otlpSpanID("session/" + s.ID),
+		Name:              SessionSpanName,
+		Kind:              otlpKindInternal,
+		StartTimeUnixNano: otlpTime(time.UnixMilli(s.StartedAt)),
+		EndTimeUnixNano:   otlpTime(time.UnixMilli(end)),
+	}
+
+	span.addString("session.id", s.ID)
+	span.addString("sniffops.client.name", s.ClientName)
+	span.addString("sniffops.client.version", s.ClientVersion)
+	span.addString("sniffops.transport", s.Transport)
+	span.addString("sniffops.kube_context", s.KubeContext)
+	return span
+}
+
+// otlpTraceID derives the 16-byte OTel trace ID of a session
+func otlpTraceID(sessionID string) string {
+	sum := sha256.Sum256([]byte("session/" + sessionID))
+	return hex.EncodeToString(sum[:16])
+}
+
+// otlpSpanID derives an 8-byte OTel span ID
+func otlpSpanID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// otlpTime formats a time as OTLP JSON fixed64 nanoseconds
+func otlpTime(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// OTLP/HTTP JSON request body (opentelemetry.proto.collector.trace.v1.ExportTraceServiceRequest)
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope   `json:"scope"`
+	Spans []*otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"` // Hex, not base64, in the JSON encoding
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+// addString adds a string attribute unless value is empty
+func (s *otlpSpan) addString(key, value string) {
+	if value != "" {
+		s.Attributes = append(s.Attributes, stringAttr(key, value))
+	}
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"` // 0 = unset, 2 = error
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+}
+
+func stringAttr(key, value string) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{StringValue: &value}}
+}
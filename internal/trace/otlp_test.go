@@ -0,0 +1,257 @@
+package trace
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// collectorStub is an in-process OTLP/HTTP collector that records the spans it receives
+type collectorStub struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []*http.Request
+	spans    []*otlpSpan
+	resource otlpResource
+	failures int // Requests to answer with 503 before accepting
+}
+
+func newCollectorStub(t *testing.T) *collectorStub {
+	t.Helper()
+	c := &collectorStub{}
+	c.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.requests = append(c.requests, r)
+
+		if r.URL.Path != otlpTracesPath || r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		if c.failures > 0 {
+			c.failures--
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+
+		var req otlpRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, rs := range req.ResourceSpans {
+			c.resource = rs.Resource
+			for _, ss := range rs.ScopeSpans {
+				c.spans = append(c.spans, ss.Spans...)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+	}))
+	t.Cleanup(c.Close)
+	return c
+}
+
+// received returns the spans received so far, keyed by name
+func (c *collectorStub) received() map[string][]*otlpSpan {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	spans := make(map[string][]*otlpSpan)
+	for _, span := range c.spans {
+		spans[span.Name] = append(spans[span.Name], span)
+	}
+	return spans
+}
+
+func attribute(span *otlpSpan, key string) string {
+	for _, kv := range span.Attributes {
+		if kv.Key == key && kv.Value.StringValue != nil {
+			return *kv.Value.StringValue
+		}
+	}
+	return ""
+}
+
+func TestSpanExporter(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+	collector := newCollectorStub(t)
+
+	exporter, err := NewSpanExporter(store, OTLPConfig{
+		Endpoint:    collector.URL,
+		Headers:     map[string]string{"Authorization": "Bearer secret"},
+		ServiceName: "sniffops-test",
+	})
+	if err != nil {
+		t.Fatalf("NewSpanExporter() error = %v", err)
+	}
+
+	get := createTestTrace("session-1", "sniff_get")
+	get.ResourceKind = "pods"
+	del := createTestTrace("session-1", "sniff_delete")
+	del.Result = "blocked"
+	del.ErrorMessage = "blocked by SniffOps enforcement"
+	other := createTestTrace("session-2", "sniff_logs")
+	for _, tr := range []*Trace{get, del, other} {
+		if err := exporter.Insert(tr); err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+	}
+	exporter.ExportSession(&Session{ID: "session-1", ClientName: "claude-code", StartedAt: get.Timestamp - 1000, EndedAt: get.Timestamp + 5000})
+
+	if err := exporter.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	// Traces still reach the backend
+	if n, _ := store.Count(nil); n != 3 {
+		t.Errorf("Count() = %d, want 3", n)
+	}
+
+	spans := collector.received()
+	if len(spans["sniff_get"]) != 1 || len(spans["sniff_delete"]) != 1 || len(spans[SessionSpanName]) != 1 {
+		t.Fatalf("received spans %v, want sniff_get, sniff_delete and a session", spans)
+	}
+	getSpan, delSpan, root := spans["sniff_get"][0], spans["sniff_delete"][0], spans[SessionSpanName][0]
+	otherSpan := spans["sniff_logs"][0]
+
+	// Tool calls are children of the session root
+	if getSpan.TraceID != root.TraceID || delSpan.TraceID != root.TraceID || otherSpan.TraceID == root.TraceID {
+		t.Error("expected one OTel trace per session")
+	}
+	if len(root.TraceID) != 32 || len(getSpan.SpanID) != 16 {
+		t.Errorf("IDs = %q/%q, want 16 and 8 hex bytes", root.TraceID, getSpan.SpanID)
+	}
+	if getSpan.ParentSpanID != root.SpanID || root.ParentSpanID != "" {
+		t.Errorf("parent = %q, want the session span %q", getSpan.ParentSpanID, root.SpanID)
+	}
+
+	wantAttrs := map[string]string{
+		"sniffops.trace.id":      get.ID,
+		"k8s.namespace.name":     "default",
+		"sniffops.resource.kind": "pods",
+		"sniffops.risk.level":    "low",
+		"sniffops.result":        "success",
+	}
+	for key, want := range wantAttrs {
+		if got := attribute(getSpan, key); got != want {
+			t.Errorf("attribute %s = %q, want %q", key, got, want)
+		}
+	}
+	if attribute(root, "sniffops.client.name") != "claude-code" {
+		t.Errorf("session span attributes = %+v", root.Attributes)
+	}
+
+	start := time.UnixMilli(get.Timestamp)
+	if getSpan.StartTimeUnixNano != otlpTime(start) || getSpan.EndTimeUnixNano != otlpTime(start.Add(100*time.Millisecond)) {
+		t.Errorf("span time = %s..%s, want the call's latency", getSpan.StartTimeUnixNano, getSpan.EndTimeUnixNano)
+	}
+
+	if getSpan.Status.Code != 0 {
+		t.Errorf("successful span status = %+v, want unset", getSpan.Status)
+	}
+	if delSpan.Status.Code != otlpStatusError || delSpan.Status.Message != del.ErrorMessage {
+		t.Errorf("blocked span status = %+v, want error with the message", delSpan.Status)
+	}
+
+	if attribute(&otlpSpan{Attributes: collector.resource.Attributes}, "service.name") != "sniffops-test" {
+		t.Errorf("resource = %+v, want service.name", collector.resource)
+	}
+	if auth := collector.requests[0].Header.Get("Authorization"); auth != "Bearer secret" {
+		t.Errorf("Authorization = %q, want the configured header", auth)
+	}
+
+	if c := exporter.Counters(); c.Exported != 4 || c.Failed != 0 || c.Queued != 0 {
+		t.Errorf("Counters() = %+v, want 4 exported", c)
+	}
+	if err := exporter.Insert(createTestTrace("session-1", "sniff_get")); err != nil {
+		t.Errorf("Insert() after Close error = %v, want the backend result", err)
+	}
+	if c := exporter.Counters(); c.Dropped != 1 {
+		t.Errorf("Dropped = %d after Close, want 1", c.Dropped)
+	}
+}
+
+func TestSpanExporterRetries(t *testing.T) {
+	defer func(backoff time.Duration) { otlpRetryBackoff = backoff }(otlpRetryBackoff)
+	otlpRetryBackoff = time.Millisecond
+
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+	collector := newCollectorStub(t)
+
+	// Two busy answers are retried; the third attempt succeeds
+	collector.failures = 2
+	exporter, err := NewSpanExporter(store, OTLPConfig{Endpoint: collector.URL + otlpTracesPath, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("NewSpanExporter() error = %v", err)
+	}
+	exporter.Insert(createTestTrace("session-1", "sniff_get"))
+	exporter.flush()
+	if c := exporter.Counters(); c.Exported != 1 || len(collector.requests) != 3 {
+		t.Errorf("Counters() = %+v after %d requests, want exported on the third", c, len(collector.requests))
+	}
+
+	// After otlpMaxAttempts, the batch is dropped
+	collector.failures = otlpMaxAttempts
+	exporter.Insert(createTestTrace("session-1", "sniff_get"))
+	exporter.Close()
+	if c := exporter.Counters(); c.Failed != 1 || c.Exported != 1 {
+		t.Errorf("Counters() = %+v, want 1 failed", c)
+	}
+}
+
+func TestToolSpanOmitEncrypted(t *testing.T) {
+	tr := createTestTrace("session-1", "sniff_exec")
+	tr.Command = "kubectl exec api -- env DB_PASSWORD=hunter2"
+	tr.Result = "failure"
+	tr.ErrorMessage = "exit status 1: hunter2 rejected"
+
+	span := toolSpan(tr, false)
+	if attribute(span, "sniffops.command") != tr.Command || span.Status.Message != tr.ErrorMessage {
+		t.Errorf("span = %+v, want the command and error message", span)
+	}
+
+	span = toolSpan(tr, true)
+	if attribute(span, "sniffops.command") != "" || span.Status.Message != "" {
+		t.Errorf("span = %+v, want no command or error message", span)
+	}
+	if span.Status.Code != otlpStatusError || attribute(span, "sniffops.result") != "failure" {
+		t.Errorf("span = %+v, want the failure still reported", span)
+	}
+}
+
+func TestOTLPConfig(t *testing.T) {
+	urls := []struct {
+		endpoint string
+		want     string
+		wantErr  bool
+	}{
+		{"http://localhost:4318", "http://localhost:4318/v1/traces", false},
+		{"https://otel.example.com/", "https://otel.example.com/v1/traces", false},
+		{"http://gateway:8080/otlp/v1/traces", "http://gateway:8080/otlp/v1/traces", false},
+		{"localhost:4318", "", true},
+		{"", "", true},
+	}
+	for _, tt := range urls {
+		got, err := otlpTracesURL(tt.endpoint)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("otlpTracesURL(%q) = %q, %v; want %q", tt.endpoint, got, err, tt.want)
+		}
+	}
+
+	headers, err := ParseOTLPHeaders("api-key=abc%3D%3D, x-tenant = ops ,")
+	if err != nil {
+		t.Fatalf("ParseOTLPHeaders() error = %v", err)
+	}
+	if len(headers) != 2 || headers["api-key"] != "abc==" || headers["x-tenant"] != "ops" {
+		t.Errorf("ParseOTLPHeaders() = %v", headers)
+	}
+	if _, err := ParseOTLPHeaders("no-value"); err == nil {
+		t.Error("expected an error for a header without a value")
+	}
+}
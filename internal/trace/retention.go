@@ -0,0 +1,425 @@
+package trace
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sniffops/sniffops/internal/risk"
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultRetentionInterval is how often the background job prunes when the policy sets no interval
+const DefaultRetentionInterval = time.Hour
+
+// RetentionPolicy limits how long traces are kept.
+//
+// Example (~/.sniffops/retention.yaml):
+//
+//	maxAge: 90d        # default for all risk levels
+//	maxRows: 100000    # keep at most this many traces (oldest are removed first)
+//	risk:              # per-risk overrides of maxAge
+//	  critical: 365d
+//	  low: 7d
+//	interval: 1h       # how often serve and web prune in the background
+//
+// A zero value disables the corresponding limit. maxRows applies to all
+// traces regardless of risk level.
+type RetentionPolicy struct {
+	MaxAge   Age            `json:"maxAge,omitempty"`
+	MaxRows  int            `json:"maxRows,omitempty"`
+	Risk     map[string]Age `json:"risk,omitempty"`
+	Interval Age            `json:"interval,omitempty"`
+}
+
+// Age is a duration that also accepts days ("7d") in policy files
+type Age time.Duration
+
+// ParseAge parses a Go duration ("12h") or a number of days ("30d")
+func ParseAge(s string) (Age, error) {
+	s = strings.TrimSpace(s)
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age %q", s)
+		}
+		return Age(time.Duration(n) * 24 * time.Hour), nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q (expected e.g. 12h or 30d)", s)
+	}
+	return Age(d), nil
+}
+
+// String formats the age in days when it is a whole number of days
+func (a Age) String() string {
+	d := time.Duration(a)
+	if d > 0 && d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	}
+	return d.String()
+}
+
+// UnmarshalJSON accepts a duration string
+func (a *Age) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("age must be a string such as \"30d\": %w", err)
+	}
+	age, err := ParseAge(s)
+	if err != nil {
+		return err
+	}
+	*a = age
+	return nil
+}
+
+// MarshalJSON writes the age as a duration string
+func (a Age) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.String())
+}
+
+// DefaultRetentionPath returns the default retention policy location (~/.sniffops/retention.yaml)
+func DefaultRetentionPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".sniffops", "retention.yaml"), nil
+}
+
+// LoadRetentionPolicy loads a retention policy file.
+// If path is empty, the default path is used; a missing default file
+// returns nil (retention disabled).
+func LoadRetentionPolicy(path string) (*RetentionPolicy, error) {
+	if path == "" {
+		defaultPath, err := DefaultRetentionPath()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(defaultPath); os.IsNotExist(err) {
+			return nil, nil
+		}
+		path = defaultPath
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read retention policy %s: %w", path, err)
+	}
+
+	policy, err := ParseRetentionPolicy(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid retention policy %s: %w", path, err)
+	}
+
+	return policy, nil
+}
+
+// ParseRetentionPolicy parses and validates a YAML or JSON retention policy
+func ParseRetentionPolicy(data []byte) (*RetentionPolicy, error) {
+	policy := &RetentionPolicy{}
+	if err := yaml.UnmarshalStrict(data, policy); err != nil {
+		return nil, fmt.Errorf("failed to parse retention policy: %w", err)
+	}
+
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+// Validate checks the limits and normalizes risk level names
+func (p *RetentionPolicy) Validate() error {
+	if p.MaxRows < 0 {
+		return fmt.Errorf("maxRows must not be negative")
+	}
+
+	normalized := make(map[string]Age, len(p.Risk))
+	for level, age := range p.Risk {
+		parsed, err := risk.ParseRiskLevel(level)
+		if err != nil {
+			return fmt.Errorf("risk: %w", err)
+		}
+		normalized[string(parsed)] = age
+	}
+	p.Risk = normalized
+
+	return nil
+}
+
+// Enabled reports whether the policy removes anything
+func (p *RetentionPolicy) Enabled() bool {
+	if p == nil {
+		return false
+	}
+	if p.MaxAge > 0 || p.MaxRows > 0 {
+		return true
+	}
+	for _, age := range p.Risk {
+		if age > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// PruneOptions controls a single prune run
+type PruneOptions struct {
+	DryRun bool      // Only count what would be removed
+	Source string    // Recorded in the audit row (e.g., cli, serve, web)
+	Now    time.Time // Reference time for age limits (zero = time.Now())
+}
+
+// PruneResult describes the traces removed (or that would be removed) by a prune run
+type PruneResult struct {
+	Deleted  int            `json:"deleted"`
+	ByRisk   map[string]int `json:"by_risk"`
+	ByAge    int            `json:"by_age"`  // Removed because of maxAge or a risk override
+	ByRows   int            `json:"by_rows"` // Removed because of maxRows
+	DryRun   bool           `json:"dry_run,omitempty"`
+	Vacuumed bool           `json:"vacuumed,omitempty"`
+}
+
+// PruneRun is an audit record of a prune run
+type PruneRun struct {
+	ID       int64          `json:"id"`
+	PrunedAt int64          `json:"pruned_at"` // Unix timestamp (ms)
+	Source   string         `json:"source"`
+	Deleted  int            `json:"deleted"`
+	ByRisk   map[string]int `json:"by_risk"`
+	Policy   string         `json:"policy"` // JSON of the applied RetentionPolicy
+}
+
+// Prune removes traces according to the retention policy.
+//
+// Age limits are applied first, then the oldest remaining traces beyond
+// maxRows are removed. All deletes and the audit row are written in one
+// transaction; the database is vacuumed afterwards to reclaim space.
+// A dry run only counts the affected traces.
+func (s *Store) Prune(policy *RetentionPolicy, opts PruneOptions) (*PruneResult, error) {
+	result := &PruneResult{ByRisk: make(map[string]int), DryRun: opts.DryRun}
+	if !policy.Enabled() {
+		return result, nil
+	}
+
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	ageCond, ageArgs := policy.ageCondition(now)
+
+	// Traces beyond maxRows among those that survive the age limits
+	rowsQuery := fmt.Sprintf("SELECT id FROM traces WHERE NOT (%s) ORDER BY timestamp DESC LIMIT %s OFFSET ?",
+		ageCond, s.db.dialect.noLimit())
+	rowsArgs := append(append([]interface{}{}, ageArgs...), policy.MaxRows)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin prune: %w", err)
+	}
+	defer tx.Rollback()
+
+	ageCounts, err := countByRisk(tx, "SELECT risk_level, COUNT(*) FROM traces WHERE "+ageCond+" GROUP BY risk_level", ageArgs)
+	if err != nil {
+		return nil, err
+	}
+	for level, n := range ageCounts {
+		result.ByRisk[level] += n
+		result.ByAge += n
+	}
+
+	if policy.MaxRows > 0 {
+		rowCounts, err := countByRisk(tx,
+			"SELECT risk_level, COUNT(*) FROM traces WHERE id IN ("+rowsQuery+") GROUP BY risk_level", rowsArgs)
+		if err != nil {
+			return nil, err
+		}
+		for level, n := range rowCounts {
+			result.ByRisk[level] += n
+			result.ByRows += n
+		}
+	}
+	result.Deleted = result.ByAge + result.ByRows
+
+	if opts.DryRun || result.Deleted == 0 {
+		return result, nil
+	}
+
+	// Keep the chain links across the removed traces so the chain can still be verified
+	pruneCond, pruneArgs := ageCond, ageArgs
+	if policy.MaxRows > 0 {
+		pruneCond = ageCond + " OR id IN (" + rowsQuery + ")"
+		pruneArgs = append(append([]interface{}{}, ageArgs...), rowsArgs...)
+	}
+	if err := recordPrunedRanges(tx, pruneCond, pruneArgs, now.UnixMilli()); err != nil {
+		return nil, err
+	}
+
+	if policy.MaxRows > 0 {
+		if _, err := tx.Exec("DELETE FROM traces WHERE id IN ("+rowsQuery+")", rowsArgs...); err != nil {
+			return nil, fmt.Errorf("failed to prune traces by row count: %w", err)
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM traces WHERE "+ageCond, ageArgs...); err != nil {
+		return nil, fmt.Errorf("failed to prune traces by age: %w", err)
+	}
+
+	byRisk, _ := json.Marshal(result.ByRisk)
+	policyJSON, _ := json.Marshal(policy)
+	if _, err := tx.Exec(
+		"INSERT INTO prune_log (pruned_at, source, deleted, by_risk, policy) VALUES (?, ?, ?, ?, ?)",
+		now.UnixMilli(), opts.Source, result.Deleted, string(byRisk), string(policyJSON),
+	); err != nil {
+		return nil, fmt.Errorf("failed to record prune run: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit prune: %w", err)
+	}
+
+	// VACUUM can't run inside a transaction
+	if _, err := s.db.Exec("VACUUM"); err != nil {
+		return result, fmt.Errorf("pruned %d traces but VACUUM failed: %w", result.Deleted, err)
+	}
+	result.Vacuumed = true
+
+	return result, nil
+}
+
+// ageCondition builds the WHERE condition matching traces older than their age limit
+func (p *RetentionPolicy) ageCondition(now time.Time) (string, []interface{}) {
+	var (
+		conditions []string
+		args       []interface{}
+		overridden []interface{}
+	)
+
+	levels := make([]string, 0, len(p.Risk))
+	for level := range p.Risk {
+		levels = append(levels, level)
+	}
+	sort.Strings(levels)
+
+	for _, level := range levels {
+		overridden = append(overridden, level)
+		if age := p.Risk[level]; age > 0 {
+			conditions = append(conditions, "(risk_level = ? AND timestamp < ?)")
+			args = append(args, level, now.Add(-time.Duration(age)).UnixMilli())
+		}
+	}
+
+	if p.MaxAge > 0 {
+		cond := "timestamp < ?"
+		if len(overridden) > 0 {
+			cond = fmt.Sprintf("(risk_level NOT IN (%s) AND timestamp < ?)",
+				strings.TrimSuffix(strings.Repeat("?, ", len(overridden)), ", "))
+			args = append(args, overridden...)
+		}
+		conditions = append(conditions, cond)
+		args = append(args, now.Add(-time.Duration(p.MaxAge)).UnixMilli())
+	}
+
+	if len(conditions) == 0 {
+		return "1 = 0", nil
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")", args
+}
+
+// countByRisk runs a "risk_level, COUNT(*)" query
+func countByRisk(tx *sqlTx, query string, args []interface{}) (map[string]int, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count traces to prune: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var (
+			level string
+			count int
+		)
+		if err := rows.Scan(&level, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan prune count: %w", err)
+		}
+		counts[level] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// ListPruneRuns retrieves the audit records of past prune runs, newest first
+func (s *Store) ListPruneRuns(limit int) ([]*PruneRun, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+
+	rows, err := s.db.Query(
+		"SELECT id, pruned_at, source, deleted, by_risk, policy FROM prune_log ORDER BY id DESC LIMIT ?", limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query prune log: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []*PruneRun
+	for rows.Next() {
+		run := &PruneRun{}
+		var byRisk, policy sql.NullString
+		if err := rows.Scan(&run.ID, &run.PrunedAt, &run.Source, &run.Deleted, &byRisk, &policy); err != nil {
+			return nil, fmt.Errorf("failed to scan prune run: %w", err)
+		}
+		json.Unmarshal([]byte(byRisk.String), &run.ByRisk)
+		run.Policy = policy.String
+		runs = append(runs, run)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating prune log: %w", err)
+	}
+
+	return runs, nil
+}
+
+// RunRetention prunes traces immediately and then at the policy interval
+// until ctx is cancelled. It is meant to run in a background goroutine.
+func (s *Store) RunRetention(ctx context.Context, policy *RetentionPolicy, source string) {
+	if !policy.Enabled() {
+		return
+	}
+
+	interval := time.Duration(policy.Interval)
+	if interval <= 0 {
+		interval = DefaultRetentionInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		result, err := s.Prune(policy, PruneOptions{Source: source})
+		if err != nil {
+			log.Printf("Warning: trace retention failed: %v", err)
+		} else if result.Deleted > 0 {
+			log.Printf("Trace retention removed %d traces", result.Deleted)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
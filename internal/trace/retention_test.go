@@ -0,0 +1,201 @@
+package trace
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"7d", 7 * 24 * time.Hour, false},
+		{"12h", 12 * time.Hour, false},
+		{"90m", 90 * time.Minute, false},
+		{"0d", 0, false},
+		{"-1d", 0, true},
+		{"week", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseAge(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAge(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !tt.wantErr && time.Duration(got) != tt.want {
+				t.Errorf("ParseAge(%q) = %v, want %v", tt.input, time.Duration(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRetentionPolicy(t *testing.T) {
+	policy, err := ParseRetentionPolicy([]byte(`
+maxAge: 90d
+maxRows: 1000
+risk:
+  Critical: 365d
+  low: 7d
+interval: 30m
+`))
+	if err != nil {
+		t.Fatalf("ParseRetentionPolicy() error = %v", err)
+	}
+
+	if time.Duration(policy.MaxAge) != 90*24*time.Hour || policy.MaxRows != 1000 {
+		t.Errorf("unexpected limits: %+v", policy)
+	}
+	if time.Duration(policy.Risk["critical"]) != 365*24*time.Hour {
+		t.Errorf("expected risk levels to be normalized, got %v", policy.Risk)
+	}
+	if time.Duration(policy.Interval) != 30*time.Minute {
+		t.Errorf("Interval = %v, want 30m", time.Duration(policy.Interval))
+	}
+	if !policy.Enabled() {
+		t.Error("expected policy to be enabled")
+	}
+
+	invalid := []string{
+		"risk:\n  severe: 7d\n",
+		"maxAge: forever\n",
+		"maxRows: -1\n",
+		"unknownField: 1\n",
+	}
+	for _, data := range invalid {
+		if _, err := ParseRetentionPolicy([]byte(data)); err == nil {
+			t.Errorf("expected error for %q", data)
+		}
+	}
+
+	var empty *RetentionPolicy
+	if empty.Enabled() || (&RetentionPolicy{}).Enabled() {
+		t.Error("expected empty policy to be disabled")
+	}
+}
+
+// insertAgedTrace inserts a trace with the given risk level and age
+func insertAgedTrace(t *testing.T, store *Store, now time.Time, riskLevel string, age time.Duration) *Trace {
+	t.Helper()
+	tr := createTestTrace("session-1", "sniff_get")
+	tr.RiskLevel = riskLevel
+	tr.Timestamp = now.Add(-age).UnixMilli()
+	if err := store.Insert(tr); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+	return tr
+}
+
+func TestPruneByAgeAndRisk(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	day := 24 * time.Hour
+	now := time.Now()
+
+	oldLow := insertAgedTrace(t, store, now, "low", 10*day)         // > 7d low limit
+	recentLow := insertAgedTrace(t, store, now, "low", 2*day)       // kept
+	oldMedium := insertAgedTrace(t, store, now, "medium", 100*day)  // > 90d default
+	medium := insertAgedTrace(t, store, now, "medium", 30*day)      // kept
+	critical := insertAgedTrace(t, store, now, "critical", 200*day) // < 365d critical limit
+
+	policy := &RetentionPolicy{
+		MaxAge: Age(90 * day),
+		Risk:   map[string]Age{"critical": Age(365 * day), "low": Age(7 * day)},
+	}
+
+	// Dry run only counts
+	dry, err := store.Prune(policy, PruneOptions{DryRun: true, Now: now, Source: "test"})
+	if err != nil {
+		t.Fatalf("Prune(dry run) error = %v", err)
+	}
+	if dry.Deleted != 2 || dry.ByRisk["low"] != 1 || dry.ByRisk["medium"] != 1 {
+		t.Errorf("dry run result = %+v, want 2 (low=1, medium=1)", dry)
+	}
+	if count, _ := store.Count(nil); count != 5 {
+		t.Errorf("dry run removed traces: count = %d, want 5", count)
+	}
+	if runs, _ := store.ListPruneRuns(0); len(runs) != 0 {
+		t.Errorf("dry run wrote %d audit rows, want 0", len(runs))
+	}
+
+	result, err := store.Prune(policy, PruneOptions{Now: now, Source: "test"})
+	if err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	if result.Deleted != 2 || result.ByAge != 2 || !result.Vacuumed {
+		t.Errorf("Prune() = %+v, want 2 deleted by age and vacuumed", result)
+	}
+
+	for _, tr := range []*Trace{oldLow, oldMedium} {
+		if _, err := store.GetByID(tr.ID); err == nil {
+			t.Errorf("expected trace %s (%s) to be pruned", tr.ID, tr.RiskLevel)
+		}
+	}
+	for _, tr := range []*Trace{recentLow, medium, critical} {
+		if _, err := store.GetByID(tr.ID); err != nil {
+			t.Errorf("expected trace %s (%s) to be kept: %v", tr.ID, tr.RiskLevel, err)
+		}
+	}
+
+	runs, err := store.ListPruneRuns(0)
+	if err != nil {
+		t.Fatalf("ListPruneRuns() error = %v", err)
+	}
+	if len(runs) != 1 {
+		t.Fatalf("expected 1 audit row, got %d", len(runs))
+	}
+	if runs[0].Source != "test" || runs[0].Deleted != 2 || runs[0].ByRisk["low"] != 1 || runs[0].Policy == "" {
+		t.Errorf("unexpected audit row: %+v", runs[0])
+	}
+}
+
+func TestPruneByRowCount(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	now := time.Now()
+	var traces []*Trace
+	for i := 0; i < 5; i++ {
+		traces = append(traces, insertAgedTrace(t, store, now, "low", time.Duration(5-i)*time.Hour))
+	}
+	// Removed by age; must not count towards the row limit
+	insertAgedTrace(t, store, now, "high", 48*time.Hour)
+
+	policy := &RetentionPolicy{MaxAge: Age(24 * time.Hour), MaxRows: 3}
+	result, err := store.Prune(policy, PruneOptions{Now: now, Source: "test"})
+	if err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	if result.ByAge != 1 || result.ByRows != 2 || result.Deleted != 3 {
+		t.Errorf("Prune() = %+v, want by_age=1 by_rows=2", result)
+	}
+
+	// The newest three are kept
+	for i, tr := range traces {
+		_, err := store.GetByID(tr.ID)
+		if kept := err == nil; kept != (i >= 2) {
+			t.Errorf("trace %d kept = %v, want %v", i, kept, i >= 2)
+		}
+	}
+}
+
+func TestPruneNothingToDo(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	insertAgedTrace(t, store, time.Now(), "low", time.Hour)
+
+	result, err := store.Prune(&RetentionPolicy{MaxAge: Age(24 * time.Hour)}, PruneOptions{Source: "test"})
+	if err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	if result.Deleted != 0 {
+		t.Errorf("Deleted = %d, want 0", result.Deleted)
+	}
+	if runs, _ := store.ListPruneRuns(0); len(runs) != 0 {
+		t.Errorf("expected no audit row when nothing was removed, got %d", len(runs))
+	}
+}
@@ -2,6 +2,7 @@ package trace
 
 import (
 	"encoding/json"
+	"reflect"
 	"regexp"
 	"strings"
 )
@@ -14,22 +15,44 @@ import (
 // - 환경 변수의 민감한 값
 // - URL의 credential
 func SanitizeOutput(output string) string {
+	sanitized, _ := SanitizeOutputMasked(output)
+	return sanitized
+}
+
+// SanitizeOutputMasked는 SanitizeOutput과 같이 sanitize하고, 마스킹된 값이 있었는지도 반환합니다.
+// 마스킹된 출력은 원본으로 되돌릴 수 없으므로 (예: resource snapshot 복원) 판단에 사용합니다.
+func SanitizeOutputMasked(output string) (string, bool) {
 	// Empty output은 그대로 반환
 	if output == "" {
-		return output
+		return output, false
 	}
 
 	// JSON 파싱 시도 (K8s resource는 주로 JSON 형식)
 	var data map[string]interface{}
 	if err := json.Unmarshal([]byte(output), &data); err == nil {
-		// JSON인 경우 구조적으로 sanitize
+		// JSON인 경우 구조적으로 sanitize (원본 map은 변경되지 않으므로 비교로 마스킹 여부 판단)
 		sanitized := sanitizeJSONMap(data)
 		result, _ := json.Marshal(sanitized)
-		return string(result)
+		return string(result), !reflect.DeepEqual(data, sanitized)
 	}
 
 	// JSON이 아닌 경우 텍스트 기반 sanitize (예: logs, exec output)
-	return sanitizeText(output)
+	result := sanitizeText(output)
+	return result, result != output
+}
+
+// redactionMarkers는 sanitize가 값 대신 남기는 표시입니다
+var redactionMarkers = []string{"[REDACTED]", "[PRIVATE KEY REDACTED]", "***:***@"}
+
+// HasRedactionMarker는 sanitize된 문자열에 마스킹 표시가 있는지 확인합니다.
+// 마스킹 여부가 기록되지 않은 이전 trace의 판단에만 사용합니다 (SanitizeOutputMasked 참고).
+func HasRedactionMarker(s string) bool {
+	for _, marker := range redactionMarkers {
+		if strings.Contains(s, marker) {
+			return true
+		}
+	}
+	return false
 }
 
 // sanitizeJSONMap은 JSON map을 재귀적으로 순회하며 민감한 필드를 마스킹합니다.
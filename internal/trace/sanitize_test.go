@@ -466,3 +466,30 @@ func TestSanitizeOutput_PreservesStructure(t *testing.T) {
 		t.Error("namespace should not be modified")
 	}
 }
+
+func TestSanitizeOutputMasked(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		wantMasked bool
+	}{
+		{"empty", "", false},
+		{"plain JSON", `{"kind":"Deployment","spec":{"replicas":3}}`, false},
+		{"plain text", "Starting server on port 8080", false},
+		{"secret data", `{"kind":"Secret","data":{"password":"aHVudGVyMg=="}}`, true},
+		{"URL credential in JSON", `{"kind":"Deployment","spec":{"env":[{"name":"DB_URL","value":"postgres://app:hunter2@db:5432/app"}]}}`, true},
+		{"URL credential in text", "connecting to postgres://app:hunter2@db:5432/app", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result, masked := SanitizeOutputMasked(tc.input)
+			if masked != tc.wantMasked {
+				t.Errorf("SanitizeOutputMasked(%q) masked = %v, want %v (result %q)", tc.input, masked, tc.wantMasked, result)
+			}
+			if result != SanitizeOutput(tc.input) {
+				t.Errorf("SanitizeOutputMasked() = %q, want the SanitizeOutput result", result)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package trace
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Snippet markers around the matched words in Trace.Snippet
+const (
+	SnippetOpen  = "<mark>"
+	SnippetClose = "</mark>"
+)
+
+// snippetWords is the approximate length of a snippet in words
+const snippetWords = 16
+
+// Full-text search covers the command, user intent, output and error message
+// of traces. Fields encrypted at rest (see Keyring) are not indexed, so
+// encrypted traces can only be found by their command.
+//
+// SQLite keeps an FTS5 index (traces_fts) in sync with triggers; PostgreSQL
+// uses a GIN index on the tsvector of searchDocument. In both, a trace
+// matches when it contains every word of the query.
+
+// sqliteSearchSchema creates the FTS5 index over the traces table and indexes
+// existing traces. The index reads snippets from traces (external content),
+// so it doesn't keep a second copy of the outputs; encrypted values are
+// indexed as NULL, and the delete trigger passes the same values.
+var sqliteSearchSchema = `
+	CREATE VIRTUAL TABLE IF NOT EXISTS traces_fts USING fts5(
+		command, user_intent, output, error_message,
+		content = 'traces', content_rowid = 'rowid'
+	);
+
+	INSERT INTO traces_fts (rowid, command, user_intent, output, error_message)
+		SELECT rowid, command, ` + plaintextColumns("") + ` FROM traces;
+
+	CREATE TRIGGER IF NOT EXISTS traces_fts_insert AFTER INSERT ON traces BEGIN
+		INSERT INTO traces_fts (rowid, command, user_intent, output, error_message)
+		VALUES (new.rowid, new.command, ` + plaintextColumns("new.") + `);
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS traces_fts_delete AFTER DELETE ON traces BEGIN
+		INSERT INTO traces_fts (traces_fts, rowid, command, user_intent, output, error_message)
+		VALUES ('delete', old.rowid, old.command, ` + plaintextColumns("old.") + `);
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS traces_fts_update AFTER UPDATE OF command, user_intent, output, error_message ON traces BEGIN
+		INSERT INTO traces_fts (traces_fts, rowid, command, user_intent, output, error_message)
+		VALUES ('delete', old.rowid, old.command, ` + plaintextColumns("old.") + `);
+		INSERT INTO traces_fts (rowid, command, user_intent, output, error_message)
+		VALUES (new.rowid, new.command, ` + plaintextColumns("new.") + `);
+	END;
+	`
+
+// plaintextColumns returns the user_intent, output and error_message
+// columns (with a prefix such as "new.") as NULL when they are encrypted
+func plaintextColumns(prefix string) string {
+	cols := make([]string, len(encryptedColumns))
+	for i, column := range encryptedColumns {
+		cols[i] = fmt.Sprintf("CASE WHEN %[1]s%[2]s LIKE '%[3]s%%' THEN NULL ELSE %[1]s%[2]s END", prefix, column, encryptedPrefix)
+	}
+	return strings.Join(cols, ", ")
+}
+
+// encryptedColumns are the columns that may hold encrypted values, in the
+// order of the search columns after command
+var encryptedColumns = []string{"user_intent", "output", "error_message"}
+
+// searchDocument is the text PostgreSQL indexes for full-text search.
+// Queries must use the same expression for the index to apply.
+var searchDocument = func() string {
+	parts := []string{"coalesce(command, '')"}
+	for _, column := range encryptedColumns {
+		parts = append(parts, fmt.Sprintf("CASE WHEN %[1]s LIKE '%[2]s%%' THEN '' ELSE coalesce(%[1]s, '') END", column, encryptedPrefix))
+	}
+	return strings.Join(parts, " || ' ' || ")
+}()
+
+// postgresSearchSchema creates the full-text index for PostgreSQL
+var postgresSearchSchema = `
+	CREATE INDEX IF NOT EXISTS idx_traces_search ON traces USING GIN (to_tsvector('simple', ` + searchDocument + `));
+	`
+
+// sqliteSearchQuery quotes every word of a user query, so that punctuation
+// such as "-rf" or "kube-system" isn't parsed as FTS5 syntax. The words are
+// matched in any order.
+func sqliteSearchQuery(q string) string {
+	words := strings.Fields(q)
+	for i, word := range words {
+		words[i] = `"` + strings.ReplaceAll(word, `"`, `""`) + `"`
+	}
+	return strings.Join(words, " ")
+}
+
+// search selects the traces matching filter.Query with their snippet,
+// best match first (then newest first)
+func (s *Store) search(filter *ListFilter) ([]*Trace, error) {
+	// The join applies the query; the rest of the filter is plain conditions
+	rest := *filter
+	rest.Query = ""
+	where, args := filterConditions(s.db.dialect, &rest)
+
+	query := "SELECT " + traceColumns + ", search.search_snippet FROM traces" + s.db.dialect.searchJoin() +
+		" WHERE 1=1" + where + " ORDER BY search.search_rank, timestamp DESC LIMIT ? OFFSET ?"
+	args = append([]interface{}{s.db.dialect.searchQuery(filter.Query)}, args...)
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search traces: %w", err)
+	}
+	defer rows.Close()
+
+	var traces []*Trace
+	for rows.Next() {
+		var snippet *string
+		trace, err := scanTrace(extraScanner{rows, []interface{}{&snippet}})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan trace: %w", err)
+		}
+		if err := s.open(trace); err != nil {
+			return nil, err
+		}
+		if snippet != nil {
+			trace.Snippet = *snippet
+		}
+		traces = append(traces, trace)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating traces: %w", err)
+	}
+
+	return traces, nil
+}
+
+// extraScanner scans a row of traceColumns followed by extra columns
+type extraScanner struct {
+	row   rowScanner
+	extra []interface{}
+}
+
+func (e extraScanner) Scan(dest ...interface{}) error {
+	return e.row.Scan(append(dest, e.extra...)...)
+}
@@ -0,0 +1,204 @@
+package trace
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// insertSearchTraces inserts traces with distinct commands and outputs
+func insertSearchTraces(t *testing.T, store *Store) map[string]*Trace {
+	t.Helper()
+	now := time.Now()
+
+	oom := createTestTrace("session-1", "sniff_get")
+	oom.Command = "kubectl get pods -n production"
+	oom.Output = "api-7d9f   0/1   OOMKilled   3   5m\nworker-1   1/1   Running   0   1h"
+	oom.Timestamp = now.Add(-3 * time.Minute).UnixMilli()
+
+	oomLogs := createTestTrace("session-1", "sniff_logs")
+	oomLogs.Command = "kubectl logs api-7d9f -n production"
+	oomLogs.Output = "starting server\nallocating cache"
+	oomLogs.ErrorMessage = "container was OOMKilled; OOMKilled twice in 5m"
+	oomLogs.Timestamp = now.Add(-2 * time.Minute).UnixMilli()
+
+	exec := createTestTrace("session-2", "sniff_exec")
+	exec.Command = "kubectl exec worker-1 -n kube-system -- rm -rf /tmp/cache"
+	exec.Output = ""
+	exec.Timestamp = now.Add(-time.Minute).UnixMilli()
+
+	intent := createTestTrace("session-2", "sniff_get")
+	intent.UserIntent = "Find why the checkout service keeps restarting"
+	intent.Timestamp = now.UnixMilli()
+
+	traces := map[string]*Trace{"oom": oom, "oomLogs": oomLogs, "exec": exec, "intent": intent}
+	for _, tr := range []*Trace{oom, oomLogs, exec, intent} {
+		if err := store.Insert(tr); err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+	}
+	return traces
+}
+
+func traceIDs(traces []*Trace) []string {
+	ids := make([]string, len(traces))
+	for i, tr := range traces {
+		ids[i] = tr.ID
+	}
+	return ids
+}
+
+func TestSearch(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+	traces := insertSearchTraces(t, store)
+
+	tests := []struct {
+		name   string
+		filter ListFilter
+		want   []string // In rank order
+	}{
+		{"output and error, best match first", ListFilter{Query: "oomkilled"}, []string{"oomLogs", "oom"}},
+		{"all words must match", ListFilter{Query: "OOMKilled running"}, []string{"oom"}},
+		{"punctuation is not query syntax", ListFilter{Query: "rm -rf"}, []string{"exec"}},
+		{"hyphenated word", ListFilter{Query: "kube-system"}, []string{"exec"}},
+		{"user intent", ListFilter{Query: "checkout restarting"}, []string{"intent"}},
+		{"combined with filters", ListFilter{Query: "oomkilled", Tool: "sniff_get"}, []string{"oom"}},
+		{"no match", ListFilter{Query: "CrashLoopBackOff"}, nil},
+		{"quotes", ListFilter{Query: `"unbalanced`}, nil},
+		{"only punctuation", ListFilter{Query: "-- /"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := tt.filter
+			got, err := store.List(&filter)
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+			var want []string
+			for _, name := range tt.want {
+				want = append(want, traces[name].ID)
+			}
+			if strings.Join(traceIDs(got), ",") != strings.Join(want, ",") {
+				t.Errorf("List() = %v, want %v", traceIDs(got), tt.want)
+			}
+
+			count, err := store.Count(&filter)
+			if err != nil {
+				t.Fatalf("Count() error = %v", err)
+			}
+			if count != len(tt.want) {
+				t.Errorf("Count() = %d, want %d", count, len(tt.want))
+			}
+		})
+	}
+
+	got, _ := store.List(&ListFilter{Query: "oomkilled"})
+	if len(got) != 2 || !strings.Contains(got[0].Snippet, SnippetOpen+"OOMKilled"+SnippetClose) {
+		t.Fatalf("expected a highlighted snippet, got %+v", got)
+	}
+	if got[0].Output != traces["oomLogs"].Output {
+		t.Errorf("search results should be complete traces, got output %q", got[0].Output)
+	}
+
+	// Without a query, traces have no snippet
+	all, _ := store.List(nil)
+	if len(all) != 4 || all[0].Snippet != "" {
+		t.Errorf("List() without a query = %d traces, snippet %q", len(all), all[0].Snippet)
+	}
+
+	// Each applies the query too
+	var each []string
+	store.Each(&ListFilter{Query: "production"}, func(tr *Trace) error {
+		each = append(each, tr.ID)
+		return nil
+	})
+	if len(each) != 2 || each[0] != traces["oom"].ID {
+		t.Errorf("Each() = %v, want the two production traces, oldest first", each)
+	}
+}
+
+func TestSearchIndexFollowsPrune(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+	traces := insertSearchTraces(t, store)
+
+	now := time.Now()
+	result, err := store.Prune(&RetentionPolicy{MaxRows: 2}, PruneOptions{Now: now, Source: "test"})
+	if err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	if result.Deleted != 2 {
+		t.Fatalf("Prune() deleted %d, want 2", result.Deleted)
+	}
+
+	// The two oldest (both OOMKilled) are gone from the index
+	got, err := store.List(&ListFilter{Query: "oomkilled"})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("List() = %v after prune, want none", traceIDs(got))
+	}
+
+	// New traces are indexed after VACUUM
+	tr := createTestTrace("session-3", "sniff_get")
+	tr.Output = "ImagePullBackOff"
+	if err := store.Insert(tr); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+	for query, want := range map[string]string{"imagepullbackoff": tr.ID, "rm": traces["exec"].ID} {
+		got, err := store.List(&ListFilter{Query: query})
+		if err != nil || len(got) != 1 || got[0].ID != want {
+			t.Errorf("List(%q) = %v, %v; want %s", query, got, err, want)
+		}
+	}
+}
+
+func TestSearchEncryptedTraces(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+	kr, _ := newTestKeyring(t)
+	store.SetKeyring(kr)
+
+	tr := createSecretTrace()
+	if err := store.Insert(tr); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+
+	// Encrypted fields are not indexed; the command still is
+	for query, want := range map[string]int{"hunter2": 0, "password": 0, "kubectl": 1} {
+		got, err := store.List(&ListFilter{Query: query})
+		if err != nil {
+			t.Fatalf("List(%q) error = %v", query, err)
+		}
+		if len(got) != want {
+			t.Errorf("List(%q) = %d traces, want %d", query, len(got), want)
+		}
+	}
+
+	// Removing an encrypted trace keeps the index consistent
+	if _, err := store.db.Exec("DELETE FROM traces WHERE id = ?", tr.ID); err != nil {
+		t.Fatalf("DELETE error = %v", err)
+	}
+	if _, err := store.db.Exec("INSERT INTO traces_fts (traces_fts) VALUES ('integrity-check')"); err != nil {
+		t.Errorf("FTS integrity check failed: %v", err)
+	}
+}
+
+func TestSearchMigratedDatabase(t *testing.T) {
+	store, err := NewStore(createV1Database(t))
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	defer store.Close()
+
+	// Traces written before the index existed are searchable
+	got, err := store.List(&ListFilter{Query: "pods"})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(got) != 1 || got[0].ID != "v1-trace-1" {
+		t.Errorf("List() = %v, want v1-trace-1", traceIDs(got))
+	}
+}
@@ -0,0 +1,207 @@
+package trace
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// sessionColumns is the column list shared by the session queries
+const sessionColumns = `
+		id, client_name, client_version, protocol_version, transport,
+		started_at, ended_at, cwd, kube_context`
+
+// SaveSession records a session. If the session already exists, its client
+// details are updated and the original start time is kept.
+func (s *Store) SaveSession(session *Session) error {
+	if session == nil {
+		return fmt.Errorf("session cannot be nil")
+	}
+	if session.ID == "" {
+		return fmt.Errorf("session id cannot be empty")
+	}
+
+	query := "INSERT INTO sessions (" + sessionColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			client_name = excluded.client_name,
+			client_version = excluded.client_version,
+			protocol_version = excluded.protocol_version,
+			transport = excluded.transport,
+			cwd = excluded.cwd,
+			kube_context = excluded.kube_context`
+
+	_, err := s.db.Exec(query,
+		session.ID, session.ClientName, session.ClientVersion, session.ProtocolVersion, session.Transport,
+		session.StartedAt, nullInt64(session.EndedAt), session.Cwd, session.KubeContext,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateSessionCwd sets the working directory of a session
+func (s *Store) UpdateSessionCwd(id, cwd string) error {
+	if _, err := s.db.Exec("UPDATE sessions SET cwd = ? WHERE id = ?", cwd, id); err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+	return nil
+}
+
+// EndSession records the end time of a session. Sessions that already ended are left unchanged.
+func (s *Store) EndSession(id string, endedAt int64) error {
+	_, err := s.db.Exec("UPDATE sessions SET ended_at = ? WHERE id = ? AND ended_at IS NULL", endedAt, id)
+	if err != nil {
+		return fmt.Errorf("failed to end session: %w", err)
+	}
+	return nil
+}
+
+// GetSession retrieves a single session with its trace summary
+func (s *Store) GetSession(id string) (*SessionSummary, error) {
+	if id == "" {
+		return nil, fmt.Errorf("id cannot be empty")
+	}
+
+	query := "SELECT " + sessionColumns + " FROM sessions WHERE id = ?"
+
+	session, err := scanSession(s.db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("session not found: %s", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	return s.summarizeSession(session)
+}
+
+// ListSessions retrieves sessions with their trace summaries, newest first
+func (s *Store) ListSessions(limit, offset int) ([]*SessionSummary, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+
+	query := "SELECT " + sessionColumns + " FROM sessions ORDER BY started_at DESC LIMIT ? OFFSET ?"
+
+	rows, err := s.db.Query(query, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []*Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating sessions: %w", err)
+	}
+	rows.Close()
+
+	summaries := make([]*SessionSummary, 0, len(sessions))
+	for _, session := range sessions {
+		summary, err := s.summarizeSession(session)
+		if err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, summary)
+	}
+
+	return summaries, nil
+}
+
+// CountSessions returns the total number of sessions
+func (s *Store) CountSessions() (int, error) {
+	var count int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM sessions").Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count sessions: %w", err)
+	}
+	return count, nil
+}
+
+// summarizeSession aggregates the traces of a session by risk level
+func (s *Store) summarizeSession(session *Session) (*SessionSummary, error) {
+	summary := &SessionSummary{
+		Session:       session,
+		RiskBreakdown: make(map[string]int),
+	}
+
+	rows, err := s.db.Query(
+		"SELECT risk_level, COUNT(*), MAX(timestamp) FROM traces WHERE session_id = ? GROUP BY risk_level",
+		session.ID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize session: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			riskLevel string
+			count     int
+			last      int64
+		)
+		if err := rows.Scan(&riskLevel, &count, &last); err != nil {
+			return nil, fmt.Errorf("failed to scan session summary: %w", err)
+		}
+		summary.RiskBreakdown[riskLevel] = count
+		summary.TraceCount += count
+		if last > summary.LastActivity {
+			summary.LastActivity = last
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating session summary: %w", err)
+	}
+
+	// Active sessions are measured until their last trace
+	end := session.EndedAt
+	if end == 0 {
+		end = summary.LastActivity
+	}
+	if end > session.StartedAt {
+		summary.DurationMs = end - session.StartedAt
+	}
+
+	return summary, nil
+}
+
+// scanSession scans a row selected with sessionColumns
+func scanSession(row rowScanner) (*Session, error) {
+	session := &Session{}
+	var (
+		clientName, clientVersion, protocolVersion, transport sql.NullString
+		cwd, kubeContext                                      sql.NullString
+		endedAt                                               sql.NullInt64
+	)
+
+	err := row.Scan(
+		&session.ID, &clientName, &clientVersion, &protocolVersion, &transport,
+		&session.StartedAt, &endedAt, &cwd, &kubeContext,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	session.ClientName = clientName.String
+	session.ClientVersion = clientVersion.String
+	session.ProtocolVersion = protocolVersion.String
+	session.Transport = transport.String
+	session.EndedAt = endedAt.Int64
+	session.Cwd = cwd.String
+	session.KubeContext = kubeContext.String
+
+	return session, nil
+}
+
+// nullInt64 stores zero as NULL
+func nullInt64(v int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: v, Valid: v != 0}
+}
@@ -0,0 +1,198 @@
+package trace
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func createTestSession(id string, startedAt int64) *Session {
+	return &Session{
+		ID:              id,
+		ClientName:      "claude-code",
+		ClientVersion:   "1.0.0",
+		ProtocolVersion: "2025-06-18",
+		Transport:       "stdio",
+		StartedAt:       startedAt,
+		Cwd:             "/home/user/project",
+		KubeContext:     "kind-dev",
+	}
+}
+
+func TestSaveAndGetSession(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	start := time.Now().Add(-time.Minute).UnixMilli()
+	session := createTestSession("session-1", start)
+	if err := store.SaveSession(session); err != nil {
+		t.Fatalf("SaveSession() error = %v", err)
+	}
+
+	levels := []string{"low", "low", "high"}
+	var last int64
+	for i, level := range levels {
+		tr := createTestTrace("session-1", "sniff_get")
+		tr.RiskLevel = level
+		tr.Timestamp = start + int64(i+1)*1000
+		last = tr.Timestamp
+		if err := store.Insert(tr); err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+	}
+	// Traces of other sessions are not counted
+	if err := store.Insert(createTestTrace("session-2", "sniff_get")); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+
+	got, err := store.GetSession("session-1")
+	if err != nil {
+		t.Fatalf("GetSession() error = %v", err)
+	}
+
+	if got.ClientName != "claude-code" || got.KubeContext != "kind-dev" || got.Cwd != session.Cwd {
+		t.Errorf("GetSession() = %+v, want %+v", got.Session, session)
+	}
+	if got.TraceCount != 3 {
+		t.Errorf("TraceCount = %d, want 3", got.TraceCount)
+	}
+	if got.RiskBreakdown["low"] != 2 || got.RiskBreakdown["high"] != 1 {
+		t.Errorf("RiskBreakdown = %v, want low=2 high=1", got.RiskBreakdown)
+	}
+	if got.LastActivity != last {
+		t.Errorf("LastActivity = %d, want %d", got.LastActivity, last)
+	}
+	// Active session: duration runs until the last trace
+	if got.DurationMs != last-start {
+		t.Errorf("DurationMs = %d, want %d", got.DurationMs, last-start)
+	}
+
+	if _, err := store.GetSession("missing"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected not found error, got %v", err)
+	}
+}
+
+func TestSaveSessionUpdatesExisting(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	start := time.Now().UnixMilli()
+	if err := store.SaveSession(&Session{ID: "session-1", StartedAt: start}); err != nil {
+		t.Fatalf("SaveSession() error = %v", err)
+	}
+
+	updated := createTestSession("session-1", start+5000)
+	if err := store.SaveSession(updated); err != nil {
+		t.Fatalf("SaveSession() error = %v", err)
+	}
+
+	got, err := store.GetSession("session-1")
+	if err != nil {
+		t.Fatalf("GetSession() error = %v", err)
+	}
+	if got.ClientName != "claude-code" {
+		t.Errorf("ClientName = %q, want claude-code", got.ClientName)
+	}
+	if got.StartedAt != start {
+		t.Errorf("StartedAt = %d, want original %d", got.StartedAt, start)
+	}
+
+	if err := store.UpdateSessionCwd("session-1", "/tmp/other"); err != nil {
+		t.Fatalf("UpdateSessionCwd() error = %v", err)
+	}
+	got, _ = store.GetSession("session-1")
+	if got.Cwd != "/tmp/other" {
+		t.Errorf("Cwd = %q, want /tmp/other", got.Cwd)
+	}
+}
+
+func TestEndSession(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	start := time.Now().UnixMilli()
+	if err := store.SaveSession(createTestSession("session-1", start)); err != nil {
+		t.Fatalf("SaveSession() error = %v", err)
+	}
+
+	if err := store.EndSession("session-1", start+60000); err != nil {
+		t.Fatalf("EndSession() error = %v", err)
+	}
+	// A second end doesn't overwrite the first
+	if err := store.EndSession("session-1", start+90000); err != nil {
+		t.Fatalf("EndSession() error = %v", err)
+	}
+
+	got, err := store.GetSession("session-1")
+	if err != nil {
+		t.Fatalf("GetSession() error = %v", err)
+	}
+	if got.EndedAt != start+60000 {
+		t.Errorf("EndedAt = %d, want %d", got.EndedAt, start+60000)
+	}
+	if got.DurationMs != 60000 {
+		t.Errorf("DurationMs = %d, want 60000", got.DurationMs)
+	}
+}
+
+func TestListSessions(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	start := time.Now().UnixMilli()
+	for i, id := range []string{"old", "middle", "new"} {
+		if err := store.SaveSession(createTestSession(id, start+int64(i))); err != nil {
+			t.Fatalf("SaveSession() error = %v", err)
+		}
+	}
+	if err := store.Insert(createTestTrace("middle", "sniff_get")); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+
+	sessions, err := store.ListSessions(2, 0)
+	if err != nil {
+		t.Fatalf("ListSessions() error = %v", err)
+	}
+	if len(sessions) != 2 || sessions[0].ID != "new" || sessions[1].ID != "middle" {
+		t.Fatalf("ListSessions() returned unexpected order: %+v", sessions)
+	}
+	if sessions[0].TraceCount != 0 || sessions[1].TraceCount != 1 {
+		t.Errorf("unexpected trace counts: new=%d middle=%d", sessions[0].TraceCount, sessions[1].TraceCount)
+	}
+
+	count, err := store.CountSessions()
+	if err != nil {
+		t.Fatalf("CountSessions() error = %v", err)
+	}
+	if count != 3 {
+		t.Errorf("CountSessions() = %d, want 3", count)
+	}
+}
+
+func TestListFilterSessionID(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	for _, sessionID := range []string{"session-1", "session-1", "session-2"} {
+		if err := store.Insert(createTestTrace(sessionID, "sniff_get")); err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+	}
+
+	filter := &ListFilter{SessionID: "session-1"}
+	traces, err := store.List(filter)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(traces) != 2 {
+		t.Errorf("List() returned %d traces, want 2", len(traces))
+	}
+
+	count, err := store.Count(&ListFilter{SessionID: "session-1"})
+	if err != nil {
+		t.Fatalf("Count() error = %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Count() = %d, want 2", count)
+	}
+}
@@ -8,26 +8,53 @@ import (
 
 // Stats represents aggregated statistics from traces
 type Stats struct {
-	RiskDistribution map[string]int       `json:"risk_distribution"`
-	ToolUsage        map[string]int       `json:"tool_usage"`
-	Timeline         []TimelinePoint      `json:"timeline"`
-	TotalOperations  int                  `json:"total_operations"`
-	TotalCost        float64              `json:"total_cost_estimate"`
+	RiskDistribution  map[string]int  `json:"risk_distribution"`
+	ToolUsage         map[string]int  `json:"tool_usage"`
+	NamespaceUsage    map[string]int  `json:"namespace_usage"` // Top 10 namespaces
+	ResultCounts      map[string]int  `json:"result_counts"`
+	Timeline          []TimelinePoint `json:"timeline"`
+	TotalOperations   int             `json:"total_operations"`
+	TotalCost         float64         `json:"total_cost_estimate"`
+	TotalTokensInput  int             `json:"total_tokens_input"`
+	TotalTokensOutput int             `json:"total_tokens_output"`
+	AvgLatencyMs      float64         `json:"avg_latency_ms"`
+
+	// Token and cost rollups
+	CostByTool      map[string]UsageTotals `json:"cost_by_tool"`
+	CostByNamespace map[string]UsageTotals `json:"cost_by_namespace"` // Top 10 namespaces by cost
+	CostBySession   map[string]UsageTotals `json:"cost_by_session"`   // Top 10 sessions by cost
+}
+
+// UsageTotals sums the estimated tokens and cost of a group of traces
+type UsageTotals struct {
+	Calls        int     `json:"calls"`
+	TokensInput  int     `json:"tokens_input"`
+	TokensOutput int     `json:"tokens_output"`
+	CostEstimate float64 `json:"cost_estimate"`
 }
 
+// usageRollupLimit is the number of namespaces and sessions in the cost rollups
+const usageRollupLimit = 10
+
 // TimelinePoint represents a point in the timeline chart
 type TimelinePoint struct {
 	Hour  string `json:"hour"`
 	Count int    `json:"count"`
 }
 
-// GetStats retrieves aggregated statistics for the specified period
+// Stats retrieves aggregated statistics for the specified period
 // period can be: "1h", "24h", "7d", "30d", or empty for all-time
-func GetStats(db *sql.DB, period string) (*Stats, error) {
+func (s *Store) Stats(period string) (*Stats, error) {
+	db := s.db
 	stats := &Stats{
 		RiskDistribution: make(map[string]int),
 		ToolUsage:        make(map[string]int),
+		NamespaceUsage:   make(map[string]int),
+		ResultCounts:     make(map[string]int),
 		Timeline:         []TimelinePoint{},
+		CostByTool:       make(map[string]UsageTotals),
+		CostByNamespace:  make(map[string]UsageTotals),
+		CostBySession:    make(map[string]UsageTotals),
 	}
 
 	// Calculate time range based on period
@@ -85,18 +112,57 @@ func GetStats(db *sql.DB, period string) (*Stats, error) {
 	}
 	rows.Close()
 
-	// 3. Timeline (hourly buckets)
-	// SQLite doesn't have built-in date_trunc, so we'll use strftime
+	// 3. Namespace usage (top 10)
+	namespaceWhere := "WHERE namespace != ''"
+	if whereClause != "" {
+		namespaceWhere = whereClause + " AND namespace != ''"
+	}
+	namespaceQuery := fmt.Sprintf("SELECT namespace, COUNT(*) FROM traces %s GROUP BY namespace ORDER BY COUNT(*) DESC LIMIT 10", namespaceWhere)
+	rows, err = db.Query(namespaceQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query namespace usage: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var namespace string
+		var count int
+		if err := rows.Scan(&namespace, &count); err != nil {
+			return nil, err
+		}
+		stats.NamespaceUsage[namespace] = count
+	}
+	rows.Close()
+
+	// 4. Result counts
+	resultQuery := fmt.Sprintf("SELECT result, COUNT(*) FROM traces %s GROUP BY result", whereClause)
+	rows, err = db.Query(resultQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query result counts: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var result string
+		var count int
+		if err := rows.Scan(&result, &count); err != nil {
+			return nil, err
+		}
+		stats.ResultCounts[result] = count
+	}
+	rows.Close()
+
+	// 5. Timeline (hourly buckets)
 	timelineQuery := fmt.Sprintf(`
 		SELECT 
-			strftime('%%Y-%%m-%%dT%%H:00:00Z', datetime(timestamp/1000, 'unixepoch')) as hour,
+			%s as hour,
 			COUNT(*) as count
 		FROM traces
 		%s
 		GROUP BY hour
 		ORDER BY hour DESC
 		LIMIT 24
-	`, whereClause)
+	`, db.dialect.hourBucket("timestamp"), whereClause)
 
 	rows, err = db.Query(timelineQuery, args...)
 	if err != nil {
@@ -113,18 +179,80 @@ func GetStats(db *sql.DB, period string) (*Stats, error) {
 	}
 	rows.Close()
 
-	// 4. Total cost
-	costQuery := fmt.Sprintf("SELECT COALESCE(SUM(cost_estimate), 0) FROM traces %s", whereClause)
-	err = db.QueryRow(costQuery, args...).Scan(&stats.TotalCost)
+	// 6. Total cost and tokens
+	costQuery := fmt.Sprintf("SELECT COALESCE(SUM(cost_estimate), 0), COALESCE(SUM(tokens_input), 0), COALESCE(SUM(tokens_output), 0) FROM traces %s", whereClause)
+	err = db.QueryRow(costQuery, args...).Scan(&stats.TotalCost, &stats.TotalTokensInput, &stats.TotalTokensOutput)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query total cost: %w", err)
 	}
 
+	// Cost per tool, namespace and session
+	rollups := []struct {
+		column string
+		limit  int
+		into   map[string]UsageTotals
+	}{
+		{"tool_name", 0, stats.CostByTool},
+		{"namespace", usageRollupLimit, stats.CostByNamespace},
+		{"session_id", usageRollupLimit, stats.CostBySession},
+	}
+	for _, rollup := range rollups {
+		if err := s.usageBy(rollup.column, whereClause, args, rollup.limit, rollup.into); err != nil {
+			return nil, err
+		}
+	}
+
+	// 7. Average latency
+	latencyWhere := "WHERE latency_ms > 0"
+	if whereClause != "" {
+		latencyWhere = whereClause + " AND latency_ms > 0"
+	}
+	var avgLatency sql.NullFloat64
+	err = db.QueryRow(fmt.Sprintf("SELECT AVG(latency_ms) FROM traces %s", latencyWhere), args...).Scan(&avgLatency)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query average latency: %w", err)
+	}
+	stats.AvgLatencyMs = avgLatency.Float64
+
 	return stats, nil
 }
 
-// GetDistinctValues retrieves distinct values for a column (for filter autocomplete)
-func GetDistinctValues(db *sql.DB, column string) ([]string, error) {
+// usageBy sums tokens and cost per value of a column, highest cost first.
+// A limit of 0 returns every value.
+func (s *Store) usageBy(column, whereClause string, args []interface{}, limit int, into map[string]UsageTotals) error {
+	where := fmt.Sprintf("WHERE %s != ''", column)
+	if whereClause != "" {
+		where = fmt.Sprintf("%s AND %s != ''", whereClause, column)
+	}
+	query := fmt.Sprintf(`
+		SELECT %[1]s, COUNT(*), COALESCE(SUM(tokens_input), 0), COALESCE(SUM(tokens_output), 0), COALESCE(SUM(cost_estimate), 0)
+		FROM traces
+		%[2]s
+		GROUP BY %[1]s
+		ORDER BY SUM(cost_estimate) DESC, SUM(tokens_input) + SUM(tokens_output) DESC, %[1]s`, column, where)
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query cost by %s: %w", column, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		var totals UsageTotals
+		if err := rows.Scan(&key, &totals.Calls, &totals.TokensInput, &totals.TokensOutput, &totals.CostEstimate); err != nil {
+			return err
+		}
+		into[key] = totals
+	}
+	return rows.Err()
+}
+
+// DistinctValues retrieves distinct values for a column (for filter autocomplete)
+func (s *Store) DistinctValues(column string) ([]string, error) {
 	// Whitelist allowed columns to prevent SQL injection
 	allowedColumns := map[string]bool{
 		"namespace": true,
@@ -135,10 +263,10 @@ func GetDistinctValues(db *sql.DB, column string) ([]string, error) {
 		return nil, fmt.Errorf("invalid column name: %s", column)
 	}
 
-	query := fmt.Sprintf("SELECT DISTINCT %s FROM traces WHERE %s IS NOT NULL AND %s != '' ORDER BY %s", 
+	query := fmt.Sprintf("SELECT DISTINCT %s FROM traces WHERE %s IS NOT NULL AND %s != '' ORDER BY %s",
 		column, column, column, column)
 
-	rows, err := db.Query(query)
+	rows, err := s.db.Query(query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query distinct values: %w", err)
 	}
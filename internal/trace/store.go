@@ -1,22 +1,33 @@
 package trace
 
 import (
+	"crypto/ed25519"
 	"database/sql"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
-
-	_ "modernc.org/sqlite" // SQLite driver (CGO-free)
 )
 
-// Store handles SQLite operations for trace storage
+// Store handles SQL operations for trace storage.
+//
+// It is backed by SQLite by default and by PostgreSQL when opened with a
+// postgres:// DSN, so a team can share one central trace database.
 type Store struct {
-	db *sql.DB
+	db *sqlDB
+
+	// Signed hash chain checkpoints (see EnableCheckpoints)
+	checkpointKey   ed25519.PrivateKey
+	checkpointEvery int64
+
+	// Payload encryption keys (see SetKeyring)
+	keyring *Keyring
 }
 
-// NewStore creates a new Store with the given database path
+// NewStore creates a new Store with the given database path or DSN.
 // If dbPath is empty, uses default: ~/.sniffops/traces.db
+// A postgres:// or postgresql:// URL selects the PostgreSQL backend.
 func NewStore(dbPath string) (*Store, error) {
 	if dbPath == "" {
 		home, err := os.UserHomeDir()
@@ -26,14 +37,18 @@ func NewStore(dbPath string) (*Store, error) {
 		dbPath = filepath.Join(home, ".sniffops", "traces.db")
 	}
 
-	// Ensure parent directory exists
-	dir := filepath.Dir(dbPath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create directory %s: %w", dir, err)
+	d := dialectFor(dbPath)
+
+	if _, ok := d.(sqliteDialect); ok {
+		// Ensure parent directory exists
+		dir := filepath.Dir(dbPath)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create directory %s: %w", dir, err)
+		}
 	}
 
 	// Open database
-	db, err := sql.Open("sqlite", dbPath)
+	db, err := sql.Open(d.driver(), d.dataSource(dbPath))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -44,12 +59,12 @@ func NewStore(dbPath string) (*Store, error) {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	store := &Store{db: db}
+	store := &Store{db: &sqlDB{DB: db, dialect: d}}
 
-	// Initialize schema
-	if err := store.initSchema(); err != nil {
+	// Create or upgrade the schema
+	if err := store.migrate(); err != nil {
 		db.Close()
-		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+		return nil, fmt.Errorf("failed to migrate schema: %w", err)
 	}
 
 	return store, nil
@@ -63,111 +78,34 @@ func (s *Store) Close() error {
 	return nil
 }
 
-// DB returns the underlying *sql.DB for custom queries
-// This is useful for advanced queries like aggregations in sniff_stats tool
-func (s *Store) DB() *sql.DB {
-	return s.db
+// BackendName returns the name of the database backend (sqlite or postgres)
+func (s *Store) BackendName() string {
+	return s.db.dialect.name()
 }
 
-// initSchema creates the traces and metadata tables if they don't exist
-func (s *Store) initSchema() error {
-	schema := `
-	CREATE TABLE IF NOT EXISTS traces (
-		-- Identity
-		id              TEXT PRIMARY KEY,
-		session_id      TEXT NOT NULL,
-		timestamp       INTEGER NOT NULL,
-		
-		-- Request Context
-		user_intent     TEXT,
-		tool_name       TEXT NOT NULL,
-		
-		-- K8s Command Details
-		command         TEXT NOT NULL,
-		target_resource TEXT,
-		namespace       TEXT,
-		resource_kind   TEXT,
-		
-		-- Risk & Security
-		risk_level      TEXT NOT NULL,
-		risk_reason     TEXT,
-		
-		-- Execution Result
-		result          TEXT NOT NULL,
-		output          TEXT,
-		error_message   TEXT,
-		
-		-- Metrics
-		latency_ms      INTEGER,
-		tokens_input    INTEGER,
-		tokens_output   INTEGER,
-		cost_estimate   REAL,
-		
-		-- Metadata
-		kubeconfig      TEXT,
-		cluster_name    TEXT
-	);
-
-	CREATE INDEX IF NOT EXISTS idx_session_id ON traces(session_id);
-	CREATE INDEX IF NOT EXISTS idx_timestamp ON traces(timestamp DESC);
-	CREATE INDEX IF NOT EXISTS idx_namespace ON traces(namespace);
-	CREATE INDEX IF NOT EXISTS idx_risk_level ON traces(risk_level);
-	CREATE INDEX IF NOT EXISTS idx_tool_name ON traces(tool_name);
-
-	CREATE TABLE IF NOT EXISTS metadata (
-		key   TEXT PRIMARY KEY,
-		value TEXT
-	);
-
-	INSERT OR IGNORE INTO metadata (key, value) VALUES ('schema_version', '1');
-	INSERT OR IGNORE INTO metadata (key, value) VALUES ('created_at', datetime('now'));
-	`
-
-	_, err := s.db.Exec(schema)
-	return err
-}
-
-// Insert saves a new trace to the database
+// Insert saves a new trace to the database and links it into the hash chain
 func (s *Store) Insert(trace *Trace) error {
 	if trace == nil {
 		return fmt.Errorf("trace cannot be nil")
 	}
 
-	query := `
-	INSERT INTO traces (
-		id, session_id, timestamp,
-		user_intent, tool_name,
-		command, target_resource, namespace, resource_kind,
-		risk_level, risk_reason,
-		result, output, error_message,
-		latency_ms, tokens_input, tokens_output, cost_estimate,
-		kubeconfig, cluster_name
-	) VALUES (
-		?, ?, ?,
-		?, ?,
-		?, ?, ?, ?,
-		?, ?,
-		?, ?, ?,
-		?, ?, ?, ?,
-		?, ?
-	)
-	`
+	return s.insertChained([]*Trace{trace}, false)
+}
 
-	_, err := s.db.Exec(query,
-		trace.ID, trace.SessionID, trace.Timestamp,
-		trace.UserIntent, trace.ToolName,
-		trace.Command, trace.TargetResource, trace.Namespace, trace.ResourceKind,
-		trace.RiskLevel, trace.RiskReason,
-		trace.Result, trace.Output, trace.ErrorMessage,
-		trace.LatencyMs, trace.TokensInput, trace.TokensOutput, trace.CostEstimate,
-		trace.Kubeconfig, trace.ClusterName,
-	)
+// InsertBatch saves several traces in one transaction.
+// Traces whose ID already exists are skipped, so a failed batch can be retried safely.
+func (s *Store) InsertBatch(traces []*Trace) error {
+	if len(traces) == 0 {
+		return nil
+	}
 
-	if err != nil {
-		return fmt.Errorf("failed to insert trace: %w", err)
+	for _, trace := range traces {
+		if trace == nil {
+			return fmt.Errorf("trace cannot be nil")
+		}
 	}
 
-	return nil
+	return s.insertChained(traces, true)
 }
 
 // GetByID retrieves a single trace by ID
@@ -176,30 +114,9 @@ func (s *Store) GetByID(id string) (*Trace, error) {
 		return nil, fmt.Errorf("id cannot be empty")
 	}
 
-	query := `
-	SELECT 
-		id, session_id, timestamp,
-		user_intent, tool_name,
-		command, target_resource, namespace, resource_kind,
-		risk_level, risk_reason,
-		result, output, error_message,
-		latency_ms, tokens_input, tokens_output, cost_estimate,
-		kubeconfig, cluster_name
-	FROM traces
-	WHERE id = ?
-	`
-
-	trace := &Trace{}
-	err := s.db.QueryRow(query, id).Scan(
-		&trace.ID, &trace.SessionID, &trace.Timestamp,
-		&trace.UserIntent, &trace.ToolName,
-		&trace.Command, &trace.TargetResource, &trace.Namespace, &trace.ResourceKind,
-		&trace.RiskLevel, &trace.RiskReason,
-		&trace.Result, &trace.Output, &trace.ErrorMessage,
-		&trace.LatencyMs, &trace.TokensInput, &trace.TokensOutput, &trace.CostEstimate,
-		&trace.Kubeconfig, &trace.ClusterName,
-	)
+	query := "SELECT " + traceColumns + " FROM traces WHERE id = ?"
 
+	trace, err := scanTrace(s.db.QueryRow(query, id))
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("trace not found: %s", id)
 	}
@@ -207,6 +124,10 @@ func (s *Store) GetByID(id string) (*Trace, error) {
 		return nil, fmt.Errorf("failed to get trace: %w", err)
 	}
 
+	if err := s.open(trace); err != nil {
+		return nil, err
+	}
+
 	return trace, nil
 }
 
@@ -221,53 +142,14 @@ func (s *Store) List(filter *ListFilter) ([]*Trace, error) {
 		filter.Limit = 100
 	}
 
-	// Build query with filters
-	query := `
-	SELECT 
-		id, session_id, timestamp,
-		user_intent, tool_name,
-		command, target_resource, namespace, resource_kind,
-		risk_level, risk_reason,
-		result, output, error_message,
-		latency_ms, tokens_input, tokens_output, cost_estimate,
-		kubeconfig, cluster_name
-	FROM traces
-	WHERE 1=1
-	`
-
-	var conditions []string
-	var args []interface{}
-
-	// Apply filters
-	if filter.Tool != "" {
-		conditions = append(conditions, "tool_name = ?")
-		args = append(args, filter.Tool)
+	// Full-text queries are ordered by relevance
+	if strings.TrimSpace(filter.Query) != "" {
+		return s.search(filter)
 	}
 
-	if filter.Namespace != "" {
-		conditions = append(conditions, "namespace = ?")
-		args = append(args, filter.Namespace)
-	}
-
-	if filter.RiskLevel != "" {
-		conditions = append(conditions, "risk_level = ?")
-		args = append(args, filter.RiskLevel)
-	}
-
-	if filter.StartTime != nil {
-		conditions = append(conditions, "timestamp >= ?")
-		args = append(args, filter.StartTime.UnixMilli())
-	}
-
-	if filter.EndTime != nil {
-		conditions = append(conditions, "timestamp <= ?")
-		args = append(args, filter.EndTime.UnixMilli())
-	}
-
-	// Add conditions to query
-	if len(conditions) > 0 {
-		query += " AND " + strings.Join(conditions, " AND ")
-	}
+	// Build query with filters
+	where, args := filterConditions(s.db.dialect, filter)
+	query := "SELECT " + traceColumns + " FROM traces WHERE 1=1" + where
 
 	// Order by timestamp (newest first)
 	query += " ORDER BY timestamp DESC"
@@ -286,19 +168,13 @@ func (s *Store) List(filter *ListFilter) ([]*Trace, error) {
 	// Scan results
 	var traces []*Trace
 	for rows.Next() {
-		trace := &Trace{}
-		err := rows.Scan(
-			&trace.ID, &trace.SessionID, &trace.Timestamp,
-			&trace.UserIntent, &trace.ToolName,
-			&trace.Command, &trace.TargetResource, &trace.Namespace, &trace.ResourceKind,
-			&trace.RiskLevel, &trace.RiskReason,
-			&trace.Result, &trace.Output, &trace.ErrorMessage,
-			&trace.LatencyMs, &trace.TokensInput, &trace.TokensOutput, &trace.CostEstimate,
-			&trace.Kubeconfig, &trace.ClusterName,
-		)
+		trace, err := scanTrace(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan trace: %w", err)
 		}
+		if err := s.open(trace); err != nil {
+			return nil, err
+		}
 		traces = append(traces, trace)
 	}
 
@@ -315,11 +191,76 @@ func (s *Store) Count(filter *ListFilter) (int, error) {
 		filter = &ListFilter{}
 	}
 
-	query := "SELECT COUNT(*) FROM traces WHERE 1=1"
+	// Apply same filters as List
+	where, args := filterConditions(s.db.dialect, filter)
+	query := "SELECT COUNT(*) FROM traces WHERE 1=1" + where
+
+	var count int
+	err := s.db.QueryRow(query, args...).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count traces: %w", err)
+	}
+
+	return count, nil
+}
+
+// Each calls fn for every trace matching the filter, oldest first, reading
+// one row at a time so that any number of traces can be exported.
+// Unlike List, a zero Limit means no limit. Iteration stops at the first
+// error returned by fn.
+func (s *Store) Each(filter *ListFilter, fn func(*Trace) error) error {
+	if filter == nil {
+		filter = &ListFilter{}
+	}
+
+	where, args := filterConditions(s.db.dialect, filter)
+	query := "SELECT " + traceColumns + " FROM traces WHERE 1=1" + where + " ORDER BY timestamp, id"
+
+	if filter.Limit > 0 || filter.Offset > 0 {
+		limit := s.db.dialect.noLimit()
+		if filter.Limit > 0 {
+			limit = strconv.Itoa(filter.Limit)
+		}
+		query += " LIMIT " + limit + " OFFSET ?"
+		args = append(args, filter.Offset)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query traces: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		trace, err := scanTrace(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan trace: %w", err)
+		}
+		if err := s.open(trace); err != nil {
+			return err
+		}
+		if err := fn(trace); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating traces: %w", err)
+	}
+	return nil
+}
+
+// filterConditions returns the WHERE conditions for a filter (starting with
+// " AND ", or empty) and their arguments. Pagination is left to the caller.
+func filterConditions(d dialect, filter *ListFilter) (string, []interface{}) {
 	var conditions []string
 	var args []interface{}
 
-	// Apply same filters as List
+	if filter.SessionID != "" {
+		conditions = append(conditions, "session_id = ?")
+		args = append(args, filter.SessionID)
+	}
+
 	if filter.Tool != "" {
 		conditions = append(conditions, "tool_name = ?")
 		args = append(args, filter.Tool)
@@ -345,15 +286,134 @@ func (s *Store) Count(filter *ListFilter) (int, error) {
 		args = append(args, filter.EndTime.UnixMilli())
 	}
 
-	if len(conditions) > 0 {
-		query += " AND " + strings.Join(conditions, " AND ")
+	if strings.TrimSpace(filter.Query) != "" {
+		conditions = append(conditions, d.searchCondition())
+		args = append(args, d.searchQuery(filter.Query))
 	}
 
-	var count int
-	err := s.db.QueryRow(query, args...).Scan(&count)
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " AND " + strings.Join(conditions, " AND "), args
+}
+
+// traceColumns is the column list shared by Insert and the SELECT queries.
+// The order must match traceValues and scanTrace.
+const traceColumns = `
+		id, session_id, timestamp,
+		user_intent, tool_name,
+		command, target_resource, namespace, resource_kind,
+		risk_level, risk_reason,
+		result, output, error_message,
+		latency_ms, tokens_input, tokens_output, cost_estimate,
+		kubeconfig, cluster_name,
+		approval_status, approved_by, approved_at, approval_wait_ms,
+		dry_run,
+		before_snapshot, after_snapshot, diff,
+		revert_of,
+		chain_seq, prev_hash, hash,
+		data_key,
+		source_host, source_user,
+		loop, input,
+		before_snapshot_redacted`
+
+// traceColumnCount is the number of columns in traceColumns
+var traceColumnCount = len(strings.Split(traceColumns, ","))
+
+// traceValues returns the column values of a trace in traceColumns order
+func traceValues(trace *Trace) []interface{} {
+	return []interface{}{
+		trace.ID, trace.SessionID, trace.Timestamp,
+		trace.UserIntent, trace.ToolName,
+		trace.Command, trace.TargetResource, trace.Namespace, trace.ResourceKind,
+		trace.RiskLevel, trace.RiskReason,
+		trace.Result, trace.Output, trace.ErrorMessage,
+		trace.LatencyMs, trace.TokensInput, trace.TokensOutput, trace.CostEstimate,
+		trace.Kubeconfig, trace.ClusterName,
+		trace.ApprovalStatus, trace.ApprovedBy, trace.ApprovedAt, trace.ApprovalWaitMs,
+		trace.DryRun,
+		trace.BeforeSnapshot, trace.AfterSnapshot, trace.Diff,
+		trace.RevertOf,
+		nullInt64(trace.ChainSeq), trace.PrevHash, trace.Hash,
+		trace.DataKey,
+		trace.SourceHost, trace.SourceUser,
+		trace.Loop, trace.Input,
+		trace.BeforeSnapshotRedacted,
+	}
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanTrace scans a row selected with traceColumns.
+// Nullable columns (e.g., added to existing databases) are scanned as empty values.
+func scanTrace(row rowScanner) (*Trace, error) {
+	trace := &Trace{}
+	var (
+		userIntent, targetResource, namespace, resourceKind  sql.NullString
+		riskReason, output, errorMessage                     sql.NullString
+		kubeconfig, clusterName, approvalStatus, approvedBy  sql.NullString
+		latencyMs, tokensInput, tokensOutput, approvalWaitMs sql.NullInt64
+		beforeSnapshot, afterSnapshot, diff, revertOf        sql.NullString
+		approvedAt, chainSeq                                 sql.NullInt64
+		prevHash, hash, dataKey                              sql.NullString
+		sourceHost, sourceUser, loop, input                  sql.NullString
+		costEstimate                                         sql.NullFloat64
+	)
+
+	err := row.Scan(
+		&trace.ID, &trace.SessionID, &trace.Timestamp,
+		&userIntent, &trace.ToolName,
+		&trace.Command, &targetResource, &namespace, &resourceKind,
+		&trace.RiskLevel, &riskReason,
+		&trace.Result, &output, &errorMessage,
+		&latencyMs, &tokensInput, &tokensOutput, &costEstimate,
+		&kubeconfig, &clusterName,
+		&approvalStatus, &approvedBy, &approvedAt, &approvalWaitMs,
+		&trace.DryRun,
+		&beforeSnapshot, &afterSnapshot, &diff,
+		&revertOf,
+		&chainSeq, &prevHash, &hash,
+		&dataKey,
+		&sourceHost, &sourceUser,
+		&loop, &input,
+		&trace.BeforeSnapshotRedacted,
+	)
 	if err != nil {
-		return 0, fmt.Errorf("failed to count traces: %w", err)
+		return nil, err
 	}
 
-	return count, nil
+	trace.UserIntent = userIntent.String
+	trace.TargetResource = targetResource.String
+	trace.Namespace = namespace.String
+	trace.ResourceKind = resourceKind.String
+	trace.RiskReason = riskReason.String
+	trace.Output = output.String
+	trace.ErrorMessage = errorMessage.String
+	trace.LatencyMs = int(latencyMs.Int64)
+	trace.TokensInput = int(tokensInput.Int64)
+	trace.TokensOutput = int(tokensOutput.Int64)
+	trace.CostEstimate = costEstimate.Float64
+	trace.Kubeconfig = kubeconfig.String
+	trace.ClusterName = clusterName.String
+	trace.ApprovalStatus = approvalStatus.String
+	trace.ApprovedBy = approvedBy.String
+	trace.ApprovedAt = approvedAt.Int64
+	trace.ApprovalWaitMs = int(approvalWaitMs.Int64)
+	trace.BeforeSnapshot = beforeSnapshot.String
+	trace.AfterSnapshot = afterSnapshot.String
+	trace.Diff = diff.String
+	trace.RevertOf = revertOf.String
+	trace.ChainSeq = chainSeq.Int64
+	trace.PrevHash = prevHash.String
+	trace.Hash = hash.String
+	trace.DataKey = dataKey.String
+	trace.SourceHost = sourceHost.String
+	trace.SourceUser = sourceUser.String
+	trace.Loop = loop.String
+	trace.Input = input.String
+
+	return trace, nil
 }
@@ -386,3 +386,43 @@ func TestOrderByTimestamp(t *testing.T) {
 		t.Errorf("expected oldest trace last, got %s", results[2].ID)
 	}
 }
+
+func TestDryRunRoundTrip(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	trace := createTestTrace("session-1", "sniff_apply")
+	trace.DryRun = true
+	if err := store.Insert(trace); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+
+	got, err := store.GetByID(trace.ID)
+	if err != nil {
+		t.Fatalf("GetByID() error = %v", err)
+	}
+	if !got.DryRun {
+		t.Error("expected DryRun to be true")
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	trace := createTestTrace("session-1", "sniff_scale")
+	trace.BeforeSnapshot = `{"kind":"Deployment","spec":{"replicas":2}}`
+	trace.AfterSnapshot = `{"kind":"Deployment","spec":{"replicas":5}}`
+	trace.Diff = `[{"path":"spec.replicas","op":"modified","old":2,"new":5}]`
+	if err := store.Insert(trace); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+
+	got, err := store.GetByID(trace.ID)
+	if err != nil {
+		t.Fatalf("GetByID() error = %v", err)
+	}
+	if got.BeforeSnapshot != trace.BeforeSnapshot || got.AfterSnapshot != trace.AfterSnapshot || got.Diff != trace.Diff {
+		t.Errorf("snapshots not round-tripped: %+v", got)
+	}
+}
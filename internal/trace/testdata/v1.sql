@@ -0,0 +1,68 @@
+-- Trace database as created by sniffops v0.1.0 (schema version 1)
+CREATE TABLE IF NOT EXISTS traces (
+	-- Identity
+	id              TEXT PRIMARY KEY,
+	session_id      TEXT NOT NULL,
+	timestamp       INTEGER NOT NULL,
+
+	-- Request Context
+	user_intent     TEXT,
+	tool_name       TEXT NOT NULL,
+
+	-- K8s Command Details
+	command         TEXT NOT NULL,
+	target_resource TEXT,
+	namespace       TEXT,
+	resource_kind   TEXT,
+
+	-- Risk & Security
+	risk_level      TEXT NOT NULL,
+	risk_reason     TEXT,
+
+	-- Execution Result
+	result          TEXT NOT NULL,
+	output          TEXT,
+	error_message   TEXT,
+
+	-- Metrics
+	latency_ms      INTEGER,
+	tokens_input    INTEGER,
+	tokens_output   INTEGER,
+	cost_estimate   REAL,
+
+	-- Metadata
+	kubeconfig      TEXT,
+	cluster_name    TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_session_id ON traces(session_id);
+CREATE INDEX IF NOT EXISTS idx_timestamp ON traces(timestamp DESC);
+CREATE INDEX IF NOT EXISTS idx_namespace ON traces(namespace);
+CREATE INDEX IF NOT EXISTS idx_risk_level ON traces(risk_level);
+CREATE INDEX IF NOT EXISTS idx_tool_name ON traces(tool_name);
+
+CREATE TABLE IF NOT EXISTS metadata (
+	key   TEXT PRIMARY KEY,
+	value TEXT
+);
+
+INSERT OR IGNORE INTO metadata (key, value) VALUES ('schema_version', '1');
+INSERT OR IGNORE INTO metadata (key, value) VALUES ('created_at', datetime('now'));
+
+INSERT INTO traces (
+	id, session_id, timestamp, user_intent, tool_name,
+	command, target_resource, namespace, resource_kind,
+	risk_level, risk_reason, result, output, error_message,
+	latency_ms, tokens_input, tokens_output, cost_estimate,
+	kubeconfig, cluster_name
+) VALUES
+	('v1-trace-1', 'v1-session', 1700000000000, 'List pods', 'sniff_get',
+	 'kubectl get pods -n default', 'pod/*', 'default', 'pod',
+	 'low', 'Read-only operation', 'success', 'NAME READY STATUS', NULL,
+	 42, 10, 20, 0.001,
+	 '/home/user/.kube/config', 'kind-dev'),
+	('v1-trace-2', 'v1-session', 1700000001000, NULL, 'sniff_delete',
+	 'kubectl delete pod nginx -n production', 'nginx', 'production', 'pod',
+	 'critical', 'Delete operation', 'failure', NULL, 'forbidden',
+	 NULL, NULL, NULL, NULL,
+	 NULL, NULL);
@@ -0,0 +1,197 @@
+package trace
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultCharsPerToken is the average number of characters per token assumed
+// by CharEstimator. It is a common rule of thumb for English text and JSON.
+const DefaultCharsPerToken = 4
+
+// TokenEstimator estimates how many tokens a model uses for a text
+type TokenEstimator interface {
+	EstimateTokens(text string) int
+}
+
+// TokenEstimatorFunc adapts a function to TokenEstimator
+type TokenEstimatorFunc func(text string) int
+
+// EstimateTokens calls f(text)
+func (f TokenEstimatorFunc) EstimateTokens(text string) int {
+	return f(text)
+}
+
+// CharEstimator estimates tokens from the number of characters. It needs no
+// model-specific tokenizer, at the price of being approximate.
+type CharEstimator struct {
+	CharsPerToken float64 // 0 means DefaultCharsPerToken
+}
+
+// EstimateTokens returns the number of characters divided by CharsPerToken, rounded up
+func (e CharEstimator) EstimateTokens(text string) int {
+	chars := utf8.RuneCountInString(text)
+	if chars == 0 {
+		return 0
+	}
+	perToken := e.CharsPerToken
+	if perToken <= 0 {
+		perToken = DefaultCharsPerToken
+	}
+	return int(math.Ceil(float64(chars) / perToken))
+}
+
+// Pricing is the price of tokens per model.
+//
+// Example (~/.sniffops/pricing.yaml):
+//
+//	models:
+//	  - match: claude-code       # MCP client name (clientInfo.name), glob, case-insensitive
+//	    input: 3.00              # USD per million input tokens
+//	    output: 15.00            # USD per million output tokens
+//	  - match: "cursor*"
+//	    input: 2.50
+//	    output: 10.00
+//	default:                     # clients matching no model (omit to record tokens only)
+//	  input: 3.00
+//	  output: 15.00
+//
+// The model of a tool call is the name the MCP client sent in its initialize
+// request. The first matching entry is used.
+type Pricing struct {
+	Models  []ModelPrice `json:"models,omitempty"`
+	Default *Price       `json:"default,omitempty"`
+}
+
+// ModelPrice is the price of the models matching a glob pattern
+type ModelPrice struct {
+	Match string `json:"match"`
+	Price
+}
+
+// Price is the cost of tokens in USD per million
+type Price struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// Cost returns the cost of a number of input and output tokens
+func (p Price) Cost(tokensInput, tokensOutput int) float64 {
+	return (float64(tokensInput)*p.Input + float64(tokensOutput)*p.Output) / 1e6
+}
+
+// DefaultPricingPath returns the default pricing table location (~/.sniffops/pricing.yaml)
+func DefaultPricingPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".sniffops", "pricing.yaml"), nil
+}
+
+// LoadPricing loads a pricing table file.
+// If path is empty, the default path is used; a missing default file
+// returns nil (tokens are recorded without cost).
+func LoadPricing(path string) (*Pricing, error) {
+	if path == "" {
+		defaultPath, err := DefaultPricingPath()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(defaultPath); os.IsNotExist(err) {
+			return nil, nil
+		}
+		path = defaultPath
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pricing table %s: %w", path, err)
+	}
+
+	pricing, err := ParsePricing(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pricing table %s: %w", path, err)
+	}
+	return pricing, nil
+}
+
+// ParsePricing parses and validates a YAML or JSON pricing table
+func ParsePricing(data []byte) (*Pricing, error) {
+	pricing := &Pricing{}
+	if err := yaml.UnmarshalStrict(data, pricing); err != nil {
+		return nil, fmt.Errorf("failed to parse pricing table: %w", err)
+	}
+
+	for i, model := range pricing.Models {
+		if model.Match == "" {
+			return nil, fmt.Errorf("model %d: match is required", i+1)
+		}
+		if _, err := path.Match(model.Match, ""); errors.Is(err, path.ErrBadPattern) {
+			return nil, fmt.Errorf("model %d: invalid pattern %q", i+1, model.Match)
+		}
+		if model.Input < 0 || model.Output < 0 {
+			return nil, fmt.Errorf("model %s: prices must not be negative", model.Match)
+		}
+	}
+	if pricing.Default != nil && (pricing.Default.Input < 0 || pricing.Default.Output < 0) {
+		return nil, fmt.Errorf("default: prices must not be negative")
+	}
+
+	return pricing, nil
+}
+
+// Price returns the price of a model, or false if the table has no price for it
+func (p *Pricing) Price(model string) (Price, bool) {
+	if p == nil {
+		return Price{}, false
+	}
+	name := strings.ToLower(model)
+	for _, m := range p.Models {
+		if ok, _ := path.Match(strings.ToLower(m.Match), name); ok {
+			return m.Price, true
+		}
+	}
+	if p.Default != nil {
+		return *p.Default, true
+	}
+	return Price{}, false
+}
+
+// Meter estimates the tokens and cost of tool calls
+type Meter struct {
+	estimator TokenEstimator
+	pricing   *Pricing
+}
+
+// NewMeter creates a meter. A nil estimator uses CharEstimator; a nil
+// pricing table records tokens without cost.
+func NewMeter(estimator TokenEstimator, pricing *Pricing) *Meter {
+	if estimator == nil {
+		estimator = CharEstimator{}
+	}
+	return &Meter{estimator: estimator, pricing: pricing}
+}
+
+// Measure records on a trace the tokens of the tool input (the raw call
+// arguments) and of the result payload returned to the model, and their cost
+// for the model. The result is what was sent back for the call: the tool
+// result, or the error of calls that failed or were refused. The trace's own
+// Output is sanitized and truncated for storage, so it is not used.
+func (m *Meter) Measure(t *Trace, model, input, result string) {
+	t.TokensInput = m.estimator.EstimateTokens(input)
+	t.TokensOutput = m.estimator.EstimateTokens(result)
+
+	t.CostEstimate = 0
+	if price, ok := m.pricing.Price(model); ok {
+		t.CostEstimate = price.Cost(t.TokensInput, t.TokensOutput)
+	}
+}
@@ -0,0 +1,112 @@
+package trace
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestCharEstimator(t *testing.T) {
+	tests := []struct {
+		text          string
+		charsPerToken float64
+		want          int
+	}{
+		{"", 0, 0},
+		{"abc", 0, 1},
+		{"abcdefgh", 0, 2},
+		{"abcdefghi", 0, 3},
+		{"네임스페이스", 0, 2}, // Characters, not bytes
+		{"abcdefghi", 3, 3},
+	}
+	for _, tt := range tests {
+		if got := (CharEstimator{CharsPerToken: tt.charsPerToken}).EstimateTokens(tt.text); got != tt.want {
+			t.Errorf("EstimateTokens(%q) with %v chars/token = %d, want %d", tt.text, tt.charsPerToken, got, tt.want)
+		}
+	}
+}
+
+func TestParsePricing(t *testing.T) {
+	pricing, err := ParsePricing([]byte(`
+models:
+  - match: claude-code
+    input: 3
+    output: 15
+  - match: "cursor*"
+    input: 2.5
+    output: 10
+default:
+  input: 1
+  output: 2
+`))
+	if err != nil {
+		t.Fatalf("ParsePricing() error = %v", err)
+	}
+
+	tests := []struct {
+		model string
+		want  Price
+	}{
+		{"claude-code", Price{Input: 3, Output: 15}},
+		{"Cursor-VSCode", Price{Input: 2.5, Output: 10}},
+		{"unknown-client", Price{Input: 1, Output: 2}},
+		{"", Price{Input: 1, Output: 2}},
+	}
+	for _, tt := range tests {
+		if got, ok := pricing.Price(tt.model); !ok || got != tt.want {
+			t.Errorf("Price(%q) = %+v, %v; want %+v", tt.model, got, ok, tt.want)
+		}
+	}
+
+	// Without a default, unknown models have no price
+	pricing.Default = nil
+	if _, ok := pricing.Price("unknown-client"); ok {
+		t.Error("Price() should not find an unknown model without a default")
+	}
+	var none *Pricing
+	if _, ok := none.Price("claude-code"); ok {
+		t.Error("a nil pricing table should have no prices")
+	}
+
+	invalid := map[string]string{
+		"missing match":    `models: [{input: 1, output: 1}]`,
+		"bad pattern":      `models: [{match: "[claude", input: 1, output: 1}]`,
+		"negative price":   `models: [{match: claude, input: -1, output: 1}]`,
+		"negative default": `default: {input: 1, output: -2}`,
+		"unknown field":    `models: [{match: claude, inputPrice: 1}]`,
+	}
+	for name, config := range invalid {
+		if _, err := ParsePricing([]byte(config)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestMeter(t *testing.T) {
+	pricing := &Pricing{Models: []ModelPrice{{Match: "claude-code", Price: Price{Input: 3, Output: 15}}}}
+	meter := NewMeter(nil, pricing)
+
+	tr := &Trace{}
+	meter.Measure(tr, "claude-code", `{"kind":"pod","namespace":"default"}`, strings.Repeat("x", 4000))
+	if tr.TokensInput != 9 || tr.TokensOutput != 1000 {
+		t.Errorf("tokens = %d/%d, want 9/1000", tr.TokensInput, tr.TokensOutput)
+	}
+	if want := (9*3.0 + 1000*15.0) / 1e6; math.Abs(tr.CostEstimate-want) > 1e-12 {
+		t.Errorf("CostEstimate = %v, want %v", tr.CostEstimate, want)
+	}
+
+	// Failed calls return their error to the model
+	failed := &Trace{}
+	meter.Measure(failed, "other-client", "{}", "pods \"nginx\" not found")
+	if failed.TokensOutput != 6 || failed.CostEstimate != 0 {
+		t.Errorf("failed call: tokens out = %d, cost = %v; want 6 and no cost for an unpriced model", failed.TokensOutput, failed.CostEstimate)
+	}
+
+	// Estimators are pluggable
+	words := NewMeter(TokenEstimatorFunc(func(text string) int { return len(strings.Fields(text)) }), nil)
+	tr = &Trace{}
+	words.Measure(tr, "claude-code", "a b", "one two three")
+	if tr.TokensInput != 2 || tr.TokensOutput != 3 || tr.CostEstimate != 0 {
+		t.Errorf("custom estimator: %d/%d tokens, cost %v", tr.TokensInput, tr.TokensOutput, tr.CostEstimate)
+	}
+}
@@ -0,0 +1,458 @@
+package trace
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Default Writer settings
+const (
+	DefaultWriterBufferSize    = 1000
+	DefaultWriterBatchSize     = 100
+	DefaultWriterFlushInterval = 200 * time.Millisecond
+)
+
+// journalExt is the extension of complete journal files; partial files use a .tmp suffix
+const journalExt = ".ndjson"
+
+// WriterConfig configures a Writer
+type WriterConfig struct {
+	BufferSize    int           // Traces held in memory before spilling to the journal (0 = DefaultWriterBufferSize)
+	BatchSize     int           // Traces inserted per transaction (0 = DefaultWriterBatchSize)
+	FlushInterval time.Duration // How often buffered traces are written (0 = DefaultWriterFlushInterval)
+	JournalDir    string        // Where traces are spilled when the database is unavailable (empty disables spilling)
+}
+
+// WriterCounters reports what happened to the traces passed to a Writer
+type WriterCounters struct {
+	Buffered int64 `json:"buffered"` // Waiting in memory
+	Written  int64 `json:"written"`  // Inserted into the database
+	Retried  int64 `json:"retried"`  // Failed to insert and were kept for another attempt
+	Spilled  int64 `json:"spilled"`  // Written to the on-disk journal
+	Dropped  int64 `json:"dropped"`  // Lost (buffer full and no journal, or journal write failed)
+}
+
+// Writer buffers trace inserts so that tool calls never wait for the database.
+//
+// Traces are written in batches, one transaction per batch, by a background
+// goroutine. When a batch fails (e.g., the SQLite database is locked by
+// another process), it is spilled to an NDJSON journal and replayed once the
+// database accepts writes again. Journal files left by a previous process are
+// replayed on start.
+//
+// Reads go to the underlying backend after pending traces are flushed, so
+// callers see their own writes. Close flushes the buffer but does not close
+// the underlying backend.
+type Writer struct {
+	Backend
+	cfg WriterConfig
+
+	mu      sync.Mutex
+	pending []*Trace
+	closed  bool
+
+	// flushMu serializes flushes between the background loop and readers
+	flushMu sync.Mutex
+	journal atomic.Bool // true if journal files may be waiting for replay
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+
+	written atomic.Int64
+	retried atomic.Int64
+	spilled atomic.Int64
+	dropped atomic.Int64
+}
+
+// NewWriter starts a Writer in front of backend
+func NewWriter(backend Backend, cfg WriterConfig) *Writer {
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = DefaultWriterBufferSize
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultWriterBatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = DefaultWriterFlushInterval
+	}
+
+	w := &Writer{
+		Backend: backend,
+		cfg:     cfg,
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	// Replay anything a previous process could not write
+	w.journal.Store(cfg.JournalDir != "")
+	if err := w.flush(); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	go w.run()
+	return w
+}
+
+// DefaultJournalDir returns the default journal location (~/.sniffops/journal)
+func DefaultJournalDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".sniffops", "journal"), nil
+}
+
+// Insert queues a trace for writing and returns immediately.
+// If the buffer is full, the trace goes straight to the journal.
+func (w *Writer) Insert(trace *Trace) error {
+	if trace == nil {
+		return fmt.Errorf("trace cannot be nil")
+	}
+	return w.enqueue([]*Trace{trace})
+}
+
+// InsertBatch queues several traces for writing
+func (w *Writer) InsertBatch(traces []*Trace) error {
+	for _, trace := range traces {
+		if trace == nil {
+			return fmt.Errorf("trace cannot be nil")
+		}
+	}
+	return w.enqueue(traces)
+}
+
+func (w *Writer) enqueue(traces []*Trace) error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		w.dropped.Add(int64(len(traces)))
+		return fmt.Errorf("trace writer is closed")
+	}
+
+	room := w.cfg.BufferSize - len(w.pending)
+	if room > len(traces) {
+		room = len(traces)
+	}
+	if room < 0 {
+		room = 0
+	}
+	// Copies, so the caller's traces aren't shared with the background goroutine
+	for _, trace := range traces[:room] {
+		c := *trace
+		w.pending = append(w.pending, &c)
+	}
+	full := len(w.pending) >= w.cfg.BatchSize
+	w.mu.Unlock()
+
+	if full {
+		w.signal()
+	}
+
+	if overflow := traces[room:]; len(overflow) > 0 {
+		return w.spill(overflow)
+	}
+	return nil
+}
+
+// signal wakes the background loop without blocking
+func (w *Writer) signal() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run writes buffered traces until Close is called
+func (w *Writer) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			w.flush()
+			return
+		case <-w.wake:
+		case <-ticker.C:
+		}
+
+		w.flush()
+	}
+}
+
+// Flush writes all buffered traces and replays the journal now
+func (w *Writer) Flush() error {
+	return w.flush()
+}
+
+func (w *Writer) flush() error {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
+	for {
+		w.mu.Lock()
+		n := len(w.pending)
+		if n > w.cfg.BatchSize {
+			n = w.cfg.BatchSize
+		}
+		batch := w.pending[:n:n]
+		w.pending = w.pending[n:]
+		w.mu.Unlock()
+
+		if len(batch) == 0 {
+			break
+		}
+
+		if err := w.Backend.InsertBatch(batch); err != nil {
+			w.retried.Add(int64(len(batch)))
+			log.Printf("Warning: failed to write %d traces: %v", len(batch), err)
+			if w.cfg.JournalDir == "" {
+				w.requeue(batch)
+			} else {
+				w.spill(batch)
+			}
+			return err
+		}
+		w.written.Add(int64(len(batch)))
+	}
+
+	return w.replayJournal()
+}
+
+// requeue puts a failed batch back at the front of the buffer (no journal configured)
+func (w *Writer) requeue(batch []*Trace) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	room := w.cfg.BufferSize - len(w.pending)
+	if room < 0 {
+		room = 0
+	}
+	if room < len(batch) {
+		w.dropped.Add(int64(len(batch) - room))
+		batch = batch[:room]
+	}
+	w.pending = append(append([]*Trace{}, batch...), w.pending...)
+}
+
+// spill writes traces to a new journal file.
+// The file is written under a temporary name and renamed when complete, so
+// replay never sees a partial file.
+func (w *Writer) spill(traces []*Trace) error {
+	if w.cfg.JournalDir == "" {
+		w.dropped.Add(int64(len(traces)))
+		return fmt.Errorf("trace buffer full, %d traces dropped", len(traces))
+	}
+
+	if err := w.writeJournal(traces); err != nil {
+		w.dropped.Add(int64(len(traces)))
+		log.Printf("Warning: failed to spill %d traces to journal: %v", len(traces), err)
+		return fmt.Errorf("failed to spill traces to journal: %w", err)
+	}
+
+	w.spilled.Add(int64(len(traces)))
+	w.journal.Store(true)
+	return nil
+}
+
+func (w *Writer) writeJournal(traces []*Trace) error {
+	if err := os.MkdirAll(w.cfg.JournalDir, 0700); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%020d-%d%s", time.Now().UnixNano(), os.Getpid(), journalExt)
+	path := filepath.Join(w.cfg.JournalDir, name)
+
+	f, err := os.OpenFile(path+".tmp", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(f)
+	for _, trace := range traces {
+		if err := enc.Encode(trace); err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return err
+		}
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+// replayJournal inserts journaled traces, oldest file first, and removes each
+// file once it is written. It stops at the first failure and retries later.
+func (w *Writer) replayJournal() error {
+	if !w.journal.Load() {
+		return nil
+	}
+
+	entries, err := os.ReadDir(w.cfg.JournalDir)
+	if os.IsNotExist(err) {
+		w.journal.Store(false)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read journal: %w", err)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), journalExt) {
+			files = append(files, filepath.Join(w.cfg.JournalDir, entry.Name()))
+		}
+	}
+	sort.Strings(files)
+
+	for _, path := range files {
+		traces, err := readJournalFile(path)
+		if os.IsNotExist(err) {
+			continue // Replayed by another process
+		}
+		if err != nil {
+			log.Printf("Warning: skipping unreadable trace journal %s: %v", path, err)
+			os.Rename(path, path+".corrupt")
+			continue
+		}
+
+		for start := 0; start < len(traces); start += w.cfg.BatchSize {
+			end := start + w.cfg.BatchSize
+			if end > len(traces) {
+				end = len(traces)
+			}
+			// Already-written traces are skipped, so a file can be replayed more than once
+			if err := w.Backend.InsertBatch(traces[start:end]); err != nil {
+				w.retried.Add(int64(end - start))
+				return fmt.Errorf("failed to replay trace journal: %w", err)
+			}
+			w.written.Add(int64(end - start))
+		}
+
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove replayed journal: %w", err)
+		}
+	}
+
+	w.journal.Store(false)
+	return nil
+}
+
+// readJournalFile reads the traces of one journal file
+func readJournalFile(path string) ([]*Trace, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var traces []*Trace
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		trace := &Trace{}
+		if err := json.Unmarshal(scanner.Bytes(), trace); err != nil {
+			return nil, err
+		}
+		traces = append(traces, trace)
+	}
+
+	return traces, scanner.Err()
+}
+
+// Counters returns the writer's counters
+func (w *Writer) Counters() WriterCounters {
+	w.mu.Lock()
+	buffered := len(w.pending)
+	w.mu.Unlock()
+
+	return WriterCounters{
+		Buffered: int64(buffered),
+		Written:  w.written.Load(),
+		Retried:  w.retried.Load(),
+		Spilled:  w.spilled.Load(),
+		Dropped:  w.dropped.Load(),
+	}
+}
+
+// Close stops accepting traces and writes the buffer, spilling whatever the
+// database does not accept. It does not close the underlying backend.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.mu.Unlock()
+
+	close(w.stop)
+	<-w.done
+
+	// Without a journal, a failed final flush leaves traces in the buffer
+	w.mu.Lock()
+	lost := len(w.pending)
+	w.pending = nil
+	w.mu.Unlock()
+
+	if lost > 0 {
+		w.dropped.Add(int64(lost))
+		return fmt.Errorf("%d traces could not be written", lost)
+	}
+	return nil
+}
+
+// GetByID flushes pending traces and retrieves a single trace
+func (w *Writer) GetByID(id string) (*Trace, error) {
+	w.flush()
+	return w.Backend.GetByID(id)
+}
+
+// List flushes pending traces and lists traces matching the filter
+func (w *Writer) List(filter *ListFilter) ([]*Trace, error) {
+	w.flush()
+	return w.Backend.List(filter)
+}
+
+// Each flushes pending traces and iterates over traces matching the filter
+func (w *Writer) Each(filter *ListFilter, fn func(*Trace) error) error {
+	w.flush()
+	return w.Backend.Each(filter, fn)
+}
+
+// Count flushes pending traces and counts traces matching the filter
+func (w *Writer) Count(filter *ListFilter) (int, error) {
+	w.flush()
+	return w.Backend.Count(filter)
+}
+
+// Stats flushes pending traces and returns aggregated statistics
+func (w *Writer) Stats(period string) (*Stats, error) {
+	w.flush()
+	return w.Backend.Stats(period)
+}
+
+var _ Backend = (*Writer)(nil)
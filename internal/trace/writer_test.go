@@ -0,0 +1,256 @@
+package trace
+
+import (
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyBackend fails batch inserts while fail is set, like a locked database
+type flakyBackend struct {
+	*Store
+	fail atomic.Bool
+}
+
+func (b *flakyBackend) InsertBatch(traces []*Trace) error {
+	if b.fail.Load() {
+		return errors.New("database is locked")
+	}
+	return b.Store.InsertBatch(traces)
+}
+
+// newTestWriter returns a writer that only flushes when asked to
+func newTestWriter(t *testing.T, backend Backend, journalDir string) *Writer {
+	t.Helper()
+	w := NewWriter(backend, WriterConfig{
+		BufferSize:    10,
+		BatchSize:     4,
+		FlushInterval: time.Hour,
+		JournalDir:    journalDir,
+	})
+	t.Cleanup(func() { w.Close() })
+	return w
+}
+
+// journalFiles lists the complete journal files in dir
+func journalFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "*"+journalExt))
+	if err != nil {
+		t.Fatalf("Glob() error = %v", err)
+	}
+	return files
+}
+
+func TestWriterBatchesInserts(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	w := newTestWriter(t, store, "")
+	for i := 0; i < 9; i++ {
+		if err := w.Insert(createTestTrace("session-1", "sniff_get")); err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if count, _ := store.Count(nil); count != 9 {
+		t.Errorf("Count() = %d, want 9", count)
+	}
+
+	counters := w.Counters()
+	if counters.Written != 9 || counters.Buffered != 0 || counters.Dropped != 0 {
+		t.Errorf("Counters() = %+v, want 9 written", counters)
+	}
+}
+
+func TestWriterReadsOwnWrites(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	w := newTestWriter(t, store, "")
+	tr := createTestTrace("session-1", "sniff_get")
+	if err := w.Insert(tr); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+
+	if _, err := w.GetByID(tr.ID); err != nil {
+		t.Errorf("GetByID() error = %v, want the buffered trace", err)
+	}
+	if count, _ := w.Count(&ListFilter{SessionID: "session-1"}); count != 1 {
+		t.Errorf("Count() = %d, want 1", count)
+	}
+}
+
+func TestWriterSpillsAndReplaysJournal(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	journalDir := t.TempDir()
+	backend := &flakyBackend{Store: store}
+	backend.fail.Store(true)
+
+	w := newTestWriter(t, backend, journalDir)
+	for i := 0; i < 6; i++ {
+		if err := w.Insert(createTestTrace("session-1", "sniff_get")); err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+	}
+
+	if err := w.Flush(); err == nil {
+		t.Fatal("expected Flush() to fail while the database is locked")
+	}
+	if files := journalFiles(t, journalDir); len(files) == 0 {
+		t.Fatal("expected traces to be spilled to the journal")
+	}
+	counters := w.Counters()
+	if counters.Retried == 0 || counters.Spilled == 0 || counters.Dropped != 0 {
+		t.Errorf("Counters() = %+v, want retried and spilled traces", counters)
+	}
+
+	backend.fail.Store(false)
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if count, _ := store.Count(nil); count != 6 {
+		t.Errorf("Count() = %d, want 6 after replay", count)
+	}
+	if files := journalFiles(t, journalDir); len(files) != 0 {
+		t.Errorf("expected replayed journal files to be removed, got %v", files)
+	}
+}
+
+func TestWriterReplaysJournalOnStart(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	journalDir := t.TempDir()
+	backend := &flakyBackend{Store: store}
+	backend.fail.Store(true)
+
+	// The first process can't write and spills everything on Close
+	first := NewWriter(backend, WriterConfig{FlushInterval: time.Hour, JournalDir: journalDir})
+	tr := createTestTrace("session-1", "sniff_delete")
+	tr.Output = "line 1\nline 2"
+	if err := first.Insert(tr); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+	if err := first.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if err := first.Insert(createTestTrace("session-1", "sniff_get")); err == nil {
+		t.Error("expected Insert() after Close() to fail")
+	}
+
+	second := newTestWriter(t, store, journalDir)
+	if err := second.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	got, err := store.GetByID(tr.ID)
+	if err != nil {
+		t.Fatalf("GetByID() error = %v", err)
+	}
+	if got.ChainSeq != 1 || got.Hash == "" {
+		t.Errorf("replayed trace was not linked into the hash chain: %+v", got)
+	}
+	got.ChainSeq, got.PrevHash, got.Hash = 0, "", ""
+	if *got != *tr {
+		t.Errorf("replayed trace = %+v, want %+v", got, tr)
+	}
+}
+
+func TestWriterBufferFull(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	backend := &flakyBackend{Store: store}
+	backend.fail.Store(true)
+
+	// Batches larger than the buffer: nothing is flushed until asked
+	w := NewWriter(backend, WriterConfig{BufferSize: 10, BatchSize: 100, FlushInterval: time.Hour})
+	defer w.Close()
+	var errs int
+	for i := 0; i < 12; i++ {
+		if err := w.Insert(createTestTrace("session-1", "sniff_get")); err != nil {
+			errs++
+		}
+	}
+
+	// Without a journal, traces beyond the buffer size are dropped
+	if errs != 2 {
+		t.Errorf("Insert() failed %d times, want 2", errs)
+	}
+	if counters := w.Counters(); counters.Dropped != 2 || counters.Buffered != 10 {
+		t.Errorf("Counters() = %+v, want 2 dropped and 10 buffered", counters)
+	}
+
+	// A failed flush keeps the traces buffered for the next attempt
+	w.Flush()
+	backend.fail.Store(false)
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if count, _ := store.Count(nil); count != 10 {
+		t.Errorf("Count() = %d, want 10", count)
+	}
+}
+
+func TestWriterCloseFlushes(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	w := NewWriter(store, WriterConfig{FlushInterval: time.Hour})
+	for i := 0; i < 3; i++ {
+		w.Insert(createTestTrace("session-1", "sniff_get"))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	if count, _ := store.Count(nil); count != 3 {
+		t.Errorf("Count() = %d, want 3 after Close()", count)
+	}
+}
+
+func TestSQLiteUsesWAL(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	var mode string
+	if err := store.db.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil {
+		t.Fatalf("failed to query journal mode: %v", err)
+	}
+	if mode != "wal" {
+		t.Errorf("journal_mode = %q, want wal", mode)
+	}
+
+	var timeout int
+	if err := store.db.QueryRow("PRAGMA busy_timeout").Scan(&timeout); err != nil {
+		t.Fatalf("failed to query busy timeout: %v", err)
+	}
+	if timeout != int(sqliteBusyTimeout.Milliseconds()) {
+		t.Errorf("busy_timeout = %d, want %d", timeout, sqliteBusyTimeout.Milliseconds())
+	}
+}
+
+func TestInsertBatchSkipsExisting(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	a := createTestTrace("session-1", "sniff_get")
+	b := createTestTrace("session-1", "sniff_get")
+	if err := store.Insert(a); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+	if err := store.InsertBatch([]*Trace{a, b}); err != nil {
+		t.Fatalf("InsertBatch() error = %v", err)
+	}
+	if count, _ := store.Count(nil); count != 2 {
+		t.Errorf("Count() = %d, want 2", count)
+	}
+}
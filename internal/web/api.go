@@ -2,11 +2,15 @@ package web
 
 import (
 	"encoding/json"
+	"fmt"
+	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/sniffops/sniffops/internal/loop"
 	"github.com/sniffops/sniffops/internal/trace"
 )
 
@@ -18,29 +22,7 @@ func (s *Server) handleTraces(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Parse query parameters
-	query := r.URL.Query()
-	filter := &trace.ListFilter{
-		Tool:      query.Get("tool"),
-		Namespace: query.Get("namespace"),
-		RiskLevel: query.Get("risk"),
-		Limit:     parseIntParam(query.Get("limit"), 50),
-		Offset:    parseIntParam(query.Get("offset"), 0),
-	}
-
-	// Parse time range
-	if startStr := query.Get("start"); startStr != "" {
-		if startMs, err := strconv.ParseInt(startStr, 10, 64); err == nil {
-			t := time.UnixMilli(startMs)
-			filter.StartTime = &t
-		}
-	}
-
-	if endStr := query.Get("end"); endStr != "" {
-		if endMs, err := strconv.ParseInt(endStr, 10, 64); err == nil {
-			t := time.UnixMilli(endMs)
-			filter.EndTime = &t
-		}
-	}
+	filter := parseTraceFilter(r.URL.Query(), 50)
 
 	// Get traces
 	traces, err := s.store.List(filter)
@@ -56,9 +38,15 @@ func (s *Server) handleTraces(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Snapshots are only returned by /api/traces/:id to keep the list small
+	items := make([]traceResponse, len(traces))
+	for i, t := range traces {
+		items[i] = newTraceResponse(t, false)
+	}
+
 	// Build response
 	response := map[string]interface{}{
-		"traces": traces,
+		"traces": items,
 		"total":  total,
 		"limit":  filter.Limit,
 		"offset": filter.Offset,
@@ -67,6 +55,70 @@ func (s *Server) handleTraces(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, response)
 }
 
+// handleExport handles GET /api/traces/export?format=ndjson|json|csv.
+// It accepts the same filters as /api/traces and streams every matching
+// trace, oldest first, unless limit is given.
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	query := r.URL.Query()
+	format, err := trace.ParseExportFormat(query.Get("format"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter := parseTraceFilter(query, 0)
+
+	// Large exports take longer than the server's write timeout
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("Export: failed to clear write deadline: %v", err)
+	}
+
+	filename := fmt.Sprintf("sniffops-traces-%s.%s", time.Now().Format("20060102-150405"), format)
+	w.Header().Set("Content-Type", trace.ExportContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+
+	// The status is already sent, so a failure can only cut the stream short
+	if _, err := trace.Export(w, s.store, filter, format); err != nil {
+		log.Printf("Export failed: %v", err)
+	}
+}
+
+// parseTraceFilter builds a trace filter from query parameters
+// (session, tool, namespace, risk, q, start, end in Unix ms, limit, offset)
+func parseTraceFilter(query url.Values, defaultLimit int) *trace.ListFilter {
+	filter := &trace.ListFilter{
+		SessionID: query.Get("session"),
+		Tool:      query.Get("tool"),
+		Namespace: query.Get("namespace"),
+		RiskLevel: query.Get("risk"),
+		Query:     query.Get("q"),
+		Limit:     parseIntParam(query.Get("limit"), defaultLimit),
+		Offset:    parseIntParam(query.Get("offset"), 0),
+	}
+
+	// Parse time range
+	if startStr := query.Get("start"); startStr != "" {
+		if startMs, err := strconv.ParseInt(startStr, 10, 64); err == nil {
+			t := time.UnixMilli(startMs)
+			filter.StartTime = &t
+		}
+	}
+
+	if endStr := query.Get("end"); endStr != "" {
+		if endMs, err := strconv.ParseInt(endStr, 10, 64); err == nil {
+			t := time.UnixMilli(endMs)
+			filter.EndTime = &t
+		}
+	}
+
+	return filter
+}
+
 // handleTraceByID handles GET /api/traces/:id
 func (s *Server) handleTraceByID(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -91,7 +143,44 @@ func (s *Server) handleTraceByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	respondJSON(w, http.StatusOK, trace)
+	respondJSON(w, http.StatusOK, newTraceResponse(trace, true))
+}
+
+// traceResponse is a trace with the stored input, snapshot and diff JSON
+// exposed as nested JSON instead of strings
+type traceResponse struct {
+	*trace.Trace
+	Input          json.RawMessage `json:"input,omitempty"`
+	BeforeSnapshot json.RawMessage `json:"before_snapshot,omitempty"`
+	AfterSnapshot  json.RawMessage `json:"after_snapshot,omitempty"`
+	Diff           json.RawMessage `json:"diff,omitempty"`
+}
+
+// newTraceResponse builds the API representation of a trace.
+// Snapshots are included only if withSnapshots is true.
+func newTraceResponse(t *trace.Trace, withSnapshots bool) traceResponse {
+	resp := traceResponse{
+		Trace: t,
+		Input: rawJSON(t.Input),
+		Diff:  rawJSON(t.Diff),
+	}
+	if withSnapshots {
+		resp.BeforeSnapshot = rawJSON(t.BeforeSnapshot)
+		resp.AfterSnapshot = rawJSON(t.AfterSnapshot)
+	}
+	return resp
+}
+
+// rawJSON returns s as raw JSON, or as a JSON string if it isn't valid JSON
+func rawJSON(s string) json.RawMessage {
+	if s == "" {
+		return nil
+	}
+	if json.Valid([]byte(s)) {
+		return json.RawMessage(s)
+	}
+	quoted, _ := json.Marshal(s)
+	return quoted
 }
 
 // handleStats handles GET /api/stats
@@ -105,7 +194,7 @@ func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
 	period := r.URL.Query().Get("period")
 
 	// Get statistics
-	stats, err := trace.GetStats(s.store.DB(), period)
+	stats, err := s.store.Stats(period)
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -121,7 +210,7 @@ func (s *Server) handleNamespaces(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	namespaces, err := trace.GetDistinctValues(s.store.DB(), "namespace")
+	namespaces, err := s.store.DistinctValues("namespace")
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -137,7 +226,7 @@ func (s *Server) handleTools(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tools, err := trace.GetDistinctValues(s.store.DB(), "tool_name")
+	tools, err := s.store.DistinctValues("tool_name")
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -146,6 +235,225 @@ func (s *Server) handleTools(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, tools)
 }
 
+// handleVerify handles GET /api/verify, verifying the trace hash chain.
+// Checkpoint signatures are checked with ~/.sniffops/chain.key if present.
+func (s *Server) handleVerify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var opts trace.VerifyOptions
+	if keyPath, err := trace.DefaultChainKeyPath(); err == nil {
+		if key, err := trace.LoadChainPublicKey(keyPath); err == nil {
+			opts.PublicKeys = append(opts.PublicKeys, key)
+		}
+	}
+
+	report, err := s.store.VerifyChain(opts)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, report)
+}
+
+// handleMetrics handles GET /metrics in the Prometheus text format
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	metrics, err := s.store.Metrics()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", trace.MetricsContentType)
+	if err := trace.WritePrometheus(w, metrics); err != nil {
+		log.Printf("Warning: failed to write metrics: %v", err)
+	}
+}
+
+// handleApprovals handles GET /api/approvals?status=pending
+func (s *Server) handleApprovals(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	query := r.URL.Query()
+	approvals, err := s.store.ListApprovals(query.Get("status"), parseIntParam(query.Get("limit"), 100))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if approvals == nil {
+		approvals = []*trace.Approval{}
+	}
+
+	respondJSON(w, http.StatusOK, approvals)
+}
+
+// handleApprovalByID handles GET /api/approvals/:id and
+// POST /api/approvals/:id/approve, POST /api/approvals/:id/deny
+func (s *Server) handleApprovalByID(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/approvals/")
+	id, action, _ := strings.Cut(path, "/")
+	if id == "" {
+		respondError(w, http.StatusBadRequest, "approval ID required")
+		return
+	}
+
+	if action == "" {
+		if r.Method != http.MethodGet {
+			respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		approval, err := s.store.GetApproval(id)
+		if err != nil {
+			if strings.Contains(err.Error(), "not found") {
+				respondError(w, http.StatusNotFound, err.Error())
+			} else {
+				respondError(w, http.StatusInternalServerError, err.Error())
+			}
+			return
+		}
+
+		respondJSON(w, http.StatusOK, approval)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var status string
+	switch action {
+	case "approve":
+		status = trace.ApprovalApproved
+	case "deny":
+		status = trace.ApprovalDenied
+	default:
+		respondError(w, http.StatusNotFound, "unknown action: "+action)
+		return
+	}
+
+	// Optional body: {"by": "alice", "note": "..."}
+	var body struct {
+		By   string `json:"by"`
+		Note string `json:"note"`
+	}
+	if r.Body != nil {
+		json.NewDecoder(r.Body).Decode(&body)
+	}
+	if body.By == "" {
+		body.By = "web-ui"
+	}
+
+	approval, err := s.store.DecideApproval(id, status, body.By, body.Note)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "not found"):
+			respondError(w, http.StatusNotFound, err.Error())
+		case approval != nil:
+			respondError(w, http.StatusConflict, err.Error())
+		default:
+			respondError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, approval)
+}
+
+// handleSessions handles GET /api/sessions with pagination
+func (s *Server) handleSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	query := r.URL.Query()
+	limit := parseIntParam(query.Get("limit"), 50)
+	offset := parseIntParam(query.Get("offset"), 0)
+
+	sessions, err := s.store.ListSessions(limit, offset)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	total, err := s.store.CountSessions()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response := map[string]interface{}{
+		"sessions": sessions,
+		"total":    total,
+		"limit":    limit,
+		"offset":   offset,
+	}
+
+	respondJSON(w, http.StatusOK, response)
+}
+
+// handleSessionByID handles GET /api/sessions/:id
+func (s *Server) handleSessionByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/api/sessions/")
+	if id == "" {
+		respondError(w, http.StatusBadRequest, "session ID required")
+		return
+	}
+
+	session, err := s.store.GetSession(id)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			respondError(w, http.StatusNotFound, err.Error())
+		} else {
+			respondError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	// Loops detected over the session's calls
+	var traces []*trace.Trace
+	err = s.store.Each(&trace.ListFilter{SessionID: id}, func(t *trace.Trace) error {
+		traces = append(traces, loop.Compact(t))
+		return nil
+	})
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	loops := loop.Analyze(traces, s.loops)
+	if loops == nil {
+		loops = []*loop.Detection{}
+	}
+
+	respondJSON(w, http.StatusOK, sessionResponse{SessionSummary: session, Loops: loops})
+}
+
+// sessionResponse is a session summary with the loops found in its traces
+type sessionResponse struct {
+	*trace.SessionSummary
+	Loops []*loop.Detection `json:"loops"`
+}
+
 // Helper functions
 
 func respondJSON(w http.ResponseWriter, status int, data interface{}) {
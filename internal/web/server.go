@@ -7,20 +7,26 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/sniffops/sniffops/internal/loop"
 	"github.com/sniffops/sniffops/internal/trace"
 )
 
 // Server represents the HTTP API server for SniffOps Web UI
 type Server struct {
-	addr   string
-	store  *trace.Store
-	server *http.Server
+	addr      string
+	store     *trace.Store
+	server    *http.Server
+	retention *trace.RetentionPolicy
+	loops     *loop.Config
 }
 
 // Config holds configuration for the web server
 type Config struct {
 	Port        int
-	TraceDBPath string
+	TraceDBPath string                 // SQLite path or postgres:// DSN (empty = default path)
+	KeyringPath string                 // Encryption keyring for trace output (empty = SNIFFOPS_ENCRYPTION_KEY or default path)
+	Retention   *trace.RetentionPolicy // Background pruning policy (nil disables it)
+	Loops       *loop.Config           // Loop detection thresholds for session details (nil = defaults)
 }
 
 // New creates a new web server instance
@@ -29,16 +35,23 @@ func New(cfg *Config) (*Server, error) {
 		cfg = &Config{Port: 3000}
 	}
 
-	// Initialize trace store
+	// Initialize trace store; encrypted output is shown as a marker without the key
+	keyring, err := trace.LoadKeyring(cfg.KeyringPath)
+	if err != nil {
+		return nil, err
+	}
 	store, err := trace.NewStore(cfg.TraceDBPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize trace store: %w", err)
 	}
+	store.SetKeyring(keyring)
 
 	addr := fmt.Sprintf(":%d", cfg.Port)
 	s := &Server{
-		addr:  addr,
-		store: store,
+		addr:      addr,
+		store:     store,
+		retention: cfg.Retention,
+		loops:     cfg.Loops,
 	}
 
 	// Setup routes
@@ -62,9 +75,18 @@ func (s *Server) setupRoutes(mux *http.ServeMux) {
 	// API endpoints
 	mux.HandleFunc("/api/traces", s.handleTraces)
 	mux.HandleFunc("/api/traces/", s.handleTraceByID)
+	mux.HandleFunc("/api/traces/export", s.handleExport)
 	mux.HandleFunc("/api/stats", s.handleStats)
 	mux.HandleFunc("/api/namespaces", s.handleNamespaces)
 	mux.HandleFunc("/api/tools", s.handleTools)
+	mux.HandleFunc("/api/approvals", s.handleApprovals)
+	mux.HandleFunc("/api/approvals/", s.handleApprovalByID)
+	mux.HandleFunc("/api/sessions", s.handleSessions)
+	mux.HandleFunc("/api/sessions/", s.handleSessionByID)
+	mux.HandleFunc("/api/verify", s.handleVerify)
+
+	// Prometheus scrape endpoint
+	mux.HandleFunc("/metrics", s.handleMetrics)
 
 	// Serve embedded frontend (fallback to static files)
 	mux.Handle("/", http.FileServer(http.FS(DistFS)))
@@ -72,11 +94,15 @@ func (s *Server) setupRoutes(mux *http.ServeMux) {
 
 // Run starts the HTTP server
 func (s *Server) Run(ctx context.Context) error {
+	// Prune old traces in the background according to the retention policy
+	go s.store.RunRetention(ctx, s.retention, "web")
+
 	// Start server in a goroutine
 	errChan := make(chan error, 1)
 	go func() {
 		log.Printf("Starting SniffOps Web UI on http://localhost%s", s.addr)
 		log.Printf("API endpoints available at http://localhost%s/api/*", s.addr)
+		log.Printf("Prometheus metrics available at http://localhost%s/metrics", s.addr)
 		if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			errChan <- err
 		}
@@ -1,6 +1,7 @@
 import {
   LayoutDashboard,
   ListFilter,
+  ShieldCheck,
 } from 'lucide-react'
 import { type SidebarData } from './types'
 
@@ -19,6 +20,11 @@ export const sidebarData: SidebarData = {
           url: '/traces',
           icon: ListFilter,
         },
+        {
+          title: 'Approvals',
+          url: '/approvals',
+          icon: ShieldCheck,
+        },
       ],
     },
   ],
@@ -99,6 +99,9 @@ export function TraceDetailSheet({ trace, open, onClose }: TraceDetailSheetProps
                 <Badge variant={trace.result === 'success' ? 'default' : 'destructive'}>
                   {trace.result}
                 </Badge>
+                {trace.dry_run && (
+                  <Badge variant="outline">dry run</Badge>
+                )}
               </div>
               {trace.risk_reason && (
                 <p className="mt-2 text-sm text-muted-foreground">{trace.risk_reason}</p>
@@ -140,6 +143,61 @@ export function TraceDetailSheet({ trace, open, onClose }: TraceDetailSheetProps
               </div>
             </div>
 
+            {/* Input */}
+            {trace.input !== undefined && (
+              <>
+                <Separator />
+                <div>
+                  <h3 className="text-sm font-medium mb-3">Input</h3>
+                  <div className="rounded-md bg-muted p-3 max-h-[400px] overflow-auto">
+                    <pre className="text-xs font-mono whitespace-pre-wrap break-all">
+                      {typeof trace.input === 'string' ? trace.input : JSON.stringify(trace.input, null, 2)}
+                    </pre>
+                  </div>
+                </div>
+              </>
+            )}
+
+            {/* Changes */}
+            {trace.diff && trace.diff.length > 0 && (
+              <>
+                <Separator />
+                <div>
+                  <h3 className="text-sm font-medium mb-3">Changes</h3>
+                  <div className="rounded-md border max-h-[400px] overflow-auto">
+                    <Table>
+                      <TableHeader>
+                        <TableRow>
+                          <TableHead className="w-[80px]">Change</TableHead>
+                          <TableHead className="w-[200px] min-w-[120px]">Field</TableHead>
+                          <TableHead>Before</TableHead>
+                          <TableHead>After</TableHead>
+                        </TableRow>
+                      </TableHeader>
+                      <TableBody>
+                        {trace.diff.map((change) => (
+                          <TableRow key={change.path}>
+                            <TableCell>
+                              <Badge variant={change.op === 'removed' ? 'destructive' : 'outline'}>
+                                {change.op}
+                              </Badge>
+                            </TableCell>
+                            <TableCell className="font-mono text-xs break-all">{change.path}</TableCell>
+                            <TableCell className="font-mono text-xs break-all">
+                              {change.old !== undefined ? JSON.stringify(change.old) : ''}
+                            </TableCell>
+                            <TableCell className="font-mono text-xs break-all">
+                              {change.new !== undefined ? JSON.stringify(change.new) : ''}
+                            </TableCell>
+                          </TableRow>
+                        ))}
+                      </TableBody>
+                    </Table>
+                  </div>
+                </div>
+              </>
+            )}
+
             {/* Output */}
             {formattedOutput && (
               <>
@@ -222,6 +280,14 @@ export function TraceDetailSheet({ trace, open, onClose }: TraceDetailSheetProps
                     {trace.session_id || 'N/A'}
                   </dd>
                 </div>
+                {(trace.source_host || trace.source_user) && (
+                  <div className="grid grid-cols-[120px_1fr] gap-2">
+                    <dt className="text-muted-foreground">Source</dt>
+                    <dd className="font-medium break-all">
+                      {[trace.source_user, trace.source_host].filter(Boolean).join('@')}
+                    </dd>
+                  </div>
+                )}
                 {trace.tokens_input !== undefined && (
                   <div className="grid grid-cols-[120px_1fr] gap-2">
                     <dt className="text-muted-foreground">Tokens (In/Out)</dt>
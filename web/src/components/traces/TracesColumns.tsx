@@ -12,6 +12,25 @@ const riskConfig = {
   low: { label: 'Low', variant: 'outline' as const },
 }
 
+// Highlight renders a search snippet, marking the words between <mark> and </mark>.
+// The snippet is trace content, so it is split into text nodes rather than parsed as HTML.
+function Highlight({ snippet }: { snippet: string }) {
+  return (
+    <>
+      {snippet.split('<mark>').map((part, i) => {
+        if (i === 0) return part
+        const [match, rest] = part.split('</mark>', 2)
+        return (
+          <span key={i}>
+            <mark className="rounded-sm bg-yellow-200 px-0.5 text-foreground dark:bg-yellow-800">{match}</mark>
+            {rest}
+          </span>
+        )
+      })}
+    </>
+  )
+}
+
 export const tracesColumns = (_setSelectedTrace: (trace: Trace) => void): ColumnDef<Trace>[] => [
   {
     accessorKey: 'timestamp',
@@ -82,7 +101,18 @@ export const tracesColumns = (_setSelectedTrace: (trace: Trace) => void): Column
     header: 'Resource',
     cell: ({ row }) => {
       const resource = row.getValue('target_resource') as string
-      return <div className="max-w-[180px] truncate text-sm">{resource}</div>
+      const snippet = row.original.snippet
+      if (!snippet) {
+        return <div className="max-w-[180px] truncate text-sm">{resource}</div>
+      }
+      return (
+        <div className="max-w-[320px] space-y-1">
+          <div className="truncate text-sm">{resource}</div>
+          <div className="line-clamp-2 font-mono text-xs text-muted-foreground">
+            <Highlight snippet={snippet} />
+          </div>
+        </div>
+      )
     },
   },
   {
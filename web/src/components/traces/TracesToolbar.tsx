@@ -37,7 +37,7 @@ export function TracesToolbar({ namespaces, tools, loading }: TracesToolbarProps
     setSearchParams({})
   }
 
-  const hasFilters = searchParams.has('tool') || searchParams.has('namespace') || searchParams.has('risk') || searchParams.has('search')
+  const hasFilters = searchParams.has('tool') || searchParams.has('namespace') || searchParams.has('risk') || searchParams.has('q')
 
   return (
     <div className="flex flex-col gap-4">
@@ -45,9 +45,9 @@ export function TracesToolbar({ namespaces, tools, loading }: TracesToolbarProps
         <div className="relative flex-1 max-w-sm">
           <Search className="absolute left-2.5 top-2.5 h-4 w-4 text-muted-foreground" />
           <Input
-            placeholder="Search command or resource..."
-            value={searchParams.get('search') || ''}
-            onChange={(e) => updateParam('search', e.target.value || null)}
+            placeholder="Search commands, output, errors..."
+            value={searchParams.get('q') || ''}
+            onChange={(e) => updateParam('q', e.target.value || null)}
             className="pl-8"
             disabled={loading}
           />
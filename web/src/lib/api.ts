@@ -1,4 +1,4 @@
-import type { TracesResponse, Trace, Stats, TraceFilters } from './types'
+import type { TracesResponse, Trace, Stats, TraceFilters, Session, SessionsResponse, ChainReport, Approval, ApprovalStatus } from './types'
 
 const API_BASE = '/api'
 
@@ -21,6 +21,20 @@ export async function fetchTraces(filters: TraceFilters = {}): Promise<TracesRes
   return response.json()
 }
 
+// exportTracesUrl returns the download URL for all traces matching the filters
+// (pagination is dropped so the whole result set is exported)
+export function exportTracesUrl(filters: TraceFilters, format: 'ndjson' | 'json' | 'csv'): string {
+  const params = new URLSearchParams({ format })
+  
+  Object.entries(filters).forEach(([key, value]) => {
+    if (key !== 'limit' && key !== 'offset' && value !== undefined && value !== null && value !== '') {
+      params.append(key, String(value))
+    }
+  })
+  
+  return `${API_BASE}/traces/export?${params}`
+}
+
 export async function fetchTraceById(id: string): Promise<Trace> {
   const response = await fetch(`${API_BASE}/traces/${id}`)
   
@@ -60,3 +74,60 @@ export async function fetchTools(): Promise<string[]> {
   
   return response.json()
 }
+
+export async function fetchSessions(limit = 50, offset = 0): Promise<SessionsResponse> {
+  const response = await fetch(`${API_BASE}/sessions?limit=${limit}&offset=${offset}`)
+  
+  if (!response.ok) {
+    throw new Error(`Failed to fetch sessions: ${response.statusText}`)
+  }
+  
+  return response.json()
+}
+
+export async function fetchSessionById(id: string): Promise<Session> {
+  const response = await fetch(`${API_BASE}/sessions/${id}`)
+  
+  if (!response.ok) {
+    throw new Error(`Failed to fetch session: ${response.statusText}`)
+  }
+  
+  return response.json()
+}
+
+export async function fetchVerification(): Promise<ChainReport> {
+  const response = await fetch(`${API_BASE}/verify`)
+  
+  if (!response.ok) {
+    throw new Error(`Failed to verify trace chain: ${response.statusText}`)
+  }
+  
+  return response.json()
+}
+
+export async function fetchApprovals(status: ApprovalStatus | '' = 'pending'): Promise<Approval[]> {
+  const response = await fetch(`${API_BASE}/approvals${status ? `?status=${status}` : ''}`)
+  
+  if (!response.ok) {
+    throw new Error(`Failed to fetch approvals: ${response.statusText}`)
+  }
+  
+  return response.json()
+}
+
+// decideApproval approves or denies a pending approval. The error of a request
+// that was already decided or expired (409) carries the server's message.
+export async function decideApproval(id: string, action: 'approve' | 'deny', by = '', note = ''): Promise<Approval> {
+  const response = await fetch(`${API_BASE}/approvals/${id}/${action}`, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ by, note }),
+  })
+  
+  if (!response.ok) {
+    const body = await response.json().catch(() => null)
+    throw new Error(body?.error || `Failed to ${action} approval: ${response.statusText}`)
+  }
+  
+  return response.json()
+}
@@ -2,6 +2,7 @@ import { createBrowserRouter } from 'react-router-dom'
 import { Layout } from '@/components/layout/Layout'
 import { Dashboard } from '@/pages/Dashboard'
 import { Traces } from '@/pages/Traces'
+import { Approvals } from '@/pages/Approvals'
 
 export const router = createBrowserRouter([
   {
@@ -16,6 +17,10 @@ export const router = createBrowserRouter([
         path: 'traces',
         element: <Traces />,
       },
+      {
+        path: 'approvals',
+        element: <Approvals />,
+      },
     ],
   },
 ])
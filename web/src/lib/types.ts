@@ -5,19 +5,99 @@ export interface Trace {
   session_id: string
   timestamp: number
   tool_name: string
+  input?: Record<string, unknown> | string // Sanitized tool arguments (a string if encrypted)
   command: string
   namespace: string
   resource_kind: string
   target_resource: string
   risk_level: RiskLevel
   risk_reason: string
-  result: 'success' | 'error'
+  result: 'success' | 'failure' | 'blocked' | 'denied' | 'budget_exceeded' | 'loop_blocked'
   latency_ms: number
   output?: string
   error_message?: string
   tokens_input?: number
   tokens_output?: number
   cost_estimate?: number
+  approval_status?: ApprovalStatus
+  approved_by?: string
+  approved_at?: number
+  approval_wait_ms?: number
+  dry_run?: boolean
+  diff?: FieldChange[]
+  before_snapshot?: Record<string, unknown>
+  after_snapshot?: Record<string, unknown>
+  revert_of?: string
+  chain_seq?: number
+  prev_hash?: string
+  hash?: string
+  source_host?: string
+  source_user?: string
+  loop?: string // Comma-separated loop patterns this call continued
+  snippet?: string // Best match of a full-text search, with <mark>…</mark> around matched words
+}
+
+export type ApprovalStatus = 'pending' | 'approved' | 'denied' | 'expired'
+
+export interface Approval {
+  id: string
+  trace_id: string
+  session_id: string
+  tool_name: string
+  command: string
+  namespace?: string
+  resource_kind?: string
+  target_resource?: string
+  risk_level: RiskLevel
+  risk_reason?: string
+  status: ApprovalStatus
+  requested_at: number
+  decided_at?: number
+  decided_by?: string
+  note?: string
+}
+
+export interface FieldChange {
+  path: string
+  op: 'added' | 'removed' | 'modified'
+  old?: unknown
+  new?: unknown
+}
+
+export interface Session {
+  id: string
+  client_name?: string
+  client_version?: string
+  protocol_version?: string
+  transport?: 'stdio' | 'http'
+  started_at: number
+  ended_at?: number
+  cwd?: string
+  kube_context?: string
+  trace_count: number
+  risk_breakdown: Partial<Record<RiskLevel, number>>
+  last_activity?: number
+  duration_ms: number
+  loops?: LoopDetection[] // Only in the session detail (/api/sessions/:id)
+}
+
+export type LoopPattern = 'repeated_command' | 'scale_flapping' | 'create_delete_churn' | 'error_storm'
+
+export interface LoopDetection {
+  pattern: LoopPattern
+  message: string
+  resource?: string
+  count: number
+  trace_ids: string[]
+  first_at: number
+  last_at: number
+}
+
+export interface SessionsResponse {
+  sessions: Session[]
+  total: number
+  limit: number
+  offset: number
 }
 
 export interface TracesResponse {
@@ -46,15 +126,52 @@ export interface TimelineEntry {
 export interface Stats {
   risk_distribution: RiskDistribution
   tool_usage: ToolUsage
+  namespace_usage: Record<string, number>
+  result_counts: Record<string, number>
   timeline: TimelineEntry[]
   total_operations: number
   total_cost_estimate: number
+  total_tokens_input: number
+  total_tokens_output: number
+  avg_latency_ms: number
+  cost_by_tool: Record<string, UsageTotals>
+  cost_by_namespace: Record<string, UsageTotals>
+  cost_by_session: Record<string, UsageTotals>
+}
+
+export interface UsageTotals {
+  calls: number
+  tokens_input: number
+  tokens_output: number
+  cost_estimate: number
+}
+
+export interface ChainBreak {
+  seq: number
+  trace_id?: string
+  reason: string
+}
+
+export interface ChainReport {
+  status: 'ok' | 'broken' | 'empty'
+  verified: number
+  pruned: number
+  unchained: number
+  head_seq: number
+  head_hash: string
+  broken?: ChainBreak
+  checkpoints: number
+  signed_checkpoints: number
+  unverified_checkpoints: number
+  checked_at: number
 }
 
 export interface TraceFilters {
+  session?: string
   tool?: string
   namespace?: string
   risk?: RiskLevel
+  q?: string
   limit?: number
   offset?: number
   start?: number
@@ -0,0 +1,156 @@
+import { useState, useEffect, useCallback } from 'react'
+import { Check, X, Clock } from 'lucide-react'
+import { Card, CardContent, CardDescription, CardHeader, CardTitle } from '@/components/ui/card'
+import { Badge } from '@/components/ui/badge'
+import { Button } from '@/components/ui/button'
+import { Input } from '@/components/ui/input'
+import { fetchApprovals, decideApproval } from '@/lib/api'
+import { type Approval } from '@/lib/types'
+import { format, formatDistanceToNow } from 'date-fns'
+
+// Pending approvals are polled, since calls wait on them
+const POLL_INTERVAL_MS = 3000
+
+// The approver name is remembered in the browser
+const APPROVER_KEY = 'sniffops.approver'
+
+const riskBorder = {
+  critical: 'border-l-4 border-red-500',
+  high: 'border-l-4 border-orange-500',
+  medium: 'border-l-4 border-yellow-400',
+  low: 'border-l-4 border-green-500',
+}
+
+export function Approvals() {
+  const [approvals, setApprovals] = useState<Approval[]>([])
+  const [loading, setLoading] = useState(true)
+  const [approver, setApprover] = useState(() => localStorage.getItem(APPROVER_KEY) || '')
+  const [notes, setNotes] = useState<Record<string, string>>({})
+  const [deciding, setDeciding] = useState<string | null>(null)
+  const [error, setError] = useState<string | null>(null)
+
+  const loadApprovals = useCallback(async () => {
+    try {
+      setApprovals(await fetchApprovals('pending'))
+    } catch (error) {
+      console.error('Failed to load approvals:', error)
+    } finally {
+      setLoading(false)
+    }
+  }, [])
+
+  useEffect(() => {
+    loadApprovals()
+    const timer = setInterval(loadApprovals, POLL_INTERVAL_MS)
+    return () => clearInterval(timer)
+  }, [loadApprovals])
+
+  const decide = async (approval: Approval, action: 'approve' | 'deny') => {
+    setDeciding(approval.id)
+    setError(null)
+    localStorage.setItem(APPROVER_KEY, approver)
+    try {
+      await decideApproval(approval.id, action, approver, notes[approval.id] || '')
+    } catch (err) {
+      // Already decided elsewhere, or expired while waiting
+      setError(err instanceof Error ? err.message : String(err))
+    } finally {
+      setDeciding(null)
+      loadApprovals()
+    }
+  }
+
+  return (
+    <div className="space-y-6">
+      <div className="flex items-start justify-between gap-4">
+        <div>
+          <h1 className="text-3xl font-bold tracking-tight">Approvals</h1>
+          <p className="text-muted-foreground">
+            Critical operations waiting for a human decision
+          </p>
+        </div>
+        <Input
+          className="max-w-[14rem]"
+          placeholder="Your name (default: web-ui)"
+          value={approver}
+          onChange={(e) => setApprover(e.target.value)}
+        />
+      </div>
+
+      {error && (
+        <p className="text-sm text-red-500">{error}</p>
+      )}
+
+      {loading ? (
+        <div className="flex items-center justify-center py-8">Loading...</div>
+      ) : approvals.length === 0 ? (
+        <Card>
+          <CardContent className="py-8">
+            <p className="text-sm text-center text-muted-foreground">
+              No pending approvals
+            </p>
+          </CardContent>
+        </Card>
+      ) : (
+        <div className="space-y-4">
+          {approvals.map((approval) => (
+            <Card key={approval.id} className={riskBorder[approval.risk_level]}>
+              <CardHeader>
+                <CardTitle className="flex items-center gap-2">
+                  {approval.tool_name}
+                  <Badge variant={approval.risk_level === 'critical' ? 'destructive' : 'secondary'}>
+                    {approval.risk_level}
+                  </Badge>
+                  {approval.namespace && (
+                    <Badge variant="outline">{approval.namespace}</Badge>
+                  )}
+                </CardTitle>
+                <CardDescription className="flex items-center gap-1">
+                  <Clock className="h-3 w-3" />
+                  Requested {formatDistanceToNow(new Date(approval.requested_at), { addSuffix: true })}
+                  {' '}({format(new Date(approval.requested_at), 'yyyy-MM-dd HH:mm:ss')})
+                </CardDescription>
+              </CardHeader>
+              <CardContent className="space-y-3">
+                <p className="font-mono text-sm break-all">{approval.command}</p>
+                {approval.risk_reason && (
+                  <p className="text-sm text-muted-foreground">{approval.risk_reason}</p>
+                )}
+                <p className="text-xs text-muted-foreground">
+                  {approval.resource_kind && approval.target_resource && (
+                    <>{approval.resource_kind}/{approval.target_resource} · </>
+                  )}
+                  session <span className="font-mono">{approval.session_id}</span> · approval{' '}
+                  <span className="font-mono">{approval.id}</span>
+                </p>
+                <div className="flex flex-wrap items-center gap-2">
+                  <Input
+                    className="max-w-md"
+                    placeholder="Note (optional)"
+                    value={notes[approval.id] || ''}
+                    onChange={(e) => setNotes({ ...notes, [approval.id]: e.target.value })}
+                  />
+                  <Button
+                    disabled={deciding === approval.id}
+                    onClick={() => decide(approval, 'approve')}
+                  >
+                    <Check />
+                    Approve
+                  </Button>
+                  <Button
+                    variant="destructive"
+                    disabled={deciding === approval.id}
+                    onClick={() => decide(approval, 'deny')}
+                  >
+                    <X />
+                    Deny
+                  </Button>
+                </div>
+              </CardContent>
+            </Card>
+          ))}
+        </div>
+      )}
+    </div>
+  )
+}
@@ -1,11 +1,11 @@
 import { useState, useEffect } from 'react'
 import { useNavigate } from 'react-router-dom'
-import { Activity, Wrench, ArrowRight } from 'lucide-react'
+import { Activity, Wrench, ArrowRight, ShieldCheck, ShieldAlert } from 'lucide-react'
 import { Card, CardContent, CardDescription, CardHeader, CardTitle } from '@/components/ui/card'
 import { Badge } from '@/components/ui/badge'
 import { Button } from '@/components/ui/button'
-import { fetchStats, fetchTraces } from '@/lib/api'
-import { type Stats, type Trace, type RiskLevel } from '@/lib/types'
+import { fetchStats, fetchTraces, fetchVerification } from '@/lib/api'
+import { type Stats, type Trace, type RiskLevel, type ChainReport } from '@/lib/types'
 import { format } from 'date-fns'
 
 const riskConfig = {
@@ -21,6 +21,7 @@ export function Dashboard() {
   const navigate = useNavigate()
   const [stats, setStats] = useState<Stats | null>(null)
   const [recentTraces, setRecentTraces] = useState<Trace[]>([])
+  const [chain, setChain] = useState<ChainReport | null>(null)
   const [loading, setLoading] = useState(true)
 
   useEffect(() => {
@@ -39,6 +40,11 @@ export function Dashboard() {
       }
     }
     loadData()
+
+    // Verification walks the whole chain, so it doesn't hold up the dashboard
+    fetchVerification()
+      .then(setChain)
+      .catch((error) => console.error('Failed to verify trace chain:', error))
   }, [])
 
   if (loading) {
@@ -127,6 +133,49 @@ export function Dashboard() {
         </Card>
       </div>
 
+      {/* Trace Integrity */}
+      {chain && (
+        <Card className={chain.status === 'broken' ? 'border-l-4 border-red-500' : undefined}>
+          <CardHeader>
+            <CardTitle className="flex items-center gap-2">
+              {chain.status === 'broken' ? (
+                <ShieldAlert className="h-5 w-5 text-red-500" />
+              ) : (
+                <ShieldCheck className="h-5 w-5 text-green-500" />
+              )}
+              Trace Integrity
+              <Badge variant={chain.status === 'broken' ? 'destructive' : 'secondary'}>
+                {chain.status}
+              </Badge>
+            </CardTitle>
+            <CardDescription>
+              Hash chain checked {format(new Date(chain.checked_at), 'MMM dd, HH:mm:ss')}
+            </CardDescription>
+          </CardHeader>
+          <CardContent className="space-y-2">
+            <div className="flex flex-wrap gap-x-6 gap-y-1 text-sm">
+              <span><span className="font-medium">{chain.verified}</span> verified</span>
+              <span><span className="font-medium">{chain.pruned}</span> pruned</span>
+              {chain.unchained > 0 && (
+                <span><span className="font-medium">{chain.unchained}</span> before chaining</span>
+              )}
+              <span>
+                <span className="font-medium">{chain.signed_checkpoints}</span>/{chain.checkpoints} checkpoints signed
+              </span>
+            </div>
+            {chain.broken && (
+              <p className="text-sm text-red-500">
+                Broken at #{chain.broken.seq}
+                {chain.broken.trace_id && (
+                  <> (trace <span className="font-mono">{chain.broken.trace_id}</span>)</>
+                )}
+                : {chain.broken.reason}
+              </p>
+            )}
+          </CardContent>
+        </Card>
+      )}
+
       {/* Recent Traces */}
       <Card>
         <CardHeader>
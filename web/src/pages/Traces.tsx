@@ -1,8 +1,10 @@
 import { useState, useEffect } from 'react'
 import { useSearchParams } from 'react-router-dom'
+import { Download } from 'lucide-react'
 import { TracesTable } from '@/components/traces/TracesTable'
-import { fetchTraces, fetchNamespaces, fetchTools } from '@/lib/api'
-import { type Trace } from '@/lib/types'
+import { Button } from '@/components/ui/button'
+import { fetchTraces, fetchNamespaces, fetchTools, exportTracesUrl } from '@/lib/api'
+import { type Trace, type TraceFilters } from '@/lib/types'
 
 export function Traces() {
   const [searchParams] = useSearchParams()
@@ -36,6 +38,7 @@ export function Traces() {
           tool: searchParams.get('tool') || undefined,
           namespace: searchParams.get('namespace') || undefined,
           risk: searchParams.get('risk') as any || undefined,
+          q: searchParams.get('q') || undefined,
           limit: parseInt(searchParams.get('limit') || '50'),
           offset: parseInt(searchParams.get('offset') || '0'),
         }
@@ -52,13 +55,32 @@ export function Traces() {
     loadTraces()
   }, [searchParams])
 
+  const exportFilters: TraceFilters = {
+    tool: searchParams.get('tool') || undefined,
+    namespace: searchParams.get('namespace') || undefined,
+    risk: searchParams.get('risk') as any || undefined,
+    q: searchParams.get('q') || undefined,
+  }
+
   return (
     <div className="space-y-6">
-      <div>
-        <h1 className="text-3xl font-bold tracking-tight">Traces</h1>
-        <p className="text-muted-foreground">
-          View and analyze all security traces
-        </p>
+      <div className="flex items-start justify-between gap-4">
+        <div>
+          <h1 className="text-3xl font-bold tracking-tight">Traces</h1>
+          <p className="text-muted-foreground">
+            View and analyze all security traces
+          </p>
+        </div>
+        <div className="flex gap-2">
+          {(['csv', 'ndjson'] as const).map((format) => (
+            <Button key={format} variant="outline" size="sm" asChild>
+              <a href={exportTracesUrl(exportFilters, format)} download>
+                <Download />
+                {format.toUpperCase()}
+              </a>
+            </Button>
+          ))}
+        </div>
       </div>
 
       <TracesTable